@@ -0,0 +1,324 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package main
+
+import (
+	"time"
+
+	"github.com/dell/goiscsi"
+	"github.com/spf13/cobra"
+)
+
+// maskedSecret replaces the CHAP secrets in the output
+const maskedSecret = "********"
+
+func newDiscoverCommand(flags *clientFlags) *cobra.Command {
+	var opts goiscsi.DiscoveryOptions
+	var discoveryType string
+	cmd := &cobra.Command{
+		Use:   "discover ADDRESS",
+		Short: "Discover the targets exposed by a portal, hostname or iSNS server",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := flags.newClient()
+			if err != nil {
+				return err
+			}
+			opts.Type = goiscsi.DiscoveryType(discoveryType)
+			targets, err := c.DiscoverTargetsWithOptions(args[0], opts)
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd.OutOrStdout(), targets)
+		},
+	}
+	cmd.Flags().StringVar(&discoveryType, "type", string(goiscsi.DiscoverySendTargets), "discovery type, sendtargets or isns")
+	cmd.Flags().IntVar(&opts.Port, "port", 0, "port of the discovery address, the default port of the type if 0")
+	cmd.Flags().BoolVar(&opts.Login, "login", false, "log into the discovered targets")
+	cmd.Flags().StringVar(&opts.Iface, "iface", "", "iSCSI iface to discover and log in through")
+	return cmd
+}
+
+func newLoginCommand(flags *clientFlags) *cobra.Command {
+	var iface string
+	cmd := &cobra.Command{
+		Use:   "login PORTAL TARGET",
+		Short: "Log into a target at a portal",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			c, err := flags.newClient()
+			if err != nil {
+				return err
+			}
+			return c.PerformLogin(goiscsi.ISCSITarget{Portal: args[0], Target: args[1], Iface: iface})
+		},
+	}
+	cmd.Flags().StringVar(&iface, "iface", "", "iSCSI iface to log in through, every iface of the node records if empty")
+	return cmd
+}
+
+func newLogoutCommand(flags *clientFlags) *cobra.Command {
+	var opts goiscsi.LogoutOptions
+	var sid string
+	cmd := &cobra.Command{
+		Use:   "logout {PORTAL TARGET | --sid SID}",
+		Short: "Log out of a target at a portal, or of a session",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if sid != "" {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(2)(cmd, args)
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			c, err := flags.newClient()
+			if err != nil {
+				return err
+			}
+			if sid != "" {
+				return c.LogoutSessionBySID(sid)
+			}
+			return c.PerformLogoutWithOptions(goiscsi.ISCSITarget{Portal: args[0], Target: args[1]}, opts)
+		},
+	}
+	cmd.Flags().StringVar(&sid, "sid", "", "log out of the session with this SID, even without a node record")
+	cmd.Flags().BoolVar(&opts.Force, "force", false, "log out even if it removes the last active path of a multipath device in use")
+	cmd.Flags().BoolVar(&opts.Flush, "flush", false, "flush the block devices of the target before the logout")
+	return cmd
+}
+
+func newSessionsCommand(flags *clientFlags) *cobra.Command {
+	var iface string
+	cmd := &cobra.Command{
+		Use:   "sessions",
+		Short: "List the iSCSI sessions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, err := flags.newClient()
+			if err != nil {
+				return err
+			}
+			var sessions []goiscsi.ISCSISession
+			if iface != "" {
+				sessions, err = c.GetSessionsByIface(iface)
+			} else {
+				sessions, err = c.GetSessions()
+			}
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd.OutOrStdout(), maskSessions(sessions))
+		},
+	}
+	cmd.Flags().StringVar(&iface, "iface", "", "only list the sessions established through this iSCSI iface")
+	return cmd
+}
+
+func newNodesCommand(flags *clientFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "nodes",
+		Short: "List the iSCSI node records",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, err := flags.newClient()
+			if err != nil {
+				return err
+			}
+			nodes, err := c.GetNodes()
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd.OutOrStdout(), nodes)
+		},
+	}
+}
+
+func newCHAPCommand(flags *clientFlags) *cobra.Command {
+	var username, password string
+	cmd := &cobra.Command{
+		Use:   "chap PORTAL TARGET",
+		Short: "Set the CHAP credentials of the node record of a target at a portal",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			c, err := flags.newClient()
+			if err != nil {
+				return err
+			}
+			return c.SetCHAPCredentials(goiscsi.ISCSITarget{Portal: args[0], Target: args[1]}, username, password)
+		},
+	}
+	cmd.Flags().StringVar(&username, "username", "", "CHAP user name")
+	cmd.Flags().StringVar(&password, "password", "", "CHAP secret")
+	_ = cmd.MarkFlagRequired("username")
+	_ = cmd.MarkFlagRequired("password")
+	return cmd
+}
+
+func newRescanCommand(flags *clientFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "rescan",
+		Short: "Rescan the iSCSI sessions",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			c, err := flags.newClient()
+			if err != nil {
+				return err
+			}
+			return c.PerformRescan()
+		},
+	}
+}
+
+// diagReport is the output of the diag command. The failing checks are reported in Errors
+// rather than stopping the command, to collect as much as possible.
+type diagReport struct {
+	Initiators goiscsi.InitiatorReport
+	Sessions   []goiscsi.ISCSISession
+	Ifaces     []goiscsi.IfaceSessionCount
+	Pings      []goiscsi.PingResult
+	Warnings   []goiscsi.Warning
+	Errors     []string
+}
+
+func newAuditCommand(flags *clientFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "audit",
+		Short: "Report the drift between the node records and the sessions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, err := flags.newClient()
+			if err != nil {
+				return err
+			}
+			findings, err := c.AuditConsistency()
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd.OutOrStdout(), findings)
+		},
+	}
+}
+
+func newTuningCommand(flags *clientFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "tuning",
+		Short: "Compare the iSCSI and multipath settings of the host with the Dell best practices",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, err := flags.newClient()
+			if err != nil {
+				return err
+			}
+			recs, err := c.AnalyzeHostTuning()
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd.OutOrStdout(), recs)
+		},
+	}
+}
+
+func newExportCommand(flags *clientFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "export",
+		Short: "Print the sessions and node records in the JSON shape of the open-iscsi tools",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, err := flags.newClient()
+			if err != nil {
+				return err
+			}
+			state, err := goiscsi.CaptureState(c)
+			if err != nil {
+				return err
+			}
+			return state.WriteOpenISCSIJSON(cmd.OutOrStdout())
+		},
+	}
+}
+
+func newDiagCommand(flags *clientFlags) *cobra.Command {
+	var count int
+	var timeout time.Duration
+	cmd := &cobra.Command{
+		Use:   "diag",
+		Short: "Report the initiator names, the sessions and their reachability",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, err := flags.newClient()
+			if err != nil {
+				return err
+			}
+			report := diagReport{}
+			c.AddWarningHandler(func(w goiscsi.Warning) {
+				report.Warnings = append(report.Warnings, w)
+			})
+			addError := func(err error) {
+				report.Errors = append(report.Errors, err.Error())
+			}
+			if report.Initiators, err = c.GetAllInitiators(); err != nil {
+				addError(err)
+			}
+			sessions, err := c.GetSessions()
+			if err != nil {
+				addError(err)
+			}
+			report.Sessions = maskSessions(sessions)
+			if report.Ifaces, err = c.GetIfaceSessionCounts(); err != nil {
+				addError(err)
+			}
+			for _, s := range sessions {
+				result, err := c.Ping(goiscsi.ISCSITarget{Portal: s.Portal, Target: s.Target}, count, timeout)
+				if err != nil {
+					addError(err)
+				}
+				report.Pings = append(report.Pings, result)
+			}
+			return printJSON(cmd.OutOrStdout(), report)
+		},
+	}
+	cmd.Flags().IntVar(&count, "count", 3, "number of probes of each session target")
+	cmd.Flags().DurationVar(&timeout, "timeout", 2*time.Second, "timeout of each probe")
+	return cmd
+}
+
+// maskSessions returns sessions with their CHAP secrets masked
+func maskSessions(sessions []goiscsi.ISCSISession) []goiscsi.ISCSISession {
+	masked := make([]goiscsi.ISCSISession, len(sessions))
+	for i, s := range sessions {
+		if s.Password != "" {
+			s.Password = maskedSecret
+		}
+		if s.PasswordIn != "" {
+			s.PasswordIn = maskedSecret
+		}
+		masked[i] = s
+	}
+	return masked
+}
+
+func newVersionCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the version, commit and capabilities of the goiscsi library",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return printJSON(cmd.OutOrStdout(), goiscsi.GetBuildInfo())
+		},
+	}
+}
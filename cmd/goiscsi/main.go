@@ -0,0 +1,91 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Command goiscsi runs the operations of the goiscsi library from the command line, e.g. to reproduce the
+// behavior of a driver on a node with the same code paths:
+//
+//	goiscsi discover 10.0.0.1 --login
+//	goiscsi sessions -o sessionSource=iscsiadm
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dell/goiscsi"
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// clientFlags holds the flags selecting the client the commands run with
+type clientFlags struct {
+	mock    bool
+	options map[string]string
+}
+
+// newClient returns the client selected by the flags, rejecting unknown or malformed options of the Linux client
+func (f *clientFlags) newClient() (goiscsi.ISCSIinterface, error) {
+	if f.mock {
+		return goiscsi.NewMockISCSI(f.options), nil
+	}
+	return goiscsi.NewLinuxISCSIE(f.options)
+}
+
+func newRootCommand() *cobra.Command {
+	flags := &clientFlags{}
+	root := &cobra.Command{
+		Use:          "goiscsi",
+		Short:        "Run iSCSI operations with the goiscsi library",
+		SilenceUsage: true,
+	}
+	root.PersistentFlags().BoolVar(&flags.mock, "mock", false, "use the mock client instead of iscsiadm")
+	root.PersistentFlags().StringToStringVarP(&flags.options, "option", "o", map[string]string{},
+		"client option as key=value, e.g. chrootDirectory=/host; may be repeated")
+	root.AddCommand(
+		newDiscoverCommand(flags),
+		newLoginCommand(flags),
+		newLogoutCommand(flags),
+		newSessionsCommand(flags),
+		newNodesCommand(flags),
+		newAuditCommand(flags),
+		newTuningCommand(flags),
+		newExportCommand(flags),
+		newCHAPCommand(flags),
+		newRescanCommand(flags),
+		newDiagCommand(flags),
+		newVersionCommand(),
+	)
+	return root
+}
+
+// printJSON writes v as indented JSON, the output format of all the commands
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("error writing output: %w", err)
+	}
+	return nil
+}
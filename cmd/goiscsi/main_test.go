@@ -0,0 +1,116 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dell/goiscsi"
+)
+
+func runCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	out := &bytes.Buffer{}
+	cmd := newRootCommand()
+	cmd.SetOut(out)
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestCommands(t *testing.T) {
+	out, err := runCommand(t, "--mock", "-o", "numberOfTargets=2", "discover", "10.0.0.1", "--login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var targets []goiscsi.ISCSITarget
+	if err = json.Unmarshal([]byte(out), &targets); err != nil || len(targets) != 2 {
+		t.Errorf("Unexpected discover output %s, %v", out, err)
+	}
+
+	for _, args := range [][]string{
+		{"login", "10.0.0.1", "iqn.2015-10.com.dell:target"},
+		{"logout", "10.0.0.1", "iqn.2015-10.com.dell:target", "--force"},
+		{"logout", "10.0.0.1", "iqn.2015-10.com.dell:target", "--flush"},
+		{"logout", "--sid", "3"},
+		{"chap", "10.0.0.1", "iqn.2015-10.com.dell:target", "--username", "user", "--password", "secret"},
+		{"rescan"},
+		{"nodes"},
+		{"audit"},
+		{"tuning"},
+		{"export"},
+	} {
+		if _, err = runCommand(t, append([]string{"--mock"}, args...)...); err != nil {
+			t.Errorf("Unexpected error running %v: %v", args, err)
+		}
+	}
+
+	out, err = runCommand(t, "--mock", "-o", "numberOfSession=2", "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sessions []goiscsi.ISCSISession
+	if err = json.Unmarshal([]byte(out), &sessions); err != nil {
+		t.Errorf("Unexpected sessions output %s, %v", out, err)
+	}
+	for _, s := range sessions {
+		if s.Password != "" && s.Password != maskedSecret {
+			t.Errorf("Expected the CHAP secret to be masked but got %s", s.Password)
+		}
+	}
+
+	out, err = runCommand(t, "--mock", "-o", "numberOfSession=2", "sessions", "--iface", "iface0")
+	if err != nil || strings.TrimSpace(out) != "[]" {
+		t.Errorf("Expected no session through iface0 but got %s, %v", out, err)
+	}
+
+	out, err = runCommand(t, "version")
+	var info goiscsi.BuildInfo
+	if err != nil || json.Unmarshal([]byte(out), &info) != nil || info.Version == "" || len(info.Capabilities) == 0 {
+		t.Errorf("Unexpected version output %s, %v", out, err)
+	}
+
+	out, err = runCommand(t, "--mock", "diag", "--count", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report diagReport
+	if err = json.Unmarshal([]byte(out), &report); err != nil || len(report.Initiators.IQNs) != 1 {
+		t.Errorf("Unexpected diag output %s, %v", out, err)
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	if _, err := runCommand(t, "login", "10.0.0.1"); err == nil {
+		t.Error("Expected an error for a missing argument")
+	}
+	if _, err := runCommand(t, "logout", "--sid", "3", "10.0.0.1"); err == nil {
+		t.Error("Expected an error for arguments given with --sid")
+	}
+	if _, err := runCommand(t, "-o", "unknownOption=1", "sessions"); err == nil || !strings.Contains(err.Error(), "unknownOption") {
+		t.Errorf("Expected an unknown option error but got %v", err)
+	}
+	if _, err := runCommand(t, "--mock", "chap", "10.0.0.1", "iqn.2015-10.com.dell:target"); err == nil {
+		t.Error("Expected an error for the missing CHAP flags")
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package collector exposes the iSCSI session health of a goiscsi client as Prometheus metrics.
+//
+//	c := collector.New(goiscsi.NewLinuxISCSI(map[string]string{}))
+//	prometheus.MustRegister(c)
+package collector
+
+import (
+	"sync"
+
+	"github.com/dell/goiscsi"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "iscsi"
+
+// Collector implements prometheus.Collector for the sessions of a goiscsi client
+type Collector struct {
+	client goiscsi.ISCSIinterface
+
+	sessions    *prometheus.Desc
+	targetPaths *prometheus.Desc
+
+	mu           sync.Mutex
+	loginErrors  map[string]float64
+	errorsDesc   *prometheus.Desc
+	warnings     map[goiscsi.WarningCode]float64
+	warningsDesc *prometheus.Desc
+}
+
+// New returns a Collector for the sessions of client, counting the failed logins and the warnings of client from now on.
+// The metrics are labeled with the ID of the initiator fingerprint of the host, if it can be read.
+func New(client goiscsi.ISCSIinterface) *Collector {
+	var labels prometheus.Labels
+	if f, err := client.GetInitiatorFingerprint(); err == nil {
+		labels = prometheus.Labels{"initiator": f.ID}
+	}
+	c := &Collector{
+		client: client,
+		sessions: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "sessions"),
+			"Number of iSCSI sessions by session state.", []string{"state"}, labels),
+		targetPaths: prometheus.NewDesc(prometheus.BuildFQName(namespace, "target", "paths"),
+			"Number of logged in iSCSI sessions to a target.", []string{"target"}, labels),
+		errorsDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "login", "errors_total"),
+			"Number of failed iSCSI logins to a target.", []string{"target"}, labels),
+		warningsDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "warnings_total"),
+			"Number of warnings reported by the iSCSI operations, e.g. a slow session query.", []string{"code"}, labels),
+		loginErrors: make(map[string]float64),
+		warnings:    make(map[goiscsi.WarningCode]float64),
+	}
+	client.AddLoginHook(c.observeLogin)
+	client.AddWarningHandler(c.observeWarning)
+	return c
+}
+
+func (c *Collector) observeWarning(w goiscsi.Warning) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warnings[w.Code]++
+}
+
+func (c *Collector) observeLogin(target goiscsi.ISCSITarget, err error) {
+	if err == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loginErrors[target.Target]++
+}
+
+// Describe sends the descriptors of the metrics to ch
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.sessions
+	ch <- c.targetPaths
+	ch <- c.errorsDesc
+	ch <- c.warningsDesc
+}
+
+// Collect queries the sessions of the client and sends the metrics to ch
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	for target, count := range c.loginErrors {
+		ch <- prometheus.MustNewConstMetric(c.errorsDesc, prometheus.CounterValue, count, target)
+	}
+	for code, count := range c.warnings {
+		ch <- prometheus.MustNewConstMetric(c.warningsDesc, prometheus.CounterValue, count, string(code))
+	}
+	c.mu.Unlock()
+
+	sessions, err := c.client.GetSessions()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.sessions, err)
+		return
+	}
+	states := map[goiscsi.ISCSISessionState]float64{
+		goiscsi.ISCSISessionStateLOGGEDIN: 0,
+		goiscsi.ISCSISessionStateFAILED:   0,
+		goiscsi.ISCSISessionStateFREE:     0,
+	}
+	paths := make(map[string]float64)
+	for _, s := range sessions {
+		states[s.ISCSISessionState]++
+		if _, ok := paths[s.Target]; !ok {
+			paths[s.Target] = 0
+		}
+		if s.ISCSISessionState == goiscsi.ISCSISessionStateLOGGEDIN {
+			paths[s.Target]++
+		}
+	}
+	for state, count := range states {
+		ch <- prometheus.MustNewConstMetric(c.sessions, prometheus.GaugeValue, count, string(state))
+	}
+	for target, count := range paths {
+		ch <- prometheus.MustNewConstMetric(c.targetPaths, prometheus.GaugeValue, count, target)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dell/goiscsi"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	client := goiscsi.NewMockISCSI(map[string]string{
+		goiscsi.MockNumberOfSessions: "2",
+		goiscsi.MockNumberOfTargets:  "2",
+		goiscsi.TargetFilterRegex:    "0$",
+	})
+	c := New(client)
+	_, _ = client.DiscoverTargets("1.1.1.1", false)
+
+	goiscsi.GOISCSIMock.InduceLoginError = true
+	_ = client.PerformLogin(goiscsi.ISCSITarget{Target: "iqn.2015-10.com.dell:failed"})
+	_ = client.PerformLogin(goiscsi.ISCSITarget{Target: "iqn.2015-10.com.dell:failed"})
+	goiscsi.GOISCSIMock.InduceLoginError = false
+	_ = client.PerformLogin(goiscsi.ISCSITarget{Target: "iqn.2015-10.com.dell:ok"})
+
+	expected := `
+# HELP iscsi_login_errors_total Number of failed iSCSI logins to a target.
+# TYPE iscsi_login_errors_total counter
+iscsi_login_errors_total{initiator="2861ece24d028302",target="iqn.2015-10.com.dell:failed"} 2
+# HELP iscsi_sessions Number of iSCSI sessions by session state.
+# TYPE iscsi_sessions gauge
+iscsi_sessions{initiator="2861ece24d028302",state="FAILED"} 0
+iscsi_sessions{initiator="2861ece24d028302",state="FREE"} 0
+iscsi_sessions{initiator="2861ece24d028302",state="LOGGED_IN"} 2
+# HELP iscsi_target_paths Number of logged in iSCSI sessions to a target.
+# TYPE iscsi_target_paths gauge
+iscsi_target_paths{initiator="2861ece24d028302",target="iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a0"} 1
+iscsi_target_paths{initiator="2861ece24d028302",target="iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a1"} 1
+# HELP iscsi_warnings_total Number of warnings reported by the iSCSI operations, e.g. a slow session query.
+# TYPE iscsi_warnings_total counter
+iscsi_warnings_total{code="TargetsFiltered",initiator="2861ece24d028302"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCollectorSessionsError(t *testing.T) {
+	client := goiscsi.NewMockISCSI(map[string]string{})
+	c := New(client)
+	goiscsi.GOISCSIMock.InduceGetSessionsError = true
+	defer func() { goiscsi.GOISCSIMock.InduceGetSessionsError = false }()
+	if err := testutil.CollectAndCompare(c, strings.NewReader("")); err == nil {
+		t.Error("Expected an error collecting the sessions")
+	}
+}
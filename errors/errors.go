@@ -0,0 +1,109 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package errors defines the categories of the errors returned by goiscsi.
+//
+// Every error returned by the goiscsi clients carries a category which can be tested with the
+// standard errors package, without changing the message of the underlying error:
+//
+//	if errors.Is(err, goiscsierrors.NotFound) {
+//		return status.Error(codes.NotFound, err.Error())
+//	}
+package errors
+
+import (
+	"errors"
+)
+
+// Category classifies an error. A Category is itself an error so it can be the target of errors.Is.
+type Category string
+
+// Error categories
+const (
+	// Validation errors are caused by invalid arguments or options
+	Validation Category = "validation"
+	// NotFound errors are caused by missing sessions, records, devices, files or utilities
+	NotFound Category = "not found"
+	// Auth errors are caused by failed authentication or authorization
+	Auth Category = "auth"
+	// Transport errors are caused by connection or login failures
+	Transport Category = "transport"
+	// Timeout errors are caused by operations that did not complete in time
+	Timeout Category = "timeout"
+	// Conflict errors are caused by the current state preventing an operation
+	Conflict Category = "conflict"
+	// Internal errors are all the other failures
+	Internal Category = "internal"
+)
+
+func (c Category) Error() string {
+	return string(c)
+}
+
+// Error is an error with a category
+type Error struct {
+	Category Category
+	Err      error
+}
+
+// Error returns the message of the underlying error
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the category of the error
+func (e *Error) Is(target error) bool {
+	c, ok := target.(Category)
+	return ok && c == e.Category
+}
+
+// New returns an error with the given category and message
+func New(c Category, msg string) error {
+	return &Error{Category: c, Err: errors.New(msg)}
+}
+
+// Wrap returns err with the given category. It returns nil if err is nil
+// and err itself if it already has a category.
+func Wrap(c Category, err error) error {
+	if err == nil || CategoryOf(err) != "" {
+		return err
+	}
+	return &Error{Category: c, Err: err}
+}
+
+// categories lists all the categories, for CategoryOf
+var categories = []Category{Validation, NotFound, Auth, Transport, Timeout, Conflict, Internal}
+
+// CategoryOf returns the category of err, or "" if it has none
+func CategoryOf(err error) Category {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Category
+	}
+	for _, c := range categories {
+		if errors.Is(err, c) {
+			return c
+		}
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCategories(t *testing.T) {
+	base := errors.New("iscsiadm failed")
+	err := fmt.Errorf("login: %w", Wrap(Auth, base))
+	if !errors.Is(err, Auth) {
+		t.Error("Expected an Auth error")
+	}
+	if errors.Is(err, Transport) {
+		t.Error("Did not expect a Transport error")
+	}
+	if !errors.Is(err, base) {
+		t.Error("Expected the underlying error to be wrapped")
+	}
+	if err.Error() != "login: iscsiadm failed" {
+		t.Errorf("Unexpected message %q", err.Error())
+	}
+	var e *Error
+	if !errors.As(err, &e) || e.Category != Auth {
+		t.Errorf("Expected an *Error with category %s", Auth)
+	}
+	if CategoryOf(err) != Auth || CategoryOf(base) != "" {
+		t.Error("Unexpected category")
+	}
+	if Wrap(Timeout, err) != err {
+		t.Error("Expected the category of an error to be kept")
+	}
+	if Wrap(Timeout, nil) != nil {
+		t.Error("Expected nil")
+	}
+	if err = New(NotFound, "no session"); !errors.Is(err, NotFound) || err.Error() != "no session" {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
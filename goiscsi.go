@@ -19,7 +19,17 @@
 package goiscsi
 
 import (
-	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
 )
 
 // ISCSIinterface is the interface that provides the iSCSI client functionality
@@ -28,16 +38,60 @@ type ISCSIinterface interface {
 	// returns an array of ISCSITarget instances
 	DiscoverTargets(address string, login bool) ([]ISCSITarget, error)
 
+	// Discover the targets exposed via a given portal, hostname or iSNS server
+	// the port is explicit: taken from opts, the address, or the default of the discovery type, in that order
+	DiscoverTargetsWithOptions(address string, opts DiscoveryOptions) ([]ISCSITarget, error)
+
+	// DiscoverTargetsFromAddresses runs a discovery with opts through each address, e.g. the redundant
+	// discovery addresses of an array, which may also be given as a comma separated list.
+	// It fails only if the discovery failed through every address.
+	DiscoverTargetsFromAddresses(addresses []string, opts DiscoveryOptions) (DiscoveryResults, error)
+
+	// DiscoverEndpointTargets runs a discovery with opts through the first address of a discovery endpoint,
+	// failing over to its next addresses on transport errors and timeouts until the discovery succeeds through one
+	DiscoverEndpointTargets(endpoint DiscoveryEndpoint, opts DiscoveryOptions) ([]ISCSITarget, error)
+
 	// Get a list of iSCSI initiators defined in a specified file
 	// To use the system default file of "/etc/iscsi/initiatorname.iscsi", provide a filename of ""
 	GetInitiators(filename string) ([]string, error)
 
+	// Get the iSCSI initiators defined in the default and the alternate initiator name files,
+	// reporting a conflict when they define different names
+	GetAllInitiators() (InitiatorReport, error)
+
+	// SetInitiatorOverride sets the initiator name returned by GetInitiators and GetAllInitiators instead of
+	// the names of the initiator name files, e.g. injected in a container. An empty name clears the override.
+	SetInitiatorOverride(iqn string)
+
+	// GetInitiatorFingerprint returns a stable identifier of the host, from its initiator name, hostname and
+	// the MAC addresses of its iSCSI ifaces
+	GetInitiatorFingerprint() (InitiatorFingerprint, error)
+
 	// Log into a specified target
 	PerformLogin(target ISCSITarget) error
 
+	// PerformLoginWithOptions performs an iSCSI login with a timeout and retry policy overriding those of the client
+	PerformLoginWithOptions(target ISCSITarget, opts LoginOptions) error
+
 	// Log out of a specified target
 	PerformLogout(target ISCSITarget) error
 
+	// Log out of a specified target, controlling the safety checks
+	PerformLogoutWithOptions(target ISCSITarget, opts LogoutOptions) error
+
+	// Probe a target count times, waiting up to timeout for each probe, and report the round trip times
+	// along with the NOP-Out activity of the session to the target, if any
+	Ping(target ISCSITarget, count int, timeout time.Duration) (PingResult, error)
+
+	// Log out of the session with a given SID, e.g. when its node record is gone.
+	// A session to an iBFT boot target is never logged out of.
+	LogoutSessionBySID(sid string) error
+
+	// UpdateLiveSessionParam changes a node parameter of a live session through sysfs, without the logout and login
+	// the node record updates need to apply, for the parameters listed by LiveSessionParams only. The node record
+	// is unchanged, so the sessions established later use its value.
+	UpdateLiveSessionParam(sid, param, value string) error
+
 	// Rescan current iSCSI sessions
 	PerformRescan() error
 
@@ -47,32 +101,408 @@ type ISCSIinterface interface {
 	// Query information about nodes
 	GetNodes() ([]ISCSINode, error)
 
+	// Invalidate drops the sessions, node records and ifaces cached by the client with the cache TTL options,
+	// e.g. after changes made by another client
+	Invalidate()
+
+	// GetCHAPConfig returns the CHAP configuration of the node record of a target, with its secrets
+	// reported as set or unset, to tell whether credentials need to be applied without logging in
+	GetCHAPConfig(target ISCSITarget) (CHAPConfig, error)
+
 	// Set CHAP credentials for a target (creates/updates node database)
 	SetCHAPCredentials(target ISCSITarget, username, password string) error
 
+	// SetCHAPCredentialsBidirectional sets the credentials of mutual CHAP for a target, with which the
+	// initiator and the target authenticate each other (creates/updates node database)
+	SetCHAPCredentialsBidirectional(target ISCSITarget, creds CHAPCredentials) error
+
 	// CreateOrUpdateNode creates new or update existing iSCSI node in iscsid database
 	CreateOrUpdateNode(target ISCSITarget, options map[string]string) error
 
 	// DeleteNode delete iSCSI node from iscsid database
 	DeleteNode(target ISCSITarget) error
 
+	// AddPathToTarget creates a node record for a new portal of a target through the given iface
+	// copying the settings, including CHAP, of an existing record of the target, and logs in
+	// use an iface of "" for the default iface
+	AddPathToTarget(iqn string, newPortal string, iface string) error
+
+	// GetIfaceSessionCounts returns the number of sessions using each iSCSI iface
+	GetIfaceSessionCounts() ([]IfaceSessionCount, error)
+
+	// GetSessionsFiltered returns the sessions matching a filter on their target, portal, iface, SID and state,
+	// reading only the matching sessions when possible
+	GetSessionsFiltered(filter SessionFilter) ([]ISCSISession, error)
+
+	// GetSessionsByTarget returns the sessions to a target
+	GetSessionsByTarget(iqn string) ([]ISCSISession, error)
+
+	// GetSessionsByPortal returns the sessions to a portal
+	GetSessionsByPortal(portal string) ([]ISCSISession, error)
+
+	// ListDiscoverySessions returns the SendTargets discovery sessions kept open, which count against
+	// the session limits of the arrays
+	ListDiscoverySessions() ([]ISCSISession, error)
+
+	// LogoutDiscoverySession logs out of the discovery sessions to a portal
+	LogoutDiscoverySession(portal string) error
+
+	// GetSessionsByIface returns the sessions established through an iSCSI iface,
+	// e.g. to know which sessions to move or log out of before draining a NIC
+	GetSessionsByIface(iface string) ([]ISCSISession, error)
+
+	// GetSIDToHostMap returns the SCSI host number of each session by SID, e.g. to scan a host or delete
+	// the devices of a session without guessing its host
+	GetSIDToHostMap() (map[string]int, error)
+
+	// DetectIBFTConfiguration returns the boot from SAN configuration of the iSCSI Boot Firmware Table,
+	// empty if the system did not boot from an iSCSI target
+	DetectIBFTConfiguration() (IBFTConfiguration, error)
+
+	// AuditConsistency compares the node records with the active sessions and reports their drift: records logged in at
+	// startup without session, sessions without record and sessions whose CHAP user or secrets differ from their record
+	AuditConsistency() ([]ConsistencyFinding, error)
+
+	// AnalyzeHostTuning compares iscsid.conf, the node records, the queue depth of the LUNs and the multipath
+	// settings with the Dell best practices and returns a recommendation, with its severity, for each deviation
+	AnalyzeHostTuning() ([]TuningRecommendation, error)
+
+	// ReconcileCHAPSessions logs out and in again the sessions whose CHAP user or secrets differ from their record, at most
+	// maxParallel at once, keeping an active path to each multipath device in use
+	ReconcileCHAPSessions(maxParallel int) (NodeOpResults, error)
+
+	// AuditTargetSource compares the targets expected by source, e.g. from the REST API of the storage array, with the
+	// node records and the sessions, and reports the expected targets without session and the sessions to these
+	// targets at portals or through ifaces the source does not list
+	AuditTargetSource(source TargetSource) ([]ConsistencyFinding, error)
+
+	// ValidateIfaces reports the iSCSI ifaces bound to a network interface, MAC address or IP address
+	// which no longer exists on the host, e.g. after a NIC rename, with a suggested fix
+	ValidateIfaces() ([]IfaceFinding, error)
+
+	// RepairIfaceBindings rebinds the iSCSI ifaces bound to a stale network interface or MAC address to the network
+	// interface holding their IP address, or only reports the repairs in dry run mode
+	RepairIfaceBindings(dryRun bool) ([]IfaceRepair, error)
+
+	// GetIfaceParameters returns the iface.* parameters of an iSCSI iface
+	GetIfaceParameters(iface string) (map[string]string, error)
+
+	// SetIfaceParameters creates or updates the iface.* parameters of an iSCSI iface
+	SetIfaceParameters(iface string, params map[string]string) error
+
+	// ListIfaces returns the iSCSI ifaces, with their transport and bindings
+	ListIfaces() ([]ISCSIIface, error)
+
+	// CreateIface creates an iSCSI iface bound to a transport, network interface, IP address or initiator name
+	CreateIface(iface ISCSIIface) error
+
+	// UpdateIface changes the transport and bindings of an existing iSCSI iface
+	UpdateIface(iface ISCSIIface) error
+
+	// DeleteIface deletes an iSCSI iface no session is established through
+	DeleteIface(name string) error
+
+	// ExportNodes returns a snapshot of the iSCSI node records, including their CHAP secrets
+	ExportNodes(opts SnapshotOptions) (*NodeSnapshot, error)
+
+	// ImportNodes creates or updates the iSCSI node records of a snapshot
+	ImportNodes(snapshot *NodeSnapshot, opts SnapshotOptions) (NodeOpResults, error)
+
+	// DeleteNodes delete many iSCSI nodes from iscsid database
+	// returns the result of each deletion, in the order of targets
+	DeleteNodes(targets []ISCSITarget) (NodeOpResults, error)
+
+	// GetHCTLsForTarget returns the SCSI addresses of the devices exposed by the sessions to a target
+	// if the target Portal is empty, the devices of the sessions through all portals are returned
+	GetHCTLsForTarget(target ISCSITarget) ([]HCTL, error)
+
+	// RescanHCTL scans a single SCSI address for a device
+	RescanHCTL(h HCTL) error
+
+	// RescanDevice rescans a block device, e.g. sdb, updating its capacity
+	RescanDevice(device string) error
+
+	// DetectResizedDevices rescans the block devices of the sessions to a target and returns those whose capacity changed
+	DetectResizedDevices(target ISCSITarget) ([]ResizedDevice, error)
+
+	// ResolveDevicePaths returns the block devices of a LUN of a target and their stable paths:
+	// /dev/disk/by-path, /dev/disk/by-id and those of the multipath device, if any
+	ResolveDevicePaths(target ISCSITarget, lun int) (DevicePaths, error)
+
+	// GetSessionDevices returns the SCSI block devices created through a session and their multipath devices
+	GetSessionDevices(sid string) ([]SessionDevice, error)
+
+	// GetTargetDevices returns the SCSI block devices created through the sessions to a target
+	// and their multipath devices
+	GetTargetDevices(target ISCSITarget) ([]SessionDevice, error)
+
+	// RescanAndVerifyLUN scans for a LUN on the sessions to a target and waits for its block device
+	// returns the device path, or an error wrapping ErrLUNNotVisible if it does not appear within timeout
+	RescanAndVerifyLUN(target ISCSITarget, lun int, timeout time.Duration) (string, error)
+
+	// WaitForSessionState waits until the session with the given SID reaches the desired state
+	// returns an error wrapping ErrSessionStateTimeout if it does not within timeout
+	WaitForSessionState(sid string, desired ISCSISessionState, timeout time.Duration) error
+
+	// ResetLoginBackoff clears the login failure history of the given targets, or of all targets if none are given
+	ResetLoginBackoff(targets ...ISCSITarget)
+
+	// AddLoginHook registers a function called with the result of every login attempt
+	AddLoginHook(hook LoginHook)
+
+	// AddWarningHandler registers a function called with the warnings of operations which succeeded
+	AddWarningHandler(handler WarningHandler)
+
+	// AddRetryHook registers a function called before each retry of a failed iscsiadm command
+	AddRetryHook(hook RetryHook)
+
+	// SetTracer sets the tracer creating spans for the discoveries, logins, rescans and LUN waits
+	SetTracer(tracer Tracer)
+
+	// SetTimeout sets the timeout of the iscsiadm discovery and login commands
+	SetTimeout(timeout time.Duration)
+
+	// GetTimeout returns the timeout of the iscsiadm discovery and login commands
+	GetTimeout() time.Duration
+
 	// generic implementations
 	isMock() bool
 	getOptions() map[string]string
 }
 
+const (
+	// TargetFilterRegex restricts discovered targets to those whose IQN matches this regular expression
+	TargetFilterRegex = "targetFilterRegex"
+	// TargetFilterPrefixes restricts discovered targets to those whose IQN starts with one of these comma separated prefixes
+	TargetFilterPrefixes = "targetFilterPrefixes"
+	// LoginBackoff enables a cool-down after failed logins to a target, starting at this duration (e.g. "5s")
+	// and doubling with each consecutive failure up to MaxLoginBackoff
+	LoginBackoff = "loginBackoff"
+
+	// ErrorOnExistingSession set to "true" makes PerformLogin return an AlreadyLoggedInError instead of
+	// nil when a session to the target at the portal already exists
+	ErrorOnExistingSession = "errorOnExistingSession"
+
+	// EnforceMaxSessions set to "true" makes PerformLogin fail with ErrMaxSessions instead of logging into
+	// a target which already has the sessions hinted by the MaxSessions of the target or its node records
+	EnforceMaxSessions = "enforceMaxSessions"
+
+	// MaxSessionsMetadataKey is the node metadata key holding the most sessions to a target the array
+	// accepts from the initiator, e.g. stored with NodeMetadataOptions from the recommendations of the array
+	MaxSessionsMetadataKey = "max-sessions"
+
+	// MaxLoginBackoff is the longest cool-down applied after consecutive failed logins
+	MaxLoginBackoff = 5 * time.Minute
+)
+
+// InitiatorNameEnv is the environment variable whose value, if set, overrides the initiator names of the
+// initiator name files, e.g. for containers which get the IQN of the host injected. SetInitiatorOverride
+// takes precedence over it.
+const InitiatorNameEnv = "GOISCSI_INITIATOR_NAME"
+
+// sessionStatePollInterval is how often the session state is checked while waiting for a state change
+var sessionStatePollInterval = time.Second
+
+// lunPollInterval is how often the block device of a LUN is looked for after a rescan
+var lunPollInterval = 500 * time.Millisecond
+
+// LoginOptions holds the settings of PerformLoginWithOptions overriding those of the client, e.g. a larger
+// budget for the targets of a cloud iSCSI gateway
+type LoginOptions struct {
+	// Timeout bounds the iscsiadm login, overriding the timeout of the client if set
+	Timeout time.Duration
+	// RetryPolicy overrides the retry policy of the client for the iscsiadm commands of the login, if set
+	RetryPolicy *RetryPolicy
+	// Chroot overrides the chroot directory of the client for the login, e.g. to log in from the node database of
+	// a nested container, if set
+	Chroot string
+}
+
+// LogoutOptions controls the behavior of PerformLogoutWithOptions
+type LogoutOptions struct {
+	// Force logs out even if it removes the last active path of a multipath device in use,
+	// a session managed in the flash of an offload adapter or a session to an iBFT boot target
+	Force bool
+	// Flush writes the cached data of the block devices of the target, and of the multipath devices built on them,
+	// and flushes their buffer cache before the logout, which is skipped if the flush fails
+	Flush bool
+	// FlushTimeout bounds the flush, DefaultFlushTimeout if not set
+	FlushTimeout time.Duration
+	// Chroot overrides the chroot directory of the client for the logout, if set
+	Chroot string
+}
+
+// LastPathError is returned when a logout would remove the last active path of a multipath device in use
+type LastPathError struct {
+	Target ISCSITarget
+	Device string
+}
+
+// Is reports the LastPathError as a goiscsierrors.Conflict
+func (e *LastPathError) Is(target error) bool {
+	return target == goiscsierrors.Conflict
+}
+
+func (e *LastPathError) Error() string {
+	return fmt.Sprintf("logout of %s at %s would remove the last active path of multipath device %s in use",
+		e.Target.Target, e.Target.Portal, e.Device)
+}
+
+// AlreadyLoggedInError is returned by PerformLogin when the ErrorOnExistingSession option is set and
+// a session to the target at the portal exists, possibly with another group tag
+type AlreadyLoggedInError struct {
+	Target ISCSITarget
+	// SID and GroupTag are the ID and group tag of the existing session
+	SID      string
+	GroupTag string
+}
+
+// Is reports the AlreadyLoggedInError as ErrAlreadyLoggedIn and a goiscsierrors.Conflict
+func (e *AlreadyLoggedInError) Is(target error) bool {
+	return target == ErrAlreadyLoggedIn || target == goiscsierrors.Conflict
+}
+
+func (e *AlreadyLoggedInError) Error() string {
+	return fmt.Sprintf("%s: session %s to %s at %s with group tag %s", ErrAlreadyLoggedIn,
+		e.SID, e.Target.Target, e.Target.Portal, e.GroupTag)
+}
+
+// InitiatorFile holds the initiator names defined in an initiator name file
+type InitiatorFile struct {
+	Path string
+	IQNs []string
+}
+
+// InitiatorReport describes the initiator names defined on the system
+type InitiatorReport struct {
+	// Files lists the initiator name files found, the default file first
+	Files []InitiatorFile
+	// IQNs lists the distinct initiator names of the files, in the order they are found
+	IQNs []string
+	// Conflict is true when more than one distinct initiator name is defined, in which case the
+	// storage arrays may see the host under a name other than the one registered for it
+	Conflict bool
+	// Override is the initiator name set with SetInitiatorOverride or InitiatorNameEnv, if any.
+	// The initiator name files are then not read.
+	Override string
+}
+
+// newInitiatorReport builds the report of the initiator names defined by files
+func newInitiatorReport(files []InitiatorFile) InitiatorReport {
+	report := InitiatorReport{Files: files, IQNs: []string{}}
+	seen := make(map[string]bool)
+	for _, f := range files {
+		for _, iqn := range f.IQNs {
+			if !seen[iqn] {
+				seen[iqn] = true
+				report.IQNs = append(report.IQNs, iqn)
+			}
+		}
+	}
+	report.Conflict = len(report.IQNs) > 1
+	return report
+}
+
+// LoginHook is called with the target and the result of a login attempt
+type LoginHook func(target ISCSITarget, err error)
+
+// RetryHook is called when an iscsiadm command of operation op failed with err on its attempt-th attempt and is
+// run again after nextDelay, according to the retry policy of the client. The op is the mode and the action of the
+// command, e.g. "node login" or "discovery".
+type RetryHook func(op string, attempt int, err error, nextDelay time.Duration)
+
+// WarningCode identifies the condition reported by a Warning
+type WarningCode string
+
+const (
+	// WarningSessionExists is reported when a login finds the session already established
+	WarningSessionExists WarningCode = "SessionExists"
+	// WarningSessionDegraded is reported when a login succeeds but the session is not logged in
+	WarningSessionDegraded WarningCode = "SessionDegraded"
+	// WarningHostSkipped is reported when a rescan could not scan the SCSI host of a session
+	WarningHostSkipped WarningCode = "HostSkipped"
+	// WarningTargetsFiltered is reported when discovered targets are dropped by the target filter options
+	WarningTargetsFiltered WarningCode = "TargetsFiltered"
+	// WarningSlowPath is reported when the session query is slow and switches to a cheaper print level
+	WarningSlowPath WarningCode = "SlowPath"
+	// WarningInitiatorConflict is reported when the initiator name files define different initiator names
+	WarningInitiatorConflict WarningCode = "InitiatorConflict"
+	// WarningMaxSessions is reported when a discovery skips the login to a target at its session limit
+	WarningMaxSessions WarningCode = "MaxSessions"
+	// WarningPortalRedirected is reported when the target redirects a login to another portal
+	WarningPortalRedirected WarningCode = "PortalRedirected"
+	// WarningDiscoveryFailover is reported when a discovery through an endpoint fails over to another of its addresses
+	WarningDiscoveryFailover WarningCode = "DiscoveryFailover"
+)
+
+// Warning is a noteworthy condition met by an operation which nevertheless succeeded
+type Warning struct {
+	Code    WarningCode
+	Target  ISCSITarget
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Code, w.Message)
+}
+
+// WarningHandler is called with each warning of the operations of a client
+type WarningHandler func(w Warning)
+
 // ISCSIType is the base structre for each platform implementation
 type ISCSIType struct {
-	mock    bool
-	options map[string]string
+	mock bool
+	// options is replaced, never modified in place, so it can be reloaded at runtime
+	optionsMu sync.RWMutex
+	options   map[string]string
+
+	backoffMu     sync.Mutex
+	loginFailures map[string]loginFailure
+
+	hooksMu         sync.RWMutex
+	loginHooks      []LoginHook
+	warningHandlers []WarningHandler
+	retryHooks      []RetryHook
+	tracer          Tracer
+	clock           Clock
+	retryPolicy     RetryPolicy
+	logger          Logger
+	executor        Executor
+	middlewares     []CommandMiddleware
+	secretRedaction SecretRedaction
+	initiatorName   string
+}
+
+// loginFailure records the consecutive failed logins to a target
+type loginFailure struct {
+	count int
+	until time.Time
 }
 
 var (
 	// ErrIscsiNotInstalled is returned when the iscsi utilities are not
 	// found on a system
-	ErrIscsiNotInstalled = errors.New("iSCSI utilities are not installed")
+	ErrIscsiNotInstalled = goiscsierrors.New(goiscsierrors.NotFound, "iSCSI utilities are not installed")
 	// ErrNotImplemented is returned when a platform does not implement
-	ErrNotImplemented = errors.New("not implemented")
+	ErrNotImplemented = goiscsierrors.New(goiscsierrors.Internal, "not implemented")
+	// ErrSessionStateTimeout is returned when a session does not reach a state in time
+	ErrSessionStateTimeout = goiscsierrors.New(goiscsierrors.Timeout, "timed out waiting for session state")
+	// ErrLUNNotVisible is returned when the block device of a LUN does not appear in time
+	ErrLUNNotVisible = goiscsierrors.New(goiscsierrors.Timeout, "LUN is not visible")
+	// ErrNodeNotFound is returned when no node record exists for a target
+	ErrNodeNotFound = goiscsierrors.New(goiscsierrors.NotFound, "node record not found")
+	// ErrAlreadyLoggedIn is matched by the AlreadyLoggedInError returned when a session to a target already exists
+	ErrAlreadyLoggedIn = goiscsierrors.New(goiscsierrors.Conflict, "already logged in")
+	// ErrLoginBackoff is returned when a login is skipped because previous logins to the target failed
+	ErrLoginBackoff = goiscsierrors.New(goiscsierrors.Conflict, "login skipped after recent failures")
+	// ErrFlashSession is returned when a logout would remove a session managed in the flash of an offload adapter
+	ErrFlashSession = goiscsierrors.New(goiscsierrors.Conflict, "session is managed in flash")
+	// ErrBootSession is returned when a logout would remove a session to a boot target of the iBFT
+	ErrBootSession = goiscsierrors.New(goiscsierrors.Conflict, "session is to an iBFT boot target")
+	// ErrMaxSessions is returned when a login would exceed the sessions the array accepts for a target
+	ErrMaxSessions = goiscsierrors.New(goiscsierrors.Conflict, "target session limit reached")
+	// ErrCHAPRequired is returned when a target rejects a login whose node record has no CHAP credentials
+	ErrCHAPRequired = goiscsierrors.New(goiscsierrors.Auth, "CHAP required but not configured")
 )
 
 func (i *ISCSIType) isMock() bool {
@@ -80,5 +510,404 @@ func (i *ISCSIType) isMock() bool {
 }
 
 func (i *ISCSIType) getOptions() map[string]string {
+	i.optionsMu.RLock()
+	defer i.optionsMu.RUnlock()
 	return i.options
 }
+
+// SetOptions replaces the options of the client with a copy of opts
+func (i *ISCSIType) SetOptions(opts map[string]string) {
+	options := make(map[string]string, len(opts))
+	for k, v := range opts {
+		options[k] = v
+	}
+	i.optionsMu.Lock()
+	defer i.optionsMu.Unlock()
+	i.options = options
+}
+
+func (i *ISCSIType) setOption(key, value string) {
+	i.updateOptions(func(options map[string]string) {
+		options[key] = value
+	})
+}
+
+// updateOptions replaces the options of the client with a copy updated by update, atomically
+func (i *ISCSIType) updateOptions(update func(options map[string]string)) {
+	i.optionsMu.Lock()
+	defer i.optionsMu.Unlock()
+	options := make(map[string]string, len(i.options)+1)
+	for k, v := range i.options {
+		options[k] = v
+	}
+	update(options)
+	i.options = options
+}
+
+// ResetLoginBackoff clears the login failure history of the given targets, or of all targets if none are given
+func (i *ISCSIType) ResetLoginBackoff(targets ...ISCSITarget) {
+	i.backoffMu.Lock()
+	defer i.backoffMu.Unlock()
+	if len(targets) == 0 {
+		i.loginFailures = nil
+		return
+	}
+	for _, t := range targets {
+		delete(i.loginFailures, loginBackoffKey(t))
+	}
+}
+
+// loginBackoffKey identifies the target of a login as lockTarget does, its portal with the default port if it has none
+func loginBackoffKey(target ISCSITarget) string {
+	return target.Target + "," + portalWithPort(target.Portal)
+}
+
+// checkLoginBackoff returns an error wrapping ErrLoginBackoff if the target is cooling down after failed logins
+func (i *ISCSIType) checkLoginBackoff(target ISCSITarget) error {
+	now := i.getClock().Now()
+	i.backoffMu.Lock()
+	defer i.backoffMu.Unlock()
+	f, ok := i.loginFailures[loginBackoffKey(target)]
+	if !ok {
+		return nil
+	}
+	if remaining := f.until.Sub(now); remaining > 0 {
+		return fmt.Errorf("%w: %d failures for %s at %s, retry in %s",
+			ErrLoginBackoff, f.count, target.Target, target.Portal, remaining.Round(time.Second))
+	}
+	return nil
+}
+
+// AddLoginHook registers a function called with the result of every login attempt
+func (i *ISCSIType) AddLoginHook(hook LoginHook) {
+	i.hooksMu.Lock()
+	defer i.hooksMu.Unlock()
+	i.loginHooks = append(i.loginHooks, hook)
+}
+
+// AddWarningHandler registers a function called with the warnings of operations which succeeded
+func (i *ISCSIType) AddWarningHandler(handler WarningHandler) {
+	i.hooksMu.Lock()
+	defer i.hooksMu.Unlock()
+	i.warningHandlers = append(i.warningHandlers, handler)
+}
+
+// AddRetryHook registers a function called before each retry of a failed iscsiadm command
+func (i *ISCSIType) AddRetryHook(hook RetryHook) {
+	i.hooksMu.Lock()
+	defer i.hooksMu.Unlock()
+	i.retryHooks = append(i.retryHooks, hook)
+}
+
+// recordRetry runs the retry hooks for a failed command about to be run again
+func (i *ISCSIType) recordRetry(op string, attempt int, err error, nextDelay time.Duration) {
+	i.hooksMu.RLock()
+	hooks := i.retryHooks
+	i.hooksMu.RUnlock()
+	for _, hook := range hooks {
+		hook(op, attempt, err, nextDelay)
+	}
+}
+
+// SetInitiatorOverride sets the initiator name taking precedence over the initiator name files, empty to clear it
+func (i *ISCSIType) SetInitiatorOverride(iqn string) {
+	i.hooksMu.Lock()
+	defer i.hooksMu.Unlock()
+	i.initiatorName = unquote(strings.TrimSpace(iqn))
+}
+
+// getInitiatorOverride returns the initiator name set with SetInitiatorOverride, else the one of the
+// InitiatorNameEnv variable, empty if neither is set
+func (i *ISCSIType) getInitiatorOverride() string {
+	i.hooksMu.RLock()
+	iqn := i.initiatorName
+	i.hooksMu.RUnlock()
+	if iqn == "" {
+		iqn = unquote(strings.TrimSpace(os.Getenv(InitiatorNameEnv)))
+	}
+	return iqn
+}
+
+// overrideInitiatorReport returns the report of an initiator name overriding the initiator name files
+func overrideInitiatorReport(iqn string) InitiatorReport {
+	return InitiatorReport{Override: iqn, Files: []InitiatorFile{}, IQNs: []string{iqn}}
+}
+
+// warn reports a warning to the registered warning handlers
+func (i *ISCSIType) warn(code WarningCode, target ISCSITarget, format string, args ...interface{}) {
+	i.hooksMu.RLock()
+	handlers := i.warningHandlers
+	i.hooksMu.RUnlock()
+	w := Warning{Code: code, Target: target, Message: fmt.Sprintf(format, args...)}
+	for _, handler := range handlers {
+		handler(w)
+	}
+}
+
+// recordLoginResult runs the login hooks and updates the login failure history of the target
+// when the LoginBackoff option is set
+func (i *ISCSIType) recordLoginResult(target ISCSITarget, err error) {
+	i.hooksMu.RLock()
+	hooks := i.loginHooks
+	i.hooksMu.RUnlock()
+	for _, hook := range hooks {
+		hook(target, err)
+	}
+
+	base, _ := time.ParseDuration(i.getOptions()[LoginBackoff])
+	if base <= 0 {
+		return
+	}
+	now := i.getClock().Now()
+	i.backoffMu.Lock()
+	defer i.backoffMu.Unlock()
+	key := loginBackoffKey(target)
+	if err == nil {
+		delete(i.loginFailures, key)
+		return
+	}
+	if i.loginFailures == nil {
+		i.loginFailures = make(map[string]loginFailure)
+	}
+	f := i.loginFailures[key]
+	f.count++
+	delay := base
+	for n := 1; n < f.count && delay < MaxLoginBackoff; n++ {
+		delay *= 2
+	}
+	if delay > MaxLoginBackoff {
+		delay = MaxLoginBackoff
+	}
+	f.until = now.Add(delay)
+	i.loginFailures[key] = f
+}
+
+// filterTargets drops the targets not matching the TargetFilterRegex and TargetFilterPrefixes options
+func (i *ISCSIType) filterTargets(targets []ISCSITarget) ([]ISCSITarget, error) {
+	opts := i.getOptions()
+	var re *regexp.Regexp
+	if exp := opts[TargetFilterRegex]; exp != "" {
+		var err error
+		re, err = regexp.Compile(exp)
+		if err != nil {
+			return []ISCSITarget{}, goiscsierrors.Wrap(goiscsierrors.Validation, fmt.Errorf("invalid %s option: %w", TargetFilterRegex, err))
+		}
+	}
+	var prefixes []string
+	for _, p := range strings.Split(opts[TargetFilterPrefixes], ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			prefixes = append(prefixes, p)
+		}
+	}
+	if re == nil && len(prefixes) == 0 {
+		return targets, nil
+	}
+
+	filtered := make([]ISCSITarget, 0, len(targets))
+	for _, t := range targets {
+		if re != nil && !re.MatchString(t.Target) {
+			continue
+		}
+		if len(prefixes) > 0 && !hasAnyPrefix(t.Target, prefixes) {
+			continue
+		}
+		filtered = append(filtered, t)
+	}
+	if dropped := len(targets) - len(filtered); dropped > 0 {
+		i.warn(WarningTargetsFiltered, ISCSITarget{}, "%d of %d discovered targets dropped by the target filter", dropped, len(targets))
+	}
+	return filtered, nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// runNodeOps runs op against each target and collects the per-target results.
+// The returned error is non-nil if any of the operations failed.
+func runNodeOps(targets []ISCSITarget, op func(ISCSITarget) error) (NodeOpResults, error) {
+	results := make(NodeOpResults, 0, len(targets))
+	for _, t := range targets {
+		results = append(results, NodeOpResult{Target: t, Error: op(t)})
+	}
+	return results, nodeOpsError(results)
+}
+
+// nodeOpsError returns an error joining those of the failed node operations of results, nil if none failed
+func nodeOpsError(results NodeOpResults) error {
+	if failed := results.FailedCount(); failed > 0 {
+		return fmt.Errorf("%d of %d node operations failed: %w", failed, len(results), results.Errors())
+	}
+	return nil
+}
+
+// runDiscoveries runs discover through each of the addresses, split at the commas, failing if it failed through all
+func runDiscoveries(addresses []string, discover func(string) ([]ISCSITarget, error)) (DiscoveryResults, error) {
+	var results DiscoveryResults
+	for _, list := range addresses {
+		for _, address := range strings.Split(list, ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				targets, err := discover(address)
+				results = append(results, DiscoveryResult{Address: address, Targets: targets, Error: err})
+			}
+		}
+	}
+	if len(results) == 0 {
+		return results, goiscsierrors.New(goiscsierrors.Validation, "error missing discovery address")
+	}
+	if failed := results.FailedCount(); failed == len(results) {
+		return results, fmt.Errorf("discovery failed through all %d addresses: %w", failed, results.Errors())
+	}
+	return results, nil
+}
+
+// countIfaceSessions returns the number of sessions using each iface, sorted by iface name.
+// Sessions without an iface name are counted under the "default" iface.
+func countIfaceSessions(sessions []ISCSISession) []IfaceSessionCount {
+	byIface := make(map[string]*IfaceSessionCount)
+	for _, s := range sessions {
+		name := s.IfaceName
+		if name == "" {
+			name = "default"
+		}
+		c, ok := byIface[name]
+		if !ok {
+			c = &IfaceSessionCount{Iface: name, Netdev: s.IfaceNetdev, IPaddress: s.IfaceIPaddress}
+			byIface[name] = c
+		}
+		c.Sessions++
+	}
+	counts := make([]IfaceSessionCount, 0, len(byIface))
+	for _, c := range byIface {
+		counts = append(counts, *c)
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Iface < counts[j].Iface })
+	return counts
+}
+
+// maxSessionsHint returns the smallest session limit stored in the metadata of the node records
+// of a target, 0 if none
+func maxSessionsHint(metadata ...map[string]string) int {
+	limit := 0
+	for _, m := range metadata {
+		if n, err := strconv.Atoi(m[MaxSessionsMetadataKey]); err == nil && n > 0 && (limit == 0 || n < limit) {
+			limit = n
+		}
+	}
+	return limit
+}
+
+// checkSessionLimit returns ErrMaxSessions if the sessions to a target leave no room for another one
+func checkSessionLimit(sessions []ISCSISession, target ISCSITarget, limit int) error {
+	count := 0
+	for _, s := range sessions {
+		if s.Target == target.Target {
+			count++
+		}
+	}
+	if count >= limit {
+		return fmt.Errorf("%w: %d sessions to %s, the array accepts %d", ErrMaxSessions, count, target.Target, limit)
+	}
+	return nil
+}
+
+// filterSessionsByIface returns the sessions using iface. Sessions without an iface name
+// use the "default" iface, as in countIfaceSessions.
+func filterSessionsByIface(sessions []ISCSISession, iface string) []ISCSISession {
+	return filterSessions(sessions, SessionFilter{Iface: iface})
+}
+
+// RecommendIfaceRebalance returns the moves of sessions from the busiest to the idlest ifaces which
+// bring the ratio between the session counts of any two ifaces down to maxRatio, or nil if the
+// counts are already balanced enough. A maxRatio below 1 is treated as 1.
+func RecommendIfaceRebalance(counts []IfaceSessionCount, maxRatio float64) []IfaceRebalanceMove {
+	if len(counts) < 2 {
+		return nil
+	}
+	maxRatio = max(maxRatio, 1)
+	load := make([]IfaceSessionCount, len(counts))
+	copy(load, counts)
+	moves := make(map[[2]string]int)
+	for {
+		busiest, idlest := 0, 0
+		for i, c := range load {
+			if c.Sessions > load[busiest].Sessions {
+				busiest = i
+			}
+			if c.Sessions < load[idlest].Sessions {
+				idlest = i
+			}
+		}
+		high, low := load[busiest].Sessions, load[idlest].Sessions
+		// stop once balanced, or when a move would only swap the busiest and idlest ifaces
+		if high-low < 2 || float64(high) <= maxRatio*float64(low) {
+			break
+		}
+		load[busiest].Sessions--
+		load[idlest].Sessions++
+		moves[[2]string{load[busiest].Iface, load[idlest].Iface}]++
+	}
+	if len(moves) == 0 {
+		return nil
+	}
+	result := make([]IfaceRebalanceMove, 0, len(moves))
+	for k, n := range moves {
+		result = append(result, IfaceRebalanceMove{From: k[0], To: k[1], Sessions: n})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].From != result[j].From {
+			return result[i].From < result[j].From
+		}
+		return result[i].To < result[j].To
+	})
+	return result
+}
+
+// waitForSessionState polls the sessions returned by getSessions until the session with
+// the given SID is in the desired state
+func waitForSessionState(clock Clock, getSessions func() ([]ISCSISession, error), sid string, desired ISCSISessionState, timeout time.Duration) error {
+	deadline := clock.Now().Add(timeout)
+	for {
+		sessions, err := getSessions()
+		if err != nil {
+			return err
+		}
+		current := "not found"
+		for _, s := range sessions {
+			if s.SID == sid {
+				if s.ISCSISessionState == desired {
+					return nil
+				}
+				current = string(s.ISCSISessionState)
+			}
+		}
+		now := clock.Now()
+		if !now.Before(deadline) {
+			return fmt.Errorf("%w: session %s is %s after %s, expected %s", ErrSessionStateTimeout, sid, current, timeout, desired)
+		}
+		clock.Sleep(min(sessionStatePollInterval, deadline.Sub(now)))
+	}
+}
+
+// clonableNodeFields returns the settings of a node record that can be copied to a record
+// for another portal of the same target. The CHAP secrets masked by iscsiadm are not copied.
+func clonableNodeFields(fields map[string]string) map[string]string {
+	clone := make(map[string]string)
+	for k, v := range fields {
+		if v == "" || (v == maskedSecret && slices.Contains(chapSecretFields, k)) {
+			continue
+		}
+		switch {
+		case k == "node.startup",
+			strings.HasPrefix(k, "node.session."),
+			strings.HasPrefix(k, "node.conn[0].") && k != "node.conn[0].address" && k != "node.conn[0].port":
+			clone[k] = v
+		}
+	}
+	return clone
+}
@@ -0,0 +1,114 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import "fmt"
+
+// FindingKind identifies the drift between the node records and the sessions reported by a ConsistencyFinding
+type FindingKind string
+
+const (
+	// FindingNodeWithoutSession is reported for a node record logged in at startup which has no session
+	FindingNodeWithoutSession FindingKind = "NodeWithoutSession"
+	// FindingSessionWithoutNode is reported for a session of iscsid whose node record was deleted
+	FindingSessionWithoutNode FindingKind = "SessionWithoutNode"
+	// FindingCHAPUserMismatch is reported for a session whose CHAP user differs from that of its node record
+	FindingCHAPUserMismatch FindingKind = "CHAPUserMismatch"
+	// FindingCHAPSecretMismatch is reported for a session with the CHAP user of its node record but other secrets,
+	// e.g. after a rotation of the secrets only
+	FindingCHAPSecretMismatch FindingKind = "CHAPSecretMismatch"
+)
+
+// ConsistencyFinding is a drift between the node records and the sessions found by AuditConsistency
+type ConsistencyFinding struct {
+	Kind FindingKind
+	// Target is the target, portal and iface of the node record or session
+	Target ISCSITarget
+	// SID is the session of the finding, empty for a node record without session
+	SID string
+	// Message describes the drift and how to resolve it
+	Message string
+}
+
+// auditConsistency compares the node records with the sessions. The sessions managed in the flash
+// of an offload adapter and the discovery sessions have no node record, so they are only checked
+// against the records they match.
+func auditConsistency(nodes []ISCSINode, sessions []ISCSISession) []ConsistencyFinding {
+	findings := []ConsistencyFinding{}
+	matched := make([]bool, len(sessions))
+	for _, n := range nodes {
+		target := ISCSITarget{Target: n.Target, Portal: n.Portal, Iface: n.Fields["iface.iscsi_ifacename"]}
+		found := false
+		for i, s := range sessions {
+			if !nodeSession(n, s) {
+				continue
+			}
+			found, matched[i] = true, true
+			if user := replaceEmpty(n.Fields["node.session.auth.username"]); user != s.Username {
+				findings = append(findings, ConsistencyFinding{
+					Kind: FindingCHAPUserMismatch, Target: target, SID: s.SID,
+					Message: fmt.Sprintf("session %s to %s at %s uses CHAP user %q but its node record has %q, "+
+						"log out and in again to apply the credentials of the record", s.SID, n.Target, n.Portal, s.Username, user),
+				})
+			} else if chapSecretsDiffer(n, s) {
+				findings = append(findings, ConsistencyFinding{
+					Kind: FindingCHAPSecretMismatch, Target: target, SID: s.SID,
+					Message: fmt.Sprintf("session %s to %s at %s uses other CHAP secrets than its node record, "+
+						"log out and in again to apply the credentials of the record", s.SID, n.Target, n.Portal),
+				})
+			}
+		}
+		if !found && n.Fields["node.startup"] == "automatic" {
+			findings = append(findings, ConsistencyFinding{
+				Kind: FindingNodeWithoutSession, Target: target,
+				Message: fmt.Sprintf("node record of %s at %s is logged in at startup but has no session, "+
+					"log in with PerformLogin or delete the record", n.Target, n.Portal),
+			})
+		}
+	}
+	for i, s := range sessions {
+		if matched[i] || s.SessionSource == ISCSISessionSourceFlash || s.IsDiscovery() {
+			continue
+		}
+		findings = append(findings, ConsistencyFinding{
+			Kind: FindingSessionWithoutNode, Target: ISCSITarget{Target: s.Target, Portal: s.Portal, Iface: s.IfaceName}, SID: s.SID,
+			Message: fmt.Sprintf("session %s to %s at %s has no node record, create it with CreateOrUpdateNode "+
+				"or log out with LogoutSessionBySID", s.SID, s.Target, s.Portal),
+		})
+	}
+	return findings
+}
+
+// nodeSession reports whether a session is to the target, portal and iface of a node record
+func nodeSession(n ISCSINode, s ISCSISession) bool {
+	return s.Target == n.Target && s.matchesPortal(n.Portal) && ifaceMatches(s.IfaceName, n.Fields["iface.iscsi_ifacename"])
+}
+
+// chapSecretsDiffer reports whether the CHAP secrets of a session differ from those of its node record, the secrets
+// masked in the record being ignored
+func chapSecretsDiffer(n ISCSINode, s ISCSISession) bool {
+	for field, secret := range map[string]string{
+		"node.session.auth.password": s.Password, "node.session.auth.password_in": s.PasswordIn,
+	} {
+		if v := replaceEmpty(n.Fields[field]); v != maskedSecret && v != secret {
+			return true
+		}
+	}
+	return false
+}
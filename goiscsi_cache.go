@@ -0,0 +1,163 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// SessionCacheTTL is how long GetSessions returns the sessions it read before reading them again, e.g. "5s",
+	// so that frequent health checks do not run iscsiadm each time. Default is no cache.
+	SessionCacheTTL = "sessionCacheTTL"
+	// NodeCacheTTL is how long GetNodes returns the node records it read before reading them again. Default is no cache.
+	NodeCacheTTL = "nodeCacheTTL"
+	// IfaceCacheTTL is how long GetIfaceParameters, ListIfaces and ValidateIfaces return the ifaces they read
+	// before reading them again. Default is no cache.
+	IfaceCacheTTL = "ifaceCacheTTL"
+)
+
+// cacheCategory is a kind of results cached by a client
+type cacheCategory string
+
+const (
+	cacheSessions cacheCategory = "sessions"
+	cacheNodes    cacheCategory = "nodes"
+	cacheIfaces   cacheCategory = "ifaces"
+)
+
+// cacheTTLOptions are the options setting the TTLs of the categories
+var cacheTTLOptions = map[cacheCategory]string{
+	cacheSessions: SessionCacheTTL,
+	cacheNodes:    NodeCacheTTL,
+	cacheIfaces:   IfaceCacheTTL,
+}
+
+// journalOpInvalidations are the categories of results changed by the operations of a client
+var journalOpInvalidations = map[string][]cacheCategory{
+	JournalOpDiscovery:          {cacheSessions, cacheNodes},
+	JournalOpLogin:              {cacheSessions},
+	JournalOpLogout:             {cacheSessions},
+	JournalOpCreateOrUpdateNode: {cacheNodes},
+	JournalOpDeleteNode:         {cacheNodes},
+	JournalOpSetCHAP:            {cacheNodes},
+	JournalOpAddPath:            {cacheSessions, cacheNodes},
+	JournalOpSetIface:           {cacheIfaces},
+	JournalOpCreateIface:        {cacheIfaces},
+	JournalOpDeleteIface:        {cacheIfaces},
+}
+
+// readCache holds the results of the reads of a client until their TTL expires or they are invalidated
+type readCache struct {
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+	// generations counts the invalidations of each category, so that a read running across an invalidation
+	// does not cache its result
+	generations map[cacheCategory]int
+}
+
+type cacheKey struct {
+	category cacheCategory
+	key      string
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// cachedRead returns the cached result of read for the key of a category if it has not expired,
+// and calls read and caches its result otherwise. The results are cloned with clone, so that the
+// callers can change them.
+func cachedRead[T any](iscsi *LinuxISCSI, category cacheCategory, key string, read func() (T, error), clone func(T) T) (T, error) {
+	ttl := iscsi.cacheTTL(category)
+	if ttl <= 0 {
+		return read()
+	}
+	c, k := &iscsi.cache, cacheKey{category: category, key: key}
+	now := iscsi.getClock().Now()
+	c.mu.Lock()
+	entry, ok := c.entries[k]
+	generation := c.generations[category]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return clone(entry.value.(T)), nil
+	}
+	value, err := read()
+	if err != nil {
+		return value, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generations[category] == generation {
+		if c.entries == nil {
+			c.entries = make(map[cacheKey]cacheEntry)
+		}
+		c.entries[k] = cacheEntry{value: clone(value), expires: now.Add(ttl)}
+	}
+	return value, nil
+}
+
+// cacheTTL returns how long the results of a category are cached, 0 if they are not
+func (iscsi *LinuxISCSI) cacheTTL(category cacheCategory) time.Duration {
+	ttl, err := time.ParseDuration(iscsi.getOptions()[cacheTTLOptions[category]])
+	if err != nil {
+		return 0
+	}
+	return ttl
+}
+
+// invalidate drops the cached results of the categories
+func (c *readCache) invalidate(categories ...cacheCategory) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generations == nil {
+		c.generations = make(map[cacheCategory]int)
+	}
+	for _, category := range categories {
+		c.generations[category]++
+		for k := range c.entries {
+			if k.category == category {
+				delete(c.entries, k)
+			}
+		}
+	}
+}
+
+// Invalidate drops the sessions, node records and ifaces cached by the client, so that the next reads
+// query them again, e.g. after changes made by another client. The operations of the client changing
+// them invalidate them on their own.
+func (iscsi *LinuxISCSI) Invalidate() {
+	iscsi.cache.invalidate(cacheSessions, cacheNodes, cacheIfaces)
+	iscsi.fingerprintMu.Lock()
+	iscsi.fingerprint = InitiatorFingerprint{}
+	iscsi.fingerprintMu.Unlock()
+}
+
+// cloneNodes returns a copy of nodes with copies of their fields
+func cloneNodes(nodes []ISCSINode) []ISCSINode {
+	clone := slices.Clone(nodes)
+	for i := range clone {
+		clone[i].Fields = maps.Clone(clone[i].Fields)
+	}
+	return clone
+}
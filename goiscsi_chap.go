@@ -0,0 +1,200 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+// CHAPConfig is the CHAP configuration of the node record of a target. The secrets are not
+// returned, only whether they are set.
+type CHAPConfig struct {
+	Target ISCSITarget
+	// AuthMethod is the node.session.auth.authmethod of the record, e.g. "CHAP" or "None"
+	AuthMethod string
+	Username   string
+	// PasswordSet tells whether the record holds a CHAP password
+	PasswordSet bool
+	// UsernameIn is the username of the target for mutual CHAP
+	UsernameIn string
+	// PasswordInSet tells whether the record holds a mutual CHAP password
+	PasswordInSet bool
+}
+
+// Enabled tells whether the record logs in with CHAP, with a username and password
+func (c CHAPConfig) Enabled() bool {
+	return strings.EqualFold(c.AuthMethod, "CHAP") && c.Username != "" && c.PasswordSet
+}
+
+// Mutual tells whether the record also authenticates the target
+func (c CHAPConfig) Mutual() bool {
+	return c.Enabled() && c.UsernameIn != "" && c.PasswordInSet
+}
+
+// chapConfig returns the CHAP configuration held by the fields of a node record of target.
+// iscsiadm prints the passwords masked, which still tells they are set.
+func chapConfig(target ISCSITarget, fields map[string]string) CHAPConfig {
+	return CHAPConfig{
+		Target:        target,
+		AuthMethod:    replaceEmpty(fields["node.session.auth.authmethod"]),
+		Username:      replaceEmpty(fields["node.session.auth.username"]),
+		PasswordSet:   replaceEmpty(fields["node.session.auth.password"]) != "",
+		UsernameIn:    replaceEmpty(fields["node.session.auth.username_in"]),
+		PasswordInSet: replaceEmpty(fields["node.session.auth.password_in"]) != "",
+	}
+}
+
+// GetCHAPConfig returns the CHAP configuration of the node record of a target, read with iscsiadm.
+// If the target has no iface, the record of the first iface is returned.
+func (iscsi *LinuxISCSI) GetCHAPConfig(target ISCSITarget) (CHAPConfig, error) {
+	if err := iscsi.validateTarget(target); err != nil {
+		return CHAPConfig{}, err
+	}
+	exe := iscsi.buildISCSICommand(withIface(
+		[]string{"iscsiadm", "-m", "node", "-T", target.Target, "-p", target.Portal, "-o", "show"}, target.Iface))
+	output, err := iscsi.runCommand(context.Background(), exe)
+	if isNoObjsExitCode(err) {
+		return CHAPConfig{}, fmt.Errorf("%w: %s at %s", ErrNodeNotFound, target.Target, target.Portal)
+	}
+	if err != nil {
+		return CHAPConfig{}, err
+	}
+	nodes := iscsi.nodeParser.Parse(output)
+	if len(nodes) == 0 {
+		return CHAPConfig{}, fmt.Errorf("%w: %s at %s", ErrNodeNotFound, target.Target, target.Portal)
+	}
+	return chapConfig(target, nodes[0].Fields), nil
+}
+
+// GetCHAPConfig returns the CHAP configuration of a mock node record
+func (iscsi *MockISCSI) GetCHAPConfig(target ISCSITarget) (CHAPConfig, error) {
+	if iscsi.GetCHAPConfigFn != nil {
+		return iscsi.GetCHAPConfigFn(target)
+	}
+	nodes, err := iscsi.getNodes()
+	if err != nil {
+		return CHAPConfig{}, err
+	}
+	for _, n := range nodes {
+		if n.Target == target.Target && n.Portal == target.Portal {
+			return chapConfig(target, n.Fields), nil
+		}
+	}
+	return CHAPConfig{}, fmt.Errorf("%w: %s at %s", ErrNodeNotFound, target.Target, target.Portal)
+}
+
+// CHAPCredentials holds the CHAP user name and secret of the initiator and, for mutual CHAP, those the target
+// authenticates with
+type CHAPCredentials struct {
+	Username string
+	Password string
+	// UsernameIn and PasswordIn are the credentials of the target, for mutual CHAP
+	UsernameIn string
+	PasswordIn string
+}
+
+// Mutual tells whether the credentials also authenticate the target
+func (c CHAPCredentials) Mutual() bool {
+	return c.UsernameIn != "" || c.PasswordIn != ""
+}
+
+// validate checks that the credentials have a user name and secret, and both or neither of those of the target
+func (c CHAPCredentials) validate() error {
+	if c.Username == "" || c.Password == "" {
+		return goiscsierrors.New(goiscsierrors.Validation, "error CHAP credentials need a username and a password")
+	}
+	if c.Mutual() && (c.UsernameIn == "" || c.PasswordIn == "") {
+		return goiscsierrors.New(goiscsierrors.Validation, "error mutual CHAP credentials need a usernameIn and a passwordIn")
+	}
+	return nil
+}
+
+// settings returns the record parameters setting the credentials, under prefix, e.g. node.session.auth
+func (c CHAPCredentials) settings(prefix string) map[string]string {
+	settings := map[string]string{
+		prefix + ".authmethod": "CHAP",
+		prefix + ".username":   c.Username,
+		prefix + ".password":   c.Password,
+	}
+	if c.Mutual() {
+		settings[prefix+".username_in"] = c.UsernameIn
+		settings[prefix+".password_in"] = c.PasswordIn
+	}
+	return settings
+}
+
+// SetCHAPCredentialsBidirectional sets the credentials of mutual CHAP in the node record of a target: the
+// initiator authenticates with Username and Password, the target with UsernameIn and PasswordIn
+func (iscsi *LinuxISCSI) SetCHAPCredentialsBidirectional(target ISCSITarget, creds CHAPCredentials) error {
+	// the target is checked first, as by the other mutations
+	err := iscsi.preflight(context.Background(), target)
+	if err == nil {
+		err = validateMutualCHAP(creds)
+	}
+	if err == nil {
+		err = iscsi.createOrUpdateNode(target, creds.settings("node.session.auth"))
+	}
+	err = iscsi.recordOperation(targetJournalEntry(JournalOpSetCHAP, target), err)
+	return err
+}
+
+// validateMutualCHAP checks the credentials of SetCHAPCredentialsBidirectional
+func validateMutualCHAP(creds CHAPCredentials) error {
+	if !creds.Mutual() {
+		return goiscsierrors.New(goiscsierrors.Validation, "error mutual CHAP credentials need a usernameIn and a passwordIn")
+	}
+	return creds.validate()
+}
+
+// validateDiscoveryCHAP checks the CHAP credentials of a discovery, which only SendTargets authenticates
+func validateDiscoveryCHAP(opts DiscoveryOptions) error {
+	if opts.CHAP == nil {
+		return nil
+	}
+	if opts.Type == DiscoveryISNS {
+		return goiscsierrors.New(goiscsierrors.Validation, "error CHAP credentials are not supported by iSNS discovery")
+	}
+	return opts.CHAP.validate()
+}
+
+// setDiscoveryCHAP creates or updates the SendTargets discovery record of a portal with CHAP credentials
+func (iscsi *LinuxISCSI) setDiscoveryCHAP(ctx context.Context, portal string, creds CHAPCredentials) error {
+	baseCmd := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "discoverydb", "-t", "st", "-p", portal})
+	_, err := iscsi.runCommand(ctx, append(slices.Clone(baseCmd), "-o", "new"))
+	if code, ok := ExitCodeFromError(err); err != nil && !(ok && isIdempotentExitCode(opCreateNode, int(code))) {
+		return err
+	}
+	return iscsi.updateNode(ctx, baseCmd, creds.settings("discovery.sendtargets.auth"))
+}
+
+// SetCHAPCredentialsBidirectional sets the mutual CHAP credentials of a mock node record
+func (iscsi *MockISCSI) SetCHAPCredentialsBidirectional(target ISCSITarget, creds CHAPCredentials) error {
+	if iscsi.SetCHAPCredentialsBidirectionalFn != nil {
+		return iscsi.SetCHAPCredentialsBidirectionalFn(target, creds)
+	}
+	if err := validateMutualCHAP(creds); err != nil {
+		return err
+	}
+	return iscsi.newNode(target, creds.settings("node.session.auth"))
+}
@@ -0,0 +1,131 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+// chapReconcileStagger is the delay between the waves of re-logins of ReconcileCHAPSessions, for the paths of
+// the sessions logged in again to come back in their multipath devices before the next wave
+var chapReconcileStagger = 5 * time.Second
+
+// chapMismatches returns the findings of the sessions whose CHAP user or secrets differ from those of their node record
+func chapMismatches(findings []ConsistencyFinding) []ConsistencyFinding {
+	var mismatches []ConsistencyFinding
+	for _, f := range findings {
+		if f.Kind == FindingCHAPUserMismatch || f.Kind == FindingCHAPSecretMismatch {
+			mismatches = append(mismatches, f)
+		}
+	}
+	return mismatches
+}
+
+// validateMaxParallel checks the number of sessions logged in again at once by ReconcileCHAPSessions
+func validateMaxParallel(maxParallel int) error {
+	if maxParallel < 1 {
+		return goiscsierrors.New(goiscsierrors.Validation, "error maxParallel must be at least 1")
+	}
+	return nil
+}
+
+// ReconcileCHAPSessions logs out and in again the sessions whose CHAP user or secrets differ from those of their node
+// record, as reported by AuditConsistency, so that they use the credentials of the record, e.g. after a CHAP rotation.
+// The sessions are logged in again in waves of at most maxParallel sessions, chapReconcileStagger apart, and a
+// wave never takes the last active path of a multipath device in use: a session holding it is not logged out and
+// its result is a LastPathError. The results are in the order of the findings of AuditConsistency, and the error
+// is not nil if any session failed to be logged in again or was kept for its last path.
+func (iscsi *LinuxISCSI) ReconcileCHAPSessions(maxParallel int) (NodeOpResults, error) {
+	if err := validateMaxParallel(maxParallel); err != nil {
+		return nil, err
+	}
+	findings, err := iscsi.AuditConsistency()
+	if err != nil {
+		return nil, err
+	}
+	mismatches := chapMismatches(findings)
+	results := make(NodeOpResults, len(mismatches))
+	pending := make([]int, len(mismatches))
+	for i, f := range mismatches {
+		results[i].Target = f.Target
+		pending[i] = i
+	}
+	for waves := 0; len(pending) > 0; waves++ {
+		if waves > 0 {
+			iscsi.getClock().Sleep(chapReconcileStagger)
+		}
+		var wave []int
+		wave, pending = iscsi.planCHAPWave(mismatches, pending, maxParallel, results)
+		var wg sync.WaitGroup
+		for _, i := range wave {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i].Error = iscsi.reloginSession(mismatches[i])
+			}(i)
+		}
+		wg.Wait()
+	}
+	return results, nodeOpsError(results)
+}
+
+// planCHAPWave returns up to maxParallel of the pending mismatches to log in again together and those left
+// pending. A mismatch whose session holds the last active path of a multipath device in use, on its own or
+// with the sessions of the wave, is left out: with a LastPathError in results in the first case, pending in
+// the second.
+func (iscsi *LinuxISCSI) planCHAPWave(mismatches []ConsistencyFinding, pending []int, maxParallel int,
+	results NodeOpResults,
+) ([]int, []int) {
+	tree := iscsi.sysfs()
+	var wave, left []int
+	leaving := make(map[string]bool)
+	for _, i := range pending {
+		devices := make(map[string]bool)
+		for _, d := range tree.sessionBlockDevices(mismatches[i].SID) {
+			devices[d] = true
+		}
+		if mpath := lastPathDevice(tree, devices); mpath != "" {
+			results[i].Error = &LastPathError{Target: mismatches[i].Target, Device: mpath}
+			continue
+		}
+		together := maps.Clone(leaving)
+		maps.Copy(together, devices)
+		if len(wave) == maxParallel || lastPathDevice(tree, together) != "" {
+			left = append(left, i)
+			continue
+		}
+		wave = append(wave, i)
+		leaving = together
+	}
+	return wave, left
+}
+
+// reloginSession logs out of the session of a CHAP mismatch and logs in again to its target with the
+// credentials of the node record
+func (iscsi *LinuxISCSI) reloginSession(mismatch ConsistencyFinding) error {
+	if err := iscsi.LogoutSessionBySID(mismatch.SID); err != nil {
+		return err
+	}
+	return iscsi.loginWithContext(context.Background(), mismatch.Target)
+}
@@ -0,0 +1,84 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and waits on behalf of the operations of a client which poll until a condition
+// is met, WaitForSessionState and RescanAndVerifyLUN, and between the probes of Ping
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// systemClock is the Clock of the system
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// FakeClock is a Clock whose Sleep returns at once after advancing its time, so the waiting
+// operations resolve without real sleeps in tests. It is the default clock of the mock client.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns a FakeClock set to start
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now returns the time of the clock
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sleep advances the time of the clock by d
+func (c *FakeClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// SetClock sets the clock of the waiting operations of the client, nil for the system clock
+func (i *ISCSIType) SetClock(clock Clock) {
+	i.hooksMu.Lock()
+	defer i.hooksMu.Unlock()
+	i.clock = clock
+}
+
+// getClock returns the clock of the waiting operations of the client
+func (i *ISCSIType) getClock() Clock {
+	i.hooksMu.RLock()
+	defer i.hooksMu.RUnlock()
+	if i.clock == nil {
+		return systemClock{}
+	}
+	return i.clock
+}
@@ -0,0 +1,391 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+// CommandTimeout is the duration (e.g. "2m") after which the iscsiadm discovery and login commands are
+// killed, DefaultCommandTimeout if not set
+const CommandTimeout = "commandTimeout"
+
+// DefaultCommandTimeout is the timeout of the iscsiadm discovery and login commands when CommandTimeout is not set
+const DefaultCommandTimeout = time.Duration(Timeout) * time.Second
+
+// LogLevel limits the messages logged by a client: "error" logs only the errors, "info" also the other messages
+// and "debug", the default, also the iscsiadm commands run
+const LogLevel = "logLevel"
+
+// RetryAttempts, RetryDelay and RetryMaxDelay override the fields of the retry policy of a client, e.g. from an
+// options file reloaded by WatchOptionsFile
+const (
+	RetryAttempts = "retryAttempts"
+	RetryDelay    = "retryDelay"
+	RetryMaxDelay = "retryMaxDelay"
+)
+
+// logLevels orders the values of the LogLevel option
+var logLevels = map[string]int{"error": 0, "info": 1, "debug": 2}
+
+// redactedSecret replaces the CHAP secrets in the logged commands
+const redactedSecret = "********"
+
+// Config holds the settings of a LinuxISCSI client, a typed alternative to the options map of NewLinuxISCSI
+type Config struct {
+	// Chroot is the directory iscsiadm is run chrooted in, as the ChrootDirectory option
+	Chroot string
+	// Timeout bounds the iscsiadm discovery and login commands, as the CommandTimeout option
+	Timeout time.Duration
+	// RetryPolicy sets how the iscsiadm commands failing with a transient error are retried. Default is no retry
+	RetryPolicy RetryPolicy
+	// Logger receives the messages of the client and the iscsiadm commands it runs.
+	// Default prints the messages on the standard output, without the commands.
+	Logger Logger
+	// Executor runs the commands of the client. Default runs them with os/exec
+	Executor Executor
+	// Middlewares wrap each run of the commands of the client, as added with Use
+	Middlewares []CommandMiddleware
+	// Paths locates the open-iscsi files of the client, as set with SetPaths. Default is DefaultPaths
+	Paths Paths
+	// SecretRedaction sets whether the CHAP secrets are masked in the commands logged. Default masks them
+	SecretRedaction SecretRedaction
+	// Options holds the other options of the client, by their key
+	Options map[string]string
+}
+
+// Logger receives the messages of a client
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// Executor runs the commands built by a client, e.g. to run them through a helper or to fake them in tests
+type Executor interface {
+	// Output runs cmd and returns its standard output. As with exec.Cmd.Output, the standard error
+	// of a command which fails is returned in an *exec.ExitError.
+	Output(cmd *exec.Cmd) ([]byte, error)
+}
+
+// CommandFunc runs an iscsiadm command of a client and returns its standard output
+type CommandFunc func(ctx context.Context, exe []string) ([]byte, error)
+
+// CommandMiddleware wraps the runs of the iscsiadm commands of a client, e.g. to rate limit or meter them.
+// It returns a CommandFunc calling next to run the command.
+type CommandMiddleware func(next CommandFunc) CommandFunc
+
+// execExecutor runs the commands with os/exec. If maxOutput is set, the output beyond it is discarded
+// as the command runs. If reaper is set, it kills the processes running too long.
+type execExecutor struct {
+	maxOutput int
+	reaper    *processReaper
+}
+
+func (e execExecutor) Output(cmd *exec.Cmd) ([]byte, error) {
+	if e.maxOutput > 0 || e.reaper != nil {
+		return cappedOutput(cmd, e.maxOutput, e.reaper)
+	}
+	return cmd.Output()
+}
+
+// RetryPolicy sets how a client retries the iscsiadm commands failing with a transport error or a
+// timeout of iscsiadm, which may succeed when run again. The zero value does not retry.
+type RetryPolicy struct {
+	// Attempts is the maximum number of runs of a command
+	Attempts int
+	// Delay is the wait before the first retry, doubling with each retry
+	Delay time.Duration
+	// MaxDelay caps the wait between retries, if set
+	MaxDelay time.Duration
+	// RetryAuthFailures also retries the commands failing with an authentication error, which are not retried by
+	// default as the repeated failed logins may get the initiator locked out by the array
+	RetryAuthFailures bool
+}
+
+// withOptions returns the policy with the fields set by the RetryAttempts, RetryDelay and RetryMaxDelay options
+func (p RetryPolicy) withOptions(opts map[string]string) RetryPolicy {
+	p.Attempts = optionInt(opts, RetryAttempts, p.Attempts)
+	if d, err := time.ParseDuration(opts[RetryDelay]); err == nil {
+		p.Delay = d
+	}
+	if d, err := time.ParseDuration(opts[RetryMaxDelay]); err == nil {
+		p.MaxDelay = d
+	}
+	return p
+}
+
+// SecretRedaction sets whether the CHAP secrets are masked in the commands logged by a client
+type SecretRedaction string
+
+const (
+	// SecretRedactionMask masks the CHAP secrets, it is the default
+	SecretRedactionMask SecretRedaction = "mask"
+	// SecretRedactionNone logs the CHAP secrets in clear, for debugging
+	SecretRedactionNone SecretRedaction = "none"
+)
+
+// NewLinuxISCSIFromConfig returns a LinuxISCSI client with the settings of cfg.
+// The options of cfg are validated as by NewLinuxISCSIE.
+func NewLinuxISCSIFromConfig(cfg Config) (*LinuxISCSI, error) {
+	opts := maps.Clone(cfg.Options)
+	if opts == nil {
+		opts = map[string]string{}
+	}
+	if cfg.Chroot != "" {
+		opts[ChrootDirectory] = cfg.Chroot
+	}
+	if cfg.Timeout != 0 {
+		opts[CommandTimeout] = cfg.Timeout.String()
+	}
+	var errs []error
+	if err := validateOptions(opts, linuxOptionValidators); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.RetryPolicy.Attempts < 0 || cfg.RetryPolicy.Delay < 0 || cfg.RetryPolicy.MaxDelay < 0 {
+		errs = append(errs, fmt.Errorf("%w: negative retry policy %+v", ErrInvalidOptions, cfg.RetryPolicy))
+	}
+	if err := validateOneOf("", string(SecretRedactionMask), string(SecretRedactionNone))(string(cfg.SecretRedaction)); err != nil {
+		errs = append(errs, fmt.Errorf("%w: secret redaction: %w", ErrInvalidOptions, err))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	iscsi := NewLinuxISCSI(opts)
+	iscsi.retryPolicy = cfg.RetryPolicy
+	iscsi.logger = cfg.Logger
+	iscsi.executor = cfg.Executor
+	iscsi.middlewares = slices.Clone(cfg.Middlewares)
+	iscsi.paths = cfg.Paths
+	iscsi.secretRedaction = cfg.SecretRedaction
+	return iscsi, nil
+}
+
+// SetTimeout sets the timeout of the iscsiadm discovery and login commands
+func (i *ISCSIType) SetTimeout(timeout time.Duration) {
+	i.setOption(CommandTimeout, timeout.String())
+}
+
+// GetTimeout returns the timeout of the iscsiadm discovery and login commands
+func (i *ISCSIType) GetTimeout() time.Duration {
+	timeout, err := time.ParseDuration(i.getOptions()[CommandTimeout])
+	if err != nil || timeout <= 0 {
+		return DefaultCommandTimeout
+	}
+	return timeout
+}
+
+// SetRetryPolicy sets how the iscsiadm commands failing with a transient error are retried
+func (i *ISCSIType) SetRetryPolicy(policy RetryPolicy) {
+	i.hooksMu.Lock()
+	defer i.hooksMu.Unlock()
+	i.retryPolicy = policy
+}
+
+// SetLogger sets the logger of the messages of the client and of the iscsiadm commands it runs,
+// nil to print the messages on the standard output
+func (i *ISCSIType) SetLogger(logger Logger) {
+	i.hooksMu.Lock()
+	defer i.hooksMu.Unlock()
+	i.logger = logger
+}
+
+// SetExecutor sets the executor of the commands of the client, nil to run them with os/exec
+func (i *ISCSIType) SetExecutor(executor Executor) {
+	i.hooksMu.Lock()
+	defer i.hooksMu.Unlock()
+	i.executor = executor
+}
+
+// Use adds middlewares wrapping the runs of the iscsiadm commands of the client. The commands go through the
+// retries of the retry policy, the logging, then the middlewares in the order they were added, the first added
+// being the outermost, before the executor, so each attempt of a retried command goes through the middlewares.
+func (i *ISCSIType) Use(middlewares ...CommandMiddleware) {
+	i.hooksMu.Lock()
+	defer i.hooksMu.Unlock()
+	i.middlewares = append(i.middlewares, middlewares...)
+}
+
+// getMiddlewares returns the middlewares added to the client
+func (i *ISCSIType) getMiddlewares() []CommandMiddleware {
+	i.hooksMu.RLock()
+	defer i.hooksMu.RUnlock()
+	return slices.Clone(i.middlewares)
+}
+
+// logEnabled tells whether the messages of a level are logged, all of them if the LogLevel option is not set
+func (i *ISCSIType) logEnabled(level string) bool {
+	limit, ok := logLevels[i.getOptions()[LogLevel]]
+	return !ok || logLevels[level] <= limit
+}
+
+// logf prints an informational message of the client, unless the LogLevel option only logs the errors
+func (i *ISCSIType) logf(format string, args ...interface{}) {
+	if i.logEnabled("info") {
+		i.printf(format, args...)
+	}
+}
+
+// errorf prints an error message of the client, whatever the LogLevel option
+func (i *ISCSIType) errorf(format string, args ...interface{}) {
+	i.printf(format, args...)
+}
+
+// printf prints a message of the client with its logger, on the standard output if it has none
+func (i *ISCSIType) printf(format string, args ...interface{}) {
+	i.hooksMu.RLock()
+	logger := i.logger
+	i.hooksMu.RUnlock()
+	if logger == nil {
+		fmt.Printf(format, args...)
+		return
+	}
+	logger.Printf(strings.TrimLeft(format, "\n"), args...)
+}
+
+// logCommand logs a command run by the client, if it has a logger
+func (i *ISCSIType) logCommand(exe []string) {
+	i.hooksMu.RLock()
+	logger, redaction := i.logger, i.secretRedaction
+	i.hooksMu.RUnlock()
+	if logger == nil || !i.logEnabled("debug") {
+		return
+	}
+	if redaction != SecretRedactionNone {
+		exe = redactCommand(exe)
+	}
+	logger.Printf("running %s", strings.Join(exe, " "))
+}
+
+// redactCommand returns a copy of an iscsiadm command with the values of the secret parameters masked
+func redactCommand(exe []string) []string {
+	redacted := append([]string{}, exe...)
+	for n := 0; n+3 < len(redacted); n++ {
+		if redacted[n] == "-n" && redacted[n+2] == "-v" && strings.Contains(redacted[n+1], "password") {
+			redacted[n+3] = redactedSecret
+		}
+	}
+	return redacted
+}
+
+// commandRunner returns the executor and the retry policy of the client, overridden by the retry options
+func (i *ISCSIType) commandRunner() (Executor, RetryPolicy) {
+	opts := i.getOptions()
+	i.hooksMu.RLock()
+	defer i.hooksMu.RUnlock()
+	if i.executor == nil {
+		return execExecutor{}, i.retryPolicy.withOptions(opts)
+	}
+	return i.executor, i.retryPolicy.withOptions(opts)
+}
+
+// commandOperation returns the mode and the action of an iscsiadm command, e.g. "node login"
+func commandOperation(exe []string) string {
+	var mode, action string
+	for n, arg := range exe {
+		next := ""
+		if n+1 < len(exe) {
+			next = exe[n+1]
+		}
+		switch arg {
+		case "-m", "--mode":
+			mode = next
+		case "-l", "--login":
+			action = "login"
+		case "-u", "--logout":
+			action = "logout"
+		case "-R", "--rescan":
+			action = "rescan"
+		case "-o", "--op":
+			action = next
+		}
+	}
+	return strings.TrimSpace(mode + " " + action)
+}
+
+// IsRetryableError reports whether a failed command may succeed when run again, as classified by the retry policies:
+// the transport errors and timeouts are retryable, the authentication failures, e.g. a login rejected by the target,
+// and the other errors are not
+func IsRetryableError(err error) bool {
+	if errors.Is(err, goiscsierrors.Auth) {
+		return false
+	}
+	return errors.Is(err, goiscsierrors.Transport) || errors.Is(err, goiscsierrors.Timeout)
+}
+
+// retryable reports whether a command failing with err is retried by the policy
+func (p RetryPolicy) retryable(err error) bool {
+	return IsRetryableError(err) || (p.RetryAuthFailures && errors.Is(err, goiscsierrors.Auth))
+}
+
+// callOptionsKey is the context key of the callOptions of an operation
+type callOptionsKey struct{}
+
+// callOptions holds the settings of an operation overriding those of the client, unset if zero
+type callOptions struct {
+	timeout     time.Duration
+	retryPolicy *RetryPolicy
+	// chroot is the chroot directory of the iscsiadm commands and the open-iscsi files of the operation
+	chroot string
+}
+
+// withCallOptions returns ctx carrying the settings of an operation to the commands it runs
+func withCallOptions(ctx context.Context, o callOptions) context.Context {
+	return context.WithValue(ctx, callOptionsKey{}, o)
+}
+
+// callTimeout returns the timeout of the iscsiadm discovery and login commands of the operation of ctx
+func (i *ISCSIType) callTimeout(ctx context.Context) time.Duration {
+	if o, ok := ctx.Value(callOptionsKey{}).(callOptions); ok && o.timeout > 0 {
+		return o.timeout
+	}
+	return i.GetTimeout()
+}
+
+// validateCallChroot checks the chroot directory overriding that of the client for an operation, if set, as the
+// ChrootDirectory option
+func validateCallChroot(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	if !filepath.IsAbs(dir) {
+		return goiscsierrors.Wrap(goiscsierrors.Validation, fmt.Errorf("chroot directory %q is not an absolute path", dir))
+	}
+	if err := validateDirectory(dir); err != nil {
+		return goiscsierrors.Wrap(goiscsierrors.Validation, fmt.Errorf("chroot directory: %w", err))
+	}
+	return nil
+}
+
+// nextDelay returns the wait before the retry following a wait of delay
+func (p RetryPolicy) nextDelay(delay time.Duration) time.Duration {
+	delay *= 2
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,278 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// iscsidConfFile is the default configuration file of iscsid, relative to the chroot directory
+const iscsidConfFile = "/etc/iscsi/iscsid.conf"
+
+// DiagnosticBundle is a snapshot of the iSCSI configuration of a system, as JSON, to compare it with
+// the bundle of a known-good system
+type DiagnosticBundle struct {
+	Captured time.Time `json:"captured"`
+	// Initiator is the fingerprint of the host, if it can be read
+	Initiator *InitiatorFingerprint `json:"initiator,omitempty"`
+	// IscsidConf holds the settings of iscsid.conf, without the commented out ones
+	IscsidConf map[string]string `json:"iscsidConf,omitempty"`
+	Nodes      []ISCSINode       `json:"nodes,omitempty"`
+	// Ifaces holds the iface.* parameters of the ifaces of the node records and sessions, by iface name
+	Ifaces map[string]map[string]string `json:"ifaces,omitempty"`
+}
+
+// DiagnosticChange holds a setting present in two bundles with different values
+type DiagnosticChange struct {
+	Key      string
+	Current  string
+	Baseline string
+}
+
+// DiagnosticNodeChange holds the parameters of a node record which differ between two bundles
+type DiagnosticNodeChange struct {
+	Target  string
+	Portal  string
+	Iface   string
+	Changes []DiagnosticChange
+}
+
+// DiagnosticIfaceChange holds the parameters of an iface which differ between two bundles
+type DiagnosticIfaceChange struct {
+	Iface   string
+	Changes []DiagnosticChange
+}
+
+// DiagnosticsDiff holds the differences of a bundle from a baseline. Added items are in the current bundle only,
+// removed items in the baseline only.
+type DiagnosticsDiff struct {
+	IscsidConf    []DiagnosticChange
+	AddedNodes    []ISCSINode
+	RemovedNodes  []ISCSINode
+	ChangedNodes  []DiagnosticNodeChange
+	AddedIfaces   []string
+	RemovedIfaces []string
+	ChangedIfaces []DiagnosticIfaceChange
+}
+
+// CaptureDiagnostics returns the diagnostic bundle of a client as JSON. The iscsid.conf settings are
+// only captured by the clients reading the file system of the initiator, e.g. not by the mock.
+func CaptureDiagnostics(iscsi ISCSIinterface) ([]byte, error) {
+	bundle := DiagnosticBundle{Captured: time.Now()}
+	if f, err := iscsi.GetInitiatorFingerprint(); err == nil {
+		bundle.Initiator = &f
+	}
+	var err error
+	if c, ok := iscsi.(interface {
+		readIscsidConf() (map[string]string, error)
+	}); ok {
+		if bundle.IscsidConf, err = c.readIscsidConf(); err != nil {
+			return nil, err
+		}
+	}
+	if bundle.Nodes, err = iscsi.GetNodes(); err != nil {
+		return nil, err
+	}
+	sessions, err := iscsi.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+	ifaces := make(map[string]bool)
+	for _, n := range bundle.Nodes {
+		if name := n.Fields["iface.iscsi_ifacename"]; name != "" {
+			ifaces[name] = true
+		}
+	}
+	for _, s := range sessions {
+		if s.IfaceName != "" {
+			ifaces[s.IfaceName] = true
+		}
+	}
+	for name := range ifaces {
+		params, err := iscsi.GetIfaceParameters(name)
+		if err != nil {
+			return nil, err
+		}
+		if bundle.Ifaces == nil {
+			bundle.Ifaces = make(map[string]map[string]string)
+		}
+		bundle.Ifaces[name] = params
+	}
+	return json.Marshal(bundle)
+}
+
+// CompareDiagnostics parses the diagnostic bundles current and baseline and returns how current differs from
+// baseline, in iscsid.conf, the parameters of the node records and the ifaces. Node records are matched by
+// target, portal and iface.
+func CompareDiagnostics(current, baseline []byte) (DiagnosticsDiff, error) {
+	var cur, base DiagnosticBundle
+	if err := json.Unmarshal(current, &cur); err != nil {
+		return DiagnosticsDiff{}, fmt.Errorf("parsing current bundle: %w", err)
+	}
+	if err := json.Unmarshal(baseline, &base); err != nil {
+		return DiagnosticsDiff{}, fmt.Errorf("parsing baseline bundle: %w", err)
+	}
+	diff := DiagnosticsDiff{IscsidConf: diffSettings(cur.IscsidConf, base.IscsidConf)}
+
+	baseNodes := make(map[string]ISCSINode, len(base.Nodes))
+	for _, n := range base.Nodes {
+		baseNodes[diagnosticNodeKey(n)] = n
+	}
+	for _, n := range cur.Nodes {
+		key := diagnosticNodeKey(n)
+		prev, ok := baseNodes[key]
+		delete(baseNodes, key)
+		if !ok {
+			diff.AddedNodes = append(diff.AddedNodes, n)
+			continue
+		}
+		if changes := diffSettings(n.Fields, prev.Fields); len(changes) > 0 {
+			diff.ChangedNodes = append(diff.ChangedNodes, DiagnosticNodeChange{
+				Target: n.Target, Portal: n.Portal, Iface: n.Fields["iface.iscsi_ifacename"], Changes: changes,
+			})
+		}
+	}
+	for _, n := range base.Nodes {
+		if _, ok := baseNodes[diagnosticNodeKey(n)]; ok {
+			diff.RemovedNodes = append(diff.RemovedNodes, n)
+		}
+	}
+
+	for name, params := range cur.Ifaces {
+		prev, ok := base.Ifaces[name]
+		if !ok {
+			diff.AddedIfaces = append(diff.AddedIfaces, name)
+			continue
+		}
+		if changes := diffSettings(params, prev); len(changes) > 0 {
+			diff.ChangedIfaces = append(diff.ChangedIfaces, DiagnosticIfaceChange{Iface: name, Changes: changes})
+		}
+	}
+	for name := range base.Ifaces {
+		if _, ok := cur.Ifaces[name]; !ok {
+			diff.RemovedIfaces = append(diff.RemovedIfaces, name)
+		}
+	}
+	sort.Strings(diff.AddedIfaces)
+	sort.Strings(diff.RemovedIfaces)
+	sort.Slice(diff.ChangedIfaces, func(i, j int) bool { return diff.ChangedIfaces[i].Iface < diff.ChangedIfaces[j].Iface })
+	return diff, nil
+}
+
+// Empty reports whether the bundles had no differences
+func (d DiagnosticsDiff) Empty() bool {
+	return len(d.IscsidConf)+len(d.AddedNodes)+len(d.RemovedNodes)+len(d.ChangedNodes)+
+		len(d.AddedIfaces)+len(d.RemovedIfaces)+len(d.ChangedIfaces) == 0
+}
+
+// String returns a summary of the differences, one per line, suitable for logs
+func (d DiagnosticsDiff) String() string {
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+	for _, c := range d.IscsidConf {
+		add("~ iscsid.conf %s", c)
+	}
+	for _, n := range d.AddedNodes {
+		add("+ node %s at %s", n.Target, n.Portal)
+	}
+	for _, n := range d.RemovedNodes {
+		add("- node %s at %s", n.Target, n.Portal)
+	}
+	for _, n := range d.ChangedNodes {
+		for _, c := range n.Changes {
+			add("~ node %s at %s %s", n.Target, n.Portal, c)
+		}
+	}
+	for _, name := range d.AddedIfaces {
+		add("+ iface %s", name)
+	}
+	for _, name := range d.RemovedIfaces {
+		add("- iface %s", name)
+	}
+	for _, i := range d.ChangedIfaces {
+		for _, c := range i.Changes {
+			add("~ iface %s %s", i.Iface, c)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// String returns the setting with its baseline and current values, an absent value shown as <unset>
+func (c DiagnosticChange) String() string {
+	unset := func(v string) string {
+		if v == "" {
+			return "<unset>"
+		}
+		return v
+	}
+	return fmt.Sprintf("%s %s -> %s", c.Key, unset(c.Baseline), unset(c.Current))
+}
+
+func diagnosticNodeKey(n ISCSINode) string {
+	return n.Target + "," + n.Portal + "," + n.Fields["iface.iscsi_ifacename"]
+}
+
+// diffSettings returns the settings which differ between current and baseline, sorted by key
+func diffSettings(current, baseline map[string]string) []DiagnosticChange {
+	var changes []DiagnosticChange
+	for _, key := range changedFields(baseline, current) {
+		changes = append(changes, DiagnosticChange{Key: key, Current: current[key], Baseline: baseline[key]})
+	}
+	return changes
+}
+
+// readIscsidConf returns the settings of the iscsid.conf file of the chroot directory,
+// or none if the file does not exist
+func (iscsi *LinuxISCSI) readIscsidConf() (map[string]string, error) {
+	f, err := os.Open(iscsi.hostPath(context.Background(), iscsi.getPaths().IscsidConf))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return parseIscsidConf(f)
+}
+
+// parseIscsidConf parses the "key = value" lines of an iscsid.conf file, skipping the comments
+func parseIscsidConf(r io.Reader) (map[string]string, error) {
+	settings := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || !strings.Contains(line, "=") {
+			continue
+		}
+		key, value := nodeFieldKeyValue(line)
+		settings[key] = value
+	}
+	return settings, scanner.Err()
+}
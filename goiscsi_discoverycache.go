@@ -0,0 +1,180 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiscoveryCache shares the output of the SendTargets discoveries between the clients it is set on, with
+// SetDiscoveryCache, for a short TTL. Concurrent discoveries of a portal wait for the one running iscsiadm
+// instead of running their own, so that staging many volumes of an array at once queries its discovery
+// service once. Each client still filters the discovered targets and logs into them on its own.
+type DiscoveryCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[discoveryCacheKey]*discoveryCacheEntry
+}
+
+// discoveryCacheKey identifies a discovery, which returns the same targets for the same portal, type, iface, node
+// database and CHAP credentials. chap is the fingerprint of the credentials, so that a client without them or with
+// others is not handed the output of an authenticated discovery.
+type discoveryCacheKey struct {
+	portal, discoveryType, iface, chroot, chap string
+}
+
+// chapFingerprint returns the SHA-256 of the CHAP credentials of a discovery, empty without credentials
+func chapFingerprint(chap *CHAPCredentials) string {
+	if chap == nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(chap.Username + "\n" + chap.Password + "\n" + chap.UsernameIn + "\n" + chap.PasswordIn))
+	return hex.EncodeToString(sum[:])
+}
+
+// discoveryCacheEntry is the output of a discovery, available once done is closed
+type discoveryCacheEntry struct {
+	done    chan struct{}
+	output  []byte
+	err     error
+	expires time.Time
+}
+
+// NewDiscoveryCache returns a discovery cache keeping the output of the discoveries for ttl
+func NewDiscoveryCache(ttl time.Duration) *DiscoveryCache {
+	return &DiscoveryCache{ttl: ttl, entries: make(map[discoveryCacheKey]*discoveryCacheEntry)}
+}
+
+// Invalidate drops the cached discoveries of a portal, e.g. after targets were added to the array, or of all the
+// portals if portal is empty
+func (c *DiscoveryCache) Invalidate(portal string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.entries {
+		if portal == "" || k.portal == portalWithPort(portal) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// invalidateTarget drops the cached discoveries of the portal of a target and those which listed the target, as its
+// node records, which only the discovery writes, may be gone
+func (c *DiscoveryCache) invalidateTarget(target ISCSITarget) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, entry := range c.entries {
+		select {
+		case <-entry.done:
+		default:
+			// a running discovery writes the node records it returns
+			continue
+		}
+		if k.portal == portalWithPort(target.Portal) || listsTarget(entry.output, target.Target) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// listsTarget reports whether the output of a discovery lists a target
+func listsTarget(output []byte, target string) bool {
+	for _, line := range strings.Split(string(output), "\n") {
+		if tokens := strings.Fields(line); len(tokens) == 2 && tokens[1] == target {
+			return true
+		}
+	}
+	return false
+}
+
+// do returns the cached output of the discovery of key if it has not expired, waits for it if it is running, and
+// runs it with discover otherwise. A failed discovery is returned to its waiters but not cached, and the TTL of a
+// successful one starts once it is done.
+func (c *DiscoveryCache) do(ctx context.Context, key discoveryCacheKey, now func() time.Time, discover func() ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && !entry.expires.IsZero() && !now().Before(entry.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	if ok {
+		c.mu.Unlock()
+		select {
+		case <-entry.done:
+			return slices.Clone(entry.output), entry.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	entry = &discoveryCacheEntry{done: make(chan struct{})}
+	c.entries[key] = entry
+	c.mu.Unlock()
+
+	entry.output, entry.err = discover()
+	c.mu.Lock()
+	if entry.err != nil {
+		if c.entries[key] == entry {
+			delete(c.entries, key)
+		}
+	} else {
+		entry.expires = now().Add(c.ttl)
+	}
+	c.mu.Unlock()
+	close(entry.done)
+	return slices.Clone(entry.output), entry.err
+}
+
+// SetDiscoveryCache shares the discoveries of the client through cache, nil to stop sharing them. The same cache can
+// be set on many clients of the host.
+func (iscsi *LinuxISCSI) SetDiscoveryCache(cache *DiscoveryCache) {
+	iscsi.discoveryCacheMu.Lock()
+	defer iscsi.discoveryCacheMu.Unlock()
+	iscsi.discoveryCache = cache
+}
+
+// getDiscoveryCache returns the discovery cache of the client, nil if not set
+func (iscsi *LinuxISCSI) getDiscoveryCache() *DiscoveryCache {
+	iscsi.discoveryCacheMu.RLock()
+	defer iscsi.discoveryCacheMu.RUnlock()
+	return iscsi.discoveryCache
+}
+
+// invalidateDiscoveries drops the cached discoveries which may return a target without its node records
+func (iscsi *LinuxISCSI) invalidateDiscoveries(target ISCSITarget) {
+	if cache := iscsi.getDiscoveryCache(); cache != nil {
+		cache.invalidateTarget(target)
+	}
+}
+
+// discoveryOutput runs the discovery command exe, through the discovery cache of the client if set
+func (iscsi *LinuxISCSI) discoveryOutput(ctx context.Context, key discoveryCacheKey, exe []string) ([]byte, error) {
+	cache := iscsi.getDiscoveryCache()
+	if cache == nil {
+		return iscsi.runCommand(ctx, exe)
+	}
+	key.portal, key.chroot = portalWithPort(key.portal), iscsi.callChroot(ctx)
+	return cache.do(ctx, key, iscsi.getClock().Now, func() ([]byte, error) {
+		return iscsi.runCommand(ctx, exe)
+	})
+}
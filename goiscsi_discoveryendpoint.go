@@ -0,0 +1,139 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+// DiscoveryEndpoint groups the equivalent discovery addresses of an array, e.g. those of its controllers,
+// any of which returns the same targets
+type DiscoveryEndpoint struct {
+	// Name identifies the array in the warnings and errors, the addresses if empty
+	Name string
+	// Addresses are tried in order, a comma separated list being split. Each address is a portal, hostname or
+	// iSNS server as accepted by DiscoverTargetsWithOptions.
+	Addresses []string
+}
+
+// addresses returns the addresses of the endpoint, split at the commas
+func (e DiscoveryEndpoint) addresses() []string {
+	var addresses []string
+	for _, list := range e.Addresses {
+		for _, address := range strings.Split(list, ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	return addresses
+}
+
+func (e DiscoveryEndpoint) String() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return strings.Join(e.addresses(), ",")
+}
+
+// validate checks that the endpoint has addresses and that each is valid for a discovery with opts,
+// so that a wrong standby address is reported before it is needed
+func (e DiscoveryEndpoint) validate(opts DiscoveryOptions) error {
+	addresses := e.addresses()
+	if len(addresses) == 0 {
+		return goiscsierrors.New(goiscsierrors.Validation, "error missing discovery address")
+	}
+	for _, address := range addresses {
+		if _, err := discoveryPortal(address, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discoveryLoginError is the failure of a login to a target found by a discovery which succeeded
+type discoveryLoginError struct {
+	err error
+}
+
+func (e *discoveryLoginError) Error() string {
+	return e.err.Error()
+}
+
+func (e *discoveryLoginError) Unwrap() error {
+	return e.err
+}
+
+// failoverDiscovery runs discover through the addresses of the endpoint in order, until it succeeds through one.
+// It only moves to the next address when the discovery failed with a transport error or a timeout: the other
+// errors, e.g. a validation or an authentication error, would fail alike through every address, and a failed
+// login to the discovered targets is not a failure of the discovery.
+func (i *ISCSIType) failoverDiscovery(endpoint DiscoveryEndpoint, discover func(string) ([]ISCSITarget, error)) ([]ISCSITarget, error) {
+	var results DiscoveryResults
+	for _, address := range endpoint.addresses() {
+		targets, err := discover(address)
+		if err == nil {
+			if len(results) > 0 {
+				i.warn(WarningDiscoveryFailover, ISCSITarget{}, "discovery of %s failed over to %s: %v",
+					endpoint, address, results.Errors())
+			}
+			return targets, nil
+		}
+		var loginErr *discoveryLoginError
+		if !IsRetryableError(err) || errors.As(err, &loginErr) {
+			return []ISCSITarget{}, fmt.Errorf("discovery of %s through %s: %w", endpoint, address, err)
+		}
+		results = append(results, DiscoveryResult{Address: address, Error: err})
+	}
+	return []ISCSITarget{}, fmt.Errorf("discovery of %s failed through all %d addresses: %w",
+		endpoint, len(results), results.Errors())
+}
+
+// DiscoverEndpointTargets runs a discovery with opts through the first address of the endpoint, failing over to
+// the next ones on transport errors and timeouts until the discovery succeeds through one of them
+func (iscsi *LinuxISCSI) DiscoverEndpointTargets(endpoint DiscoveryEndpoint, opts DiscoveryOptions) ([]ISCSITarget, error) {
+	if err := endpoint.validate(opts); err != nil {
+		iscsi.errorf("\nError invalid discovery endpoint %s: %v", endpoint, err)
+		return []ISCSITarget{}, err
+	}
+	return iscsi.failoverDiscovery(endpoint, func(address string) ([]ISCSITarget, error) {
+		targets, err := iscsi.DiscoverTargetsWithOptions(address, opts)
+		if err != nil {
+			iscsi.errorf("\nError discovering %s through %s: %v", endpoint, address, err)
+		}
+		return targets, err
+	})
+}
+
+// DiscoverEndpointTargets runs a mock discovery with opts through the addresses of the endpoint until one succeeds
+func (iscsi *MockISCSI) DiscoverEndpointTargets(endpoint DiscoveryEndpoint, opts DiscoveryOptions) ([]ISCSITarget, error) {
+	if iscsi.DiscoverEndpointTargetsFn != nil {
+		return iscsi.DiscoverEndpointTargetsFn(endpoint, opts)
+	}
+	if err := endpoint.validate(opts); err != nil {
+		return []ISCSITarget{}, err
+	}
+	return iscsi.failoverDiscovery(endpoint, func(address string) ([]ISCSITarget, error) {
+		return iscsi.DiscoverTargetsWithOptions(address, opts)
+	})
+}
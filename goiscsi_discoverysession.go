@@ -0,0 +1,92 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"context"
+	"errors"
+)
+
+// discoverySessions returns the discovery sessions to portal, or all of them if portal is empty
+func discoverySessions(sessions []ISCSISession, portal string) []ISCSISession {
+	result := []ISCSISession{}
+	for _, s := range sessions {
+		if s.IsDiscovery() && (portal == "" || s.matchesPortal(portal)) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// ListDiscoverySessions returns the SendTargets discovery sessions kept open, e.g. by offload adapters or
+// the discovery daemon of iscsid, which count against the session limits of the arrays
+func (iscsi *LinuxISCSI) ListDiscoverySessions() ([]ISCSISession, error) {
+	sessions, err := iscsi.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+	return discoverySessions(sessions, ""), nil
+}
+
+// LogoutDiscoverySession logs out of the discovery sessions to a portal, e.g. 10.0.0.1:3260. It succeeds
+// if there is none.
+func (iscsi *LinuxISCSI) LogoutDiscoverySession(portal string) error {
+	if err := iscsi.validateIPAddress(portal); err != nil {
+		iscsi.errorf("\nError invalid portal %s: %v", portal, err)
+		return err
+	}
+	sessions, err := iscsi.GetSessions()
+	if err != nil {
+		return err
+	}
+	sessions = discoverySessions(sessions, portal)
+	if len(sessions) == 0 {
+		iscsi.logf("\nNo discovery session to %s", portal)
+		return nil
+	}
+	var errs []error
+	for _, s := range sessions {
+		err := iscsi.logoutSession(context.Background(), s.SID)
+		errs = append(errs, iscsi.recordOperation(JournalEntry{Op: JournalOpLogout, Portal: portal, SID: s.SID}, err))
+	}
+	return errors.Join(errs...)
+}
+
+// ListDiscoverySessions returns the mocked discovery sessions
+func (iscsi *MockISCSI) ListDiscoverySessions() ([]ISCSISession, error) {
+	if iscsi.ListDiscoverySessionsFn != nil {
+		return iscsi.ListDiscoverySessionsFn()
+	}
+	sessions, err := iscsi.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+	return discoverySessions(sessions, ""), nil
+}
+
+// LogoutDiscoverySession validates the portal of the mocked discovery sessions to log out of
+func (iscsi *MockISCSI) LogoutDiscoverySession(portal string) error {
+	if iscsi.LogoutDiscoverySessionFn != nil {
+		return iscsi.LogoutDiscoverySessionFn(portal)
+	}
+	if iscsi.induced().InduceLogoutError {
+		return errors.New("logoutDiscoverySession induced error")
+	}
+	return validateIPAddress(portal)
+}
@@ -0,0 +1,128 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// AttachErrorContext set to "true" makes the failed operations of a client return a *ContextError, holding the
+// target, the exit code and the end of the standard error of iscsiadm and the open-iscsi version, for bug reports
+const AttachErrorContext = "attachErrorContext"
+
+// errorContextStderrLines is the number of the last lines of the standard error of iscsiadm kept in an ErrorContext
+const errorContextStderrLines = 20
+
+// ErrorContext is a snapshot of the context of a failed operation
+type ErrorContext struct {
+	// Op is the operation, as in the operation journal, e.g. "login"
+	Op     string
+	Target string
+	Portal string
+	Iface  string
+	SID    string
+	// ExitCode is the exit code of the failed iscsiadm command, -1 if the operation did not fail on a command
+	ExitCode int
+	// Stderr holds the last lines of the standard error of the failed iscsiadm command
+	Stderr []string
+	// Version is the version of open-iscsi, empty if unknown
+	Version string
+}
+
+// String returns the context on one line
+func (c ErrorContext) String() string {
+	s := fmt.Sprintf("op=%s target=%s portal=%s iface=%s sid=%s exit=%d open-iscsi=%s",
+		c.Op, c.Target, c.Portal, c.Iface, c.SID, c.ExitCode, c.Version)
+	if len(c.Stderr) > 0 {
+		s += " stderr=" + strconv.Quote(strings.Join(c.Stderr, "\n"))
+	}
+	return s
+}
+
+// ContextError wraps the error of an operation with its context when the AttachErrorContext option is set.
+// Its message is the message of the error, so the context is retrieved with errors.As.
+type ContextError struct {
+	Context ErrorContext
+	Err     error
+}
+
+func (e *ContextError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error of the operation
+func (e *ContextError) Unwrap() error {
+	return e.Err
+}
+
+// recordOperation wraps the error of an operation with its context if the AttachErrorContext option is set,
+// records the operation in the journal and returns the error
+func (iscsi *LinuxISCSI) recordOperation(entry JournalEntry, err error) error {
+	if err != nil && optionBool(iscsi.getOptions(), AttachErrorContext) {
+		var contextErr *ContextError
+		if !errors.As(err, &contextErr) {
+			err = &ContextError{Context: iscsi.errorContext(entry, err), Err: err}
+		}
+	}
+	iscsi.cache.invalidate(journalOpInvalidations[entry.Op]...)
+	if iscsi.getOptions()[JournalFile] != "" {
+		entry.Initiator = iscsi.initiatorID()
+	}
+	iscsi.journal(entry, err)
+	return err
+}
+
+// errorContext returns the context of an operation which failed with err
+func (iscsi *LinuxISCSI) errorContext(entry JournalEntry, err error) ErrorContext {
+	c := ErrorContext{
+		Op: entry.Op, Target: entry.Target, Portal: entry.Portal, Iface: entry.Iface, SID: entry.SID,
+		ExitCode: -1, Version: iscsi.openISCSIVersion(),
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		c.ExitCode = exitErr.ExitCode()
+		lines := strings.Split(strings.TrimRight(string(exitErr.Stderr), "\n"), "\n")
+		if len(lines) > errorContextStderrLines {
+			lines = lines[len(lines)-errorContextStderrLines:]
+		}
+		if len(lines) > 1 || lines[0] != "" {
+			c.Stderr = lines
+		}
+	}
+	return c
+}
+
+// openISCSIVersion returns the version of open-iscsi printed by iscsiadm, e.g. 2.1.8, cached once known
+func (iscsi *LinuxISCSI) openISCSIVersion() string {
+	iscsi.versionMu.Lock()
+	defer iscsi.versionMu.Unlock()
+	if iscsi.version == "" {
+		exe := iscsi.buildISCSICommand([]string{"iscsiadm", "--version"})
+		out, err := iscsi.runCommand(context.Background(), exe)
+		if fields := strings.Fields(string(out)); err == nil && len(fields) > 0 {
+			iscsi.version = fields[len(fields)-1]
+		}
+	}
+	return iscsi.version
+}
@@ -0,0 +1,159 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+// ExitCode is an exit code of iscsiadm, one of the ISCSI_ERR codes of open-iscsi
+type ExitCode int
+
+// The exit codes of iscsiadm
+const (
+	ExitSuccess ExitCode = iota
+	// ExitGenericFailure is returned for a failure without a more specific code, as the rejected logins of some versions
+	ExitGenericFailure
+	// ExitSessionNotFound is returned when the session to operate on does not exist
+	ExitSessionNotFound
+	ExitNoMemory
+	// ExitTransportFailure is returned when the portal can not be reached
+	ExitTransportFailure
+	// ExitLoginFailure is returned when the target rejected the login, for another reason than the authentication
+	ExitLoginFailure
+	// ExitNodeDBFailure is returned when the node database can not be read or written
+	ExitNodeDBFailure
+	// ExitInvalidArgument is returned when iscsiadm was given an invalid argument
+	ExitInvalidArgument
+	// ExitTransportTimeout is returned when the connection to the portal timed out
+	ExitTransportTimeout
+	ExitInternal
+	ExitLogoutFailure
+	// ExitPDUTimeout is returned when the target did not answer a request in time
+	ExitPDUTimeout
+	ExitTransportNotFound
+	// ExitAccessDenied is returned when iscsiadm is not allowed to reach iscsid, e.g. not run as root
+	ExitAccessDenied
+	ExitTransportCapability
+	// ExitSessionExists is returned when the session to log into already exists
+	ExitSessionExists
+	ExitInvalidRequest
+	ExitISNSUnavailable
+	// ExitIscsidCommunication is returned when iscsiadm failed to talk to iscsid
+	ExitIscsidCommunication
+	ExitFatalLoginFailure
+	// ExitIscsidNotConnected is returned when iscsid is not running
+	ExitIscsidNotConnected
+	// ExitNoObjectsFound is returned when no records, targets, sessions or portals match the command
+	ExitNoObjectsFound
+	ExitSysfsLookupFailure
+	ExitHostNotFound
+	// ExitAuthFailure is returned when the target rejected the authentication of a login
+	ExitAuthFailure
+	ExitISNSQueryFailure
+	ExitISNSRegistrationFailure
+	ExitOperationNotSupported
+	// ExitBusy is returned when a device or resource is busy
+	ExitBusy
+	ExitTryAgain
+	ExitUnknownDiscoveryType
+	ExitChildTerminated
+	// ExitSessionNotConnected is returned when the session is not logged in
+	ExitSessionNotConnected
+)
+
+var exitCodeNames = map[ExitCode]string{
+	ExitSuccess:                 "success",
+	ExitGenericFailure:          "generic failure",
+	ExitSessionNotFound:         "session not found",
+	ExitNoMemory:                "no memory",
+	ExitTransportFailure:        "transport failure",
+	ExitLoginFailure:            "login failure",
+	ExitNodeDBFailure:           "node database failure",
+	ExitInvalidArgument:         "invalid argument",
+	ExitTransportTimeout:        "transport timeout",
+	ExitInternal:                "internal error",
+	ExitLogoutFailure:           "logout failure",
+	ExitPDUTimeout:              "PDU timeout",
+	ExitTransportNotFound:       "transport module not found",
+	ExitAccessDenied:            "access denied",
+	ExitTransportCapability:     "transport capability mismatch",
+	ExitSessionExists:           "session exists",
+	ExitInvalidRequest:          "invalid management request",
+	ExitISNSUnavailable:         "iSNS service unavailable",
+	ExitIscsidCommunication:     "iscsid communication error",
+	ExitFatalLoginFailure:       "fatal login failure",
+	ExitIscsidNotConnected:      "iscsid not connected",
+	ExitNoObjectsFound:          "no objects found",
+	ExitSysfsLookupFailure:      "sysfs lookup failure",
+	ExitHostNotFound:            "host not found",
+	ExitAuthFailure:             "login authentication failure",
+	ExitISNSQueryFailure:        "iSNS query failure",
+	ExitISNSRegistrationFailure: "iSNS registration failure",
+	ExitOperationNotSupported:   "operation not supported",
+	ExitBusy:                    "device or resource busy",
+	ExitTryAgain:                "try again",
+	ExitUnknownDiscoveryType:    "unknown discovery type",
+	ExitChildTerminated:         "child process terminated",
+	ExitSessionNotConnected:     "session not connected",
+}
+
+// String returns the meaning of the exit code, e.g. "session exists"
+func (c ExitCode) String() string {
+	if name, ok := exitCodeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("exit code %d", int(c))
+}
+
+// iscsiadmExitCategories maps the iscsiadm exit codes to error categories
+var iscsiadmExitCategories = map[ExitCode]goiscsierrors.Category{
+	ExitSessionNotFound:     goiscsierrors.NotFound,
+	ExitTransportFailure:    goiscsierrors.Transport,
+	ExitLoginFailure:        goiscsierrors.Transport,
+	ExitInvalidArgument:     goiscsierrors.Validation,
+	ExitTransportTimeout:    goiscsierrors.Timeout,
+	ExitPDUTimeout:          goiscsierrors.Timeout,
+	ExitTransportNotFound:   goiscsierrors.NotFound,
+	ExitAccessDenied:        goiscsierrors.Auth,
+	ExitSessionExists:       goiscsierrors.Conflict,
+	ExitInvalidRequest:      goiscsierrors.Validation,
+	ExitIscsidCommunication: goiscsierrors.Transport,
+	ExitFatalLoginFailure:   goiscsierrors.Transport,
+	ExitIscsidNotConnected:  goiscsierrors.Transport,
+	ExitNoObjectsFound:      goiscsierrors.NotFound,
+	ExitHostNotFound:        goiscsierrors.NotFound,
+	ExitAuthFailure:         goiscsierrors.Auth,
+	ExitBusy:                goiscsierrors.Conflict,
+	ExitSessionNotConnected: goiscsierrors.Transport,
+}
+
+// ExitCodeFromError returns the exit code of the iscsiadm command which failed with err, false if err is not the
+// exit of a command, e.g. a validation error or a command which could not be started
+func ExitCodeFromError(err error) (ExitCode, bool) {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 0, false
+	}
+	return ExitCode(exitErr.ExitCode()), true
+}
@@ -0,0 +1,118 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"slices"
+	"strings"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+// mockHostname is the hostname of the fingerprint of the mock
+const mockHostname = "mock-host"
+
+// InitiatorFingerprint identifies the host of a client, to correlate the initiator records of an array with the
+// hosts of a fleet. ID is stable as long as the initiator name, the hostname and the MAC addresses of the iSCSI
+// ifaces are.
+type InitiatorFingerprint struct {
+	// ID is the first 16 hex digits of the SHA-256 of the other fields
+	ID       string `json:"id"`
+	IQN      string `json:"iqn"`
+	Hostname string `json:"hostname"`
+	// MACs holds the sorted MAC addresses of the network interfaces bound to iSCSI ifaces, none with the default iface
+	MACs []string `json:"macs,omitempty"`
+}
+
+// String returns the ID of the fingerprint
+func (f InitiatorFingerprint) String() string {
+	return f.ID
+}
+
+// newInitiatorFingerprint returns the fingerprint of an initiator name, a hostname and MAC addresses
+func newInitiatorFingerprint(iqn, hostname string, macs []string) InitiatorFingerprint {
+	macs = slices.Compact(slices.Sorted(slices.Values(macs)))
+	sum := sha256.Sum256([]byte(iqn + "\n" + hostname + "\n" + strings.Join(macs, ",")))
+	return InitiatorFingerprint{ID: hex.EncodeToString(sum[:8]), IQN: iqn, Hostname: hostname, MACs: macs}
+}
+
+// hostname returns the hostname of the host, a variable to be faked in tests
+var hostname = os.Hostname
+
+// ifaceMACs returns the MAC addresses of the network interfaces bound to iSCSI ifaces, by MAC address or by name
+func ifaceMACs(bindings []ifaceBinding, netdevs map[string]hostNetdev) []string {
+	var macs []string
+	for _, b := range bindings {
+		switch {
+		case b.hwAddress != "":
+			macs = append(macs, b.hwAddress)
+		case b.netdev != "" && netdevs[b.netdev].hwAddress != "":
+			macs = append(macs, strings.ToLower(netdevs[b.netdev].hwAddress))
+		}
+	}
+	return macs
+}
+
+// GetInitiatorFingerprint returns the fingerprint of the host, from the first initiator name of GetInitiators,
+// the hostname and the MAC addresses of the iSCSI ifaces
+func (iscsi *LinuxISCSI) GetInitiatorFingerprint() (InitiatorFingerprint, error) {
+	iqns, err := iscsi.GetInitiators("")
+	if err != nil {
+		return InitiatorFingerprint{}, err
+	}
+	if len(iqns) == 0 {
+		return InitiatorFingerprint{}, goiscsierrors.New(goiscsierrors.NotFound, "error no initiator name found")
+	}
+	host, err := hostname()
+	if err != nil {
+		return InitiatorFingerprint{}, goiscsierrors.Wrap(goiscsierrors.Internal, err)
+	}
+	bindings, err := cachedRead(iscsi, cacheIfaces, "", iscsi.readIfaceBindings, slices.Clone[[]ifaceBinding])
+	if err != nil {
+		return InitiatorFingerprint{}, err
+	}
+	netdevs, err := hostNetdevs()
+	if err != nil {
+		return InitiatorFingerprint{}, goiscsierrors.Wrap(goiscsierrors.Internal, err)
+	}
+	return newInitiatorFingerprint(iqns[0], host, ifaceMACs(bindings, netdevs)), nil
+}
+
+// initiatorID returns the ID of the fingerprint of the host for the journal entries, empty if it can not be read.
+// The fingerprint is cached until Invalidate or a change of the initiator name, so that the ifaces are not listed
+// for each entry.
+func (iscsi *LinuxISCSI) initiatorID() string {
+	iqns, err := iscsi.GetInitiators("")
+	if err != nil || len(iqns) == 0 {
+		return ""
+	}
+	iscsi.fingerprintMu.Lock()
+	defer iscsi.fingerprintMu.Unlock()
+	if iscsi.fingerprint.ID == "" || iscsi.fingerprint.IQN != iqns[0] {
+		f, err := iscsi.GetInitiatorFingerprint()
+		if err != nil {
+			return ""
+		}
+		iscsi.fingerprint = f
+	}
+	return iscsi.fingerprint.ID
+}
@@ -0,0 +1,118 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+// DefaultFlushTimeout is the longest wait for the flush of the devices of a target before its logout, when the
+// FlushTimeout of the LogoutOptions is not set
+const DefaultFlushTimeout = 30 * time.Second
+
+// ErrFlushTimeout is returned when the flush of the devices of a target did not complete in time; the target is not
+// logged out of, as the writes still cached would be lost
+var ErrFlushTimeout = goiscsierrors.New(goiscsierrors.Timeout, "flushing the devices of the target timed out")
+
+// blkflsbuf is the ioctl flushing the buffer cache of a block device, as blockdev --flushbufs
+const blkflsbuf = 0x1261
+
+// flushBlockDevice writes the cached data of a block device to the device, then flushes its buffer cache
+var flushBlockDevice = func(path string) error {
+	f, err := os.OpenFile(filepath.Clean(path), os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), blkflsbuf, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// targetDevices returns the block devices of the sessions to the target, with the multipath devices built on them
+// first, as the data cached by a multipath device is flushed through its paths
+func (iscsi *LinuxISCSI) targetDevices(target ISCSITarget) ([]string, error) {
+	sessions, err := iscsi.readSessions()
+	if err != nil {
+		return nil, err
+	}
+	tree := iscsi.sysfs()
+	var mpaths, paths []string
+	seen := map[string]bool{}
+	for _, s := range sessions {
+		if s.Target != target.Target || !s.matchesPortal(target.Portal) || !ifaceMatches(s.IfaceName, target.Iface) {
+			continue
+		}
+		for _, d := range tree.sessionBlockDevices(s.SID) {
+			for _, mpath := range tree.multipathHolders(d) {
+				if !seen[mpath] {
+					seen[mpath] = true
+					mpaths = append(mpaths, mpath)
+				}
+			}
+			if !seen[d] {
+				seen[d] = true
+				paths = append(paths, d)
+			}
+		}
+	}
+	return append(mpaths, paths...), nil
+}
+
+// flushTargetDevices flushes the block devices of the sessions to the target, waiting timeout at most. A flush
+// stuck on an unresponsive device keeps running after the timeout, until the device completes or fails it.
+func (iscsi *LinuxISCSI) flushTargetDevices(target ISCSITarget, timeout time.Duration) error {
+	devices, err := iscsi.targetDevices(target)
+	if err != nil {
+		return err
+	}
+	if timeout <= 0 {
+		timeout = DefaultFlushTimeout
+	}
+	tree := iscsi.sysfs()
+	// a stuck flush outlives the call, so it keeps the flush function of its start
+	flush := flushBlockDevice
+	done := make(chan error, 1)
+	go func() {
+		for _, d := range devices {
+			if err := flush(filepath.Join(tree.dev, d)); err != nil {
+				done <- classifyFileError(fmt.Errorf("flushing %s: %w", d, err))
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-time.After(timeout):
+		iscsi.logf("\nFlushing the devices %v of %s at %s did not complete in %s", devices, target.Target, target.Portal, timeout)
+		return fmt.Errorf("%w: %s at %s", ErrFlushTimeout, target.Target, target.Portal)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+// HostLock set to "true" makes the client take the lock of the open-iscsi database, the one taken by iscsiadm
+// and iscsid, while it reads the node database files directly or writes the metadata of the node records, so
+// it does not race with the other tools of the host changing the database, e.g. OS installers or cloud-init
+const HostLock = "hostLock"
+
+// ErrHostLockTimeout is returned when the lock of the open-iscsi database was not released in time
+var ErrHostLockTimeout = goiscsierrors.New(goiscsierrors.Timeout, "timed out waiting for the open-iscsi database lock")
+
+const (
+	// hostLockFile is the file of the lock directory linked to take the lock
+	hostLockFile = "lock"
+	// hostLockWriteFile is the hard link of the lock file existing while the lock is held
+	hostLockWriteFile = "lock.write"
+	// hostLockPoll is the time between two attempts to take the lock, as iscsiadm does
+	hostLockPoll = 10 * time.Millisecond
+)
+
+// hostLockDir is the default lock directory of open-iscsi
+const hostLockDir = "/run/lock/iscsi"
+
+// hostLockTimeout is the longest wait for the lock, the time after which iscsiadm itself gives up
+var hostLockTimeout = 30 * time.Second
+
+// WithHostLock runs fn holding the lock of the open-iscsi database, in the LockDir of the paths of the client,
+// so that the changes fn makes to the files of open-iscsi do not race with iscsiadm, iscsid or the other tools
+// respecting the lock. The lock is waited for until ctx is done or for 30 seconds at most.
+// As iscsiadm takes the same lock, fn must not run the iscsiadm commands changing the database.
+func (iscsi *LinuxISCSI) WithHostLock(ctx context.Context, fn func() error) error {
+	unlock, err := iscsi.acquireHostLock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return fn()
+}
+
+// hostLocked runs fn holding the lock of the open-iscsi database of the chroot of the operation of ctx if the
+// HostLock option is set
+func (iscsi *LinuxISCSI) hostLocked(ctx context.Context, fn func() error) error {
+	if !optionBool(iscsi.getOptions(), HostLock) {
+		return fn()
+	}
+	return iscsi.WithHostLock(ctx, fn)
+}
+
+// acquireHostLock takes the lock of the open-iscsi database the way open-iscsi does, by creating the write file
+// as a hard link of the lock file, which fails while another process holds it, and returns the function
+// releasing it
+func (iscsi *LinuxISCSI) acquireHostLock(ctx context.Context) (func(), error) {
+	dir := iscsi.hostPath(ctx, iscsi.getPaths().LockDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, classifyFileError(err)
+	}
+	lock := filepath.Join(dir, hostLockFile)
+	f, err := os.OpenFile(lock, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return nil, classifyFileError(err)
+	}
+	f.Close()
+	write := filepath.Join(dir, hostLockWriteFile)
+	clock := iscsi.getClock()
+	deadline := clock.Now().Add(hostLockTimeout)
+	for {
+		err := os.Link(lock, write)
+		if err == nil {
+			return func() {
+				if err := os.Remove(write); err != nil {
+					iscsi.errorf("\nError releasing the open-iscsi database lock: %v", err)
+				}
+			}, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, classifyFileError(err)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, goiscsierrors.Wrap(goiscsierrors.Timeout, err)
+		}
+		if !clock.Now().Before(deadline) {
+			return nil, ErrHostLockTimeout
+		}
+		clock.Sleep(hostLockPoll)
+	}
+}
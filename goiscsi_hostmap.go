@@ -0,0 +1,101 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// GetSIDToHostMap returns the SCSI host number of each session by SID, read from sysfs when available, else from
+// iscsiadm. The map is cached with the sessions, for the SessionCacheTTL option.
+func (iscsi *LinuxISCSI) GetSIDToHostMap() (map[string]int, error) {
+	return cachedRead(iscsi, cacheSessions, "hosts", iscsi.readSIDToHostMap, maps.Clone[map[string]int])
+}
+
+// readSIDToHostMap returns the SCSI host numbers of the sessions as GetSIDToHostMap, without the cache
+func (iscsi *LinuxISCSI) readSIDToHostMap() (map[string]int, error) {
+	hosts, err := iscsi.sysfs().readSessionHosts()
+	if err != nil {
+		return iscsi.iscsiadmSessionHosts()
+	}
+	return hosts, nil
+}
+
+// iscsiadmSessionHosts reads the SCSI host numbers of the sessions from the iscsiadm output at print level 3
+func (iscsi *LinuxISCSI) iscsiadmSessionHosts() (map[string]int, error) {
+	exe := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "session", "-P", "3"})
+	output, err := iscsi.runCommand(context.Background(), exe)
+	if err != nil {
+		if isNoObjsExitCode(err) {
+			return map[string]int{}, nil
+		}
+		return nil, err
+	}
+	return parseSessionHosts(output), nil
+}
+
+// parseSessionHosts parses the "SID:" and the following "Host Number:" lines of the iscsiadm session output
+// at print level 3, e.g. "Host Number: 3	State: running"
+func parseSessionHosts(output []byte) map[string]int {
+	hosts := make(map[string]int)
+	sid := ""
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if v, ok := strings.CutPrefix(line, "SID:"); ok {
+			sid = strings.TrimSpace(v)
+			continue
+		}
+		if v, ok := strings.CutPrefix(line, "Host Number:"); ok && sid != "" {
+			fields := strings.Fields(v)
+			if len(fields) == 0 {
+				continue
+			}
+			if host, err := strconv.Atoi(fields[0]); err == nil {
+				hosts[sid] = host
+			}
+			sid = ""
+		}
+	}
+	return hosts
+}
+
+// readSessionHosts returns the SCSI host number of each session in sysfs by SID
+func (tree sysfsTree) readSessionHosts() (map[string]int, error) {
+	entries, err := os.ReadDir(tree.classPath("iscsi_session"))
+	if err != nil {
+		return nil, errSysfsUnavailable
+	}
+	hosts := make(map[string]int)
+	for _, e := range entries {
+		sid, ok := strings.CutPrefix(e.Name(), "session")
+		if !ok {
+			continue
+		}
+		host := tree.sessionHost(filepath.Join(tree.classPath("iscsi_session"), e.Name()))
+		if n, err := strconv.Atoi(strings.TrimPrefix(host, "host")); err == nil && host != "" {
+			hosts[sid] = n
+		}
+	}
+	return hosts, nil
+}
@@ -0,0 +1,136 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IBFTConfiguration is the boot from SAN configuration of the iSCSI Boot Firmware Table (iBFT),
+// which the firmware used to log into the boot target before the operating system started
+type IBFTConfiguration struct {
+	// InitiatorName is the initiator name the firmware logged in with
+	InitiatorName string
+	// Targets are the boot targets, the first one usually backing the root file system
+	Targets []IBFTTarget
+}
+
+// IBFTTarget is a boot target of the iBFT
+type IBFTTarget struct {
+	// Index is the number of the target entry, e.g. 0 for target0
+	Index  int
+	Target string
+	Portal string
+	LUN    string
+}
+
+// Present reports whether the system has an iBFT with boot targets
+func (c IBFTConfiguration) Present() bool {
+	return len(c.Targets) > 0
+}
+
+// isBootSession reports whether a session is to one of the boot targets
+func (c IBFTConfiguration) isBootSession(s ISCSISession) bool {
+	for _, t := range c.Targets {
+		if t.Target == s.Target && s.matchesPortal(t.Portal) {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectIBFTConfiguration returns the boot from SAN configuration of the iBFT in sysfs, which is empty
+// if the system did not boot from an iSCSI target
+func (iscsi *LinuxISCSI) DetectIBFTConfiguration() (IBFTConfiguration, error) {
+	return iscsi.sysfs().readIBFT()
+}
+
+// readIBFT reads the initiator and target entries of the iBFT, exposed by the iscsi_ibft module
+func (tree sysfsTree) readIBFT() (IBFTConfiguration, error) {
+	dir := filepath.Join(tree.root, "firmware", "ibft")
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return IBFTConfiguration{}, nil
+	}
+	if err != nil {
+		return IBFTConfiguration{}, classifyFileError(err)
+	}
+	config := IBFTConfiguration{InitiatorName: readSysfsAttr(dir, "initiator", "initiator-name")}
+	for _, e := range entries {
+		index, ok := strings.CutPrefix(e.Name(), "target")
+		n, err := strconv.Atoi(index)
+		if !ok || err != nil {
+			continue
+		}
+		target := readSysfsAttr(dir, e.Name(), "target-name")
+		address := readSysfsAttr(dir, e.Name(), "ip-addr")
+		if target == "" || address == "" {
+			continue
+		}
+		port, _ := strconv.Atoi(readSysfsAttr(dir, e.Name(), "port"))
+		if port == 0 {
+			port = DefaultPort
+		}
+		config.Targets = append(config.Targets, IBFTTarget{
+			Index:  n,
+			Target: target,
+			Portal: JoinPortal(address, port),
+			LUN:    readSysfsAttr(dir, e.Name(), "lun"),
+		})
+	}
+	sort.Slice(config.Targets, func(i, j int) bool { return config.Targets[i].Index < config.Targets[j].Index })
+	return config, nil
+}
+
+// markBootSessions sets BootCritical on the sessions to the boot targets of the iBFT
+func (tree sysfsTree) markBootSessions(sessions []ISCSISession) {
+	config, err := tree.readIBFT()
+	if err != nil || !config.Present() {
+		return
+	}
+	for i := range sessions {
+		sessions[i].BootCritical = config.isBootSession(sessions[i])
+	}
+}
+
+// checkBootSession returns ErrBootSession if the sessions selected by match include a session
+// to a boot target of the iBFT, which likely backs the root file system
+func (iscsi *LinuxISCSI) checkBootSession(match func(s ISCSISession) bool) error {
+	tree := iscsi.sysfs()
+	config, err := tree.readIBFT()
+	if err != nil || !config.Present() {
+		return nil
+	}
+	sessions, err := tree.readSessions()
+	if err != nil {
+		return nil
+	}
+	for _, s := range sessions {
+		if match(s) && config.isBootSession(s) {
+			return fmt.Errorf("%w: session %s to %s at %s", ErrBootSession, s.SID, s.Target, s.Portal)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,518 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+// IfaceProblem is a mismatch between an iSCSI iface and the network interfaces of the host
+type IfaceProblem string
+
+const (
+	// IfaceNetdevMissing is reported for an iface bound to a network interface missing on the host, e.g. renamed
+	IfaceNetdevMissing IfaceProblem = "netdev-missing"
+	// IfaceHWAddressMissing is reported for an iface bound to a MAC address no network interface of the host has
+	IfaceHWAddressMissing IfaceProblem = "hwaddress-missing"
+	// IfaceIPMissing is reported for an iface bound to an IP address no network interface of the host has
+	IfaceIPMissing IfaceProblem = "ip-missing"
+	// IfaceIPMismatch is reported for an iface bound to an IP address held by another network interface than its own
+	IfaceIPMismatch IfaceProblem = "ip-mismatch"
+)
+
+// IfaceFinding reports an iSCSI iface whose binding no longer matches the network interfaces of the host
+type IfaceFinding struct {
+	Iface     string
+	Netdev    string
+	HWAddress string
+	IPAddress string
+	Problem   IfaceProblem
+	// Suggestion tells how to fix the iface, e.g. the iscsiadm command binding it to the renamed interface
+	Suggestion string
+}
+
+// ifaceBinding holds the bindings of an iSCSI iface, as listed by iscsiadm -m iface
+type ifaceBinding struct {
+	name, transport, hwAddress, ipAddress, netdev, initiatorName string
+}
+
+// hostNetdev holds the MAC and IP addresses of a network interface of the host
+type hostNetdev struct {
+	hwAddress string
+	ips       []string
+}
+
+// hostNetdevs returns the network interfaces of the host by name, a variable to be faked in tests
+var hostNetdevs = func() (map[string]hostNetdev, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	netdevs := make(map[string]hostNetdev, len(interfaces))
+	for _, i := range interfaces {
+		netdev := hostNetdev{hwAddress: i.HardwareAddr.String()}
+		addrs, err := i.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			if ipNet, ok := a.(*net.IPNet); ok {
+				netdev.ips = append(netdev.ips, ipNet.IP.String())
+			}
+		}
+		netdevs[i.Name] = netdev
+	}
+	return netdevs, nil
+}
+
+// ValidateIfaces reports the iSCSI ifaces bound to a network interface, MAC address or IP address which no
+// longer exists on the host, e.g. after a NIC rename, with a suggested fix. The ifaces without bindings, as the
+// default iface, are not reported.
+func (iscsi *LinuxISCSI) ValidateIfaces() ([]IfaceFinding, error) {
+	bindings, err := cachedRead(iscsi, cacheIfaces, "", iscsi.readIfaceBindings, slices.Clone[[]ifaceBinding])
+	if err != nil {
+		return nil, err
+	}
+	netdevs, err := hostNetdevs()
+	if err != nil {
+		return nil, goiscsierrors.Wrap(goiscsierrors.Internal, err)
+	}
+	return validateIfaceBindings(bindings, netdevs), nil
+}
+
+// readIfaceBindings returns the bindings of the iSCSI ifaces listed by iscsiadm
+func (iscsi *LinuxISCSI) readIfaceBindings() ([]ifaceBinding, error) {
+	exe := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "iface"})
+	output, err := iscsi.runCommand(context.Background(), exe)
+	if err != nil && !isNoObjsExitCode(err) {
+		return nil, err
+	}
+	return parseIfaceBindings(output), nil
+}
+
+// parseIfaceBindings parses the output of iscsiadm -m iface, whose lines look like:
+// iface0 tcp,00:50:56:a1:b2:c3,10.0.0.5,eth1,<empty>
+func parseIfaceBindings(output []byte) []ifaceBinding {
+	var bindings []ifaceBinding
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		values := strings.Split(fields[1], ",")
+		if len(values) < 4 {
+			continue
+		}
+		binding := ifaceBinding{
+			name:      fields[0],
+			transport: replaceEmpty(values[0]),
+			hwAddress: strings.ToLower(replaceEmpty(values[1])),
+			ipAddress: replaceEmpty(values[2]),
+			netdev:    replaceEmpty(values[3]),
+		}
+		if len(values) > 4 {
+			binding.initiatorName = replaceEmpty(values[4])
+		}
+		bindings = append(bindings, binding)
+	}
+	return bindings
+}
+
+// validateIfaceBindings returns the findings of the bindings of the ifaces not matching the netdevs of the host
+func validateIfaceBindings(bindings []ifaceBinding, netdevs map[string]hostNetdev) []IfaceFinding {
+	var findings []IfaceFinding
+	// netdevWith returns the name of the netdev matching, if any
+	netdevWith := func(match func(hostNetdev) bool) string {
+		names := make([]string, 0, len(netdevs))
+		for name, n := range netdevs {
+			if match(n) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return ""
+		}
+		return names[0]
+	}
+	byHWAddress := func(hw string) string {
+		return netdevWith(func(n hostNetdev) bool { return hw != "" && strings.EqualFold(n.hwAddress, hw) })
+	}
+	byIP := func(ip string) string {
+		return netdevWith(func(n hostNetdev) bool { return ip != "" && slices.Contains(n.ips, ip) })
+	}
+	update := func(iface, param, value string) string {
+		return fmt.Sprintf("iscsiadm -m iface -I %s -o update -n %s -v %s", iface, param, value)
+	}
+	for _, b := range bindings {
+		finding := IfaceFinding{Iface: b.name, Netdev: b.netdev, HWAddress: b.hwAddress, IPAddress: b.ipAddress}
+		report := func(problem IfaceProblem, suggestion string) {
+			finding.Problem, finding.Suggestion = problem, suggestion
+			findings = append(findings, finding)
+		}
+		netdev, netdevFound := netdevs[b.netdev]
+		switch {
+		case b.netdev != "" && !netdevFound:
+			if renamed := byHWAddress(b.hwAddress); renamed != "" {
+				report(IfaceNetdevMissing, update(b.name, "iface.net_ifacename", renamed))
+			} else if renamed = byIP(b.ipAddress); renamed != "" {
+				report(IfaceNetdevMissing, update(b.name, "iface.net_ifacename", renamed))
+			} else {
+				report(IfaceNetdevMissing, fmt.Sprintf("bind the iface to an existing interface or delete it: "+
+					"iscsiadm -m iface -I %s -o delete", b.name))
+			}
+			continue
+		case b.hwAddress != "" && byHWAddress(b.hwAddress) == "":
+			if netdevFound && netdev.hwAddress != "" {
+				report(IfaceHWAddressMissing, update(b.name, "iface.hwaddress", netdev.hwAddress))
+			} else {
+				report(IfaceHWAddressMissing, "bind the iface to the MAC address of an existing interface")
+			}
+			continue
+		}
+		if b.ipAddress == "" {
+			continue
+		}
+		holder := byIP(b.ipAddress)
+		switch {
+		case holder == "" && netdevFound && len(netdev.ips) > 0:
+			report(IfaceIPMissing, update(b.name, "iface.ipaddress", netdev.ips[0]))
+		case holder == "":
+			report(IfaceIPMissing, "bind the iface to an IP address of the host")
+		case b.netdev != "" && holder != b.netdev:
+			report(IfaceIPMismatch, update(b.name, "iface.net_ifacename", holder))
+		}
+	}
+	return findings
+}
+
+// IfaceRepair is the rebinding of an iSCSI iface bound to a stale network interface or MAC address, e.g. after a
+// NIC replacement, to the network interface holding its IP address
+type IfaceRepair struct {
+	Iface   string
+	Problem IfaceProblem
+	// Params are the iface parameters set, iface.net_ifacename and iface.hwaddress
+	Params map[string]string
+	// Applied tells whether the iface was updated, false in dry run mode or if the update failed
+	Applied bool
+	// Error is the error of the update
+	Error error
+}
+
+// planIfaceRepairs returns the repairs of the ifaces whose network interface or MAC address is not that of the
+// network interface holding their IP address. The ifaces bound to an IP address the host does not have can't be
+// repaired this way.
+func planIfaceRepairs(bindings []ifaceBinding, netdevs map[string]hostNetdev) []IfaceRepair {
+	repairs := []IfaceRepair{}
+	for _, b := range bindings {
+		if b.ipAddress == "" {
+			continue
+		}
+		holders := make([]string, 0, 1)
+		for name, n := range netdevs {
+			if slices.Contains(n.ips, b.ipAddress) {
+				holders = append(holders, name)
+			}
+		}
+		if len(holders) == 0 {
+			continue
+		}
+		sort.Strings(holders)
+		holder := netdevs[holders[0]]
+		repair := IfaceRepair{Iface: b.name, Params: map[string]string{}}
+		if b.netdev != "" && b.netdev != holders[0] {
+			repair.Params["iface.net_ifacename"] = holders[0]
+			repair.Problem = IfaceIPMismatch
+			if _, ok := netdevs[b.netdev]; !ok {
+				repair.Problem = IfaceNetdevMissing
+			}
+		}
+		if b.hwAddress != "" && holder.hwAddress != "" && !strings.EqualFold(b.hwAddress, holder.hwAddress) {
+			repair.Params["iface.hwaddress"] = holder.hwAddress
+			if repair.Problem == "" {
+				repair.Problem = IfaceHWAddressMissing
+			}
+		}
+		if len(repair.Params) > 0 {
+			repairs = append(repairs, repair)
+		}
+	}
+	return repairs
+}
+
+// RepairIfaceBindings rebinds the iSCSI ifaces bound to a stale network interface or MAC address, e.g. after a NIC
+// replacement, to the network interface holding their IP address, and returns the repairs. With dryRun, the repairs
+// are only returned. The failed updates are reported in the Error of their repair.
+func (iscsi *LinuxISCSI) RepairIfaceBindings(dryRun bool) ([]IfaceRepair, error) {
+	bindings, err := iscsi.readIfaceBindings()
+	if err != nil {
+		return nil, err
+	}
+	netdevs, err := hostNetdevs()
+	if err != nil {
+		return nil, goiscsierrors.Wrap(goiscsierrors.Internal, err)
+	}
+	repairs := planIfaceRepairs(bindings, netdevs)
+	if dryRun {
+		return repairs, nil
+	}
+	for i, r := range repairs {
+		baseCmd := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "iface", "-I", r.Iface})
+		err := iscsi.updateIface(baseCmd, r.Params)
+		if err != nil {
+			iscsi.errorf("\nError repairing the bindings of the iface %s: %v", r.Iface, err)
+		}
+		repairs[i].Error = iscsi.recordOperation(JournalEntry{Op: JournalOpSetIface, Iface: r.Iface}, err)
+		repairs[i].Applied = err == nil
+	}
+	return repairs, nil
+}
+
+// RepairIfaceBindings reports no stale binding of the mock ifaces
+func (iscsi *MockISCSI) RepairIfaceBindings(dryRun bool) ([]IfaceRepair, error) {
+	if iscsi.RepairIfaceBindingsFn != nil {
+		return iscsi.RepairIfaceBindingsFn(dryRun)
+	}
+	return []IfaceRepair{}, nil
+}
+
+// ISCSIIface is an iSCSI iface, binding the sessions of the node records using it to a transport and
+// a network interface of the host
+type ISCSIIface struct {
+	Name string
+	// Transport is the transport of the iface, ISCSITransportNameTCP if empty
+	Transport ISCSITransportName
+	// HWAddress binds the iface to the network interface with this MAC address
+	HWAddress string
+	// IPAddress is the source address of the sessions of the iface
+	IPAddress string
+	// Netdev binds the iface to a network interface, e.g. eth1
+	Netdev string
+	// InitiatorName overrides the initiator name of the host for the sessions of the iface
+	InitiatorName string
+}
+
+var (
+	// ErrIfaceNotFound is returned for an iSCSI iface which does not exist
+	ErrIfaceNotFound = goiscsierrors.New(goiscsierrors.NotFound, "iface not found")
+	// ErrIfaceExists is returned when creating an iSCSI iface which already exists
+	ErrIfaceExists = goiscsierrors.New(goiscsierrors.Conflict, "iface already exists")
+	// ErrIfaceInUse is returned when deleting an iSCSI iface which sessions are established through
+	ErrIfaceInUse = goiscsierrors.New(goiscsierrors.Conflict, "iface in use")
+)
+
+// builtinIfaces are the ifaces provided by iscsiadm, which can't be created or deleted
+var builtinIfaces = []string{"default", "iser"}
+
+// params returns the iface.* parameters of the non-empty fields of an iface
+func (i ISCSIIface) params() map[string]string {
+	params := make(map[string]string)
+	for k, v := range map[string]string{
+		"iface.transport_name": string(i.Transport),
+		"iface.hwaddress":      i.HWAddress,
+		"iface.ipaddress":      i.IPAddress,
+		"iface.net_ifacename":  i.Netdev,
+		"iface.initiatorname":  i.InitiatorName,
+	} {
+		if v != "" {
+			params[k] = v
+		}
+	}
+	return params
+}
+
+// validate checks the name, transport and bindings of an iface which is not built in
+func (i ISCSIIface) validate() error {
+	if err := validateIfaceName(i.Name); err != nil {
+		return err
+	}
+	if slices.Contains(builtinIfaces, i.Name) {
+		return goiscsierrors.New(goiscsierrors.Validation, fmt.Sprintf("error iface %s is built in", i.Name))
+	}
+	switch i.Transport {
+	case "", ISCSITransportNameTCP, ISCSITransportNameISER:
+	default:
+		return goiscsierrors.New(goiscsierrors.Validation, fmt.Sprintf("error invalid iface transport %s", i.Transport))
+	}
+	return validateIfaceParameters(i.params())
+}
+
+// iface returns the iface of a binding
+func (b ifaceBinding) iface() ISCSIIface {
+	return ISCSIIface{
+		Name: b.name, Transport: ISCSITransportName(b.transport), HWAddress: b.hwAddress, IPAddress: b.ipAddress,
+		Netdev: b.netdev, InitiatorName: b.initiatorName,
+	}
+}
+
+// ListIfaces returns the iSCSI ifaces, including the built-in ones
+func (iscsi *LinuxISCSI) ListIfaces() ([]ISCSIIface, error) {
+	bindings, err := cachedRead(iscsi, cacheIfaces, "", iscsi.readIfaceBindings, slices.Clone[[]ifaceBinding])
+	if err != nil {
+		return nil, err
+	}
+	ifaces := make([]ISCSIIface, 0, len(bindings))
+	for _, b := range bindings {
+		ifaces = append(ifaces, b.iface())
+	}
+	return ifaces, nil
+}
+
+// CreateIface creates an iSCSI iface with the transport and bindings of iface. It fails with
+// ErrIfaceExists if the iface already exists.
+func (iscsi *LinuxISCSI) CreateIface(iface ISCSIIface) error {
+	err := iscsi.createIface(iface)
+	err = iscsi.recordOperation(JournalEntry{Op: JournalOpCreateIface, Iface: iface.Name}, err)
+	return err
+}
+
+func (iscsi *LinuxISCSI) createIface(iface ISCSIIface) error {
+	if err := iface.validate(); err != nil {
+		return err
+	}
+	if err := iscsi.checkIscsid(); err != nil {
+		return err
+	}
+	baseCmd := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "iface", "-I", iface.Name})
+	_, err := iscsi.runCommand(context.Background(), append(slices.Clone(baseCmd), "-o", "new"))
+	if code, ok := ExitCodeFromError(err); ok && code == ExitSessionExists {
+		return fmt.Errorf("%w: %s", ErrIfaceExists, iface.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if err = iscsi.updateIface(baseCmd, iface.params()); err != nil {
+		// don't leave a half configured iface behind, which sessions would use
+		if _, deleteErr := iscsi.runCommand(context.Background(), append(slices.Clone(baseCmd), "-o", "delete")); deleteErr != nil {
+			iscsi.errorf("\nError deleting the iface %s after its failed creation: %v", iface.Name, deleteErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// UpdateIface sets the transport and bindings of an existing iSCSI iface to the non-empty fields of iface,
+// the others being left unchanged. It fails with ErrIfaceNotFound if the iface does not exist.
+func (iscsi *LinuxISCSI) UpdateIface(iface ISCSIIface) error {
+	err := iscsi.updateExistingIface(iface)
+	err = iscsi.recordOperation(JournalEntry{Op: JournalOpSetIface, Iface: iface.Name}, err)
+	return err
+}
+
+func (iscsi *LinuxISCSI) updateExistingIface(iface ISCSIIface) error {
+	if err := iface.validate(); err != nil {
+		return err
+	}
+	if err := iscsi.checkIscsid(); err != nil {
+		return err
+	}
+	baseCmd := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "iface", "-I", iface.Name})
+	_, err := iscsi.runCommand(context.Background(), append(slices.Clone(baseCmd), "-o", "show"))
+	if isNoObjsExitCode(err) {
+		return fmt.Errorf("%w: %s", ErrIfaceNotFound, iface.Name)
+	}
+	if err != nil {
+		return err
+	}
+	return iscsi.updateIface(baseCmd, iface.params())
+}
+
+// DeleteIface deletes an iSCSI iface. It fails with ErrIfaceInUse if sessions are established through the iface,
+// and succeeds if the iface does not exist.
+func (iscsi *LinuxISCSI) DeleteIface(name string) error {
+	err := iscsi.deleteIface(name)
+	err = iscsi.recordOperation(JournalEntry{Op: JournalOpDeleteIface, Iface: name}, err)
+	return err
+}
+
+func (iscsi *LinuxISCSI) deleteIface(name string) error {
+	if err := (ISCSIIface{Name: name}).validate(); err != nil {
+		return err
+	}
+	if err := iscsi.checkIscsid(); err != nil {
+		return err
+	}
+	sessions, err := iscsi.GetSessionsByIface(name)
+	if err != nil {
+		return err
+	}
+	if len(sessions) > 0 {
+		return fmt.Errorf("%w: %s has %d sessions", ErrIfaceInUse, name, len(sessions))
+	}
+	exe := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "iface", "-I", name, "-o", "delete"})
+	if _, err = iscsi.runCommand(context.Background(), exe); err != nil && !isNoObjsExitCode(err) {
+		return err
+	}
+	return nil
+}
+
+// ListIfaces returns the built-in iSCSI ifaces of the mock
+func (iscsi *MockISCSI) ListIfaces() ([]ISCSIIface, error) {
+	if iscsi.ListIfacesFn != nil {
+		return iscsi.ListIfacesFn()
+	}
+	if iscsi.induced().InduceGetIfaceError {
+		return nil, errors.New("listIfaces induced error")
+	}
+	return []ISCSIIface{
+		{Name: "default", Transport: ISCSITransportNameTCP},
+		{Name: "iser", Transport: ISCSITransportNameISER},
+	}, nil
+}
+
+// CreateIface validates the iSCSI iface to create
+func (iscsi *MockISCSI) CreateIface(iface ISCSIIface) error {
+	if iscsi.CreateIfaceFn != nil {
+		return iscsi.CreateIfaceFn(iface)
+	}
+	if iscsi.induced().InduceSetIfaceError {
+		return errors.New("createIface induced error")
+	}
+	return iface.validate()
+}
+
+// UpdateIface validates the iSCSI iface to update
+func (iscsi *MockISCSI) UpdateIface(iface ISCSIIface) error {
+	if iscsi.UpdateIfaceFn != nil {
+		return iscsi.UpdateIfaceFn(iface)
+	}
+	if iscsi.induced().InduceSetIfaceError {
+		return errors.New("updateIface induced error")
+	}
+	return iface.validate()
+}
+
+// DeleteIface validates the name of the iSCSI iface to delete
+func (iscsi *MockISCSI) DeleteIface(name string) error {
+	if iscsi.DeleteIfaceFn != nil {
+		return iscsi.DeleteIfaceFn(name)
+	}
+	if iscsi.induced().InduceSetIfaceError {
+		return errors.New("deleteIface induced error")
+	}
+	return ISCSIIface{Name: name}.validate()
+}
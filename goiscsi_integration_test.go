@@ -0,0 +1,164 @@
+//go:build integration && linux
+// +build integration,linux
+
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+// The integration tests run against a LIO target created with targetcli on the loopback address.
+// They need root, targetcli, iscsiadm and a running iscsid:
+//   go test -tags integration -run TestIntegration
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	integrationPortal    = "127.0.0.1"
+	integrationTarget    = "iqn.2003-01.org.linux-iscsi.goiscsi:integration"
+	integrationBackstore = "goiscsi_integration"
+)
+
+func runIntegrationCommand(t *testing.T, name string, args ...string) {
+	t.Helper()
+	out, err := exec.Command(name, args...).CombinedOutput() // #nosec G204
+	if err != nil {
+		t.Fatalf("%s %v failed: %v: %s", name, args, err, out)
+	}
+}
+
+// setupLIOTarget creates a fileio backed target exposing one LUN on the loopback portal,
+// allowing the initiator of the local system to log in. The target is removed on test cleanup.
+func setupLIOTarget(t *testing.T) {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("integration tests need to run as root")
+	}
+	for _, tool := range []string{"targetcli", "iscsiadm"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("integration tests need %s: %v", tool, err)
+		}
+	}
+	initiators, err := NewLinuxISCSI(map[string]string{}).GetInitiators("")
+	if err != nil || len(initiators) == 0 {
+		t.Skipf("integration tests need an initiator name: %v", err)
+	}
+
+	image := filepath.Join(t.TempDir(), "lun0.img")
+	runIntegrationCommand(t, "targetcli", "/backstores/fileio", "create", integrationBackstore, image, "16M")
+	t.Cleanup(func() {
+		_ = exec.Command("targetcli", "/iscsi", "delete", integrationTarget).Run()
+		_ = exec.Command("targetcli", "/backstores/fileio", "delete", integrationBackstore).Run()
+	})
+	runIntegrationCommand(t, "targetcli", "/iscsi", "create", integrationTarget)
+	tpg := "/iscsi/" + integrationTarget + "/tpg1"
+	runIntegrationCommand(t, "targetcli", tpg+"/luns", "create", "/backstores/fileio/"+integrationBackstore)
+	runIntegrationCommand(t, "targetcli", tpg+"/acls", "create", initiators[0])
+	// targetcli creates a portal on 0.0.0.0:3260 by default, which serves the loopback address
+}
+
+func TestIntegrationDiscoverLoginRescanLogout(t *testing.T) {
+	setupLIOTarget(t)
+	c := NewLinuxISCSI(map[string]string{})
+
+	targets, err := c.DiscoverTargets(integrationPortal, false)
+	if err != nil {
+		t.Fatalf("DiscoverTargets failed: %v", err)
+	}
+	var tgt *ISCSITarget
+	for i := range targets {
+		if targets[i].Target == integrationTarget {
+			tgt = &targets[i]
+		}
+	}
+	if tgt == nil {
+		t.Fatalf("Expected to discover %s but got %v", integrationTarget, targets)
+	}
+	t.Cleanup(func() { _ = c.DeleteNode(*tgt) })
+
+	if err = c.PerformLogin(*tgt); err != nil {
+		t.Fatalf("PerformLogin failed: %v", err)
+	}
+	// logging in twice must not fail
+	if err = c.PerformLogin(*tgt); err != nil {
+		t.Errorf("second PerformLogin failed: %v", err)
+	}
+
+	sessions, err := c.GetSessions()
+	if err != nil {
+		t.Fatalf("GetSessions failed: %v", err)
+	}
+	found := false
+	for _, s := range sessions {
+		if s.Target == integrationTarget {
+			found = true
+			if s.ISCSISessionState != ISCSISessionStateLOGGEDIN {
+				t.Errorf("Expected session state %s but got %s", ISCSISessionStateLOGGEDIN, s.ISCSISessionState)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected a session to %s but got %v", integrationTarget, sessions)
+	}
+
+	if err = c.PerformRescan(); err != nil {
+		t.Errorf("PerformRescan failed: %v", err)
+	}
+
+	nodes, err := c.GetNodes()
+	if err != nil {
+		t.Fatalf("GetNodes failed: %v", err)
+	}
+	if len(nodes) == 0 {
+		t.Error("Expected at least one node record")
+	}
+
+	if err = c.PerformLogout(*tgt); err != nil {
+		t.Errorf("PerformLogout failed: %v", err)
+	}
+	if err = c.DeleteNode(*tgt); err != nil {
+		t.Errorf("DeleteNode failed: %v", err)
+	}
+}
+
+func TestIntegrationCreateOrUpdateNode(t *testing.T) {
+	setupLIOTarget(t)
+	c := NewLinuxISCSI(map[string]string{})
+	tgt := ISCSITarget{Portal: integrationPortal + ":3260", Target: integrationTarget}
+	t.Cleanup(func() { _ = c.DeleteNode(tgt) })
+
+	err := c.CreateOrUpdateNode(tgt, map[string]string{"node.session.scan": "manual"})
+	if err != nil {
+		t.Fatalf("CreateOrUpdateNode failed: %v", err)
+	}
+	nodes, err := c.GetNodes()
+	if err != nil {
+		t.Fatalf("GetNodes failed: %v", err)
+	}
+	for _, n := range nodes {
+		if n.Target == integrationTarget {
+			compareStr(t, n.Fields["node.session.scan"], "manual")
+			return
+		}
+	}
+	t.Errorf("Expected a node record for %s but got %v", integrationTarget, nodes)
+}
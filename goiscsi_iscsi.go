@@ -20,13 +20,22 @@ package goiscsi
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
 )
 
 const (
@@ -35,18 +44,220 @@ const (
 	// DefaultInitiatorNameFile is the default file which contains the initiator names
 	DefaultInitiatorNameFile = "/etc/iscsi/initiatorname.iscsi"
 
-	// ISCSINoObjsFoundExitCode exit code indicates that no records/targets/sessions/portals
-	// found to execute operation on
-	iSCSINoObjsFoundExitCode = 21
-	// Timeout for iscsiadm command to execute
+	// Timeout is the default timeout in seconds of the iscsiadm discovery and login commands
 	Timeout = 30
+	// CleanEnvironment set to "true" removes the dynamic linker and locale variables from the
+	// environment of iscsiadm, which otherwise may alter its behavior or the language of its output
+	CleanEnvironment = "cleanEnvironment"
+	// ExcludeEnvironment is a comma separated list of additional environment variables to remove
+	// from the environment of iscsiadm; a trailing * matches any variable with that prefix
+	ExcludeEnvironment = "excludeEnvironment"
+	// SessionSource selects where session info is read from: "sysfs", "iscsiadm" or "auto".
+	// The default "auto" reads the session attributes from sysfs when available, falling back
+	// to parsing the human readable iscsiadm output.
+	SessionSource = "sessionSource"
+	// SerializeMutations set to "true" makes the iscsiadm commands changing the node records, the ifaces or the
+	// sessions wait for each other across the clients of the process using the same chroot, as advised by the
+	// open-iscsi maintainers. The read-only listings still run concurrently.
+	SerializeMutations = "serializeMutations"
+	// ProtectLastPath set to "true" makes PerformLogout fail with a LastPathError instead of removing
+	// the last active path of a dm-multipath device which is in use
+	ProtectLastPath = "protectLastPath"
+	// NodeSource selects where GetNodes reads node records from: "iscsiadm", "db" or "auto".
+	// "db" reads the node database files of iscsid, in /etc/iscsi/nodes or the legacy
+	// /var/lib/iscsi/nodes, without running iscsiadm; "auto" reads them when available, falling
+	// back to iscsiadm. The default is "iscsiadm".
+	NodeSource = "nodeSource"
+	// SlowSessionThreshold is a duration (e.g. "2s"). When the iscsiadm session query takes longer,
+	// GetSessions switches from print level 2 to the cheaper level 1 for a while, reading the CHAP
+	// user names and secrets of the sessions from sysfs instead
+	SlowSessionThreshold = "slowSessionThreshold"
+	// CheckIscsid set to "true" makes the operations changing sessions or node records fail right away
+	// with ErrIscsidUnavailable when iscsid does not accept connections, instead of letting iscsiadm
+	// wait for its internal timeout
+	CheckIscsid = "checkIscsid"
+	// Locale is the locale iscsiadm runs with, set in its LANG and LC_ALL variables, so its output
+	// can be parsed whatever the locale of the caller. The default is "C"; "inherit" keeps the
+	// locale variables of the environment
+	Locale = "locale"
+	// SysfsRoot is the mount point of the sysfs tree the sessions, SCSI devices and block devices are
+	// read from, e.g. a fixture tree in tests. The default is the sys directory of the chroot
+	// directory when it holds a mounted sysfs, else /sys.
+	SysfsRoot = "sysfsRoot"
+	// DevRoot is the directory the device nodes and their links are read from. The default is the
+	// dev directory of the chroot directory when it holds the disk links, else /dev.
+	DevRoot = "devRoot"
+	// BatchNodeUpdates set to "true" makes CreateOrUpdateNode set the parameters of a node record with
+	// one iscsiadm update per nodeUpdateBatchSize parameters, passing a -n/-v pair per parameter, rather
+	// than one update per parameter. If iscsiadm rejects several pairs, one update per parameter is used.
+	BatchNodeUpdates = "batchNodeUpdates"
+	// UnsafeSkipValidation set to "true" disables the checks of the portal addresses and target IQNs given to the
+	// discoveries, logins, logouts and node record changes, for lab arrays exposing target names which are not
+	// valid IQNs. Only empty values and values iscsiadm would take for an option are still rejected. Never set it
+	// in production.
+	UnsafeSkipValidation = "unsafeSkipValidation"
+	// ScanSCSIHosts set to "true" makes PerformRescan also ask the SCSI hosts of the iSCSI sessions to scan all
+	// their channels, targets and LUNs, writing "- - -" to their scan attribute, as a session rescan misses a
+	// newly mapped LUN 0 on some arrays. The other SCSI hosts of the system are not scanned.
+	ScanSCSIHosts = "scanSCSIHosts"
+)
+
+// nodeUpdateBatchSize is the most parameters set by an iscsiadm update with the BatchNodeUpdates option
+const nodeUpdateBatchSize = 32
+
+// localeVariables are the environment variables selecting the locale of a program
+var localeVariables = []string{"LANG", "LANGUAGE", "LC_*"}
+
+// The operations whose repetition is idempotent
+const (
+	opLogin      = "login"
+	opLogout     = "logout"
+	opCreateNode = "create node"
+	opDeleteNode = "delete node"
 )
 
+// idempotentExitCodes are, for each operation, the iscsiadm exit codes meaning that the system is already
+// in the requested state, so the operation succeeds when repeated
+var idempotentExitCodes = map[string][]ExitCode{
+	opLogin:      {ExitSessionExists},                       // the session already exists
+	opLogout:     {ExitSessionNotFound, ExitNoObjectsFound}, // there is no session to log out of
+	opCreateNode: {ExitSessionExists},                       // the record was created by another process
+	opDeleteNode: {ExitNoObjectsFound},                      // there is no record to delete
+}
+
+// isIdempotentExitCode checks if the iscsiadm exit code of an operation means it already took effect
+func isIdempotentExitCode(op string, code int) bool {
+	return slices.Contains(idempotentExitCodes[op], ExitCode(code))
+}
+
+// cleanEnvironmentExclusions are the variables removed from the environment by the CleanEnvironment option
+var cleanEnvironmentExclusions = []string{"LD_PRELOAD", "LD_LIBRARY_PATH", "LD_AUDIT", "LANG", "LANGUAGE", "LC_*"}
+
+// hostRootCandidates are the common hostPath mount points used by CSI drivers to expose the host root filesystem
+var hostRootCandidates = []string{"/host", "/noderoot", "/rootfs"}
+
+// ErrHostRootNotFound is returned when no host root filesystem with usable iSCSI utilities is found
+var ErrHostRootNotFound = goiscsierrors.New(goiscsierrors.NotFound, "no host root with iSCSI utilities found")
+
+// ErrIscsidUnavailable is returned when the CheckIscsid option is set and iscsid is not running
+var ErrIscsidUnavailable = goiscsierrors.New(goiscsierrors.Conflict, "iscsid is not available")
+
+// iscsidSocket is the abstract unix socket iscsiadm connects to in order to talk to iscsid
+var iscsidSocket = "@ISCSIADM_ABSTRACT_NAMESPACE"
+
+// iscsidProbeTimeout bounds the connection to the iscsid socket when checking that iscsid runs
+var iscsidProbeTimeout = time.Second
+
+// slowPathRecheckInterval is how long the session query stays at the cheaper print level after being slow
+var slowPathRecheckInterval = 5 * time.Minute
+
 // LinuxISCSI provides many iSCSI-specific functions.
 type LinuxISCSI struct {
 	ISCSIType
 	sessionParser iSCSISessionParser
 	nodeParser    iSCSINodeParser
+
+	slowPathMu    sync.Mutex
+	slowPathUntil time.Time
+
+	// targetLocks serializes the logins, logouts and node record changes of a target at a portal
+	targetLocksMu sync.Mutex
+	targetLocks   map[string]*targetLock
+
+	// version caches the open-iscsi version reported by iscsiadm
+	versionMu sync.Mutex
+	version   string
+
+	// fingerprint caches the initiator fingerprint of the journal entries
+	fingerprintMu sync.Mutex
+	fingerprint   InitiatorFingerprint
+
+	// reaper kills the iscsiadm processes exceeding the ProcessLifetime option
+	reaperMu sync.Mutex
+	reaper   *processReaper
+
+	// cache holds the sessions, node records and ifaces read, with the TTLs of the cache options
+	cache readCache
+
+	// paths holds the locations of the open-iscsi files set with SetPaths
+	pathsMu sync.RWMutex
+	paths   Paths
+
+	// discoveryCache shares the discoveries with other clients, set with SetDiscoveryCache
+	discoveryCacheMu sync.RWMutex
+	discoveryCache   *DiscoveryCache
+}
+
+type targetLock struct {
+	mu    sync.Mutex
+	users int
+}
+
+// lockTarget serializes the operations on a target at a portal within the client, so that concurrent
+// calls behave as if made one after the other, and returns the function releasing the lock
+func (iscsi *LinuxISCSI) lockTarget(target ISCSITarget) func() {
+	key := target.Target + "," + portalWithPort(target.Portal)
+	iscsi.targetLocksMu.Lock()
+	if iscsi.targetLocks == nil {
+		iscsi.targetLocks = make(map[string]*targetLock)
+	}
+	l, ok := iscsi.targetLocks[key]
+	if !ok {
+		l = &targetLock{}
+		iscsi.targetLocks[key] = l
+	}
+	l.users++
+	iscsi.targetLocksMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		iscsi.targetLocksMu.Lock()
+		if l.users--; l.users == 0 {
+			delete(iscsi.targetLocks, key)
+		}
+		iscsi.targetLocksMu.Unlock()
+	}
+}
+
+// mutationLocks holds, for each chroot, the lock serializing the mutating iscsiadm commands of the process
+var (
+	mutationLocksMu sync.Mutex
+	mutationLocks   = map[string]*sync.Mutex{}
+)
+
+// lockMutation waits for the other mutating iscsiadm commands of the process in the same chroot if exe is
+// one and the SerializeMutations option is set, and returns the function releasing the lock
+func (iscsi *LinuxISCSI) lockMutation(exe []string) func() {
+	if !optionBool(iscsi.getOptions(), SerializeMutations) || !isMutatingCommand(exe) {
+		return func() {}
+	}
+	chroot := commandChroot(exe)
+	mutationLocksMu.Lock()
+	l, ok := mutationLocks[chroot]
+	if !ok {
+		l = &sync.Mutex{}
+		mutationLocks[chroot] = l
+	}
+	mutationLocksMu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// isMutatingCommand reports whether an iscsiadm command changes the node records, the ifaces or the sessions:
+// a login, a logout, a discovery, which records the targets found, or an operation other than show
+func isMutatingCommand(exe []string) bool {
+	for i, arg := range exe {
+		switch arg {
+		case "-l", "--login", "-u", "--logout", "-t", "--type":
+			return true
+		case "-o", "--op":
+			if i+1 < len(exe) && exe[i+1] != "show" {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // NewLinuxISCSI returns an LinuxISCSI client
@@ -64,13 +275,112 @@ func NewLinuxISCSI(opts map[string]string) *LinuxISCSI {
 }
 
 func (iscsi *LinuxISCSI) getChrootDirectory() string {
-	s := iscsi.options[ChrootDirectory]
+	s := iscsi.getOptions()[ChrootDirectory]
 	if s == "" {
 		s = "/"
 	}
 	return s
 }
 
+// callChroot returns the chroot directory of the operation of ctx, that of the client unless the operation
+// overrides it
+func (iscsi *LinuxISCSI) callChroot(ctx context.Context) string {
+	if o, ok := ctx.Value(callOptionsKey{}).(callOptions); ok && o.chroot != "" {
+		return o.chroot
+	}
+	return iscsi.getChrootDirectory()
+}
+
+// chrootCommand returns exe, built with buildISCSICommand, run in the chroot directory of the operation of ctx
+func (iscsi *LinuxISCSI) chrootCommand(ctx context.Context, exe []string) []string {
+	chroot := iscsi.callChroot(ctx)
+	if chroot == commandChroot(exe) {
+		return exe
+	}
+	if len(exe) > 2 && exe[0] == "chroot" {
+		exe = exe[2:]
+	}
+	if chroot == "/" {
+		return exe
+	}
+	return append([]string{"chroot", chroot}, exe...)
+}
+
+// commandChroot returns the chroot directory a command built with buildISCSICommand runs in
+func commandChroot(exe []string) string {
+	if len(exe) > 2 && exe[0] == "chroot" {
+		return exe[1]
+	}
+	return "/"
+}
+
+// validateIPAddress checks a portal address, unless the UnsafeSkipValidation option is set
+func (iscsi *LinuxISCSI) validateIPAddress(ip string) error {
+	if optionBool(iscsi.getOptions(), UnsafeSkipValidation) {
+		return validateArgument(ip)
+	}
+	return validateIPAddress(ip)
+}
+
+// validateIQN checks a target IQN, unless the UnsafeSkipValidation option is set
+func (iscsi *LinuxISCSI) validateIQN(iqn string) error {
+	if optionBool(iscsi.getOptions(), UnsafeSkipValidation) {
+		return validateArgument(iqn)
+	}
+	return validateIQN(iqn)
+}
+
+// validateTarget checks the portal, the IQN and the iface of a target, in this order, following the
+// UnsafeSkipValidation option
+func (iscsi *LinuxISCSI) validateTarget(target ISCSITarget) error {
+	if err := iscsi.validateIPAddress(target.Portal); err != nil {
+		iscsi.errorf("\nError invalid portal address %s: %v", target.Portal, err)
+		return err
+	}
+	if err := iscsi.validateIQN(target.Target); err != nil {
+		iscsi.errorf("\nError invalid IQN Target %s: %v", target.Target, err)
+		return err
+	}
+	if err := validateOptionalIface(target.Iface); err != nil {
+		iscsi.errorf("\nError invalid iface %s: %v", target.Iface, err)
+		return err
+	}
+	return nil
+}
+
+// preflight checks the arguments of a mutation of a target before any other check, lock or command, in the same
+// order for every entry point: the target, with validateTarget, then the options of the call in ctx
+func (iscsi *LinuxISCSI) preflight(ctx context.Context, target ISCSITarget) error {
+	if err := iscsi.validateTarget(target); err != nil {
+		return err
+	}
+	o, _ := ctx.Value(callOptionsKey{}).(callOptions)
+	return validateCallChroot(o.chroot)
+}
+
+// sysfs returns the sysfs and /dev trees the client reads devices from, following the SysfsRoot,
+// DevRoot and ChrootDirectory options
+func (iscsi *LinuxISCSI) sysfs() sysfsTree {
+	opts := iscsi.getOptions()
+	tree := defaultSysfsTree()
+	if chroot := opts[ChrootDirectory]; chroot != "" {
+		// a chroot directory may not have the pseudo filesystems of the host mounted
+		if validateDirectory(filepath.Join(chroot, "sys", "class")) == nil {
+			tree.root = filepath.Join(chroot, "sys")
+		}
+		if validateDirectory(filepath.Join(chroot, "dev", "disk")) == nil {
+			tree.dev = filepath.Join(chroot, "dev")
+		}
+	}
+	if root := opts[SysfsRoot]; root != "" {
+		tree.root = root
+	}
+	if dev := opts[DevRoot]; dev != "" {
+		tree.dev = dev
+	}
+	return tree
+}
+
 func (iscsi *LinuxISCSI) buildISCSICommand(cmd []string) []string {
 	if iscsi.getChrootDirectory() == "/" {
 		return cmd
@@ -80,6 +390,228 @@ func (iscsi *LinuxISCSI) buildISCSICommand(cmd []string) []string {
 	return command
 }
 
+// newCommand builds the command to run exe, applying the environment options of the client
+func (iscsi *LinuxISCSI) newCommand(ctx context.Context, exe []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, exe[0], exe[1:]...) // #nosec G204
+	var exclusions []string
+	if optionBool(iscsi.getOptions(), CleanEnvironment) {
+		exclusions = append(exclusions, cleanEnvironmentExclusions...)
+	}
+	for _, e := range strings.Split(iscsi.getOptions()[ExcludeEnvironment], ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			exclusions = append(exclusions, e)
+		}
+	}
+	locale := iscsi.getOptions()[Locale]
+	if locale == "" {
+		locale = "C"
+	}
+	if locale != "inherit" {
+		exclusions = append(exclusions, localeVariables...)
+	}
+	if len(exclusions) > 0 {
+		cmd.Env = filterEnvironment(os.Environ(), exclusions)
+	}
+	if locale != "inherit" {
+		cmd.Env = append(cmd.Env, "LANG="+locale, "LC_ALL="+locale)
+	}
+	return cmd
+}
+
+// runCommand runs exe and returns its standard output.
+// The errors are categorized according to the iscsiadm exit code.
+// Commands failing with a transient error are run again according to the retry policy of the client.
+// The output beyond the MaxOutputBytes option is discarded.
+func (iscsi *LinuxISCSI) runCommand(ctx context.Context, exe []string) ([]byte, error) {
+	exe = iscsi.chrootCommand(ctx, exe)
+	executor, policy := iscsi.commandRunner()
+	if o, ok := ctx.Value(callOptionsKey{}).(callOptions); ok && o.retryPolicy != nil {
+		policy = *o.retryPolicy
+	}
+	if e, ok := executor.(execExecutor); ok {
+		if limit := optionInt(iscsi.getOptions(), MaxOutputBytes, 0); limit > 0 {
+			// one more byte than the limit tells the output was truncated
+			e.maxOutput = limit + 1
+		}
+		e.reaper = iscsi.processReaper()
+		executor = e
+	}
+	run := iscsi.execCommand(executor)
+	middlewares := iscsi.getMiddlewares()
+	for n := len(middlewares) - 1; n >= 0; n-- {
+		run = middlewares[n](run)
+	}
+	return iscsi.retryCommand(policy)(iscsi.logCommands(run))(ctx, exe)
+}
+
+// execCommand returns the CommandFunc running the commands with executor, at the end of the middleware chain
+func (iscsi *LinuxISCSI) execCommand(executor Executor) CommandFunc {
+	return func(ctx context.Context, exe []string) ([]byte, error) {
+		unlock := iscsi.lockMutation(exe)
+		start := time.Now()
+		out, err := executor.Output(iscsi.newCommand(ctx, exe))
+		elapsed := time.Since(start)
+		unlock()
+		out, err = iscsi.limitOutput(exe, out, err)
+		if errors.Is(err, ErrProcessKilled) {
+			iscsi.logf("\nKilled iscsiadm %s after it ran longer than %s", commandOperation(exe),
+				iscsi.getOptions()[ProcessLifetime])
+		}
+		if err == nil || errors.Is(err, ErrOutputTruncated) {
+			return out, err
+		}
+		return out, iscsi.timeoutError(ctx, exe, elapsed, classifyCommandError(ctx, err))
+	}
+}
+
+// logCommands is the middleware logging the commands
+func (iscsi *LinuxISCSI) logCommands(next CommandFunc) CommandFunc {
+	return func(ctx context.Context, exe []string) ([]byte, error) {
+		iscsi.logCommand(exe)
+		return next(ctx, exe)
+	}
+}
+
+// retryCommand returns the middleware running the commands again with policy while they fail with a retryable error
+func (iscsi *LinuxISCSI) retryCommand(policy RetryPolicy) CommandMiddleware {
+	return func(next CommandFunc) CommandFunc {
+		return func(ctx context.Context, exe []string) ([]byte, error) {
+			delay := policy.Delay
+			for attempt := 1; ; attempt++ {
+				out, err := next(ctx, exe)
+				if err == nil || attempt >= policy.Attempts || ctx.Err() != nil || !policy.retryable(err) {
+					return out, err
+				}
+				iscsi.recordRetry(commandOperation(exe), attempt, err, delay)
+				iscsi.getClock().Sleep(delay)
+				delay = policy.nextDelay(delay)
+			}
+		}
+	}
+}
+
+// record records the output of a command in raw, if not nil
+func (raw *RawOutput) record(exe []string, out []byte, err error) {
+	if raw == nil {
+		return
+	}
+	*raw = RawOutput{Command: exe, Stdout: string(out)}
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		raw.ExitCode = exitErr.ExitCode()
+		raw.Stderr = string(exitErr.Stderr)
+	default:
+		raw.ExitCode = -1
+	}
+}
+
+// classifyCommandError returns err with the category of the failure of a command run with ctx
+func classifyCommandError(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return goiscsierrors.Wrap(goiscsierrors.Timeout, err)
+	}
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+		return goiscsierrors.Wrap(goiscsierrors.NotFound, err)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if isAuthFailure(exitErr) {
+			// iscsiadm versions reporting the rejected logins with a generic exit code
+			return goiscsierrors.Wrap(goiscsierrors.Auth, err)
+		}
+		if c, ok := iscsiadmExitCategories[ExitCode(exitErr.ExitCode())]; ok {
+			return goiscsierrors.Wrap(c, err)
+		}
+	}
+	return goiscsierrors.Wrap(goiscsierrors.Internal, err)
+}
+
+// classifyFileError returns err with the category of a failed file system operation
+func classifyFileError(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return goiscsierrors.Wrap(goiscsierrors.NotFound, err)
+	}
+	return goiscsierrors.Wrap(goiscsierrors.Internal, err)
+}
+
+// filterEnvironment returns env without the variables matching exclusions
+func filterEnvironment(env []string, exclusions []string) []string {
+	filtered := make([]string, 0, len(env))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		excluded := false
+		for _, e := range exclusions {
+			if prefix, ok := strings.CutSuffix(e, "*"); ok {
+				excluded = strings.HasPrefix(name, prefix)
+			} else {
+				excluded = name == e
+			}
+			if excluded {
+				break
+			}
+		}
+		if !excluded {
+			filtered = append(filtered, kv)
+		}
+	}
+	return filtered
+}
+
+// checkIscsid returns ErrIscsidUnavailable if the CheckIscsid option is set and iscsid does not
+// accept connections on its socket
+func (iscsi *LinuxISCSI) checkIscsid() error {
+	if !optionBool(iscsi.getOptions(), CheckIscsid) {
+		return nil
+	}
+	return probeIscsid()
+}
+
+// probeIscsid returns ErrIscsidUnavailable if iscsid does not accept connections on its socket
+func probeIscsid() error {
+	conn, err := net.DialTimeout("unix", iscsidSocket, iscsidProbeTimeout)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrIscsidUnavailable, err)
+	}
+	_ = conn.Close()
+	return nil
+}
+
+// DetectHostRoot looks for the host root filesystem at the common CSI hostPath mounts
+// and configures the client to chroot into the first one providing iscsiadm and iscsid,
+// provided iscsid accepts connections on its socket. It returns the detected directory,
+// or ErrHostRootNotFound if none is usable, also wrapping ErrIscsidUnavailable if iscsid is not.
+func (iscsi *LinuxISCSI) DetectHostRoot() (string, error) {
+	for _, root := range hostRootCandidates {
+		if !hasISCSIUtilities(root) {
+			continue
+		}
+		// the socket of iscsid is abstract, the same for every root of the network namespace
+		if err := probeIscsid(); err != nil {
+			return "", fmt.Errorf("%w: %s: %w", ErrHostRootNotFound, root, err)
+		}
+		iscsi.setOption(ChrootDirectory, root)
+		return root, nil
+	}
+	return "", ErrHostRootNotFound
+}
+
+// hasISCSIUtilities checks whether iscsiadm and iscsid are installed under root
+func hasISCSIUtilities(root string) bool {
+	return findExecutable(root, "iscsiadm") && findExecutable(root, "iscsid")
+}
+
+func findExecutable(root, name string) bool {
+	for _, dir := range []string{"sbin", "usr/sbin", "bin", "usr/bin"} {
+		info, err := os.Stat(filepath.Join(root, dir, name))
+		if err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0o111 != 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // DiscoverTargets runs an iSCSI discovery and returns a list of targets.
 func (iscsi *LinuxISCSI) DiscoverTargets(address string, login bool) ([]ISCSITarget, error) {
 	return iscsi.discoverTargets(address, login)
@@ -90,22 +622,101 @@ func (iscsi *LinuxISCSI) discoverTargets(address string, login bool) ([]ISCSITar
 	// iscsiadm -m discovery -t st --portal <target>
 
 	// validate for valid address
-	err := validateIPAddress(address)
+	err := iscsi.validateIPAddress(address)
 	if err != nil {
-		fmt.Printf("\nError invalid address %s: %v", address, err)
+		iscsi.errorf("\nError invalid address %s: %v", address, err)
 		return []ISCSITarget{}, err
 	}
-	exe := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "discovery", "-t", "st", "--portal", address})
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(Timeout)*time.Second)
-	defer cancel()
+	return iscsi.runDiscovery(context.Background(), address, "st", "", login, nil, nil)
+}
 
-	cmd := exec.CommandContext(ctx, exe[0], exe[1:]...) // #nosec G204
+// DiscoverTargetsWithOptions runs an iSCSI discovery of the given type and returns a list of targets.
+func (iscsi *LinuxISCSI) DiscoverTargetsWithOptions(address string, opts DiscoveryOptions) ([]ISCSITarget, error) {
+	return iscsi.discoverWithOptions(address, opts, nil)
+}
+
+// DiscoverTargetsFromAddresses runs a discovery with opts through each address and returns the results by address
+func (iscsi *LinuxISCSI) DiscoverTargetsFromAddresses(addresses []string, opts DiscoveryOptions) (DiscoveryResults, error) {
+	return runDiscoveries(addresses, func(address string) ([]ISCSITarget, error) {
+		return iscsi.DiscoverTargetsWithOptions(address, opts)
+	})
+}
 
-	out, err := cmd.Output()
+// DiscoverTargetsRaw runs a discovery as DiscoverTargetsWithOptions and also returns the output of iscsiadm
+func (iscsi *LinuxISCSI) DiscoverTargetsRaw(address string, opts DiscoveryOptions) ([]ISCSITarget, RawOutput, error) {
+	var raw RawOutput
+	targets, err := iscsi.discoverWithOptions(address, opts, &raw)
+	return targets, raw, err
+}
+
+func (iscsi *LinuxISCSI) discoverWithOptions(address string, opts DiscoveryOptions, raw *RawOutput) ([]ISCSITarget, error) {
+	portal, err := discoveryPortal(address, opts)
+	if err != nil {
+		iscsi.errorf("\nError invalid address %s: %v", address, err)
+		return []ISCSITarget{}, err
+	}
+	if err = validateOptionalIface(opts.Iface); err != nil {
+		return []ISCSITarget{}, err
+	}
+	if err = validateDiscoveryCHAP(opts); err != nil {
+		return []ISCSITarget{}, err
+	}
+	discoveryType := "st"
+	if opts.Type == DiscoveryISNS {
+		discoveryType = "isns"
+	}
+	if err = validateCallChroot(opts.Chroot); err != nil {
+		return []ISCSITarget{}, err
+	}
+	ctx := withCallOptions(context.Background(),
+		callOptions{timeout: opts.Timeout, retryPolicy: opts.RetryPolicy, chroot: opts.Chroot})
+	return iscsi.runDiscovery(ctx, portal, discoveryType, opts.Iface, opts.Login, opts.CHAP, raw)
+}
+
+// runDiscovery runs a discovery through iface, the default iface if empty, and returns the
+// targets found with iface so that their logins go through it too. The discovery record is
+// set with the credentials of chap first, if not nil. The output of iscsiadm is recorded in
+// raw, if not nil.
+func (iscsi *LinuxISCSI) runDiscovery(ctx context.Context, address string, discoveryType string, iface string, login bool, chap *CHAPCredentials, raw *RawOutput) ([]ISCSITarget, error) {
+	endSpan := iscsi.startSpan(SpanDiscovery, map[string]string{
+		AttributePortal: address, AttributeDiscoveryType: discoveryType, AttributeIface: iface,
+	})
+	targets, err := iscsi.discover(ctx, address, discoveryType, iface, login, chap, raw)
+	endSpan(err)
+	err = iscsi.recordOperation(JournalEntry{Op: JournalOpDiscovery, Portal: address, Iface: iface}, err)
+	return targets, err
+}
+
+func (iscsi *LinuxISCSI) discover(parent context.Context, address string, discoveryType string, iface string, login bool, chap *CHAPCredentials, raw *RawOutput) ([]ISCSITarget, error) {
+	if err := iscsi.checkIscsid(); err != nil {
+		return []ISCSITarget{}, err
+	}
+	rollback, err := iscsi.startDiscoveryRollback(parent, address, discoveryType)
 	if err != nil {
-		fmt.Printf("\nError discovering %s: %v", address, err)
 		return []ISCSITarget{}, err
 	}
+	existing := iscsi.filteredNodeKeys(parent)
+	exe := iscsi.buildISCSICommand(withIface(
+		[]string{"iscsiadm", "-m", "discovery", "-t", discoveryType, "--portal", address}, iface))
+	if chap != nil {
+		// the discovery mode does not read the credentials of the discovery record, discoverydb does
+		if err = iscsi.setDiscoveryCHAP(parent, address, *chap); err != nil {
+			iscsi.errorf("\nError setting the discovery CHAP credentials of %s: %v", address, err)
+			return []ISCSITarget{}, rollback.undo(err, nil)
+		}
+		exe = iscsi.buildISCSICommand(withIface(
+			[]string{"iscsiadm", "-m", "discoverydb", "-t", discoveryType, "--portal", address, "--discover"}, iface))
+	}
+	ctx, cancel := context.WithTimeout(parent, iscsi.callTimeout(parent))
+	defer cancel()
+
+	out, err := iscsi.discoveryOutput(ctx, discoveryCacheKey{
+		portal: address, discoveryType: discoveryType, iface: iface, chap: chapFingerprint(chap)}, exe)
+	raw.record(exe, out, err)
+	if err != nil {
+		iscsi.errorf("\nError discovering %s: %v", address, err)
+		return []ISCSITarget{}, rollback.undo(err, nil)
+	}
 
 	targets := make([]ISCSITarget, 0)
 
@@ -116,28 +727,100 @@ func (iscsi *LinuxISCSI) discoverTargets(address string, login bool) ([]ISCSITar
 		tokens := strings.Split(line, " ")
 		// make sure we got two tokens
 		if len(tokens) == 2 {
-			addrtag := strings.Split(line, " ")[0]
-			tgt := strings.Split(line, " ")[1]
+			addrtag := strings.SplitN(tokens[0], ",", 2)
+			if len(addrtag) != 2 {
+				continue
+			}
+			if _, err := ParseGroupTag(addrtag[1]); err != nil {
+				iscsi.logf("\nSkipping discovered target %s at %s: %v", tokens[1], addrtag[0], err)
+				continue
+			}
 			targets = append(targets,
 				ISCSITarget{
-					Portal:   strings.Split(addrtag, ",")[0],
-					GroupTag: strings.Split(addrtag, ",")[1],
-					Target:   tgt,
+					Portal:   addrtag[0],
+					GroupTag: addrtag[1],
+					Target:   tokens[1],
+					Iface:    iface,
 				})
 		}
 	}
+	discovered := targets
+	targets, err = iscsi.filterTargets(targets)
+	if err != nil {
+		return []ISCSITarget{}, rollback.undo(err, discovered)
+	}
+	iscsi.deleteFilteredNodes(parent, discovered, targets, existing)
+	if targets, err = limitRecords(iscsi, targets, "targets"); err != nil {
+		return targets, rollback.undo(err, discovered)
+	}
+	for i := range targets {
+		targets[i].MaxSessions = iscsi.targetMaxSessions(parent, targets[i])
+	}
+
 	// log into the target if asked
 	if login {
 		for _, t := range targets {
-			_ = iscsi.PerformLogin(t)
+			err := iscsi.loginWithContext(parent, t)
+			if errors.Is(err, ErrMaxSessions) {
+				iscsi.warn(WarningMaxSessions, t, "login to %s at %s skipped: %v", t.Target, t.Portal, err)
+			} else if err != nil && rollback != nil {
+				return []ISCSITarget{}, rollback.undo(
+					&discoveryLoginError{fmt.Errorf("login to %s at %s: %w", t.Target, t.Portal, err)}, discovered)
+			}
 		}
 	}
 
 	return targets, nil
 }
 
+// filteredNodeKeys returns the keys of the node records before a discovery if the target filter is set, for
+// deleteFilteredNodes to keep them; nil if the filter is not set or the records can't be read
+func (iscsi *LinuxISCSI) filteredNodeKeys(ctx context.Context) map[string]bool {
+	opts := iscsi.getOptions()
+	if opts[TargetFilterRegex] == "" && strings.Trim(opts[TargetFilterPrefixes], ", ") == "" {
+		return nil
+	}
+	nodes, err := iscsi.getNodes(ctx)
+	if err != nil {
+		iscsi.errorf("\nError listing the node records before the discovery, keeping those of the filtered targets: %v", err)
+		return nil
+	}
+	keys := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		keys[n.Target+","+portalWithPort(n.Portal)+","+nodeIface(n)] = true
+	}
+	return keys
+}
+
+// deleteFilteredNodes deletes the node records the discovery created for the targets dropped by the target filter,
+// which could otherwise be logged into, e.g. at startup or with iscsiadm -L all. The records which existed before
+// the discovery, as listed in existing, are kept, and nothing is deleted if existing is nil.
+func (iscsi *LinuxISCSI) deleteFilteredNodes(ctx context.Context, discovered, kept []ISCSITarget, existing map[string]bool) {
+	if existing == nil {
+		return
+	}
+	for _, t := range discovered {
+		iface := t.Iface
+		if iface == "" {
+			iface = "default"
+		}
+		if slices.Contains(kept, t) || existing[t.Target+","+portalWithPort(t.Portal)+","+iface] {
+			continue
+		}
+		exe := iscsi.buildISCSICommand(
+			[]string{"iscsiadm", "-m", "node", "-T", t.Target, "-p", t.Portal, "-I", iface, "-o", "delete"})
+		if _, err := iscsi.runCommand(ctx, exe); err != nil && !isNoObjsExitCode(err) {
+			iscsi.errorf("\nError deleting the node record of the filtered target %s at %s: %v", t.Target, t.Portal, err)
+		}
+	}
+}
+
 // GetInitiators returns a list of initiators on the local system.
+// The initiator name set with SetInitiatorOverride or InitiatorNameEnv takes precedence over the file.
 func (iscsi *LinuxISCSI) GetInitiators(filename string) ([]string, error) {
+	if iqn := iscsi.getInitiatorOverride(); iqn != "" {
+		return []string{iqn}, nil
+	}
 	return iscsi.getInitiators(filename)
 }
 
@@ -147,13 +830,8 @@ func (iscsi *LinuxISCSI) getInitiators(filename string) ([]string, error) {
 	iqns := []string{}
 
 	if filename == "" {
-		// add default filename(s) here
-		// /etc/iscsi/initiatorname.iscsi is the proper file for CentOS, RedHat, Debian, Ubuntu
-		if iscsi.getChrootDirectory() != "/" {
-			initiatorConfig = append(initiatorConfig, iscsi.getChrootDirectory()+"/"+DefaultInitiatorNameFile)
-		} else {
-			initiatorConfig = append(initiatorConfig, DefaultInitiatorNameFile)
-		}
+		// /etc/iscsi/initiatorname.iscsi by default, the proper file for CentOS, RedHat, Debian, Ubuntu
+		initiatorConfig = append(initiatorConfig, iscsi.hostPath(context.Background(), iscsi.getPaths().InitiatorNameFile))
 	} else {
 		initiatorConfig = append(initiatorConfig, filename)
 	}
@@ -163,76 +841,302 @@ func (iscsi *LinuxISCSI) getInitiators(filename string) ([]string, error) {
 		// make sure the file exists
 		_, err := os.Stat(init)
 		if err != nil {
-			return []string{}, err
+			return []string{}, classifyFileError(err)
 		}
 
-		// get the contents of the initiator config file
-		cmd, err := os.ReadFile(filepath.Clean(init))
+		names, err := iscsi.readInitiatorFile(init)
 		if err != nil {
-			fmt.Printf("Error gathering initiator names: %v", err)
 			return nil, err
 		}
-		lines := strings.Split(string(cmd), "\n")
-		for _, l := range lines {
-			// remove all whitespace to catch different formatting
-			l = strings.Join(strings.Fields(l), "")
-			if strings.HasPrefix(l, "InitiatorName=") {
-				iqns = append(iqns, strings.Split(l, "=")[1])
+		iqns = append(iqns, names...)
+	}
+
+	return iqns, nil
+}
+
+// readInitiatorFile returns the initiator names defined in an initiator name file
+func (iscsi *LinuxISCSI) readInitiatorFile(filename string) ([]string, error) {
+	iqns := []string{}
+	// get the contents of the initiator config file
+	cmd, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		iscsi.errorf("\nError gathering initiator names: %v", err)
+		return nil, classifyFileError(err)
+	}
+	lines := strings.Split(strings.TrimPrefix(string(cmd), "\ufeff"), "\n")
+	for _, l := range lines {
+		// remove all whitespace, including the carriage returns of CRLF files, to catch different formatting
+		l = strings.Join(strings.Fields(l), "")
+		if iqn, ok := strings.CutPrefix(l, "InitiatorName="); ok {
+			if iqn = unquote(iqn); iqn != "" {
+				iqns = append(iqns, iqn)
 			}
 		}
 	}
-
 	return iqns, nil
 }
 
+// alternateInitiatorNameFiles are the initiator name files used by older or other distributions,
+// which may be left behind and picked up by tools next to the default file
+var alternateInitiatorNameFiles = []string{
+	"/etc/initiatorname.iscsi",
+	"/etc/open-iscsi/initiatorname.iscsi",
+}
+
+// GetAllInitiators returns the initiator names defined in the default and the alternate initiator name files
+// of the system. A WarningInitiatorConflict is reported when they define different names. The initiator name set
+// with SetInitiatorOverride or InitiatorNameEnv takes precedence over the files.
+func (iscsi *LinuxISCSI) GetAllInitiators() (InitiatorReport, error) {
+	if iqn := iscsi.getInitiatorOverride(); iqn != "" {
+		return overrideInitiatorReport(iqn), nil
+	}
+	files := []InitiatorFile{}
+	paths := iscsi.getPaths()
+	for _, name := range append([]string{paths.InitiatorNameFile}, paths.AlternateInitiatorNameFiles...) {
+		path := iscsi.hostPath(context.Background(), name)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		iqns, err := iscsi.readInitiatorFile(path)
+		if err != nil {
+			return InitiatorReport{}, err
+		}
+		files = append(files, InitiatorFile{Path: path, IQNs: iqns})
+	}
+	if len(files) == 0 {
+		return InitiatorReport{}, goiscsierrors.New(goiscsierrors.NotFound, "error no initiator name file found")
+	}
+	report := newInitiatorReport(files)
+	if report.Conflict {
+		iscsi.warn(WarningInitiatorConflict, ISCSITarget{}, "initiator names %s are defined in %d files",
+			strings.Join(report.IQNs, ", "), len(files))
+	}
+	return report, nil
+}
+
 // PerformLogin will attempt to log into an iSCSI target
 func (iscsi *LinuxISCSI) PerformLogin(target ISCSITarget) error {
-	return iscsi.performLogin(target)
+	return iscsi.PerformLoginWithOptions(target, LoginOptions{})
 }
 
-func (iscsi *LinuxISCSI) performLogin(target ISCSITarget) error {
-	// iSCSI login is done via the iscsiadm cli
-	// iscsiadm -m node -T <target> --portal <address> -l
+// PerformLoginWithOptions will attempt to log into an iSCSI target with the timeout and retry policy of opts
+func (iscsi *LinuxISCSI) PerformLoginWithOptions(target ISCSITarget, opts LoginOptions) error {
+	ctx := withCallOptions(context.Background(),
+		callOptions{timeout: opts.Timeout, retryPolicy: opts.RetryPolicy, chroot: opts.Chroot})
+	return iscsi.loginWithContext(ctx, target)
+}
 
-	err := validateIPAddress(target.Portal)
-	if err != nil {
-		fmt.Printf("\nError invalid portal address %s: %v", target.Portal, err)
+func (iscsi *LinuxISCSI) loginWithContext(ctx context.Context, target ISCSITarget) error {
+	err := iscsi.preflight(ctx, target)
+	if err == nil {
+		err = iscsi.loginTarget(ctx, target)
+	}
+	err = iscsi.recordOperation(targetJournalEntry(JournalOpLogin, target), err)
+	return err
+}
+
+func (iscsi *LinuxISCSI) loginTarget(ctx context.Context, target ISCSITarget) error {
+	if err := iscsi.checkLoginBackoff(target); err != nil {
+		return err
+	}
+	defer iscsi.lockTarget(target)()
+	if s, ok := iscsi.existingSession(target); ok {
+		if optionBool(iscsi.getOptions(), ErrorOnExistingSession) {
+			return &AlreadyLoggedInError{Target: target, SID: s.SID, GroupTag: s.GroupTag}
+		}
+		iscsi.warn(WarningSessionExists, target, "session %s to %s at %s already exists with group tag %s",
+			s.SID, target.Target, target.Portal, s.GroupTag)
+		return nil
+	}
+	if err := iscsi.checkMaxSessions(ctx, target); err != nil {
+		return err
+	}
+	if err := iscsi.checkIscsid(); err != nil {
 		return err
 	}
+	err := iscsi.performLogin(ctx, target)
+	iscsi.recordLoginResult(target, err)
+	if err == nil {
+		iscsi.checkLoginSession(target)
+	}
+	return err
+}
 
-	err = validateIQN(target.Target)
+// checkMaxSessions returns ErrMaxSessions if the EnforceMaxSessions option is set and the target
+// already has the sessions hinted by its MaxSessions or by the metadata of its node records
+func (iscsi *LinuxISCSI) checkMaxSessions(ctx context.Context, target ISCSITarget) error {
+	if !optionBool(iscsi.getOptions(), EnforceMaxSessions) {
+		return nil
+	}
+	limit := iscsi.targetMaxSessions(ctx, target)
+	if limit == 0 {
+		return nil
+	}
+	sessions, err := iscsi.readSessions()
 	if err != nil {
-		fmt.Printf("\nError invalid IQN Target %s: %v", target.Target, err)
 		return err
 	}
+	return checkSessionLimit(sessions, target, limit)
+}
 
-	exe := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "node", "-T", target.Target, "--portal", target.Portal, "-l"})
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(Timeout)*time.Second)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, exe[0], exe[1:]...) // #nosec G204
+// targetMaxSessions returns the MaxSessions of a target if set, else the hint stored with its node records
+func (iscsi *LinuxISCSI) targetMaxSessions(ctx context.Context, target ISCSITarget) int {
+	if target.MaxSessions > 0 {
+		return target.MaxSessions
+	}
+	return maxSessionsHint(readTargetMetadata(iscsi.metadataDir(ctx), target.Target)...)
+}
 
-	_, err = cmd.Output()
+// existingSession returns the session to the target at the portal, whatever its group tag, so that
+// logging in again does not create a duplicate session through another portal group
+func (iscsi *LinuxISCSI) existingSession(target ISCSITarget) (ISCSISession, bool) {
+	if target.Target == "" || target.Portal == "" {
+		return ISCSISession{}, false
+	}
+	sessions, err := iscsi.readSessions()
 	if err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			// iscsiadm exited with an exit code != 0
-			iscsiResult := -1
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				iscsiResult = status.ExitStatus()
+		return ISCSISession{}, false
+	}
+	for _, s := range sessions {
+		if s.Target == target.Target && s.matchesPortal(target.Portal) && ifaceMatches(s.IfaceName, target.Iface) {
+			return s, true
+		}
+	}
+	return ISCSISession{}, false
+}
+
+// pingInterval is the delay between the probes of Ping
+var pingInterval = time.Second
+
+// Ping probes a target count times, waiting up to timeout for each probe, and reports the round trip times.
+// The probes are TCP connections to the portal: the NOP-Out pings of software iSCSI sessions are sent by the
+// kernel, at the noop_out_interval of the node, and cannot be issued from user space. When a session to the
+// target exists, its state and the NOP-Out and NOP-In PDUs counted by the kernel while probing are reported,
+// telling apart a reachable portal from a healthy session. An error is returned when no probe is answered.
+func (iscsi *LinuxISCSI) Ping(target ISCSITarget, count int, timeout time.Duration) (PingResult, error) {
+	address, err := pingAddress(target, count, timeout)
+	if err != nil {
+		return PingResult{}, err
+	}
+	result := PingResult{Target: target}
+	session, ok := iscsi.existingSession(target)
+	var before map[string]uint64
+	if ok {
+		result.SID = session.SID
+		result.SessionState = session.ISCSISessionState
+		before, _ = iscsi.getSessionStats(session.SID)
+	}
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			iscsi.getClock().Sleep(pingInterval)
+		}
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", address, timeout)
+		if err != nil {
+			result.Lost++
+			continue
+		}
+		result.RTTs = append(result.RTTs, time.Since(start))
+		_ = conn.Close()
+	}
+	if before != nil {
+		if after, err := iscsi.getSessionStats(session.SID); err == nil {
+			result.NopOuts = after["noptx_pdus"] - before["noptx_pdus"]
+			result.NopIns = after["noprx_pdus"] - before["noprx_pdus"]
+		}
+	}
+	if result.Lost == count {
+		return result, goiscsierrors.New(goiscsierrors.Transport, fmt.Sprintf("error no reply from portal %s", address))
+	}
+	return result, nil
+}
+
+// getSessionStats returns the counters of the statistics of a session
+func (iscsi *LinuxISCSI) getSessionStats(sid string) (map[string]uint64, error) {
+	exe := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "session", "-r", sid, "-s"})
+	output, err := iscsi.runCommand(context.Background(), exe)
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]uint64)
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64); err == nil {
+			stats[key] = n
+		}
+	}
+	return stats, nil
+}
+
+// checkLoginSession warns about the sessions to a target which are not logged in after a login.
+// It relies on sysfs only, so it adds no iscsiadm call to the login.
+func (iscsi *LinuxISCSI) checkLoginSession(target ISCSITarget) {
+	sessions, err := iscsi.sysfs().readSessions()
+	if err != nil {
+		return
+	}
+	for _, s := range sessions {
+		if s.Target != target.Target || !s.matchesPortal(target.Portal) {
+			continue
+		}
+		if s.ISCSISessionState != ISCSISessionStateLOGGEDIN {
+			iscsi.warn(WarningSessionDegraded, target, "session %s to %s at %s is in state %s",
+				s.SID, target.Target, target.Portal, s.ISCSISessionState)
+		}
+		if s.Redirected() {
+			iscsi.warn(WarningPortalRedirected, target, "session %s to %s at %s was redirected to %s",
+				s.SID, target.Target, s.OriginalPortal, s.EffectivePortal)
+		}
+	}
+}
+
+func (iscsi *LinuxISCSI) performLogin(ctx context.Context, target ISCSITarget) error {
+	endSpan := iscsi.startSpan(SpanLogin, targetSpanAttributes(target))
+	err := iscsi.login(ctx, target)
+	endSpan(err)
+	return err
+}
+
+func (iscsi *LinuxISCSI) login(parent context.Context, target ISCSITarget) error {
+	// iSCSI login is done via the iscsiadm cli
+	// iscsiadm -m node -T <target> --portal <address> -l
+
+	exe := iscsi.buildISCSICommand(withIface(
+		[]string{"iscsiadm", "-m", "node", "-T", target.Target, "--portal", portalArgument(target), "-l"}, target.Iface))
+	ctx, cancel := context.WithTimeout(parent, iscsi.callTimeout(parent))
+	defer cancel()
+
+	_, err := iscsi.runCommand(ctx, exe)
+	if err != nil {
+		var exiterr *exec.ExitError
+		if errors.As(err, &exiterr) {
+			// iscsiadm exited with an exit code != 0
+			iscsiResult := -1
+			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+				iscsiResult = status.ExitStatus()
 			}
-			if iscsiResult == 15 {
+			if isIdempotentExitCode(opLogin, iscsiResult) {
 				// session already exists
 				// do not treat this as a failure
 				err = nil
+				iscsi.warn(WarningSessionExists, target, "session to %s at %s already exists", target.Target, target.Portal)
 			} else {
-				fmt.Printf("\niscsiadm login failure: %v", err)
+				iscsi.errorf("\niscsiadm login failure: %v", err)
+				if isAuthFailure(exiterr) && !iscsi.nodeHasCHAP(ctx, target) {
+					err = fmt.Errorf("%w: %s at %s: %w", ErrCHAPRequired, target.Target, target.Portal, err)
+				}
 			}
 		} else {
-			fmt.Printf("\nError logging %s at %s: %v", target.Target, target.Portal, err)
+			iscsi.errorf("\nError logging %s at %s: %v", target.Target, target.Portal, err)
 		}
 
 		if err != nil {
-			fmt.Printf("\nError logging %s at %s: %v", target.Target, target.Portal, err)
+			iscsi.errorf("\nError logging %s at %s: %v", target.Target, target.Portal, err)
+			// the node records of the target may be gone, so that the next discovery has to recreate them
+			iscsi.invalidateDiscoveries(target)
 			return err
 		}
 	}
@@ -240,50 +1144,217 @@ func (iscsi *LinuxISCSI) performLogin(target ISCSITarget) error {
 	return nil
 }
 
+// isAuthFailure reports whether a failed login was rejected by the authentication of the target,
+// either by its exit code or by the message of iscsiadm versions which exit with a generic code
+func isAuthFailure(exitErr *exec.ExitError) bool {
+	return ExitCode(exitErr.ExitCode()) == ExitAuthFailure ||
+		strings.Contains(strings.ToLower(string(exitErr.Stderr)), "authorization failure")
+}
+
+// nodeHasCHAP reports whether the node record of a target is configured for CHAP. A record
+// which can't be read is reported as configured so the login error is returned unchanged.
+func (iscsi *LinuxISCSI) nodeHasCHAP(ctx context.Context, target ISCSITarget) bool {
+	exe := iscsi.buildISCSICommand(withIface(
+		[]string{"iscsiadm", "-m", "node", "-T", target.Target, "-p", target.Portal, "-o", "show"}, target.Iface))
+	output, err := iscsi.runCommand(ctx, exe)
+	if err != nil {
+		return true
+	}
+	for _, n := range iscsi.nodeParser.Parse(output) {
+		if !strings.EqualFold(n.Fields["node.session.auth.authmethod"], "CHAP") ||
+			replaceEmpty(n.Fields["node.session.auth.username"]) == "" {
+			return false
+		}
+	}
+	return true
+}
+
 // PerformLogout will attempt to log out of an iSCSI target
 func (iscsi *LinuxISCSI) PerformLogout(target ISCSITarget) error {
-	return iscsi.performLogout(target)
+	return iscsi.PerformLogoutWithOptions(target, LogoutOptions{})
 }
 
-func (iscsi *LinuxISCSI) performLogout(target ISCSITarget) error {
-	// iSCSI login is done via the iscsiadm cli
-	// iscsiadm -m node -T <target> --portal <address> -l
-	err := validateIPAddress(target.Portal)
+// PerformLogoutWithOptions will attempt to log out of an iSCSI target
+func (iscsi *LinuxISCSI) PerformLogoutWithOptions(target ISCSITarget, opts LogoutOptions) error {
+	ctx := withCallOptions(context.Background(), callOptions{chroot: opts.Chroot})
+	err := iscsi.preflight(ctx, target)
+	if err == nil {
+		err = iscsi.logoutTarget(ctx, target, opts)
+	}
+	err = iscsi.recordOperation(targetJournalEntry(JournalOpLogout, target), err)
+	return err
+}
+
+func (iscsi *LinuxISCSI) logoutTarget(ctx context.Context, target ISCSITarget, opts LogoutOptions) error {
+	defer iscsi.lockTarget(target)()
+	if err := iscsi.checkIscsid(); err != nil {
+		return err
+	}
+	if !opts.Force {
+		if err := iscsi.checkFlashSession(target); err != nil {
+			return err
+		}
+		err := iscsi.checkBootSession(func(s ISCSISession) bool {
+			return s.Target == target.Target && s.matchesPortal(target.Portal) && ifaceMatches(s.IfaceName, target.Iface)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if !opts.Force && optionBool(iscsi.getOptions(), ProtectLastPath) {
+		if err := iscsi.checkLastPath(target); err != nil {
+			return err
+		}
+	}
+	if opts.Flush {
+		if err := iscsi.flushTargetDevices(target, opts.FlushTimeout); err != nil {
+			return err
+		}
+	}
+	return iscsi.performLogout(ctx, target)
+}
+
+// checkFlashSession returns ErrFlashSession if a session to the target is managed in flash: the adapter
+// would log in again from its flash, or the logout would drop a boot path. It relies on sysfs only, so it
+// adds no iscsiadm call to the logout.
+func (iscsi *LinuxISCSI) checkFlashSession(target ISCSITarget) error {
+	sessions, err := iscsi.sysfs().readSessions()
 	if err != nil {
-		fmt.Printf("\nError invalid portal address %s: %v", target.Portal, err)
+		return nil
+	}
+	for _, s := range sessions {
+		if s.SessionSource == ISCSISessionSourceFlash && s.Target == target.Target &&
+			s.matchesPortal(target.Portal) && ifaceMatches(s.IfaceName, target.Iface) {
+			return fmt.Errorf("%w: session %s to %s at %s", ErrFlashSession, s.SID, s.Target, s.Portal)
+		}
+	}
+	return nil
+}
+
+// LogoutSessionBySID will attempt to log out of the session with the given SID.
+// Unlike PerformLogout, it does not need the node record of the session. It returns ErrBootSession
+// rather than log out of a session to a boot target of the iBFT.
+func (iscsi *LinuxISCSI) LogoutSessionBySID(sid string) error {
+	err := iscsi.logoutSession(context.Background(), sid)
+	err = iscsi.recordOperation(JournalEntry{Op: JournalOpLogout, SID: sid}, err)
+	return err
+}
+
+// UpdateLiveSessionParam changes a node parameter of a live session through sysfs, for the parameters listed by
+// LiveSessionParams: the recovery timeout of the session or the queue depth of each of its LUNs
+func (iscsi *LinuxISCSI) UpdateLiveSessionParam(sid, param, value string) error {
+	p, err := validateLiveSessionParam(sid, param, value)
+	if err == nil {
+		err = iscsi.sysfs().updateLiveSessionParam(sid, p, value)
+	}
+	if err != nil {
+		iscsi.errorf("\nError updating %s of session %s: %v", param, sid, err)
+	}
+	err = iscsi.recordOperation(JournalEntry{Op: JournalOpUpdateSessionParam, SID: sid}, err)
+	return err
+}
+
+func (iscsi *LinuxISCSI) logoutSession(ctx context.Context, sid string) error {
+	if err := validateSID(sid); err != nil {
+		iscsi.errorf("\nError invalid session SID %s: %v", sid, err)
+		return err
+	}
+	if err := iscsi.checkBootSession(func(s ISCSISession) bool { return s.SID == sid }); err != nil {
+		return err
+	}
+	if err := iscsi.checkIscsid(); err != nil {
+		return err
+	}
+	exe := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "session", "-r", sid, "-u"})
+	if _, err := iscsi.runCommand(ctx, exe); err != nil {
+		iscsi.errorf("Error logging out of session %s: %v", sid, err)
 		return err
 	}
+	return nil
+}
 
-	err = validateIQN(target.Target)
+// checkLastPath returns a LastPathError if logging out of the target removes
+// the last active path of a multipath device in use
+func (iscsi *LinuxISCSI) checkLastPath(target ISCSITarget) error {
+	sessions, err := iscsi.readSessions()
 	if err != nil {
-		fmt.Printf("\nError invalid IQN Target %s: %v", target.Target, err)
 		return err
 	}
+	tree := iscsi.sysfs()
+	leaving := make(map[string]bool)
+	for _, s := range sessions {
+		if s.Target == target.Target && s.matchesPortal(target.Portal) {
+			for _, d := range tree.sessionBlockDevices(s.SID) {
+				leaving[d] = true
+			}
+		}
+	}
+	if mpath := lastPathDevice(tree, leaving); mpath != "" {
+		return &LastPathError{Target: target, Device: mpath}
+	}
+	return nil
+}
 
-	exe := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "node", "-T", target.Target, "--portal", target.Portal, "--logout"})
-	cmd := exec.Command(exe[0], exe[1:]...) // #nosec G204
+// lastPathDevice returns a multipath device in use whose active paths are all among the leaving block devices,
+// empty if there is none
+func lastPathDevice(tree sysfsTree, leaving map[string]bool) string {
+	for d := range leaving {
+		for _, mpath := range tree.multipathHolders(d) {
+			remaining := 0
+			for _, p := range tree.multipathActivePaths(mpath) {
+				if !leaving[p] {
+					remaining++
+				}
+			}
+			if remaining == 0 && multipathInUse(tree, mpath) {
+				return mpath
+			}
+		}
+	}
+	return ""
+}
+
+func multipathInUse(tree sysfsTree, dm string) bool {
+	return tree.hasHolders(dm) || deviceBusy(filepath.Join(tree.dev, dm))
+}
 
-	_, err = cmd.Output()
+// deviceBusy checks if a block device is in use, e.g. mounted, by opening it exclusively
+var deviceBusy = func(path string) bool {
+	fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_EXCL, 0)
+	if err != nil {
+		return err == syscall.EBUSY
+	}
+	_ = syscall.Close(fd)
+	return false
+}
+
+func (iscsi *LinuxISCSI) performLogout(ctx context.Context, target ISCSITarget) error {
+	// iSCSI login is done via the iscsiadm cli
+	// iscsiadm -m node -T <target> --portal <address> -l
+	exe := iscsi.buildISCSICommand(withIface(
+		[]string{"iscsiadm", "-m", "node", "-T", target.Target, "--portal", portalArgument(target), "--logout"}, target.Iface))
+	_, err := iscsi.runCommand(ctx, exe)
 	if err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
+		var exiterr *exec.ExitError
+		if errors.As(err, &exiterr) {
 			// iscsiadm exited with an exit code != 0
 			iscsiResult := -1
 			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
 				iscsiResult = status.ExitStatus()
 			}
-			if iscsiResult == 15 {
-				// session already exists
+			if isIdempotentExitCode(opLogout, iscsiResult) {
+				// no session to log out of
 				// do not treat this as a failure
 				err = nil
 			} else {
-				fmt.Printf("iscsiadm login failure: %v", err)
+				iscsi.errorf("iscsiadm logout failure: %v", err)
 			}
 		} else {
-			fmt.Printf("Error logging %s at %s: %v", target.Target, target.Portal, err)
+			iscsi.errorf("Error logging %s at %s: %v", target.Target, target.Portal, err)
 		}
 
 		if err != nil {
-			fmt.Printf("Error logging %s at %s: %v", target.Target, target.Portal, err)
+			iscsi.errorf("Error logging %s at %s: %v", target.Target, target.Portal, err)
 			return err
 		}
 	}
@@ -293,46 +1364,200 @@ func (iscsi *LinuxISCSI) performLogout(target ISCSITarget) error {
 
 // PerformRescan will rescan targets known to current sessions
 func (iscsi *LinuxISCSI) PerformRescan() error {
-	return iscsi.performRescan()
+	endSpan := iscsi.startSpan(SpanRescan, map[string]string{})
+	err := iscsi.performRescan()
+	endSpan(err)
+	err = iscsi.recordOperation(JournalEntry{Op: JournalOpRescan}, err)
+	return err
 }
 
 func (iscsi *LinuxISCSI) performRescan() error {
+	if err := iscsi.checkIscsid(); err != nil {
+		return err
+	}
 	exe := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "node", "--rescan"})
-	cmd := exec.Command(exe[0], exe[1:]...) // #nosec G204
-
-	_, err := cmd.Output()
+	_, err := iscsi.runCommand(context.Background(), exe)
 	if err != nil {
 		return err
 	}
+	if optionBool(iscsi.getOptions(), ScanSCSIHosts) {
+		return iscsi.sysfs().scanSessionHosts()
+	}
 	return nil
 }
 
 // GetSessions will query information about sessions
 func (iscsi *LinuxISCSI) GetSessions() ([]ISCSISession, error) {
-	exe := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "session", "-P", "2", "-S"})
-	cmd := exec.Command(exe[0], exe[1:]...) // #nosec G204
-	output, err := cmd.Output()
+	return cachedRead(iscsi, cacheSessions, "", iscsi.readSessions, slices.Clone[[]ISCSISession])
+}
+
+// readSessions returns the sessions as GetSessions, without the cache, for the operations deciding on them
+func (iscsi *LinuxISCSI) readSessions() ([]ISCSISession, error) {
+	sessions, err := iscsi.getSessions()
+	iscsi.sysfs().markBootSessions(sessions)
+	return sessions, err
+}
+
+func (iscsi *LinuxISCSI) getSessions() ([]ISCSISession, error) {
+	source := iscsi.getOptions()[SessionSource]
+	tree := iscsi.sysfs()
+	if source != "iscsiadm" {
+		sessions, err := tree.readSessions()
+		if err == nil {
+			return limitRecords(iscsi, sessions, "sessions")
+		}
+		if source == "sysfs" {
+			return sessions, err
+		}
+	}
+	return iscsi.iscsiadmSessions(nil, "")
+}
+
+// GetSessionsRaw queries the sessions with iscsiadm, whatever the SessionSource option, and returns
+// them with the output of iscsiadm
+func (iscsi *LinuxISCSI) GetSessionsRaw() ([]ISCSISession, RawOutput, error) {
+	var raw RawOutput
+	sessions, err := iscsi.iscsiadmSessions(&raw, "")
+	return sessions, raw, err
+}
+
+// iscsiadmSessions queries the sessions with iscsiadm, only the session sid if not empty, recording its output
+// in raw if not nil
+func (iscsi *LinuxISCSI) iscsiadmSessions(raw *RawOutput, sid string) ([]ISCSISession, error) {
+	tree := iscsi.sysfs()
+	level := "2"
+	slowPath := iscsi.inSlowPath()
+	if slowPath {
+		level = "1"
+	}
+	args := []string{"iscsiadm", "-m", "session"}
+	if sid != "" {
+		args = append(args, "-r", sid)
+	}
+	exe := iscsi.buildISCSICommand(append(args, "-P", level, "-S"))
+	start := time.Now()
+	output, err := iscsi.runCommand(context.Background(), exe)
+	raw.record(exe, output, err)
+	if !slowPath {
+		iscsi.checkSlowPath(time.Since(start))
+	}
 	if err != nil {
-		if isNoObjsExitCode(err) {
+		if code, ok := ExitCodeFromError(err); ok && (code == ExitNoObjectsFound || code == ExitSessionNotFound) {
 			return []ISCSISession{}, nil
 		}
 		return []ISCSISession{}, err
 	}
-	return iscsi.sessionParser.Parse(output), nil
+	sessions, err := limitRecords(iscsi, iscsi.sessionParser.Parse(output), "sessions")
+	for i := range sessions {
+		if slowPath {
+			// level 1 does not print the CHAP settings
+			tree.readSessionAuth(&sessions[i])
+		}
+	}
+	return sessions, err
+}
+
+// inSlowPath reports whether the session query uses the cheaper print level after being slow
+func (iscsi *LinuxISCSI) inSlowPath() bool {
+	iscsi.slowPathMu.Lock()
+	defer iscsi.slowPathMu.Unlock()
+	return time.Now().Before(iscsi.slowPathUntil)
+}
+
+// checkSlowPath switches the session query to the cheaper print level for slowPathRecheckInterval
+// if it took longer than the SlowSessionThreshold option
+func (iscsi *LinuxISCSI) checkSlowPath(elapsed time.Duration) {
+	threshold, _ := time.ParseDuration(iscsi.getOptions()[SlowSessionThreshold])
+	if threshold <= 0 || elapsed <= threshold {
+		return
+	}
+	iscsi.slowPathMu.Lock()
+	iscsi.slowPathUntil = time.Now().Add(slowPathRecheckInterval)
+	iscsi.slowPathMu.Unlock()
+	iscsi.warn(WarningSlowPath, ISCSITarget{}, "session query took %s, above the %s threshold; using print level 1 for %s",
+		elapsed.Round(time.Millisecond), threshold, slowPathRecheckInterval)
 }
 
 // GetNodes will query information about nodes
 func (iscsi *LinuxISCSI) GetNodes() ([]ISCSINode, error) {
+	return cachedRead(iscsi, cacheNodes, "", iscsi.readNodes, cloneNodes)
+}
+
+// readNodes returns the node records as GetNodes, without the cache
+func (iscsi *LinuxISCSI) readNodes() ([]ISCSINode, error) {
+	nodes, err := iscsi.getNodes(context.Background())
+	if err != nil {
+		return nodes, err
+	}
+	return iscsi.addNodeMetadata(nodes)
+}
+
+// GetNodesRaw queries the node records with iscsiadm, whatever the NodeSource option, and returns
+// them with the output of iscsiadm
+func (iscsi *LinuxISCSI) GetNodesRaw() ([]ISCSINode, RawOutput, error) {
+	var raw RawOutput
+	nodes, err := iscsi.iscsiadmNodes(context.Background(), &raw)
+	if err != nil {
+		return nodes, raw, err
+	}
+	nodes, err = iscsi.addNodeMetadata(nodes)
+	return nodes, raw, err
+}
+
+// addNodeMetadata adds the metadata stored with the node records to their fields
+func (iscsi *LinuxISCSI) addNodeMetadata(nodes []ISCSINode) ([]ISCSINode, error) {
+	for _, n := range nodes {
+		portal := n.Portal
+		if address := n.Fields["node.conn[0].address"]; address != "" {
+			port, _ := strconv.Atoi(n.Fields["node.conn[0].port"])
+			portal = JoinPortal(address, port)
+		}
+		path, err := nodeMetadataPath(iscsi.metadataDir(context.Background()), n.Target, portal)
+		if err != nil {
+			continue
+		}
+		metadata, err := readNodeMetadata(path)
+		if err != nil {
+			return []ISCSINode{}, err
+		}
+		for k, v := range metadata {
+			n.Fields[NodeMetadataPrefix+k] = v
+		}
+	}
+	return nodes, nil
+}
+
+// getNodes returns the node records of the chroot of the operation of ctx, from the source of the NodeSource option
+func (iscsi *LinuxISCSI) getNodes(ctx context.Context) ([]ISCSINode, error) {
+	source := iscsi.getOptions()[NodeSource]
+	if source == "db" || source == "auto" {
+		var nodes []ISCSINode
+		err := iscsi.hostLocked(ctx, func() (err error) {
+			nodes, err = readNodeDB(iscsi.callChroot(ctx), iscsi.getPaths().NodeDBDirs)
+			return err
+		})
+		if err == nil {
+			return limitRecords(iscsi, nodes, "node records")
+		}
+		if source == "db" {
+			return nodes, err
+		}
+	}
+	return iscsi.iscsiadmNodes(ctx, nil)
+}
+
+// iscsiadmNodes queries the node records with iscsiadm, recording its output in raw if not nil
+func (iscsi *LinuxISCSI) iscsiadmNodes(ctx context.Context, raw *RawOutput) ([]ISCSINode, error) {
 	exe := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "node", "-o", "show"})
-	cmd := exec.Command(exe[0], exe[1:]...) // #nosec G204
-	output, err := cmd.Output()
+	output, err := iscsi.runCommand(ctx, exe)
+	raw.record(exe, output, err)
 	if err != nil {
 		if isNoObjsExitCode(err) {
 			return []ISCSINode{}, nil
 		}
 		return []ISCSINode{}, err
 	}
-	return iscsi.nodeParser.Parse(output), nil
+	return limitRecords(iscsi, iscsi.nodeParser.Parse(output), "node records")
 }
 
 // SetCHAPCredentials will set CHAP credentials
@@ -341,44 +1566,82 @@ func (iscsi *LinuxISCSI) SetCHAPCredentials(target ISCSITarget, username, passwo
 	options["node.session.auth.authmethod"] = "CHAP"
 	options["node.session.auth.username"] = username
 	options["node.session.auth.password"] = password
-	return iscsi.CreateOrUpdateNode(target, options)
+	err := iscsi.createOrUpdateNode(target, options)
+	err = iscsi.recordOperation(targetJournalEntry(JournalOpSetCHAP, target), err)
+	return err
 }
 
 // CreateOrUpdateNode creates new or update existing iSCSI node in iscsid dm
 func (iscsi *LinuxISCSI) CreateOrUpdateNode(target ISCSITarget, options map[string]string) error {
-	err := validateIPAddress(target.Portal)
+	err := iscsi.createOrUpdateNode(target, options)
+	err = iscsi.recordOperation(targetJournalEntry(JournalOpCreateOrUpdateNode, target), err)
+	return err
+}
+
+func (iscsi *LinuxISCSI) createOrUpdateNode(target ISCSITarget, options map[string]string) error {
+	err := iscsi.preflight(context.Background(), target)
 	if err != nil {
-		fmt.Printf("\nError invalid portal address %s: %v", target.Portal, err)
 		return err
 	}
-
-	err = validateIQN(target.Target)
-	if err != nil {
-		fmt.Printf("\nError invalid IQN Target %s: %v", target.Target, err)
+	options, metadata := splitNodeMetadata(options)
+	if err = validateNodeMetadata(metadata); err != nil {
 		return err
 	}
-	baseCmd := iscsi.buildISCSICommand(
-		[]string{"iscsiadm", "-m", "node", "-p", target.Portal, "-T", target.Target})
-
-	var commands [][]string
+	if err = iscsi.checkIscsid(); err != nil {
+		return err
+	}
+	defer iscsi.lockTarget(target)()
+	nodeCmd := []string{"iscsiadm", "-m", "node", "-p", target.Portal, "-T", target.Target}
+	if target.Iface != "" {
+		nodeCmd = append(nodeCmd, "-I", target.Iface)
+	}
+	baseCmd := iscsi.buildISCSICommand(nodeCmd)
 
-	cmd := exec.Command(baseCmd[0], baseCmd[1:]...) // #nosec G204
-	_, err = cmd.Output()
+	_, err = iscsi.runCommand(context.Background(), baseCmd)
 	if err != nil {
 		if !isNoObjsExitCode(err) {
 			return err
 		}
 		c := append(append([]string{}, baseCmd...), "-o", "new")
-		commands = append(commands, c)
+		_, err = iscsi.runCommand(context.Background(), c)
+		var exitErr *exec.ExitError
+		if err != nil && !(errors.As(err, &exitErr) && isIdempotentExitCode(opCreateNode, exitErr.ExitCode())) {
+			return err
+		}
 	}
 
-	for k, v := range options {
-		c := append(append([]string{}, baseCmd...), "-o", "update", "-n", k, "-v", v)
-		commands = append(commands, c)
+	if err = iscsi.updateNode(context.Background(), baseCmd, options); err != nil {
+		return err
 	}
-	for _, command := range commands {
-		cmd := exec.Command(command[0], command[1:]...) // #nosec G204
-		_, err := cmd.Output()
+	if metadata != nil {
+		path, err := nodeMetadataPath(iscsi.metadataDir(context.Background()), target.Target, target.Portal)
+		if err != nil {
+			return err
+		}
+		return iscsi.hostLocked(context.Background(), func() error { return updateNodeMetadata(path, metadata) })
+	}
+	return nil
+}
+
+// updateNode sets the parameters of the node record selected by baseCmd, one iscsiadm update per parameter,
+// or per batch of parameters with the BatchNodeUpdates option
+func (iscsi *LinuxISCSI) updateNode(ctx context.Context, baseCmd []string, options map[string]string) error {
+	batchSize := 1
+	if optionBool(iscsi.getOptions(), BatchNodeUpdates) {
+		batchSize = nodeUpdateBatchSize
+	}
+	for batch := range slices.Chunk(slices.Sorted(maps.Keys(options)), batchSize) {
+		err := iscsi.runNodeUpdate(ctx, baseCmd, options, batch)
+		var exitErr *exec.ExitError
+		if err != nil && len(batch) > 1 && errors.As(err, &exitErr) && ExitCode(exitErr.ExitCode()) == ExitInvalidArgument {
+			// this iscsiadm takes a single parameter per update
+			for _, k := range batch {
+				if err = iscsi.runNodeUpdate(ctx, baseCmd, options, []string{k}); err != nil {
+					return err
+				}
+			}
+			continue
+		}
 		if err != nil {
 			return err
 		}
@@ -386,37 +1649,498 @@ func (iscsi *LinuxISCSI) CreateOrUpdateNode(target ISCSITarget, options map[stri
 	return nil
 }
 
+// runNodeUpdate sets the given keys of options in a single iscsiadm update
+func (iscsi *LinuxISCSI) runNodeUpdate(ctx context.Context, baseCmd []string, options map[string]string, keys []string) error {
+	c := append(append([]string{}, baseCmd...), "-o", "update")
+	for _, k := range keys {
+		c = append(c, "-n", k, "-v", options[k])
+	}
+	_, err := iscsi.runCommand(ctx, c)
+	return err
+}
+
 // DeleteNode delete iSCSI node from iscsid database
 func (iscsi *LinuxISCSI) DeleteNode(target ISCSITarget) error {
-	err := validateIPAddress(target.Portal)
+	err := iscsi.deleteNode(context.Background(), target)
+	err = iscsi.recordOperation(targetJournalEntry(JournalOpDeleteNode, target), err)
+	return err
+}
+
+func (iscsi *LinuxISCSI) deleteNode(ctx context.Context, target ISCSITarget) error {
+	err := iscsi.preflight(ctx, target)
 	if err != nil {
-		fmt.Printf("\nError invalid portal address %s: %v", target.Portal, err)
 		return err
 	}
+	if err = iscsi.checkIscsid(); err != nil {
+		return err
+	}
+	defer iscsi.lockTarget(target)()
+	exe := iscsi.buildISCSICommand(withIface(
+		[]string{"iscsiadm", "-m", "node", "-p", target.Portal, "-T", target.Target, "-o", "delete"}, target.Iface))
+	_, err = iscsi.runCommand(ctx, exe)
+	iscsi.invalidateDiscoveries(target)
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && isIdempotentExitCode(opDeleteNode, exitErr.ExitCode())) {
+		return err
+	}
+	path, err := nodeMetadataPath(iscsi.metadataDir(ctx), target.Target, target.Portal)
+	if err != nil {
+		return err
+	}
+	return iscsi.hostLocked(ctx, func() error { return removeNodeMetadata(path) })
+}
+
+// AddPathToTarget creates a node record for a new portal of a target, copying the settings of an existing record, and logs in
+func (iscsi *LinuxISCSI) AddPathToTarget(iqn string, newPortal string, iface string) error {
+	err := iscsi.addPathToTarget(iqn, newPortal, iface)
+	err = iscsi.recordOperation(JournalEntry{Op: JournalOpAddPath, Target: iqn, Portal: newPortal, Iface: iface}, err)
+	return err
+}
 
-	err = validateIQN(target.Target)
+func (iscsi *LinuxISCSI) addPathToTarget(iqn string, newPortal string, iface string) error {
+	target := ISCSITarget{Portal: newPortal, Target: iqn, Iface: iface}
+	if err := iscsi.preflight(context.Background(), target); err != nil {
+		return err
+	}
+	nodes, err := iscsi.readNodes()
 	if err != nil {
-		fmt.Printf("\nError invalid IQN Target %s: %v", target.Target, err)
 		return err
 	}
-	exe := iscsi.buildISCSICommand(
-		[]string{"iscsiadm", "-m", "node", "-p", target.Portal, "-T", target.Target, "-o", "delete"})
-	cmd := exec.Command(exe[0], exe[1:]...) // #nosec G204
-	_, err = cmd.Output()
+	var source *ISCSINode
+	for i, n := range nodes {
+		if n.Target != iqn {
+			continue
+		}
+		// prefer a record using the same iface
+		if source == nil || n.Fields["iface.iscsi_ifacename"] == iface {
+			source = &nodes[i]
+		}
+	}
+	if source == nil {
+		return fmt.Errorf("%w: %s", ErrNodeNotFound, iqn)
+	}
+	fields, err := iscsi.revealNodeFields(*source)
 	if err != nil {
-		if isNoObjsExitCode(err) {
-			return nil
+		return err
+	}
+	err = iscsi.createOrUpdateNode(target, clonableNodeFields(fields))
+	if err != nil {
+		return err
+	}
+	return iscsi.PerformLogin(target)
+}
+
+// revealNodeFields reads the fields of a node record with its CHAP secrets, which the node listing masks
+func (iscsi *LinuxISCSI) revealNodeFields(node ISCSINode) (map[string]string, error) {
+	exe := iscsi.buildISCSICommand(withIface(
+		[]string{"iscsiadm", "-m", "node", "-T", node.Target, "-p", node.Portal, "-o", "show", "-S"},
+		node.Fields["iface.iscsi_ifacename"]))
+	output, err := iscsi.runCommand(context.Background(), exe)
+	if isNoObjsExitCode(err) {
+		return nil, fmt.Errorf("%w: %s at %s", ErrNodeNotFound, node.Target, node.Portal)
+	}
+	if err != nil {
+		return nil, err
+	}
+	nodes := iscsi.nodeParser.Parse(output)
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("%w: %s at %s", ErrNodeNotFound, node.Target, node.Portal)
+	}
+	return nodes[0].Fields, nil
+}
+
+// AuditConsistency compares the node records with the active sessions and reports their drift
+func (iscsi *LinuxISCSI) AuditConsistency() ([]ConsistencyFinding, error) {
+	nodes, err := iscsi.GetNodes()
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := iscsi.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+	if nodes, err = iscsi.revealCHAPSecrets(nodes, sessions); err != nil {
+		return nil, err
+	}
+	return auditConsistency(nodes, sessions), nil
+}
+
+// revealCHAPSecrets returns the node records with the CHAP secrets, masked in the listed records, of those having a
+// session with their CHAP user read revealed, for their sessions to be checked for other secrets
+func (iscsi *LinuxISCSI) revealCHAPSecrets(nodes []ISCSINode, sessions []ISCSISession) ([]ISCSINode, error) {
+	for i, n := range nodes {
+		user := replaceEmpty(n.Fields["node.session.auth.username"])
+		masked := slices.ContainsFunc(chapSecretFields, func(k string) bool { return n.Fields[k] == maskedSecret })
+		chapSession := slices.ContainsFunc(sessions, func(s ISCSISession) bool { return nodeSession(n, s) && s.Username == user })
+		if user == "" || !masked || !chapSession {
+			continue
+		}
+		fields, err := iscsi.revealNodeFields(n)
+		if errors.Is(err, ErrNodeNotFound) {
+			// deleted since listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		n.Fields = maps.Clone(n.Fields)
+		for _, k := range chapSecretFields {
+			n.Fields[k] = fields[k]
+		}
+		nodes[i] = n
+	}
+	return nodes, nil
+}
+
+// AuditTargetSource compares the targets expected by source with the node records and the active sessions
+func (iscsi *LinuxISCSI) AuditTargetSource(source TargetSource) ([]ConsistencyFinding, error) {
+	return auditTargetSourceOf(iscsi, source)
+}
+
+// GetIfaceSessionCounts returns the number of sessions using each iSCSI iface
+func (iscsi *LinuxISCSI) GetIfaceSessionCounts() ([]IfaceSessionCount, error) {
+	sessions, err := iscsi.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+	return countIfaceSessions(sessions), nil
+}
+
+// GetSessionsByIface returns the sessions established through an iSCSI iface
+func (iscsi *LinuxISCSI) GetSessionsByIface(iface string) ([]ISCSISession, error) {
+	if err := validateIfaceName(iface); err != nil {
+		return nil, err
+	}
+	sessions, err := iscsi.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+	return filterSessionsByIface(sessions, iface), nil
+}
+
+// GetIfaceParameters returns the iface.* parameters of an iSCSI iface
+func (iscsi *LinuxISCSI) GetIfaceParameters(iface string) (map[string]string, error) {
+	if err := validateIfaceName(iface); err != nil {
+		return nil, err
+	}
+	return cachedRead(iscsi, cacheIfaces, iface, func() (map[string]string, error) {
+		return iscsi.readIfaceParameters(iface)
+	}, maps.Clone[map[string]string])
+}
+
+// readIfaceParameters returns the iface.* parameters of an iSCSI iface, without the cache
+func (iscsi *LinuxISCSI) readIfaceParameters(iface string) (map[string]string, error) {
+	exe := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "iface", "-I", iface, "-o", "show"})
+	output, err := iscsi.runCommand(context.Background(), exe)
+	if err != nil {
+		return nil, err
+	}
+	params := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "iface.") {
+			key, value := nodeFieldKeyValue(line)
+			params[key] = value
 		}
+	}
+	return params, nil
+}
+
+// SetIfaceParameters creates or updates the iface.* parameters of an iSCSI iface
+func (iscsi *LinuxISCSI) SetIfaceParameters(iface string, params map[string]string) error {
+	err := iscsi.setIfaceParameters(iface, params)
+	err = iscsi.recordOperation(JournalEntry{Op: JournalOpSetIface, Iface: iface}, err)
+	return err
+}
+
+func (iscsi *LinuxISCSI) setIfaceParameters(iface string, params map[string]string) error {
+	if err := validateIfaceName(iface); err != nil {
 		return err
 	}
+	if err := validateIfaceParameters(params); err != nil {
+		return err
+	}
+	if err := iscsi.checkIscsid(); err != nil {
+		return err
+	}
+	baseCmd := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "iface", "-I", iface})
+
+	var commands [][]string
+	_, err := iscsi.runCommand(context.Background(), append(append([]string{}, baseCmd...), "-o", "show"))
+	if err != nil {
+		if !isNoObjsExitCode(err) {
+			return err
+		}
+		commands = append(commands, append(append([]string{}, baseCmd...), "-o", "new"))
+	}
+	for _, command := range commands {
+		if _, err := iscsi.runCommand(context.Background(), command); err != nil {
+			return err
+		}
+	}
+	return iscsi.updateIface(baseCmd, params)
+}
+
+// updateIface sets the parameters of the iface selected by baseCmd, in the order of their names
+func (iscsi *LinuxISCSI) updateIface(baseCmd []string, params map[string]string) error {
+	for _, k := range slices.Sorted(maps.Keys(params)) {
+		command := append(slices.Clone(baseCmd), "-o", "update", "-n", k, "-v", params[k])
+		if _, err := iscsi.runCommand(context.Background(), command); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func isNoObjsExitCode(err error) bool {
+// ExportNodes returns a snapshot of the iSCSI node records, including their CHAP secrets
+func (iscsi *LinuxISCSI) ExportNodes(opts SnapshotOptions) (*NodeSnapshot, error) {
+	// -S reveals the CHAP secrets iscsiadm otherwise masks
+	exe := iscsi.buildISCSICommand([]string{"iscsiadm", "-m", "node", "-o", "show", "-S"})
+	output, err := iscsi.runCommand(context.Background(), exe)
+	if err != nil && !isNoObjsExitCode(err) {
+		return nil, err
+	}
+	return newNodeSnapshot(iscsi.nodeParser.Parse(output), opts)
+}
+
+// ImportNodes creates or updates the iSCSI node records of a snapshot
+func (iscsi *LinuxISCSI) ImportNodes(snapshot *NodeSnapshot, opts SnapshotOptions) (NodeOpResults, error) {
+	return importNodeSnapshot(snapshot, opts, iscsi.CreateOrUpdateNode)
+}
+
+// DeleteNodes delete many iSCSI nodes from iscsid database
+func (iscsi *LinuxISCSI) DeleteNodes(targets []ISCSITarget) (NodeOpResults, error) {
+	return runNodeOps(targets, iscsi.DeleteNode)
+}
+
+// RescanAndVerifyLUN scans for a LUN on the sessions to a target and waits for its block device
+func (iscsi *LinuxISCSI) RescanAndVerifyLUN(target ISCSITarget, lun int, timeout time.Duration) (string, error) {
+	attributes := targetSpanAttributes(target)
+	attributes[AttributeLUN] = strconv.Itoa(lun)
+	endSpan := iscsi.startSpan(SpanWaitLUN, attributes)
+	device, err := iscsi.rescanAndVerifyLUN(target, lun, timeout)
+	endSpan(err)
+	return device, err
+}
+
+func (iscsi *LinuxISCSI) rescanAndVerifyLUN(target ISCSITarget, lun int, timeout time.Duration) (string, error) {
+	sessions, err := iscsi.readSessions()
 	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			return exitError.ExitCode() == iSCSINoObjsFoundExitCode
+		return "", err
+	}
+	var sids []string
+	for _, s := range sessions {
+		if s.Target == target.Target && s.matchesPortal(target.Portal) {
+			sids = append(sids, s.SID)
 		}
 	}
-	return false
+	if len(sids) == 0 {
+		return "", fmt.Errorf("%w: no session to %s at %s", ErrLUNNotVisible, target.Target, target.Portal)
+	}
+	// a session whose host can't be scanned is skipped as long as another one can be
+	tree := iscsi.sysfs()
+	var scanned []string
+	skipped := make(map[string]error)
+	for _, sid := range sids {
+		if err := tree.scanHostLUN(sid, lun); err != nil {
+			skipped[sid] = err
+			continue
+		}
+		scanned = append(scanned, sid)
+	}
+	if len(scanned) == 0 {
+		return "", skipped[sids[0]]
+	}
+	for sid, err := range skipped {
+		iscsi.warn(WarningHostSkipped, target, "rescan of session %s skipped: %v", sid, err)
+	}
+	sids = scanned
+
+	clock := iscsi.getClock()
+	deadline := clock.Now().Add(timeout)
+	for {
+		for _, sid := range sids {
+			if device, ok := tree.findLUNDevice(sid, lun); ok {
+				return device, nil
+			}
+		}
+		now := clock.Now()
+		if !now.Before(deadline) {
+			return "", fmt.Errorf("%w: LUN %d of %s not found after %s", ErrLUNNotVisible, lun, target.Target, timeout)
+		}
+		clock.Sleep(min(lunPollInterval, deadline.Sub(now)))
+	}
+}
+
+// WaitForSessionState waits until the session with the given SID reaches the desired state
+func (iscsi *LinuxISCSI) WaitForSessionState(sid string, desired ISCSISessionState, timeout time.Duration) error {
+	return waitForSessionState(iscsi.getClock(), iscsi.readSessions, sid, desired, timeout)
+}
+
+// GetHCTLsForTarget returns the SCSI addresses of the devices exposed by the sessions to a target
+func (iscsi *LinuxISCSI) GetHCTLsForTarget(target ISCSITarget) ([]HCTL, error) {
+	sessions, err := iscsi.readSessions()
+	if err != nil {
+		return []HCTL{}, err
+	}
+	hctls := []HCTL{}
+	for _, s := range sessions {
+		if s.Target != target.Target || !s.matchesPortal(target.Portal) {
+			continue
+		}
+		h, err := iscsi.sysfs().readSessionHCTLs(s.SID)
+		if err != nil {
+			return []HCTL{}, err
+		}
+		hctls = append(hctls, h...)
+	}
+	return hctls, nil
+}
+
+// RescanHCTL scans a single SCSI address for a device
+func (iscsi *LinuxISCSI) RescanHCTL(h HCTL) error {
+	err := iscsi.sysfs().scanHCTL(h)
+	err = iscsi.recordOperation(JournalEntry{Op: JournalOpRescanHCTL, Device: h.String()}, err)
+	return err
+}
+
+// RescanDevice rescans a block device, e.g. sdb, updating its capacity
+func (iscsi *LinuxISCSI) RescanDevice(device string) error {
+	name, err := blockDeviceName(device)
+	if err == nil {
+		err = rescanSysfsBlockDevice(iscsi.sysfs(), name)
+	}
+	err = iscsi.recordOperation(JournalEntry{Op: JournalOpRescanDevice, Device: device}, err)
+	return err
+}
+
+// ResolveDevicePaths returns the block devices of a LUN of a target and their stable paths:
+// /dev/disk/by-path, /dev/disk/by-id and those of the multipath device, if any
+func (iscsi *LinuxISCSI) ResolveDevicePaths(target ISCSITarget, lun int) (DevicePaths, error) {
+	sessions, err := iscsi.readSessions()
+	if err != nil {
+		return DevicePaths{}, err
+	}
+	tree := iscsi.sysfs()
+	paths := DevicePaths{Devices: []string{}, ByPath: []string{}, ByID: []string{}, MultipathLinks: []string{}}
+	for _, s := range sessions {
+		if s.Target != target.Target || !s.matchesPortal(target.Portal) || !ifaceMatches(s.IfaceName, target.Iface) {
+			continue
+		}
+		for h, d := range tree.readSessionDevices(s.SID) {
+			if h.LUN == lun {
+				paths.Devices = append(paths.Devices, d)
+			}
+		}
+	}
+	if len(paths.Devices) == 0 {
+		return DevicePaths{}, goiscsierrors.New(goiscsierrors.NotFound,
+			fmt.Sprintf("error no block device found for LUN %d of %s", lun, target.Target))
+	}
+	sort.Strings(paths.Devices)
+	for _, d := range paths.Devices {
+		paths.ByPath = append(paths.ByPath, tree.devLinks("disk/by-path", d)...)
+		paths.ByID = append(paths.ByID, tree.devLinks("disk/by-id", d)...)
+		if mpaths := tree.multipathHolders(d); paths.Multipath == "" && len(mpaths) > 0 {
+			paths.Multipath = mpaths[0]
+		}
+	}
+	if paths.Multipath != "" {
+		for _, link := range tree.devLinks("disk/by-id", paths.Multipath) {
+			if strings.HasPrefix(filepath.Base(link), "dm-uuid-mpath-") {
+				paths.DMUUID = link
+			}
+			paths.MultipathLinks = append(paths.MultipathLinks, link)
+		}
+		paths.MultipathLinks = append(paths.MultipathLinks, tree.devLinks("mapper", paths.Multipath)...)
+	}
+	return paths, nil
+}
+
+// DetectResizedDevices rescans the block devices of the sessions to a target and returns those whose capacity changed
+func (iscsi *LinuxISCSI) DetectResizedDevices(target ISCSITarget) ([]ResizedDevice, error) {
+	sessions, err := iscsi.readSessions()
+	if err != nil {
+		return nil, err
+	}
+	tree := iscsi.sysfs()
+	sizes := make(map[string]int64)
+	var devices []string
+	for _, s := range sessions {
+		if s.Target != target.Target || !s.matchesPortal(target.Portal) {
+			continue
+		}
+		for _, d := range tree.sessionBlockDevices(s.SID) {
+			size, err := tree.readBlockSize(d)
+			if err != nil {
+				return nil, err
+			}
+			sizes[d] = size
+			devices = append(devices, d)
+		}
+	}
+	resized := []ResizedDevice{}
+	for _, d := range devices {
+		if err := rescanSysfsBlockDevice(tree, d); err != nil {
+			return nil, err
+		}
+		size, err := tree.readBlockSize(d)
+		if err != nil {
+			return nil, err
+		}
+		if size != sizes[d] {
+			resized = append(resized, ResizedDevice{Device: d, OldSize: sizes[d], NewSize: size})
+		}
+	}
+	return resized, nil
+}
+
+// ifaceMatches checks if a session through sessionIface is reached through iface, any iface if empty
+func ifaceMatches(sessionIface, iface string) bool {
+	if iface == "" {
+		return true
+	}
+	if sessionIface == "" {
+		sessionIface = "default"
+	}
+	return sessionIface == iface
+}
+
+// withIface appends the option binding an iscsiadm command to iface, unless iface is empty
+func withIface(cmd []string, iface string) []string {
+	if iface == "" {
+		return cmd
+	}
+	return append(cmd, "-I", iface)
+}
+
+// portalMatches checks if a session portal is the portal of a target. A target portal without a port
+// matches the sessions to its host on any port, as iscsiadm does.
+func portalMatches(sessionPortal, portal string) bool {
+	if portal == "" || sessionPortal == portal {
+		return true
+	}
+	sessionHost, sessionPort, err := SplitPortal(sessionPortal)
+	if err != nil {
+		return false
+	}
+	host, port, err := SplitPortal(portal)
+	if err != nil || !sameHost(sessionHost, host) {
+		return false
+	}
+	return port == 0 || port == sessionPort || (sessionPort == 0 && port == DefaultPort)
+}
+
+// sameHost compares two hosts, IP addresses being compared by value
+func sameHost(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA != nil && ipB != nil {
+		return ipA.Equal(ipB)
+	}
+	return a == b
+}
+
+func isNoObjsExitCode(err error) bool {
+	code, ok := ExitCodeFromError(err)
+	return ok && code == ExitNoObjectsFound
 }
@@ -0,0 +1,152 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// JournalFile is the path of a file the LinuxISCSI client appends a JSON line to for each mutating operation
+	JournalFile = "journalFile"
+	// JournalMaxSize is the size in bytes beyond which the journal file is rotated, 0 to never rotate it
+	JournalMaxSize = "journalMaxSize"
+	// JournalMaxBackups is the number of rotated journal files kept, as <journal>.1 to <journal>.N
+	JournalMaxBackups = "journalMaxBackups"
+	// DefaultJournalMaxSize is the JournalMaxSize used when the option is not set
+	DefaultJournalMaxSize = 10 << 20
+	// DefaultJournalMaxBackups is the JournalMaxBackups used when the option is not set
+	DefaultJournalMaxBackups = 3
+)
+
+// The operations recorded in the journal
+const (
+	JournalOpDiscovery          = "discovery"
+	JournalOpLogin              = "login"
+	JournalOpLogout             = "logout"
+	JournalOpCreateOrUpdateNode = "create_or_update_node"
+	JournalOpDeleteNode         = "delete_node"
+	JournalOpSetCHAP            = "set_chap"
+	JournalOpAddPath            = "add_path"
+	JournalOpSetIface           = "set_iface"
+	JournalOpCreateIface        = "create_iface"
+	JournalOpDeleteIface        = "delete_iface"
+	JournalOpRescan             = "rescan"
+	JournalOpRescanHCTL         = "rescan_hctl"
+	JournalOpRescanDevice       = "rescan_device"
+	JournalOpUpdateSessionParam = "update_session_param"
+)
+
+// Results of the journaled operations
+const (
+	JournalResultSuccess = "success"
+	JournalResultFailure = "failure"
+)
+
+// JournalEntry is a line of the operation journal. The fields which don't apply to the operation are omitted.
+// Initiator is the ID of the initiator fingerprint of the host, omitted if it can not be read.
+type JournalEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Op        string    `json:"op"`
+	Target    string    `json:"target,omitempty"`
+	Portal    string    `json:"portal,omitempty"`
+	Iface     string    `json:"iface,omitempty"`
+	SID       string    `json:"sid,omitempty"`
+	Device    string    `json:"device,omitempty"`
+	Initiator string    `json:"initiator,omitempty"`
+	Result    string    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// journalMu serializes the writes and rotations of the journal files of all the clients of the process
+var journalMu sync.Mutex
+
+// targetJournalEntry returns the journal entry of an operation on a target
+func targetJournalEntry(op string, target ISCSITarget) JournalEntry {
+	return JournalEntry{Op: op, Target: target.Target, Portal: target.Portal, Iface: target.Iface}
+}
+
+// journal appends the entry of an operation and its result to the journal file, if the JournalFile option
+// is set. The file is opened for each entry so that it can also be rotated by an external tool such as
+// logrotate. A journal which can't be written is reported but does not fail the operation.
+func (i *ISCSIType) journal(entry JournalEntry, err error) {
+	opts := i.getOptions()
+	path := opts[JournalFile]
+	if path == "" {
+		return
+	}
+	entry.Timestamp = i.getClock().Now().UTC()
+	entry.Result = JournalResultSuccess
+	if err != nil {
+		entry.Result = JournalResultFailure
+		entry.Error = err.Error()
+	}
+	line, jerr := json.Marshal(entry)
+	if jerr == nil {
+		jerr = appendJournal(path, append(line, '\n'),
+			optionInt(opts, JournalMaxSize, DefaultJournalMaxSize), optionInt(opts, JournalMaxBackups, DefaultJournalMaxBackups))
+	}
+	if jerr != nil {
+		i.errorf("\nError writing the operation journal %s: %v", path, jerr)
+	}
+}
+
+// appendJournal appends a line to the journal file, first rotating the file if the line would take it beyond maxSize
+func appendJournal(path string, line []byte, maxSize int, maxBackups int) error {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	path = filepath.Clean(path)
+	if info, err := os.Stat(path); err == nil && maxSize > 0 && info.Size() > 0 && info.Size()+int64(len(line)) > int64(maxSize) {
+		if err = rotateJournal(path, maxBackups); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600) // #nosec G304
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(line); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rotateJournal renames the journal file to <path>.1, shifting the older files up to <path>.<maxBackups>
+// and removing the oldest one. Without backups, the journal file is removed.
+func rotateJournal(path string, maxBackups int) error {
+	if maxBackups <= 0 {
+		return os.Remove(path)
+	}
+	if err := os.Remove(path + "." + strconv.Itoa(maxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := maxBackups - 1; n >= 1; n-- {
+		err := os.Rename(path+"."+strconv.Itoa(n), path+"."+strconv.Itoa(n+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(path, path+".1")
+}
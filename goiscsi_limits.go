@@ -0,0 +1,102 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strings"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+const (
+	// MaxOutputBytes is the most bytes of the standard output of a command kept by a client, the rest being
+	// discarded as the command runs. A command printing more fails with ErrOutputTruncated. Default is no limit.
+	MaxOutputBytes = "maxOutputBytes"
+	// MaxRecords is the most sessions, node records or discovered targets returned by a query of a client.
+	// A query returning more fails with ErrOutputTruncated. Default is no limit.
+	MaxRecords = "maxRecords"
+)
+
+// ErrOutputTruncated is returned along with the truncated output or records of a command exceeding the
+// MaxOutputBytes or MaxRecords options, e.g. a broken firmware reporting the same records again and again
+var ErrOutputTruncated = goiscsierrors.New(goiscsierrors.Internal, "output truncated")
+
+// cappedBuffer keeps the first max bytes written to it and discards the others
+type cappedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// cappedOutput runs cmd as exec.Cmd.Output, keeping at most max bytes of its standard output and error,
+// all of them if max is 0, and tracking its process with reaper
+func cappedOutput(cmd *exec.Cmd, max int, reaper *processReaper) ([]byte, error) {
+	if max <= 0 {
+		max = math.MaxInt
+	}
+	stdout, stderr := &cappedBuffer{max: max}, &cappedBuffer{max: max}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	untrack := reaper.track(cmd)
+	err := cmd.Wait()
+	if untrack() {
+		return stdout.Bytes(), fmt.Errorf("%w: %w", ErrProcessKilled, err)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitErr.Stderr = stderr.Bytes()
+	}
+	return stdout.Bytes(), err
+}
+
+// limitOutput truncates the output of exe to the MaxOutputBytes option of the client,
+// returning ErrOutputTruncated if it was longer and the command did not fail otherwise
+func (iscsi *LinuxISCSI) limitOutput(exe []string, out []byte, err error) ([]byte, error) {
+	limit := optionInt(iscsi.getOptions(), MaxOutputBytes, 0)
+	if limit <= 0 || len(out) <= limit {
+		return out, err
+	}
+	if err == nil {
+		err = fmt.Errorf("%w: %s printed more than %d bytes", ErrOutputTruncated, strings.Join(exe, " "), limit)
+	}
+	return out[:limit], err
+}
+
+// limitRecords truncates the records returned by a query to the MaxRecords option of the client,
+// returning ErrOutputTruncated if there were more
+func limitRecords[T any](iscsi *LinuxISCSI, records []T, what string) ([]T, error) {
+	limit := optionInt(iscsi.getOptions(), MaxRecords, 0)
+	if limit <= 0 || len(records) <= limit {
+		return records, nil
+	}
+	return records[:limit], fmt.Errorf("%w: more than %d %s", ErrOutputTruncated, limit, what)
+}
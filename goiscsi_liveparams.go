@@ -0,0 +1,87 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+// liveSessionParam is where the kernel exposes a node parameter which can be changed on a live session
+type liveSessionParam struct {
+	// sessionAttr is the attribute of the iscsi_session class, if the parameter applies to the session
+	sessionAttr string
+	// deviceAttr is the attribute of the SCSI devices of the session, under /sys/block/<dev>/device, if the
+	// parameter applies to each of its LUNs
+	deviceAttr string
+}
+
+// liveSessionParams are the node parameters which can be safely changed on the live sessions
+var liveSessionParams = map[string]liveSessionParam{
+	"node.session.timeo.replacement_timeout": {sessionAttr: "recovery_tmo"},
+	"node.session.queue_depth":               {deviceAttr: "queue_depth"},
+}
+
+// LiveSessionParams returns the node parameters UpdateLiveSessionParam can change on a live session
+func LiveSessionParams() []string {
+	return slices.Sorted(maps.Keys(liveSessionParams))
+}
+
+// validateLiveSessionParam checks the session, parameter and value of a live update and returns where the parameter
+// is exposed
+func validateLiveSessionParam(sid, param, value string) (liveSessionParam, error) {
+	if err := validateSID(sid); err != nil {
+		return liveSessionParam{}, err
+	}
+	p, ok := liveSessionParams[param]
+	if !ok {
+		return liveSessionParam{}, goiscsierrors.Wrap(goiscsierrors.Validation,
+			fmt.Errorf("parameter %s can't be updated on a live session, supported are %v", param, LiveSessionParams()))
+	}
+	if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+		return liveSessionParam{}, goiscsierrors.Wrap(goiscsierrors.Validation,
+			fmt.Errorf("invalid value %q of %s: a non-negative integer is expected", value, param))
+	}
+	return p, nil
+}
+
+// updateLiveSessionParam writes value to the sysfs attribute of the session, or of each of its block devices,
+// exposing the parameter
+func (tree sysfsTree) updateLiveSessionParam(sid string, p liveSessionParam, value string) error {
+	dir := filepath.Join(tree.classPath("iscsi_session"), "session"+sid)
+	if _, err := os.Stat(dir); err != nil {
+		return goiscsierrors.Wrap(goiscsierrors.NotFound, fmt.Errorf("session %s not found", sid))
+	}
+	if p.sessionAttr != "" {
+		return classifyFileError(os.WriteFile(filepath.Join(dir, p.sessionAttr), []byte(value), 0o200))
+	}
+	for _, device := range tree.sessionBlockDevices(sid) {
+		path := filepath.Join(tree.root, "block", device, "device", p.deviceAttr)
+		if err := os.WriteFile(path, []byte(value), 0o200); err != nil {
+			return classifyFileError(fmt.Errorf("updating %s of %s: %w", p.deviceAttr, device, err))
+		}
+	}
+	return nil
+}
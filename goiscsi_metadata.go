@@ -0,0 +1,189 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package goiscsi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+const (
+	// NodeMetadataPrefix marks the node fields holding caller defined metadata, e.g. "goiscsi.meta.volume-id".
+	// iscsiadm does not accept fields it does not know, so these fields are stored beside the node database
+	// by CreateOrUpdateNode, returned by GetNodes and removed by DeleteNode.
+	NodeMetadataPrefix = "goiscsi.meta."
+
+	// maxNodeMetadataSize is the largest size of the metadata of a node, keys and values included
+	maxNodeMetadataSize = 4096
+)
+
+// nodeMetadataDir is where the metadata of the node records is stored by default, under the chroot directory if any
+var nodeMetadataDir = "/etc/iscsi/goiscsi-metadata"
+
+var nodeMetadataKeyRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// NodeMetadataOptions returns the node fields storing metadata, to be passed to CreateOrUpdateNode.
+// An empty value removes a key.
+func NodeMetadataOptions(metadata map[string]string) map[string]string {
+	options := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		options[NodeMetadataPrefix+k] = v
+	}
+	return options
+}
+
+// NodeMetadata returns the metadata stored with a node record
+func NodeMetadata(node ISCSINode) map[string]string {
+	metadata := make(map[string]string)
+	for k, v := range node.Fields {
+		if key, ok := strings.CutPrefix(k, NodeMetadataPrefix); ok {
+			metadata[key] = v
+		}
+	}
+	return metadata
+}
+
+// splitNodeMetadata separates the metadata fields from the fields of the node record
+func splitNodeMetadata(options map[string]string) (map[string]string, map[string]string) {
+	fields := make(map[string]string, len(options))
+	var metadata map[string]string
+	for k, v := range options {
+		if key, ok := strings.CutPrefix(k, NodeMetadataPrefix); ok {
+			if metadata == nil {
+				metadata = make(map[string]string)
+			}
+			metadata[key] = v
+			continue
+		}
+		fields[k] = v
+	}
+	return fields, metadata
+}
+
+func validateNodeMetadata(metadata map[string]string) error {
+	size := 0
+	for k, v := range metadata {
+		if !nodeMetadataKeyRegexp.MatchString(k) {
+			return goiscsierrors.New(goiscsierrors.Validation, fmt.Sprintf("error invalid node metadata key %q", k))
+		}
+		size += len(k) + len(v)
+	}
+	if size > maxNodeMetadataSize {
+		return goiscsierrors.New(goiscsierrors.Validation,
+			fmt.Sprintf("error node metadata of %d bytes exceeds %d bytes", size, maxNodeMetadataSize))
+	}
+	return nil
+}
+
+// nodeMetadataPath returns the file holding the metadata of the record of a target at a portal,
+// under the metadata directory dir. The portal defaults to the iSCSI port, as for iscsiadm.
+func nodeMetadataPath(dir, target, portal string) (string, error) {
+	host, port, err := SplitPortal(portal)
+	if err != nil {
+		return "", err
+	}
+	if port == 0 {
+		port = DefaultPort
+	}
+	name := url.PathEscape(host + "," + strconv.Itoa(port))
+	return filepath.Join(nodeMetadataTargetDir(dir, target), name+".json"), nil
+}
+
+// nodeMetadataTargetDir returns the directory holding the metadata of the records of a target
+func nodeMetadataTargetDir(dir, target string) string {
+	return filepath.Join(dir, url.PathEscape(target))
+}
+
+// readTargetMetadata returns the metadata of every record of a target, under the metadata directory dir
+func readTargetMetadata(dir, target string) []map[string]string {
+	paths, _ := filepath.Glob(filepath.Join(nodeMetadataTargetDir(dir, target), "*.json"))
+	var metadata []map[string]string
+	for _, p := range paths {
+		if m, err := readNodeMetadata(p); err == nil {
+			metadata = append(metadata, m)
+		}
+	}
+	return metadata
+}
+
+func readNodeMetadata(path string) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]string{}, nil
+		}
+		return nil, classifyFileError(err)
+	}
+	metadata := make(map[string]string)
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, goiscsierrors.Wrap(goiscsierrors.Internal, fmt.Errorf("error reading node metadata %s: %w", path, err))
+	}
+	return metadata, nil
+}
+
+// updateNodeMetadata merges metadata into the one stored in path, removing the keys with an empty value
+func updateNodeMetadata(path string, metadata map[string]string) error {
+	current, err := readNodeMetadata(path)
+	if err != nil {
+		return err
+	}
+	for k, v := range metadata {
+		if v == "" {
+			delete(current, k)
+			continue
+		}
+		current[k] = v
+	}
+	if err := validateNodeMetadata(current); err != nil {
+		return err
+	}
+	if len(current) == 0 {
+		return removeNodeMetadata(path)
+	}
+	data, err := json.Marshal(current)
+	if err != nil {
+		return goiscsierrors.Wrap(goiscsierrors.Internal, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return classifyFileError(err)
+	}
+	// write and rename, so a reader never sees a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return classifyFileError(err)
+	}
+	return classifyFileError(os.Rename(tmp, path))
+}
+
+func removeNodeMetadata(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return classifyFileError(err)
+	}
+	// drop the directory of the target once empty
+	_ = os.Remove(filepath.Dir(path))
+	return nil
+}
@@ -21,7 +21,14 @@ package goiscsi
 import (
 	"errors"
 	"fmt"
+	"reflect"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
 )
 
 const (
@@ -35,11 +42,12 @@ const (
 	MockNumberOfNodes = "numberOfNode"
 )
 
-// GOISCSIMock is a struct controlling induced errors
-var GOISCSIMock struct {
+// MockInducedErrors selects the operations of a mock client which fail with an induced error
+type MockInducedErrors struct {
 	InduceDiscoveryError          bool
 	InduceInitiatorError          bool
 	InduceLoginError              bool
+	InduceCHAPRequiredError       bool
 	InduceLogoutError             bool
 	InduceRescanError             bool
 	InduceGetSessionsError        bool
@@ -47,11 +55,129 @@ var GOISCSIMock struct {
 	InduceCreateOrUpdateNodeError bool
 	InduceDeleteNodeError         bool
 	InduceSetCHAPError            bool
+	InduceGetHCTLsError           bool
+	InduceRescanHCTLError         bool
+	InduceRescanAndVerifyLUNError bool
+	InduceLastPathError           bool
+	InduceFlashSessionError       bool
+	InduceAddPathError            bool
+	InduceGetIfaceError           bool
+	InduceSetIfaceError           bool
+	InduceRescanDeviceError       bool
+	InducePingError               bool
+	InduceResolveDevicePathsError bool
+	InduceUpdateSessionParamError bool
+}
+
+// GOISCSIMock induces errors in every mock client, in addition to their own Induced errors.
+//
+// Deprecated: set the Induced field of a MockISCSI instead, which does not leak into the other tests
+// and is safe with t.Parallel().
+var GOISCSIMock MockInducedErrors
+
+// merge returns the errors induced by e or by other
+func (e MockInducedErrors) merge(other MockInducedErrors) MockInducedErrors {
+	merged, o := reflect.ValueOf(&e).Elem(), reflect.ValueOf(other)
+	for i := 0; i < merged.NumField(); i++ {
+		if o.Field(i).Bool() {
+			merged.Field(i).SetBool(true)
+		}
+	}
+	return e
+}
+
+// MockSessionStateChange sets the state of a mocked session After a delay
+type MockSessionStateChange struct {
+	After time.Duration
+	SID   string
+	State ISCSISessionState
 }
 
-// MockISCSI provides a mock implementation of an iscsi client
+// MockTimeline scripts how the mocked system changes over the time of the clock of the mock, so that
+// the waiting operations can be tested with their condition met late, or never, without real sleeps
+type MockTimeline struct {
+	// SessionStates lists the state changes of the mocked sessions, from the time the timeline is set
+	SessionStates []MockSessionStateChange
+	// LUNDelays is how long the block device of a LUN takes to appear after the rescan of
+	// RescanAndVerifyLUN; the devices of the LUNs not listed appear at once
+	LUNDelays map[int]time.Duration
+}
+
+// MockISCSI provides a mock implementation of an iscsi client. Its state belongs to the instance,
+// so that parallel tests use their own mock clients.
+// Setting one of the Fn fields replaces the behavior of the corresponding method,
+// including the errors induced through Induced or GOISCSIMock.
 type MockISCSI struct {
 	ISCSIType
+
+	// Induced selects the operations of the client which fail with an induced error
+	Induced MockInducedErrors
+
+	// nodeMetadata holds the metadata stored by CreateOrUpdateNode, by target and portal
+	metadataMu   sync.Mutex
+	nodeMetadata map[string]map[string]string
+
+	// timeline holds the changes scripted by SetTimeline, from timelineStart
+	timelineMu    sync.Mutex
+	timeline      MockTimeline
+	timelineStart time.Time
+
+	DiscoverTargetsFn                 func(address string, login bool) ([]ISCSITarget, error)
+	DiscoverTargetsWithOptionsFn      func(address string, opts DiscoveryOptions) ([]ISCSITarget, error)
+	DiscoverTargetsFromAddressesFn    func(addresses []string, opts DiscoveryOptions) (DiscoveryResults, error)
+	DiscoverEndpointTargetsFn         func(endpoint DiscoveryEndpoint, opts DiscoveryOptions) ([]ISCSITarget, error)
+	GetAllInitiatorsFn                func() (InitiatorReport, error)
+	GetInitiatorFingerprintFn         func() (InitiatorFingerprint, error)
+	GetInitiatorsFn                   func(filename string) ([]string, error)
+	PerformLoginFn                    func(target ISCSITarget) error
+	PerformLoginWithOptionsFn         func(target ISCSITarget, opts LoginOptions) error
+	PerformLogoutFn                   func(target ISCSITarget) error
+	PerformLogoutWithOptionsFn        func(target ISCSITarget, opts LogoutOptions) error
+	PingFn                            func(target ISCSITarget, count int, timeout time.Duration) (PingResult, error)
+	LogoutSessionBySIDFn              func(sid string) error
+	UpdateLiveSessionParamFn          func(sid, param, value string) error
+	PerformRescanFn                   func() error
+	GetSessionsFn                     func() ([]ISCSISession, error)
+	GetNodesFn                        func() ([]ISCSINode, error)
+	ValidateIfacesFn                  func() ([]IfaceFinding, error)
+	RepairIfaceBindingsFn             func(dryRun bool) ([]IfaceRepair, error)
+	GetCHAPConfigFn                   func(target ISCSITarget) (CHAPConfig, error)
+	CreateOrUpdateNodeFn              func(target ISCSITarget, options map[string]string) error
+	DeleteNodeFn                      func(target ISCSITarget) error
+	AddPathToTargetFn                 func(iqn string, newPortal string, iface string) error
+	GetIfaceSessionCountsFn           func() ([]IfaceSessionCount, error)
+	AuditConsistencyFn                func() ([]ConsistencyFinding, error)
+	AnalyzeHostTuningFn               func() ([]TuningRecommendation, error)
+	ReconcileCHAPSessionsFn           func(maxParallel int) (NodeOpResults, error)
+	AuditTargetSourceFn               func(source TargetSource) ([]ConsistencyFinding, error)
+	GetSIDToHostMapFn                 func() (map[string]int, error)
+	DetectIBFTConfigurationFn         func() (IBFTConfiguration, error)
+	GetSessionsByIfaceFn              func(iface string) ([]ISCSISession, error)
+	GetSessionsFilteredFn             func(filter SessionFilter) ([]ISCSISession, error)
+	GetSessionsByTargetFn             func(iqn string) ([]ISCSISession, error)
+	GetSessionsByPortalFn             func(portal string) ([]ISCSISession, error)
+	ListDiscoverySessionsFn           func() ([]ISCSISession, error)
+	LogoutDiscoverySessionFn          func(portal string) error
+	GetIfaceParametersFn              func(iface string) (map[string]string, error)
+	SetIfaceParametersFn              func(iface string, params map[string]string) error
+	ListIfacesFn                      func() ([]ISCSIIface, error)
+	CreateIfaceFn                     func(iface ISCSIIface) error
+	UpdateIfaceFn                     func(iface ISCSIIface) error
+	DeleteIfaceFn                     func(name string) error
+	ExportNodesFn                     func(opts SnapshotOptions) (*NodeSnapshot, error)
+	ImportNodesFn                     func(snapshot *NodeSnapshot, opts SnapshotOptions) (NodeOpResults, error)
+	DeleteNodesFn                     func(targets []ISCSITarget) (NodeOpResults, error)
+	RescanAndVerifyLUNFn              func(target ISCSITarget, lun int, timeout time.Duration) (string, error)
+	WaitForSessionStateFn             func(sid string, desired ISCSISessionState, timeout time.Duration) error
+	GetHCTLsForTargetFn               func(target ISCSITarget) ([]HCTL, error)
+	RescanHCTLFn                      func(h HCTL) error
+	RescanDeviceFn                    func(device string) error
+	DetectResizedDevicesFn            func(target ISCSITarget) ([]ResizedDevice, error)
+	ResolveDevicePathsFn              func(target ISCSITarget, lun int) (DevicePaths, error)
+	GetSessionDevicesFn               func(sid string) ([]SessionDevice, error)
+	GetTargetDevicesFn                func(target ISCSITarget) ([]SessionDevice, error)
+	SetCHAPCredentialsFn              func(target ISCSITarget, username, password string) error
+	SetCHAPCredentialsBidirectionalFn func(target ISCSITarget, creds CHAPCredentials) error
 }
 
 // NewMockISCSI returns an mock ISCSI client
@@ -60,23 +186,29 @@ func NewMockISCSI(opts map[string]string) *MockISCSI {
 		ISCSIType: ISCSIType{
 			mock:    true,
 			options: opts,
+			clock:   NewFakeClock(time.Now()),
 		},
 	}
 
 	return &iscsi
 }
 
+// induced returns the errors induced in the client, by its Induced field or by the deprecated GOISCSIMock
+func (iscsi *MockISCSI) induced() MockInducedErrors {
+	return iscsi.Induced.merge(GOISCSIMock)
+}
+
 func getOptionAsInt(opts map[string]string, key string) int64 {
 	v, _ := strconv.ParseInt(opts[key], 10, 64)
 	return v
 }
 
 func (iscsi *MockISCSI) discoverTargets(address string, _ bool) ([]ISCSITarget, error) {
-	if GOISCSIMock.InduceDiscoveryError {
+	if iscsi.induced().InduceDiscoveryError {
 		return []ISCSITarget{}, errors.New("discoverTargets induced error")
 	}
 	mockedTargets := make([]ISCSITarget, 0)
-	count := getOptionAsInt(iscsi.options, MockNumberOfTargets)
+	count := getOptionAsInt(iscsi.getOptions(), MockNumberOfTargets)
 	if count == 0 {
 		count = 1
 	}
@@ -85,23 +217,27 @@ func (iscsi *MockISCSI) discoverTargets(address string, _ bool) ([]ISCSITarget,
 		tgt := fmt.Sprintf("%05d", idx)
 		mockedTargets = append(mockedTargets,
 			ISCSITarget{
-				Portal:   address + ":3260",
+				Portal:   portalWithPort(address),
 				GroupTag: "0",
 				Target:   "iqn.1992-04.com.mock:600009700bcbb70e32870174000" + tgt,
 			})
 	}
 
 	// send back a slice of targets
-	return mockedTargets, nil
+	targets, err := iscsi.filterTargets(mockedTargets)
+	for i := range targets {
+		targets[i].MaxSessions = iscsi.targetMaxSessions(targets[i])
+	}
+	return targets, err
 }
 
 func (iscsi *MockISCSI) getInitiators(_ string) ([]string, error) {
-	if GOISCSIMock.InduceInitiatorError {
+	if iscsi.induced().InduceInitiatorError {
 		return []string{}, errors.New("getInitiators induced error")
 	}
 
 	mockedInitiators := make([]string, 0)
-	count := getOptionAsInt(iscsi.options, MockNumberOfInitiators)
+	count := getOptionAsInt(iscsi.getOptions(), MockNumberOfInitiators)
 	if count == 0 {
 		count = 1
 	}
@@ -114,16 +250,19 @@ func (iscsi *MockISCSI) getInitiators(_ string) ([]string, error) {
 	return mockedInitiators, nil
 }
 
-func (iscsi *MockISCSI) performLogin(_ ISCSITarget) error {
-	if GOISCSIMock.InduceLoginError {
+func (iscsi *MockISCSI) performLogin(target ISCSITarget) error {
+	if iscsi.induced().InduceLoginError {
 		return errors.New("iSCSI Login induced error")
 	}
+	if iscsi.induced().InduceCHAPRequiredError {
+		return fmt.Errorf("%w: %s at %s: iSCSI Login induced error", ErrCHAPRequired, target.Target, target.Portal)
+	}
 
 	return nil
 }
 
 func (iscsi *MockISCSI) performLogout(_ ISCSITarget) error {
-	if GOISCSIMock.InduceLogoutError {
+	if iscsi.induced().InduceLogoutError {
 		return errors.New("iSCSI Logout induced error")
 	}
 
@@ -131,7 +270,7 @@ func (iscsi *MockISCSI) performLogout(_ ISCSITarget) error {
 }
 
 func (iscsi *MockISCSI) performRescan() error {
-	if GOISCSIMock.InduceRescanError {
+	if iscsi.induced().InduceRescanError {
 		return errors.New("iSCSI Rescan induced error")
 	}
 
@@ -139,12 +278,12 @@ func (iscsi *MockISCSI) performRescan() error {
 }
 
 func (iscsi *MockISCSI) getSessions() ([]ISCSISession, error) {
-	if GOISCSIMock.InduceGetSessionsError {
+	if iscsi.induced().InduceGetSessionsError {
 		return []ISCSISession{}, errors.New("getSessions induced error")
 	}
 
 	var sessions []ISCSISession
-	count := getOptionAsInt(iscsi.options, MockNumberOfSessions)
+	count := getOptionAsInt(iscsi.getOptions(), MockNumberOfSessions)
 	if count == 0 {
 		count = 1
 	}
@@ -152,24 +291,88 @@ func (iscsi *MockISCSI) getSessions() ([]ISCSISession, error) {
 		init := fmt.Sprintf("%05d", idx)
 		session := ISCSISession{}
 		session.Target = fmt.Sprintf("iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a%d", idx)
+		session.SID = fmt.Sprintf("%d", idx+1)
 		session.Portal = fmt.Sprintf("192.168.1.%d", idx)
+		session.OriginalPortal = session.Portal
+		session.EffectivePortal = session.Portal
 		session.IfaceInitiatorname = "iqn.1993-08.com.mock:01:00000000" + init
 		session.IfaceTransport = ISCSITransportNameTCP
+		session.SessionSource = ISCSISessionSourceSoftware
 		session.ISCSIConnectionState = ISCSIConnectionStateINLOGIN
 		session.ISCSISessionState = ISCSISessionStateLOGGEDIN
 		session.IfaceIPaddress = "192.168.1.10"
+		if state, ok := iscsi.scriptedSessionState(session.SID); ok {
+			session.ISCSISessionState = state
+		}
 		sessions = append(sessions, session)
 	}
 	return sessions, nil
 }
 
+// checkMaxSessions returns ErrMaxSessions if the EnforceMaxSessions option is set and the mocked
+// sessions to the target reach its MaxSessions or the hint stored with its node records
+func (iscsi *MockISCSI) checkMaxSessions(target ISCSITarget) error {
+	if !optionBool(iscsi.getOptions(), EnforceMaxSessions) {
+		return nil
+	}
+	limit := iscsi.targetMaxSessions(target)
+	if limit == 0 {
+		return nil
+	}
+	sessions, err := iscsi.getSessions()
+	if err != nil {
+		return err
+	}
+	return checkSessionLimit(sessions, target, limit)
+}
+
+// targetMaxSessions returns the MaxSessions of a target if set, else the hint stored with its mocked node records
+func (iscsi *MockISCSI) targetMaxSessions(target ISCSITarget) int {
+	if target.MaxSessions > 0 {
+		return target.MaxSessions
+	}
+	iscsi.metadataMu.Lock()
+	defer iscsi.metadataMu.Unlock()
+	var metadata []map[string]string
+	for key, m := range iscsi.nodeMetadata {
+		if strings.HasPrefix(key, target.Target+",") {
+			metadata = append(metadata, m)
+		}
+	}
+	return maxSessionsHint(metadata...)
+}
+
+// SetTimeline scripts the changes of the mocked system from the current time of the clock of the mock
+func (iscsi *MockISCSI) SetTimeline(timeline MockTimeline) {
+	iscsi.timelineMu.Lock()
+	defer iscsi.timelineMu.Unlock()
+	iscsi.timeline = timeline
+	iscsi.timelineStart = iscsi.getClock().Now()
+}
+
+// scriptedSessionState returns the state of a session set by the timeline at the time of the clock, if any
+func (iscsi *MockISCSI) scriptedSessionState(sid string) (ISCSISessionState, bool) {
+	iscsi.timelineMu.Lock()
+	defer iscsi.timelineMu.Unlock()
+	elapsed := iscsi.getClock().Now().Sub(iscsi.timelineStart)
+	var state ISCSISessionState
+	found := false
+	latest := time.Duration(-1)
+	for _, c := range iscsi.timeline.SessionStates {
+		if c.SID == sid && c.After <= elapsed && c.After >= latest {
+			state, latest, found = c.State, c.After, true
+		}
+	}
+	return state, found
+}
+
 func (iscsi *MockISCSI) getNodes() ([]ISCSINode, error) {
-	if GOISCSIMock.InduceGetNodesError {
+	if iscsi.induced().InduceGetNodesError {
 		return []ISCSINode{}, errors.New("getSessions induced error")
 	}
 
 	var nodes []ISCSINode
-	count := getOptionAsInt(iscsi.options, MockNumberOfNodes)
+	count := getOptionAsInt(iscsi.getOptions(), MockNumberOfNodes)
 	if count == 0 {
 		count = 1
 	}
@@ -179,81 +382,588 @@ func (iscsi *MockISCSI) getNodes() ([]ISCSINode, error) {
 		node.Portal = fmt.Sprintf("192.168.1.%d", idx)
 		node.Fields = make(map[string]string)
 		node.Fields["node.session.scan"] = "auto"
+		iscsi.metadataMu.Lock()
+		for k, v := range iscsi.nodeMetadata[node.Target+","+node.Portal] {
+			node.Fields[NodeMetadataPrefix+k] = v
+		}
+		iscsi.metadataMu.Unlock()
 		nodes = append(nodes, node)
 	}
 	return nodes, nil
 }
 
-func (iscsi *MockISCSI) newNode(_ ISCSITarget, _ map[string]string) error {
-	if GOISCSIMock.InduceCreateOrUpdateNodeError {
+func (iscsi *MockISCSI) newNode(target ISCSITarget, options map[string]string) error {
+	if iscsi.induced().InduceCreateOrUpdateNodeError {
 		return errors.New("newNode induced error")
 	}
-	if GOISCSIMock.InduceSetCHAPError {
+	if iscsi.induced().InduceSetCHAPError {
 		return errors.New("set CHAP induced error")
 	}
+	_, metadata := splitNodeMetadata(options)
+	if metadata == nil {
+		return nil
+	}
+	iscsi.metadataMu.Lock()
+	defer iscsi.metadataMu.Unlock()
+	key := target.Target + "," + target.Portal
+	current := make(map[string]string)
+	for k, v := range iscsi.nodeMetadata[key] {
+		current[k] = v
+	}
+	for k, v := range metadata {
+		if v == "" {
+			delete(current, k)
+		} else {
+			current[k] = v
+		}
+	}
+	if err := validateNodeMetadata(current); err != nil {
+		return err
+	}
+	if iscsi.nodeMetadata == nil {
+		iscsi.nodeMetadata = make(map[string]map[string]string)
+	}
+	iscsi.nodeMetadata[key] = current
 	return nil
 }
 
 func (iscsi *MockISCSI) deleteNode(_ ISCSITarget) error {
-	if GOISCSIMock.InduceDeleteNodeError {
+	if iscsi.induced().InduceDeleteNodeError {
 		return errors.New("newNode induced error")
 	}
 	return nil
 }
 
+func (iscsi *MockISCSI) getHCTLsForTarget(_ ISCSITarget) ([]HCTL, error) {
+	if iscsi.induced().InduceGetHCTLsError {
+		return []HCTL{}, errors.New("getHCTLsForTarget induced error")
+	}
+	return []HCTL{{Host: 3, Channel: 0, Target: 0, LUN: 0}, {Host: 3, Channel: 0, Target: 0, LUN: 1}}, nil
+}
+
+func (iscsi *MockISCSI) rescanHCTL(_ HCTL) error {
+	if iscsi.induced().InduceRescanHCTLError {
+		return errors.New("rescanHCTL induced error")
+	}
+	return nil
+}
+
+func (iscsi *MockISCSI) rescanDevice(device string) error {
+	if iscsi.induced().InduceRescanDeviceError {
+		return errors.New("rescanDevice induced error")
+	}
+	_, err := blockDeviceName(device)
+	return err
+}
+
+func (iscsi *MockISCSI) rescanAndVerifyLUN(target ISCSITarget, lun int, timeout time.Duration) (string, error) {
+	if iscsi.induced().InduceRescanAndVerifyLUNError {
+		return "", errors.New("rescanAndVerifyLUN induced error")
+	}
+	iscsi.timelineMu.Lock()
+	delay := iscsi.timeline.LUNDelays[lun]
+	iscsi.timelineMu.Unlock()
+	clock := iscsi.getClock()
+	deadline := clock.Now().Add(timeout)
+	appears := clock.Now().Add(delay)
+	for {
+		now := clock.Now()
+		if !now.Before(appears) {
+			return fmt.Sprintf("/dev/sdmock%d", lun), nil
+		}
+		if !now.Before(deadline) {
+			return "", fmt.Errorf("%w: LUN %d of %s not found after %s", ErrLUNNotVisible, lun, target.Target, timeout)
+		}
+		clock.Sleep(min(lunPollInterval, deadline.Sub(now)))
+	}
+}
+
 // ====================================================================
 // Architecture agnostic code for the mock implementation
 
 // DiscoverTargets runs an iSCSI discovery and returns a list of targets.
 func (iscsi *MockISCSI) DiscoverTargets(address string, login bool) ([]ISCSITarget, error) {
+	if iscsi.DiscoverTargetsFn != nil {
+		return iscsi.DiscoverTargetsFn(address, login)
+	}
 	return iscsi.discoverTargets(address, login)
 }
 
+// DiscoverTargetsWithOptions runs an iSCSI discovery of the given type and returns a list of targets.
+func (iscsi *MockISCSI) DiscoverTargetsWithOptions(address string, opts DiscoveryOptions) ([]ISCSITarget, error) {
+	if iscsi.DiscoverTargetsWithOptionsFn != nil {
+		return iscsi.DiscoverTargetsWithOptionsFn(address, opts)
+	}
+	portal, err := discoveryPortal(address, opts)
+	if err != nil {
+		return []ISCSITarget{}, err
+	}
+	if err = validateOptionalIface(opts.Iface); err != nil {
+		return []ISCSITarget{}, err
+	}
+	if err = validateDiscoveryCHAP(opts); err != nil {
+		return []ISCSITarget{}, err
+	}
+	// SendTargets returns the portals of the discovery port, iSNS those of the default port
+	if opts.Type == DiscoveryISNS {
+		portal, _, _ = SplitPortal(portal)
+	}
+	targets, err := iscsi.discoverTargets(portal, opts.Login)
+	for i := range targets {
+		targets[i].Iface = opts.Iface
+	}
+	return targets, err
+}
+
+// DiscoverTargetsFromAddresses runs a mock discovery with opts through each address
+func (iscsi *MockISCSI) DiscoverTargetsFromAddresses(addresses []string, opts DiscoveryOptions) (DiscoveryResults, error) {
+	if iscsi.DiscoverTargetsFromAddressesFn != nil {
+		return iscsi.DiscoverTargetsFromAddressesFn(addresses, opts)
+	}
+	return runDiscoveries(addresses, func(address string) ([]ISCSITarget, error) {
+		return iscsi.DiscoverTargetsWithOptions(address, opts)
+	})
+}
+
 // GetInitiators returns a list of initiators on the local system.
 func (iscsi *MockISCSI) GetInitiators(filename string) ([]string, error) {
+	if iscsi.GetInitiatorsFn != nil {
+		return iscsi.GetInitiatorsFn(filename)
+	}
+	if iqn := iscsi.getInitiatorOverride(); iqn != "" {
+		return []string{iqn}, nil
+	}
 	return iscsi.getInitiators(filename)
 }
 
+// GetAllInitiators returns the mocked initiators as defined in the default initiator name file
+func (iscsi *MockISCSI) GetAllInitiators() (InitiatorReport, error) {
+	if iscsi.GetAllInitiatorsFn != nil {
+		return iscsi.GetAllInitiatorsFn()
+	}
+	if iqn := iscsi.getInitiatorOverride(); iqn != "" {
+		return overrideInitiatorReport(iqn), nil
+	}
+	iqns, err := iscsi.getInitiators("")
+	if err != nil {
+		return InitiatorReport{}, err
+	}
+	report := newInitiatorReport([]InitiatorFile{{Path: DefaultInitiatorNameFile, IQNs: iqns}})
+	if report.Conflict {
+		iscsi.warn(WarningInitiatorConflict, ISCSITarget{}, "initiator names %s are defined",
+			strings.Join(report.IQNs, ", "))
+	}
+	return report, nil
+}
+
+// GetInitiatorFingerprint returns the fingerprint of the first mocked initiator on a mock host without iSCSI ifaces
+func (iscsi *MockISCSI) GetInitiatorFingerprint() (InitiatorFingerprint, error) {
+	if iscsi.GetInitiatorFingerprintFn != nil {
+		return iscsi.GetInitiatorFingerprintFn()
+	}
+	iqns, err := iscsi.GetInitiators("")
+	if err != nil {
+		return InitiatorFingerprint{}, err
+	}
+	if len(iqns) == 0 {
+		return InitiatorFingerprint{}, goiscsierrors.New(goiscsierrors.NotFound, "error no initiator name found")
+	}
+	return newInitiatorFingerprint(iqns[0], mockHostname, nil), nil
+}
+
 // PerformLogin will attempt to log into an iSCSI target
 func (iscsi *MockISCSI) PerformLogin(target ISCSITarget) error {
-	return iscsi.performLogin(target)
+	if iscsi.PerformLoginFn != nil {
+		return iscsi.PerformLoginFn(target)
+	}
+	return iscsi.PerformLoginWithOptions(target, LoginOptions{})
+}
+
+// PerformLoginWithOptions will attempt to log into an iSCSI target, the options have no effect on the mock
+func (iscsi *MockISCSI) PerformLoginWithOptions(target ISCSITarget, opts LoginOptions) error {
+	if iscsi.PerformLoginWithOptionsFn != nil {
+		return iscsi.PerformLoginWithOptionsFn(target, opts)
+	}
+	if err := iscsi.checkLoginBackoff(target); err != nil {
+		return err
+	}
+	if err := iscsi.checkMaxSessions(target); err != nil {
+		return err
+	}
+	err := iscsi.performLogin(target)
+	iscsi.recordLoginResult(target, err)
+	return err
 }
 
 // PerformLogout will attempt to log out of an iSCSI target
 func (iscsi *MockISCSI) PerformLogout(target ISCSITarget) error {
+	if iscsi.PerformLogoutFn != nil {
+		return iscsi.PerformLogoutFn(target)
+	}
+	return iscsi.PerformLogoutWithOptions(target, LogoutOptions{})
+}
+
+// PerformLogoutWithOptions will attempt to log out of an iSCSI target
+func (iscsi *MockISCSI) PerformLogoutWithOptions(target ISCSITarget, opts LogoutOptions) error {
+	if iscsi.PerformLogoutWithOptionsFn != nil {
+		return iscsi.PerformLogoutWithOptionsFn(target, opts)
+	}
+	if iscsi.induced().InduceFlashSessionError && !opts.Force {
+		return fmt.Errorf("%w: session 1 to %s at %s", ErrFlashSession, target.Target, target.Portal)
+	}
+	if iscsi.induced().InduceLastPathError && !opts.Force {
+		return &LastPathError{Target: target, Device: "dm-0"}
+	}
 	return iscsi.performLogout(target)
 }
 
+// Ping reports each mocked probe of a target as answered in a millisecond
+func (iscsi *MockISCSI) Ping(target ISCSITarget, count int, timeout time.Duration) (PingResult, error) {
+	if iscsi.PingFn != nil {
+		return iscsi.PingFn(target, count, timeout)
+	}
+	if _, err := pingAddress(target, count, timeout); err != nil {
+		return PingResult{}, err
+	}
+	if iscsi.induced().InducePingError {
+		return PingResult{Target: target, Lost: count}, errors.New("ping induced error")
+	}
+	result := PingResult{Target: target}
+	for i := 0; i < count; i++ {
+		result.RTTs = append(result.RTTs, time.Millisecond)
+	}
+	return result, nil
+}
+
+// LogoutSessionBySID will attempt to log out of the session with the given SID
+func (iscsi *MockISCSI) LogoutSessionBySID(sid string) error {
+	if iscsi.LogoutSessionBySIDFn != nil {
+		return iscsi.LogoutSessionBySIDFn(sid)
+	}
+	if err := validateSID(sid); err != nil {
+		return err
+	}
+	return iscsi.performLogout(ISCSITarget{})
+}
+
+// UpdateLiveSessionParam checks the parameter and that the session is one of the mocked sessions
+func (iscsi *MockISCSI) UpdateLiveSessionParam(sid, param, value string) error {
+	if iscsi.UpdateLiveSessionParamFn != nil {
+		return iscsi.UpdateLiveSessionParamFn(sid, param, value)
+	}
+	if iscsi.induced().InduceUpdateSessionParamError {
+		return errors.New("updateLiveSessionParam induced error")
+	}
+	if _, err := validateLiveSessionParam(sid, param, value); err != nil {
+		return err
+	}
+	sessions, err := iscsi.getSessions()
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(sessions, func(s ISCSISession) bool { return s.SID == sid }) {
+		return goiscsierrors.Wrap(goiscsierrors.NotFound, fmt.Errorf("session %s not found", sid))
+	}
+	return nil
+}
+
 // PerformRescan will will rescan targets known to current sessions
 func (iscsi *MockISCSI) PerformRescan() error {
+	if iscsi.PerformRescanFn != nil {
+		return iscsi.PerformRescanFn()
+	}
 	return iscsi.performRescan()
 }
 
 // GetSessions will query iSCSI session info
 func (iscsi *MockISCSI) GetSessions() ([]ISCSISession, error) {
+	if iscsi.GetSessionsFn != nil {
+		return iscsi.GetSessionsFn()
+	}
 	return iscsi.getSessions()
 }
 
 // GetNodes will query iSCSI session info
 func (iscsi *MockISCSI) GetNodes() ([]ISCSINode, error) {
+	if iscsi.GetNodesFn != nil {
+		return iscsi.GetNodesFn()
+	}
 	return iscsi.getNodes()
 }
 
 // CreateOrUpdateNode creates new or update existing iSCSI node in iscsid database
 func (iscsi *MockISCSI) CreateOrUpdateNode(target ISCSITarget, options map[string]string) error {
+	if iscsi.CreateOrUpdateNodeFn != nil {
+		return iscsi.CreateOrUpdateNodeFn(target, options)
+	}
 	return iscsi.newNode(target, options)
 }
 
 // DeleteNode delete iSCSI node from iscsid database
 func (iscsi *MockISCSI) DeleteNode(target ISCSITarget) error {
+	if iscsi.DeleteNodeFn != nil {
+		return iscsi.DeleteNodeFn(target)
+	}
 	return iscsi.deleteNode(target)
 }
 
+// AddPathToTarget creates a node record for a new portal of a target, copying the settings of an existing record, and logs in
+func (iscsi *MockISCSI) AddPathToTarget(iqn string, newPortal string, iface string) error {
+	if iscsi.AddPathToTargetFn != nil {
+		return iscsi.AddPathToTargetFn(iqn, newPortal, iface)
+	}
+	if iscsi.induced().InduceAddPathError {
+		return errors.New("addPathToTarget induced error")
+	}
+	return iscsi.PerformLogin(ISCSITarget{Portal: newPortal, Target: iqn, Iface: iface})
+}
+
+// GetIfaceSessionCounts returns the number of sessions using each iSCSI iface
+func (iscsi *MockISCSI) GetIfaceSessionCounts() ([]IfaceSessionCount, error) {
+	if iscsi.GetIfaceSessionCountsFn != nil {
+		return iscsi.GetIfaceSessionCountsFn()
+	}
+	sessions, err := iscsi.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+	return countIfaceSessions(sessions), nil
+}
+
+// GetSIDToHostMap returns the mocked sessions on the SCSI hosts 3 onwards, one host per session
+func (iscsi *MockISCSI) GetSIDToHostMap() (map[string]int, error) {
+	if iscsi.GetSIDToHostMapFn != nil {
+		return iscsi.GetSIDToHostMapFn()
+	}
+	sessions, err := iscsi.getSessions()
+	if err != nil {
+		return nil, err
+	}
+	hosts := make(map[string]int, len(sessions))
+	for i, s := range sessions {
+		hosts[s.SID] = i + 3
+	}
+	return hosts, nil
+}
+
+// DetectIBFTConfiguration returns an empty configuration, the mocked system not booting from an iSCSI target
+func (iscsi *MockISCSI) DetectIBFTConfiguration() (IBFTConfiguration, error) {
+	if iscsi.DetectIBFTConfigurationFn != nil {
+		return iscsi.DetectIBFTConfigurationFn()
+	}
+	return IBFTConfiguration{}, nil
+}
+
+// AuditConsistency compares the mocked node records with the mocked sessions and reports their drift
+func (iscsi *MockISCSI) AuditConsistency() ([]ConsistencyFinding, error) {
+	if iscsi.AuditConsistencyFn != nil {
+		return iscsi.AuditConsistencyFn()
+	}
+	nodes, err := iscsi.GetNodes()
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := iscsi.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+	return auditConsistency(nodes, sessions), nil
+}
+
+// ReconcileCHAPSessions logs out and in again, one after the other, the mocked sessions whose CHAP user or secrets
+// differ from their node record
+func (iscsi *MockISCSI) ReconcileCHAPSessions(maxParallel int) (NodeOpResults, error) {
+	if iscsi.ReconcileCHAPSessionsFn != nil {
+		return iscsi.ReconcileCHAPSessionsFn(maxParallel)
+	}
+	if err := validateMaxParallel(maxParallel); err != nil {
+		return nil, err
+	}
+	findings, err := iscsi.AuditConsistency()
+	if err != nil {
+		return nil, err
+	}
+	mismatches := chapMismatches(findings)
+	results := make(NodeOpResults, len(mismatches))
+	for i, f := range mismatches {
+		results[i].Target = f.Target
+		if results[i].Error = iscsi.performLogout(f.Target); results[i].Error == nil {
+			results[i].Error = iscsi.performLogin(f.Target)
+		}
+	}
+	return results, nodeOpsError(results)
+}
+
+// AuditTargetSource compares the targets expected by source with the mocked node records and sessions
+func (iscsi *MockISCSI) AuditTargetSource(source TargetSource) ([]ConsistencyFinding, error) {
+	if iscsi.AuditTargetSourceFn != nil {
+		return iscsi.AuditTargetSourceFn(source)
+	}
+	return auditTargetSourceOf(iscsi, source)
+}
+
+// GetSessionsByIface returns the mocked sessions established through an iSCSI iface
+func (iscsi *MockISCSI) GetSessionsByIface(iface string) ([]ISCSISession, error) {
+	if iscsi.GetSessionsByIfaceFn != nil {
+		return iscsi.GetSessionsByIfaceFn(iface)
+	}
+	if err := validateIfaceName(iface); err != nil {
+		return nil, err
+	}
+	sessions, err := iscsi.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+	return filterSessionsByIface(sessions, iface), nil
+}
+
+// GetIfaceParameters returns the iface.* parameters of an iSCSI iface
+func (iscsi *MockISCSI) GetIfaceParameters(iface string) (map[string]string, error) {
+	if iscsi.GetIfaceParametersFn != nil {
+		return iscsi.GetIfaceParametersFn(iface)
+	}
+	if iscsi.induced().InduceGetIfaceError {
+		return nil, errors.New("getIfaceParameters induced error")
+	}
+	return map[string]string{
+		"iface.iscsi_ifacename": iface,
+		"iface.transport_name":  string(ISCSITransportNameTCP),
+		"iface.vlan_id":         "0",
+		"iface.mtu":             "0",
+	}, nil
+}
+
+// SetIfaceParameters creates or updates the iface.* parameters of an iSCSI iface
+func (iscsi *MockISCSI) SetIfaceParameters(iface string, params map[string]string) error {
+	if iscsi.SetIfaceParametersFn != nil {
+		return iscsi.SetIfaceParametersFn(iface, params)
+	}
+	if iscsi.induced().InduceSetIfaceError {
+		return errors.New("setIfaceParameters induced error")
+	}
+	if err := validateIfaceName(iface); err != nil {
+		return err
+	}
+	return validateIfaceParameters(params)
+}
+
+// ExportNodes returns a snapshot of the iSCSI node records, including their CHAP secrets
+func (iscsi *MockISCSI) ExportNodes(opts SnapshotOptions) (*NodeSnapshot, error) {
+	if iscsi.ExportNodesFn != nil {
+		return iscsi.ExportNodesFn(opts)
+	}
+	nodes, err := iscsi.getNodes()
+	if err != nil {
+		return nil, err
+	}
+	return newNodeSnapshot(nodes, opts)
+}
+
+// ImportNodes creates or updates the iSCSI node records of a snapshot
+func (iscsi *MockISCSI) ImportNodes(snapshot *NodeSnapshot, opts SnapshotOptions) (NodeOpResults, error) {
+	if iscsi.ImportNodesFn != nil {
+		return iscsi.ImportNodesFn(snapshot, opts)
+	}
+	return importNodeSnapshot(snapshot, opts, iscsi.newNode)
+}
+
+// DeleteNodes delete many iSCSI nodes from iscsid database
+func (iscsi *MockISCSI) DeleteNodes(targets []ISCSITarget) (NodeOpResults, error) {
+	if iscsi.DeleteNodesFn != nil {
+		return iscsi.DeleteNodesFn(targets)
+	}
+	return runNodeOps(targets, iscsi.deleteNode)
+}
+
+// RescanAndVerifyLUN scans for a LUN on the sessions to a target and waits for its block device
+func (iscsi *MockISCSI) RescanAndVerifyLUN(target ISCSITarget, lun int, timeout time.Duration) (string, error) {
+	if iscsi.RescanAndVerifyLUNFn != nil {
+		return iscsi.RescanAndVerifyLUNFn(target, lun, timeout)
+	}
+	return iscsi.rescanAndVerifyLUN(target, lun, timeout)
+}
+
+// WaitForSessionState waits until the session with the given SID reaches the desired state
+func (iscsi *MockISCSI) WaitForSessionState(sid string, desired ISCSISessionState, timeout time.Duration) error {
+	if iscsi.WaitForSessionStateFn != nil {
+		return iscsi.WaitForSessionStateFn(sid, desired, timeout)
+	}
+	return waitForSessionState(iscsi.getClock(), iscsi.getSessions, sid, desired, timeout)
+}
+
+// GetHCTLsForTarget returns the SCSI addresses of the devices exposed by the sessions to a target
+func (iscsi *MockISCSI) GetHCTLsForTarget(target ISCSITarget) ([]HCTL, error) {
+	if iscsi.GetHCTLsForTargetFn != nil {
+		return iscsi.GetHCTLsForTargetFn(target)
+	}
+	return iscsi.getHCTLsForTarget(target)
+}
+
+// RescanHCTL scans a single SCSI address for a device
+func (iscsi *MockISCSI) RescanHCTL(h HCTL) error {
+	if iscsi.RescanHCTLFn != nil {
+		return iscsi.RescanHCTLFn(h)
+	}
+	return iscsi.rescanHCTL(h)
+}
+
+// RescanDevice rescans a block device, e.g. sdb, updating its capacity
+func (iscsi *MockISCSI) RescanDevice(device string) error {
+	if iscsi.RescanDeviceFn != nil {
+		return iscsi.RescanDeviceFn(device)
+	}
+	return iscsi.rescanDevice(device)
+}
+
+// DetectResizedDevices rescans the block devices of the sessions to a target and returns those whose capacity changed
+func (iscsi *MockISCSI) DetectResizedDevices(target ISCSITarget) ([]ResizedDevice, error) {
+	if iscsi.DetectResizedDevicesFn != nil {
+		return iscsi.DetectResizedDevicesFn(target)
+	}
+	if err := iscsi.rescanDevice("sdmock0"); err != nil {
+		return nil, err
+	}
+	return []ResizedDevice{}, nil
+}
+
+// ResolveDevicePaths returns the mocked block device of a LUN and its stable paths
+func (iscsi *MockISCSI) ResolveDevicePaths(target ISCSITarget, lun int) (DevicePaths, error) {
+	if iscsi.ResolveDevicePathsFn != nil {
+		return iscsi.ResolveDevicePathsFn(target, lun)
+	}
+	if iscsi.induced().InduceResolveDevicePathsError {
+		return DevicePaths{}, errors.New("resolveDevicePaths induced error")
+	}
+	wwid := fmt.Sprintf("36000000000000000000000000000%04d", lun)
+	return DevicePaths{
+		Devices:        []string{"sdmock0"},
+		ByPath:         []string{fmt.Sprintf("/dev/disk/by-path/ip-%s-iscsi-%s-lun-%d", target.Portal, target.Target, lun)},
+		ByID:           []string{"/dev/disk/by-id/wwn-0x" + wwid[1:]},
+		Multipath:      "dm-0",
+		MultipathLinks: []string{"/dev/disk/by-id/dm-uuid-mpath-" + wwid, "/dev/mapper/" + wwid},
+		DMUUID:         "/dev/disk/by-id/dm-uuid-mpath-" + wwid,
+	}, nil
+}
+
 // SetCHAPCredentials will set CHAP credentials
 func (iscsi *MockISCSI) SetCHAPCredentials(target ISCSITarget, username, password string) error {
+	if iscsi.SetCHAPCredentialsFn != nil {
+		return iscsi.SetCHAPCredentialsFn(target, username, password)
+	}
 	options := make(map[string]string)
 	options["node.session.auth.authmethod"] = "CHAP"
 	options["node.session.auth.username"] = username
 	options["node.session.auth.password"] = password
 	return iscsi.newNode(target, options)
 }
+
+// ValidateIfaces reports no mismatch of the mock ifaces
+func (iscsi *MockISCSI) ValidateIfaces() ([]IfaceFinding, error) {
+	if iscsi.ValidateIfacesFn != nil {
+		return iscsi.ValidateIfacesFn()
+	}
+	return []IfaceFinding{}, nil
+}
+
+// Invalidate does nothing, the mock client caches no result
+func (iscsi *MockISCSI) Invalidate() {}
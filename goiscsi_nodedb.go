@@ -0,0 +1,118 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package goiscsi
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+// nodeDBDirs are the locations of the iscsid node database, current one first and legacy one second
+var nodeDBDirs = []string{"/etc/iscsi/nodes", "/var/lib/iscsi/nodes"}
+
+// errNodeDBUnavailable is returned when no node database directory is found
+var errNodeDBUnavailable = goiscsierrors.New(goiscsierrors.NotFound, "iSCSI node database is not available")
+
+// readNodeDB reads the node records from the first of the iscsid node database dirs under root, without running iscsiadm.
+// The records are stored as nodes/<target>/<address>,<port>,<tpgt>/<iface>, or as
+// nodes/<target>/<address>,<port>,<tpgt> by older versions, in the format shown by iscsiadm.
+// The CHAP secrets are masked as iscsiadm does.
+func readNodeDB(root string, dirs []string) ([]ISCSINode, error) {
+	dir := ""
+	for _, d := range dirs {
+		if info, err := os.Stat(filepath.Join(root, d)); err == nil && info.IsDir() {
+			dir = filepath.Join(root, d)
+			break
+		}
+	}
+	if dir == "" {
+		return nil, errNodeDBUnavailable
+	}
+	targets, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, classifyFileError(err)
+	}
+	nodes := []ISCSINode{}
+	for _, t := range targets {
+		if !t.IsDir() {
+			continue
+		}
+		portals, _ := os.ReadDir(filepath.Join(dir, t.Name()))
+		for _, p := range portals {
+			path := filepath.Join(dir, t.Name(), p.Name())
+			records := []string{path}
+			if p.IsDir() {
+				ifaces, _ := os.ReadDir(path)
+				records = records[:0]
+				for _, i := range ifaces {
+					records = append(records, filepath.Join(path, i.Name()))
+				}
+			}
+			for _, r := range records {
+				if n, ok := readNodeDBRecord(r, t.Name(), p.Name()); ok {
+					nodes = append(nodes, n)
+				}
+			}
+		}
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].Target != nodes[j].Target {
+			return nodes[i].Target < nodes[j].Target
+		}
+		return nodes[i].Portal < nodes[j].Portal
+	})
+	return nodes, nil
+}
+
+// readNodeDBRecord parses a node record file, taking the target and portal from its path when
+// the record does not hold them
+func readNodeDBRecord(path, target, portalDir string) (ISCSINode, bool) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return ISCSINode{}, false
+	}
+	content := string(data)
+	if !strings.Contains(content, "# BEGIN RECORD") {
+		content = "# BEGIN RECORD\n" + content
+	}
+	parsed := (&nodeParser{}).Parse([]byte(content))
+	if len(parsed) == 0 {
+		return ISCSINode{}, false
+	}
+	n := parsed[0]
+	if n.Target == "" {
+		n.Target = target
+	}
+	if n.Portal == "" {
+		// <address>,<port>,<tpgt>, joined as in the iscsiadm output
+		if parts := strings.Split(portalDir, ","); len(parts) == 3 {
+			n.Portal = net.JoinHostPort(parts[0], parts[1])
+		}
+	}
+	for _, k := range chapSecretFields {
+		if n.Fields[k] != "" {
+			n.Fields[k] = maskedSecret
+		}
+	}
+	return n, true
+}
@@ -0,0 +1,172 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"strconv"
+	"strings"
+)
+
+// OpenISCSIState is a state in the JSON shape of the open-iscsi tools, for the tools written against the JSON output
+// of iscsiadm: the sessions with the snake_case attribute names of libopeniscsiusr and the node records keyed by their
+// iscsiadm parameter names. The CHAP secrets are masked as iscsiadm does.
+type OpenISCSIState struct {
+	Sessions []OpenISCSISession  `json:"sessions"`
+	Nodes    []map[string]string `json:"nodes"`
+}
+
+// OpenISCSISession is a session in the JSON shape of the open-iscsi tools
+type OpenISCSISession struct {
+	SID               int    `json:"sid"`
+	TargetName        string `json:"target_name"`
+	Address           string `json:"address"`
+	Port              int    `json:"port"`
+	PersistentAddress string `json:"persistent_address"`
+	PersistentPort    int    `json:"persistent_port"`
+	// TPGT is the target portal group tag, -1 if unknown
+	TPGT            int            `json:"tpgt"`
+	State           string         `json:"state"`
+	ConnectionState string         `json:"connection_state"`
+	Username        string         `json:"username"`
+	Password        string         `json:"password"`
+	UsernameIn      string         `json:"username_in"`
+	PasswordIn      string         `json:"password_in"`
+	Iface           OpenISCSIIface `json:"iface"`
+}
+
+// OpenISCSIIface is the iface of a session in the JSON shape of the open-iscsi tools
+type OpenISCSIIface struct {
+	Name          string `json:"name"`
+	TransportName string `json:"transport_name"`
+	InitiatorName string `json:"initiator_name"`
+	IPAddress     string `json:"ipaddress"`
+	Netdev        string `json:"netdev"`
+}
+
+// OpenISCSI converts the sessions and node records of the state to the JSON shape of the open-iscsi tools.
+// The block devices and the node metadata of goiscsi have no open-iscsi equivalent and are left out.
+func (s *State) OpenISCSI() OpenISCSIState {
+	state := OpenISCSIState{
+		Sessions: make([]OpenISCSISession, 0, len(s.Sessions)),
+		Nodes:    make([]map[string]string, 0, len(s.Nodes)),
+	}
+	for _, session := range s.Sessions {
+		state.Sessions = append(state.Sessions, openISCSISession(session))
+	}
+	for _, n := range s.Nodes {
+		state.Nodes = append(state.Nodes, openISCSINode(n))
+	}
+	return state
+}
+
+// WriteOpenISCSIJSON writes the sessions and node records of the state as JSON in the shape of the open-iscsi tools
+func (s *State) WriteOpenISCSIJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s.OpenISCSI()); err != nil {
+		return fmt.Errorf("error writing the open-iscsi JSON: %w", err)
+	}
+	return nil
+}
+
+// openISCSISession converts a session to the JSON shape of the open-iscsi tools
+func openISCSISession(s ISCSISession) OpenISCSISession {
+	persistent := s.OriginalPortal
+	if persistent == "" {
+		persistent = s.Portal
+	}
+	current := s.EffectivePortal
+	if current == "" {
+		current = s.Portal
+	}
+	session := OpenISCSISession{
+		TargetName:      s.Target,
+		TPGT:            -1,
+		State:           string(s.ISCSISessionState),
+		ConnectionState: string(s.ISCSIConnectionState),
+		Username:        s.Username,
+		Password:        maskSecret(s.Password),
+		UsernameIn:      s.UsernameIn,
+		PasswordIn:      maskSecret(s.PasswordIn),
+		Iface: OpenISCSIIface{
+			Name:          s.IfaceName,
+			TransportName: string(s.IfaceTransport),
+			InitiatorName: s.IfaceInitiatorname,
+			IPAddress:     s.IfaceIPaddress,
+			Netdev:        s.IfaceNetdev,
+		},
+	}
+	session.SID, _ = strconv.Atoi(s.SID)
+	session.Address, session.Port = openISCSIPortal(current)
+	session.PersistentAddress, session.PersistentPort = openISCSIPortal(persistent)
+	if tag, err := s.ParsedGroupTag(); err == nil {
+		if v, ok := tag.Value(); ok {
+			session.TPGT = int(v)
+		}
+	}
+	return session
+}
+
+// openISCSIPortal returns the address and port of a portal, with the default port if it has none
+func openISCSIPortal(portal string) (string, int) {
+	address, port, err := SplitPortal(portal)
+	if err != nil {
+		return portal, DefaultPort
+	}
+	if port == 0 {
+		port = DefaultPort
+	}
+	return address, port
+}
+
+// openISCSINode returns the fields of a node record keyed by their iscsiadm parameter names, without the metadata
+// of goiscsi and with the CHAP secrets masked
+func openISCSINode(n ISCSINode) map[string]string {
+	fields := maps.Clone(n.Fields)
+	if fields == nil {
+		fields = map[string]string{}
+	}
+	maps.DeleteFunc(fields, func(k, _ string) bool { return strings.HasPrefix(k, NodeMetadataPrefix) })
+	if _, ok := fields["node.name"]; !ok && n.Target != "" {
+		fields["node.name"] = n.Target
+	}
+	if _, ok := fields["node.conn[0].address"]; !ok && n.Portal != "" {
+		address, port := openISCSIPortal(n.Portal)
+		fields["node.conn[0].address"] = address
+		fields["node.conn[0].port"] = fmt.Sprint(port)
+	}
+	for _, field := range chapSecretFields {
+		if v, ok := fields[field]; ok {
+			fields[field] = maskSecret(v)
+		}
+	}
+	return fields
+}
+
+// maskSecret returns the masked secret, or "" if it is unset
+func maskSecret(secret string) string {
+	if secret == "" || secret == "<empty>" {
+		return secret
+	}
+	return maskedSecret
+}
@@ -0,0 +1,319 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// DefaultOptionsWatchInterval is how often WatchOptionsFile checks the options file for changes
+	DefaultOptionsWatchInterval = 10 * time.Second
+	// AllowUnknownOptions set to "true" makes NewLinuxISCSIE accept option keys it does not know
+	AllowUnknownOptions = "allowUnknownOptions"
+)
+
+// ErrInvalidOptions is returned when the options given to NewLinuxISCSIE are not valid
+var ErrInvalidOptions = goiscsierrors.New(goiscsierrors.Validation, "invalid options")
+
+// linuxOptionValidators holds the validation of each option known to LinuxISCSI
+var linuxOptionValidators = map[string]func(string) error{
+	ChrootDirectory:        validateDirectory,
+	TargetFilterRegex:      validateRegex,
+	TargetFilterPrefixes:   validateAny,
+	LoginBackoff:           validateDuration,
+	SlowSessionThreshold:   validateDuration,
+	ErrorOnExistingSession: validateBool,
+	CleanEnvironment:       validateBool,
+	ExcludeEnvironment:     validateAny,
+	SessionSource:          validateOneOf("auto", "sysfs", "iscsiadm"),
+	NodeSource:             validateOneOf("auto", "db", "iscsiadm"),
+	ProtectLastPath:        validateBool,
+	SerializeMutations:     validateBool,
+	CheckIscsid:            validateBool,
+	Locale:                 validateAny,
+	SysfsRoot:              validateDirectory,
+	DevRoot:                validateDirectory,
+	BatchNodeUpdates:       validateBool,
+	ScanSCSIHosts:          validateBool,
+	UnsafeSkipValidation:   validateBool,
+	AttachErrorContext:     validateBool,
+	ProcessLifetime:        validateDuration,
+	RollbackDiscovery:      validateBool,
+	SessionCacheTTL:        validateDuration,
+	NodeCacheTTL:           validateDuration,
+	IfaceCacheTTL:          validateDuration,
+	HostLock:               validateBool,
+	EnforceMaxSessions:     validateBool,
+	CommandTimeout:         validateDuration,
+	JournalFile:            validateAny,
+	JournalMaxSize:         validateNonNegativeInt,
+	JournalMaxBackups:      validateNonNegativeInt,
+	MaxOutputBytes:         validateNonNegativeInt,
+	MaxRecords:             validateNonNegativeInt,
+	AllowUnknownOptions:    validateBool,
+	LogLevel:               validateOneOf("error", "info", "debug"),
+	RetryAttempts:          validateNonNegativeInt,
+	RetryDelay:             validateDuration,
+	RetryMaxDelay:          validateDuration,
+}
+
+// NewLinuxISCSIE returns an LinuxISCSI client after validating the options.
+// Unknown option keys are rejected unless AllowUnknownOptions is set.
+func NewLinuxISCSIE(opts map[string]string) (*LinuxISCSI, error) {
+	if err := validateOptions(opts, linuxOptionValidators); err != nil {
+		return nil, err
+	}
+	return NewLinuxISCSI(opts), nil
+}
+
+func validateOptions(opts map[string]string, validators map[string]func(string) error) error {
+	allowUnknown := optionBool(opts, AllowUnknownOptions)
+	var errs []error
+	keys := make([]string, 0, len(opts))
+	for k := range opts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		validate, ok := validators[k]
+		if !ok {
+			if !allowUnknown {
+				errs = append(errs, fmt.Errorf("unknown option %q", k))
+			}
+			continue
+		}
+		if opts[k] == "" {
+			continue
+		}
+		if err := validate(opts[k]); err != nil {
+			errs = append(errs, fmt.Errorf("option %q: %w", k, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidOptions, errors.Join(errs...))
+	}
+	return nil
+}
+
+// optionBool returns the boolean value of an option, false if it is not set or malformed
+func optionBool(opts map[string]string, key string) bool {
+	b, _ := strconv.ParseBool(opts[key])
+	return b
+}
+
+// optionInt returns the integer value of an option, def if it is not set or malformed
+func optionInt(opts map[string]string, key string, def int) int {
+	n, err := strconv.Atoi(opts[key])
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+func validateAny(_ string) error {
+	return nil
+}
+
+func validateDirectory(v string) error {
+	info, err := os.Stat(v)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", v)
+	}
+	return nil
+}
+
+func validateRegex(v string) error {
+	_, err := regexp.Compile(v)
+	return err
+}
+
+func validateDuration(v string) error {
+	d, err := time.ParseDuration(v)
+	if err == nil && d < 0 {
+		return fmt.Errorf("negative duration %s", v)
+	}
+	return err
+}
+
+func validateNonNegativeInt(v string) error {
+	n, err := strconv.Atoi(v)
+	if err == nil && n < 0 {
+		return fmt.Errorf("negative value %d", n)
+	}
+	return err
+}
+
+func validateBool(v string) error {
+	_, err := strconv.ParseBool(v)
+	return err
+}
+
+func validateOneOf(values ...string) func(string) error {
+	return func(v string) error {
+		for _, allowed := range values {
+			if v == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not one of %s", v, strings.Join(values, ", "))
+	}
+}
+
+// LoadOptionsFromFile reads client options from a file.
+// Each line of the file holds a key=value pair; blank lines and lines starting with # are ignored.
+func LoadOptionsFromFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, classifyFileError(err)
+	}
+	opts := make(map[string]string)
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.Contains(line, "=") {
+			return nil, goiscsierrors.Wrap(goiscsierrors.Validation, fmt.Errorf("%s:%d: expected key=value", path, n+1))
+		}
+		key, value := fieldKeyValue(line, "=")
+		if key == "" {
+			return nil, goiscsierrors.Wrap(goiscsierrors.Validation, fmt.Errorf("%s:%d: empty key", path, n+1))
+		}
+		opts[key] = value
+	}
+	return opts, nil
+}
+
+// WatchOptionsFile loads the client options from path and applies them over the current options of the client,
+// e.g. those of its constructor, which the options of the file override. The file is then watched for changes with
+// inotify, and also checked every interval for the file systems not reporting them, its options being applied again
+// whenever they change: the options the previous version of the file set are reverted, unless changed since, e.g.
+// by SetTimeout, and the new ones applied over the current options. The options of the file are validated first:
+// an invalid file is reported and the current options are kept. Besides the options of the client, the file can set its log level and retry
+// policy with LogLevel, RetryAttempts, RetryDelay and RetryMaxDelay. It blocks until ctx is done and only returns
+// an error if the initial load fails.
+func (i *ISCSIType) WatchOptionsFile(ctx context.Context, path string, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultOptionsWatchInterval
+	}
+	file := &optionsFile{path: path}
+	if err := i.applyOptionsFile(file); err != nil {
+		return err
+	}
+
+	var events <-chan fsnotify.Event
+	var watchErrors <-chan error
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		defer watcher.Close()
+		// the directory is watched as the file may be replaced rather than written, e.g. in a ConfigMap volume
+		if err = watcher.Add(filepath.Dir(path)); err == nil {
+			events, watchErrors = watcher.Events, watcher.Errors
+		}
+	}
+	if err != nil {
+		i.errorf("\nError watching %s for changes, checking it every %s: %v", path, interval, err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watchErrors:
+			i.errorf("\nError watching %s for changes: %v", path, err)
+			continue
+		case <-events:
+		case <-ticker.C:
+		}
+		if err := i.applyOptionsFile(file); err != nil {
+			i.errorf("\nError reloading options from %s, keeping the current options: %v", path, err)
+		}
+	}
+}
+
+// optionsFile is the state of an options file watched by WatchOptionsFile
+type optionsFile struct {
+	path string
+	// seen holds the options of the file read last, valid or not, and applied those applied last
+	seen, applied map[string]string
+	// shadowed holds the values the options of the client had before the file set them
+	shadowed map[string]string
+}
+
+// applyOptionsFile validates the options of the watched file and sets them over the current options of the client,
+// unless they are the options seen last, valid or not. The options the file applied before are reverted first.
+func (i *ISCSIType) applyOptionsFile(file *optionsFile) error {
+	opts, err := LoadOptionsFromFile(file.path)
+	if err != nil {
+		return err
+	}
+	if file.seen != nil && maps.Equal(opts, file.seen) {
+		return nil
+	}
+	file.seen = opts
+	// the current options were accepted before, only those of the file are checked
+	checked := maps.Clone(opts)
+	if i.isMock() || optionBool(opts, AllowUnknownOptions) || optionBool(i.getOptions(), AllowUnknownOptions) {
+		checked[AllowUnknownOptions] = "true"
+	}
+	if err = validateOptions(checked, linuxOptionValidators); err != nil {
+		return err
+	}
+	i.updateOptions(func(options map[string]string) {
+		for k, v := range file.applied {
+			if current, ok := options[k]; !ok || current != v {
+				// changed since by other means
+				continue
+			}
+			if shadowed, ok := file.shadowed[k]; ok {
+				options[k] = shadowed
+			} else {
+				delete(options, k)
+			}
+		}
+		file.shadowed = make(map[string]string)
+		for k, v := range opts {
+			if current, ok := options[k]; ok {
+				file.shadowed[k] = current
+			}
+			options[k] = v
+		}
+		file.applied = opts
+	})
+	return nil
+}
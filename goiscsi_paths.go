@@ -0,0 +1,111 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+)
+
+// Paths holds the locations of the open-iscsi files read and written by a Linux client, relative to its chroot
+// directory. The empty fields take their default, from DefaultPaths, e.g. to relocate a single file in tests.
+type Paths struct {
+	// InitiatorNameFile is the initiator name file read by GetInitiators, /etc/iscsi/initiatorname.iscsi
+	InitiatorNameFile string
+	// AlternateInitiatorNameFiles are the initiator name files of older or other distributions, also read by
+	// GetAllInitiators
+	AlternateInitiatorNameFiles []string
+	// IscsidConf is the configuration file of iscsid, /etc/iscsi/iscsid.conf
+	IscsidConf string
+	// NodeDBDirs are the locations of the node database of iscsid, the first existing one being read:
+	// /etc/iscsi/nodes on current distributions, /var/lib/iscsi/nodes on older RHEL and SUSE ones
+	NodeDBDirs []string
+	// MetadataDir is where the metadata of the node records is stored
+	MetadataDir string
+	// LockDir is the lock directory of open-iscsi, /run/lock/iscsi, holding the lock of its database
+	LockDir string
+	// MultipathConf is the configuration file of dm-multipath, /etc/multipath.conf, checked by AnalyzeHostTuning
+	MultipathConf string
+}
+
+// DefaultPaths returns the locations of the open-iscsi files on the Debian, Ubuntu, RHEL and SUSE layouts
+func DefaultPaths() Paths {
+	return Paths{
+		InitiatorNameFile:           DefaultInitiatorNameFile,
+		AlternateInitiatorNameFiles: slices.Clone(alternateInitiatorNameFiles),
+		IscsidConf:                  iscsidConfFile,
+		NodeDBDirs:                  slices.Clone(nodeDBDirs),
+		MetadataDir:                 nodeMetadataDir,
+		LockDir:                     hostLockDir,
+		MultipathConf:               multipathConfFile,
+	}
+}
+
+// withDefaults returns p with its empty fields set to their default
+func (p Paths) withDefaults() Paths {
+	d := DefaultPaths()
+	if p.InitiatorNameFile != "" {
+		d.InitiatorNameFile = p.InitiatorNameFile
+	}
+	if p.AlternateInitiatorNameFiles != nil {
+		d.AlternateInitiatorNameFiles = slices.Clone(p.AlternateInitiatorNameFiles)
+	}
+	if p.IscsidConf != "" {
+		d.IscsidConf = p.IscsidConf
+	}
+	if p.NodeDBDirs != nil {
+		d.NodeDBDirs = slices.Clone(p.NodeDBDirs)
+	}
+	if p.MetadataDir != "" {
+		d.MetadataDir = p.MetadataDir
+	}
+	if p.LockDir != "" {
+		d.LockDir = p.LockDir
+	}
+	if p.MultipathConf != "" {
+		d.MultipathConf = p.MultipathConf
+	}
+	return d
+}
+
+// SetPaths sets the locations of the open-iscsi files of the client, the empty fields keeping their default
+func (iscsi *LinuxISCSI) SetPaths(paths Paths) {
+	iscsi.pathsMu.Lock()
+	defer iscsi.pathsMu.Unlock()
+	iscsi.paths = paths
+}
+
+// getPaths returns the locations of the open-iscsi files of the client, relative to its chroot directory
+func (iscsi *LinuxISCSI) getPaths() Paths {
+	iscsi.pathsMu.RLock()
+	defer iscsi.pathsMu.RUnlock()
+	return iscsi.paths.withDefaults()
+}
+
+// hostPath returns the location of path under the chroot directory of the operation of ctx
+func (iscsi *LinuxISCSI) hostPath(ctx context.Context, path string) string {
+	return filepath.Join(iscsi.callChroot(ctx), path)
+}
+
+// metadataDir returns the directory of the metadata of the node records under the chroot directory of the
+// operation of ctx
+func (iscsi *LinuxISCSI) metadataDir(ctx context.Context) string {
+	return iscsi.hostPath(ctx, iscsi.getPaths().MetadataDir)
+}
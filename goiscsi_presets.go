@@ -0,0 +1,95 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+// NodePreset names a set of recommended node record settings for a Dell array family
+type NodePreset string
+
+const (
+	// PresetPowerStoreDefault holds the settings recommended for PowerStore
+	PresetPowerStoreDefault NodePreset = "powerstore-default"
+	// PresetPowerMaxDefault holds the settings recommended for PowerMax
+	PresetPowerMaxDefault NodePreset = "powermax-default"
+	// PresetUnityDefault holds the settings recommended for Unity
+	PresetUnityDefault NodePreset = "unity-default"
+)
+
+// ErrUnknownPreset is returned for a node preset which does not exist
+var ErrUnknownPreset = goiscsierrors.New(goiscsierrors.Validation, "unknown node preset")
+
+// nodePresets holds the node record settings of each preset, as recommended by the host
+// connectivity guide of the array family
+var nodePresets = map[NodePreset]map[string]string{
+	PresetPowerStoreDefault: {
+		"node.session.timeo.replacement_timeout": "15",
+		"node.session.cmds_max":                  "128",
+		"node.session.queue_depth":               "32",
+		"node.conn[0].timeo.noop_out_interval":   "5",
+		"node.conn[0].timeo.noop_out_timeout":    "5",
+	},
+	PresetPowerMaxDefault: {
+		"node.session.timeo.replacement_timeout": "120",
+		"node.session.initial_login_retry_max":   "8",
+		"node.session.iscsi.FastAbort":           "No",
+		"node.session.cmds_max":                  "128",
+		"node.session.queue_depth":               "32",
+		"node.conn[0].timeo.noop_out_interval":   "5",
+		"node.conn[0].timeo.noop_out_timeout":    "5",
+	},
+	PresetUnityDefault: {
+		"node.session.timeo.replacement_timeout": "120",
+		"node.session.cmds_max":                  "128",
+		"node.session.queue_depth":               "32",
+		"node.conn[0].timeo.noop_out_interval":   "5",
+		"node.conn[0].timeo.noop_out_timeout":    "5",
+	},
+}
+
+// NodePresets returns the names of the node presets, sorted
+func NodePresets() []NodePreset {
+	return slices.Sorted(maps.Keys(nodePresets))
+}
+
+// PresetParameters returns a copy of the node record settings of a preset
+func PresetParameters(preset NodePreset) (map[string]string, error) {
+	params, ok := nodePresets[preset]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPreset, preset)
+	}
+	return maps.Clone(params), nil
+}
+
+// ApplyNodePreset creates or updates the node record of a target with the settings of a preset,
+// through CreateOrUpdateNode. The overrides take precedence over the settings of the preset.
+func ApplyNodePreset(iscsi ISCSIinterface, target ISCSITarget, preset NodePreset, overrides map[string]string) error {
+	params, err := PresetParameters(preset)
+	if err != nil {
+		return err
+	}
+	maps.Copy(params, overrides)
+	return iscsi.CreateOrUpdateNode(target, params)
+}
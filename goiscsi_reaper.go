@@ -0,0 +1,119 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+// ProcessLifetime is the hard lifetime of the iscsiadm processes run by a client, e.g. "5m". A background reaper
+// kills the processes running longer, which fail with ErrProcessKilled. Default is no limit.
+const ProcessLifetime = "processLifetime"
+
+// ErrProcessKilled is returned when an iscsiadm process stuck beyond the ProcessLifetime option was killed
+var ErrProcessKilled = goiscsierrors.New(goiscsierrors.Timeout, "iscsiadm process killed after exceeding its lifetime")
+
+// reaperInterval is the longest time between two checks of the processes tracked by a reaper
+var reaperInterval = time.Second
+
+// processReaper tracks the processes of a client by PID and kills the ones exceeding its lifetime.
+// Its goroutine runs only while processes are tracked.
+type processReaper struct {
+	lifetime time.Duration
+
+	mu        sync.Mutex
+	processes map[int]*trackedProcess
+	running   bool
+}
+
+type trackedProcess struct {
+	process *os.Process
+	started time.Time
+	killed  bool
+}
+
+// processReaper returns the reaper of the client, nil if the ProcessLifetime option is not set
+func (iscsi *LinuxISCSI) processReaper() *processReaper {
+	lifetime, err := time.ParseDuration(iscsi.getOptions()[ProcessLifetime])
+	if err != nil || lifetime <= 0 {
+		return nil
+	}
+	iscsi.reaperMu.Lock()
+	defer iscsi.reaperMu.Unlock()
+	if iscsi.reaper == nil || iscsi.reaper.lifetime != lifetime {
+		iscsi.reaper = &processReaper{lifetime: lifetime, processes: map[int]*trackedProcess{}}
+	}
+	return iscsi.reaper
+}
+
+// track tracks the process of the started cmd, until the returned function is called.
+// The function returns whether the process was killed. A nil reaper tracks nothing.
+func (r *processReaper) track(cmd *exec.Cmd) func() bool {
+	if r == nil || cmd.Process == nil {
+		return func() bool { return false }
+	}
+	pid := cmd.Process.Pid
+	p := &trackedProcess{process: cmd.Process, started: time.Now()}
+	r.mu.Lock()
+	r.processes[pid] = p
+	if !r.running {
+		r.running = true
+		go r.run()
+	}
+	r.mu.Unlock()
+	return func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.processes, pid)
+		return p.killed
+	}
+}
+
+// run checks the tracked processes until none is left
+func (r *processReaper) run() {
+	ticker := time.NewTicker(min(r.lifetime, reaperInterval))
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if !r.reap(now) {
+			return
+		}
+	}
+}
+
+// reap kills the tracked processes started more than the lifetime before now,
+// returning false and stopping the reaper if no process is tracked anymore
+func (r *processReaper) reap(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.processes {
+		if !p.killed && now.Sub(p.started) > r.lifetime {
+			p.killed = p.process.Kill() == nil
+		}
+	}
+	if len(r.processes) == 0 {
+		r.running = false
+		return false
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// RollbackDiscovery set to "true" undoes a discovery failing after iscsiadm created records, e.g. on a failed
+// login to a discovered target: the sessions established by the discovery are logged out of, and the node records
+// and the discovery record it created are deleted, restoring the state before the call. Without it, the failed
+// logins of a discovery are ignored.
+const RollbackDiscovery = "rollbackDiscovery"
+
+// discoveryRollback records the state before a discovery to undo it
+type discoveryRollback struct {
+	iscsi *LinuxISCSI
+	// ctx is the context of the discovery, whose chroot the rollback applies to
+	ctx           context.Context
+	address       string
+	discoveryType string
+	// discoveryRecord tells whether the discovery record existed before the discovery
+	discoveryRecord bool
+	// nodes and sessions hold the node records and the sessions before the discovery
+	nodes    map[string]bool
+	sessions map[string]bool
+}
+
+// startDiscoveryRollback records the state before a discovery if the RollbackDiscovery option is set, nil otherwise
+func (iscsi *LinuxISCSI) startDiscoveryRollback(ctx context.Context, address, discoveryType string) (*discoveryRollback, error) {
+	if !optionBool(iscsi.getOptions(), RollbackDiscovery) {
+		return nil, nil
+	}
+	r := &discoveryRollback{iscsi: iscsi, ctx: ctx, address: address, discoveryType: discoveryType,
+		nodes: map[string]bool{}, sessions: map[string]bool{}}
+	exe := iscsi.buildISCSICommand(
+		[]string{"iscsiadm", "-m", "discoverydb", "-t", discoveryType, "-p", address, "-o", "show"})
+	_, err := iscsi.runCommand(ctx, exe)
+	if err != nil && !isNoObjsExitCode(err) {
+		return nil, err
+	}
+	r.discoveryRecord = err == nil
+	nodes, err := iscsi.getNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range nodes {
+		r.nodes[nodeRecordKey(n)] = true
+	}
+	sessions, err := iscsi.getSessions()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sessions {
+		r.sessions[s.SID] = true
+	}
+	return r, nil
+}
+
+// nodeRecordKey identifies a node record by its target, portal and iface
+func nodeRecordKey(n ISCSINode) string {
+	return n.Target + "," + n.Portal + "," + nodeIface(n)
+}
+
+// nodeIface returns the iface of a node record, "default" if it has none
+func nodeIface(n ISCSINode) string {
+	if iface := replaceEmpty(n.Fields["iface.iscsi_ifacename"]); iface != "" {
+		return iface
+	}
+	return "default"
+}
+
+// undo logs out of the new sessions to the discovered targets and deletes the node records of the discovered
+// targets and the discovery record created since the rollback started, then returns err with the errors of
+// the rollback, if any. A nil rollback returns err.
+func (r *discoveryRollback) undo(err error, discovered []ISCSITarget) error {
+	if r == nil {
+		return err
+	}
+	iscsi := r.iscsi
+	iscsi.logf("\nRolling back the discovery through %s: %v", r.address, err)
+	isDiscovered := func(target, portal string) bool {
+		for _, t := range discovered {
+			if t.Target == target && portalMatches(portal, t.Portal) {
+				return true
+			}
+		}
+		return false
+	}
+	// the shared output of the discovery lists the targets whose node records are deleted below
+	if cache := iscsi.getDiscoveryCache(); cache != nil {
+		cache.Invalidate(r.address)
+	}
+	errs := []error{err}
+	sessions, sessionsErr := iscsi.getSessions()
+	if sessionsErr != nil {
+		errs = append(errs, fmt.Errorf("rollback: %w", sessionsErr))
+	}
+	for _, s := range sessions {
+		if !r.sessions[s.SID] && isDiscovered(s.Target, s.Portal) {
+			if logoutErr := iscsi.logoutSession(r.ctx, s.SID); logoutErr != nil {
+				errs = append(errs, fmt.Errorf("rollback: logout of session %s: %w", s.SID, logoutErr))
+			}
+		}
+	}
+	nodes, nodesErr := iscsi.getNodes(r.ctx)
+	if nodesErr != nil {
+		errs = append(errs, fmt.Errorf("rollback: %w", nodesErr))
+	}
+	for _, n := range nodes {
+		if !r.nodes[nodeRecordKey(n)] && isDiscovered(n.Target, n.Portal) {
+			t := ISCSITarget{Portal: n.Portal, Target: n.Target, Iface: nodeIface(n)}
+			if deleteErr := iscsi.deleteNode(r.ctx, t); deleteErr != nil {
+				errs = append(errs, fmt.Errorf("rollback: delete of node %s at %s: %w", t.Target, t.Portal, deleteErr))
+			}
+		}
+	}
+	if !r.discoveryRecord {
+		exe := iscsi.buildISCSICommand(
+			[]string{"iscsiadm", "-m", "discoverydb", "-t", r.discoveryType, "-p", r.address, "-o", "delete"})
+		if _, deleteErr := iscsi.runCommand(r.ctx, exe); deleteErr != nil && !isNoObjsExitCode(deleteErr) {
+			errs = append(errs, fmt.Errorf("rollback: delete of discovery record: %w", deleteErr))
+		}
+	}
+	return errors.Join(errs...)
+}
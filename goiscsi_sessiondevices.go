@@ -0,0 +1,145 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"fmt"
+	"sort"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+// sessionDevices returns the block devices of the LUNs attached to a session, sorted by SCSI address,
+// with the dm-multipath devices built on top of them
+func (tree sysfsTree) sessionDevices(s ISCSISession) []SessionDevice {
+	var devices []SessionDevice
+	for h, device := range tree.readSessionDevices(s.SID) {
+		d := SessionDevice{SID: s.SID, Target: s.Target, HCTL: h, Device: device}
+		if mpaths := tree.multipathHolders(device); len(mpaths) > 0 {
+			d.Multipath = mpaths[0]
+		}
+		devices = append(devices, d)
+	}
+	sortSessionDevices(devices)
+	return devices
+}
+
+// sortSessionDevices sorts devices by SCSI address
+func sortSessionDevices(devices []SessionDevice) {
+	sort.Slice(devices, func(i, j int) bool {
+		a, b := devices[i].HCTL, devices[j].HCTL
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Channel != b.Channel {
+			return a.Channel < b.Channel
+		}
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.LUN < b.LUN
+	})
+}
+
+// GetSessionDevices returns the SCSI block devices created through a session, e.g. sdb, and the dm-multipath
+// devices built on top of them, found by walking /sys/class/iscsi_session and /sys/block
+func (iscsi *LinuxISCSI) GetSessionDevices(sid string) ([]SessionDevice, error) {
+	if err := validateSID(sid); err != nil {
+		return nil, err
+	}
+	sessions, err := iscsi.GetSessionsFiltered(SessionFilter{SID: sid})
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, goiscsierrors.New(goiscsierrors.NotFound, fmt.Sprintf("error session %s not found", sid))
+	}
+	devices := iscsi.sysfs().sessionDevices(sessions[0])
+	if devices == nil {
+		devices = []SessionDevice{}
+	}
+	return devices, nil
+}
+
+// GetTargetDevices returns the SCSI block devices created through the sessions to a target, and the
+// dm-multipath devices built on top of them. The portal and iface of the target, if set, restrict the sessions.
+func (iscsi *LinuxISCSI) GetTargetDevices(target ISCSITarget) ([]SessionDevice, error) {
+	if err := iscsi.validateIQN(target.Target); err != nil {
+		return nil, err
+	}
+	sessions, err := iscsi.GetSessionsFiltered(SessionFilter{Target: target.Target, Portal: target.Portal, Iface: target.Iface})
+	if err != nil {
+		return nil, err
+	}
+	tree := iscsi.sysfs()
+	devices := []SessionDevice{}
+	for _, s := range sessions {
+		devices = append(devices, tree.sessionDevices(s)...)
+	}
+	sortSessionDevices(devices)
+	return devices, nil
+}
+
+// mockSessionDevices returns a mocked multipath LUN device for each session
+func mockSessionDevices(sessions []ISCSISession) []SessionDevice {
+	devices := []SessionDevice{}
+	for i, s := range sessions {
+		devices = append(devices, SessionDevice{
+			SID:       s.SID,
+			Target:    s.Target,
+			HCTL:      HCTL{Host: i, LUN: 1},
+			Device:    fmt.Sprintf("sdmock%d", i),
+			Multipath: "dm-0",
+		})
+	}
+	return devices
+}
+
+// GetSessionDevices returns a mocked block device for the mocked session of a SID
+func (iscsi *MockISCSI) GetSessionDevices(sid string) ([]SessionDevice, error) {
+	if iscsi.GetSessionDevicesFn != nil {
+		return iscsi.GetSessionDevicesFn(sid)
+	}
+	if err := validateSID(sid); err != nil {
+		return nil, err
+	}
+	sessions, err := iscsi.GetSessionsFiltered(SessionFilter{SID: sid})
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, goiscsierrors.New(goiscsierrors.NotFound, fmt.Sprintf("error session %s not found", sid))
+	}
+	return mockSessionDevices(sessions), nil
+}
+
+// GetTargetDevices returns a mocked block device for each mocked session to a target
+func (iscsi *MockISCSI) GetTargetDevices(target ISCSITarget) ([]SessionDevice, error) {
+	if iscsi.GetTargetDevicesFn != nil {
+		return iscsi.GetTargetDevicesFn(target)
+	}
+	if err := validateIQN(target.Target); err != nil {
+		return nil, err
+	}
+	sessions, err := iscsi.GetSessionsFiltered(SessionFilter{Target: target.Target, Portal: target.Portal, Iface: target.Iface})
+	if err != nil {
+		return nil, err
+	}
+	return mockSessionDevices(sessions), nil
+}
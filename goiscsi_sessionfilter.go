@@ -0,0 +1,169 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+// SessionFilter selects the sessions returned by GetSessionsFiltered. The empty fields match every session.
+type SessionFilter struct {
+	// Target is the IQN of the target of the sessions
+	Target string
+	// Portal matches the sessions to a portal, at the portal they logged in at or were redirected to. A portal
+	// without port matches the sessions to its host on any port.
+	Portal string
+	// Iface is the iSCSI iface of the sessions, the sessions without iface name using "default"
+	Iface string
+	// SID is the ID of a session
+	SID string
+	// State is the state of the sessions, e.g. ISCSISessionStateLOGGEDIN
+	State ISCSISessionState
+}
+
+// validate checks the portal, iface and SID of the filter, if set
+func (f SessionFilter) validate() error {
+	if f.Portal != "" {
+		if err := validateIPAddress(f.Portal); err != nil {
+			return err
+		}
+	}
+	if err := validateOptionalIface(f.Iface); err != nil {
+		return err
+	}
+	if f.SID != "" {
+		return validateSID(f.SID)
+	}
+	return nil
+}
+
+// matches tells whether a session matches the filter
+func (f SessionFilter) matches(s ISCSISession) bool {
+	if f.Iface != "" {
+		name := s.IfaceName
+		if name == "" {
+			name = "default"
+		}
+		if name != f.Iface {
+			return false
+		}
+	}
+	return (f.Target == "" || s.Target == f.Target) &&
+		(f.Portal == "" || s.matchesPortal(f.Portal)) &&
+		(f.SID == "" || s.SID == f.SID) &&
+		(f.State == "" || s.ISCSISessionState == f.State)
+}
+
+// filterSessions returns the sessions matching filter
+func filterSessions(sessions []ISCSISession, filter SessionFilter) []ISCSISession {
+	filtered := make([]ISCSISession, 0)
+	for _, s := range sessions {
+		if filter.matches(s) {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
+
+// GetSessionsFiltered returns the sessions matching filter. Without session cache, the sessions are filtered as
+// they are read: from sysfs, only the sessions of the SID and target of the filter are read in full, and iscsiadm
+// only queries the session of the SID of the filter.
+func (iscsi *LinuxISCSI) GetSessionsFiltered(filter SessionFilter) ([]ISCSISession, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	if iscsi.cacheTTL(cacheSessions) > 0 {
+		sessions, err := iscsi.GetSessions()
+		if err != nil {
+			return nil, err
+		}
+		return filterSessions(sessions, filter), nil
+	}
+	sessions, err := iscsi.getFilteredSessions(filter)
+	iscsi.sysfs().markBootSessions(sessions)
+	return sessions, err
+}
+
+// getFilteredSessions reads the sessions matching filter from the source of the SessionSource option
+func (iscsi *LinuxISCSI) getFilteredSessions(filter SessionFilter) ([]ISCSISession, error) {
+	source := iscsi.getOptions()[SessionSource]
+	if source != "iscsiadm" {
+		sessions, err := iscsi.sysfs().readMatchingSessions(filter)
+		if err == nil {
+			return limitRecords(iscsi, sessions, "sessions")
+		}
+		if source == "sysfs" {
+			return sessions, err
+		}
+	}
+	sessions, err := iscsi.iscsiadmSessions(nil, filter.SID)
+	if err != nil {
+		return sessions, err
+	}
+	return filterSessions(sessions, filter), nil
+}
+
+// GetSessionsByTarget returns the sessions to a target
+func (iscsi *LinuxISCSI) GetSessionsByTarget(iqn string) ([]ISCSISession, error) {
+	if err := iscsi.validateIQN(iqn); err != nil {
+		return nil, err
+	}
+	return iscsi.GetSessionsFiltered(SessionFilter{Target: iqn})
+}
+
+// GetSessionsByPortal returns the sessions to a portal, e.g. 10.0.0.1:3260, or to a host on any port
+func (iscsi *LinuxISCSI) GetSessionsByPortal(portal string) ([]ISCSISession, error) {
+	if portal == "" {
+		return nil, validateIPAddress(portal)
+	}
+	return iscsi.GetSessionsFiltered(SessionFilter{Portal: portal})
+}
+
+// GetSessionsFiltered returns the mocked sessions matching filter
+func (iscsi *MockISCSI) GetSessionsFiltered(filter SessionFilter) ([]ISCSISession, error) {
+	if iscsi.GetSessionsFilteredFn != nil {
+		return iscsi.GetSessionsFilteredFn(filter)
+	}
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	sessions, err := iscsi.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+	return filterSessions(sessions, filter), nil
+}
+
+// GetSessionsByTarget returns the mocked sessions to a target
+func (iscsi *MockISCSI) GetSessionsByTarget(iqn string) ([]ISCSISession, error) {
+	if iscsi.GetSessionsByTargetFn != nil {
+		return iscsi.GetSessionsByTargetFn(iqn)
+	}
+	if err := validateIQN(iqn); err != nil {
+		return nil, err
+	}
+	return iscsi.GetSessionsFiltered(SessionFilter{Target: iqn})
+}
+
+// GetSessionsByPortal returns the mocked sessions to a portal
+func (iscsi *MockISCSI) GetSessionsByPortal(portal string) ([]ISCSISession, error) {
+	if iscsi.GetSessionsByPortalFn != nil {
+		return iscsi.GetSessionsByPortalFn(portal)
+	}
+	if portal == "" {
+		return nil, validateIPAddress(portal)
+	}
+	return iscsi.GetSessionsFiltered(SessionFilter{Portal: portal})
+}
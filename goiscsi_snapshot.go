@@ -0,0 +1,162 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package goiscsi
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+const (
+	// NodeSnapshotVersion is the version of the NodeSnapshot format
+	NodeSnapshotVersion = 1
+
+	// encryptedSecretPrefix marks the CHAP secrets encrypted in a snapshot
+	encryptedSecretPrefix = "aes-gcm:"
+	// maskedSecret is shown by iscsiadm instead of the secrets it does not reveal
+	maskedSecret = "********"
+)
+
+// chapSecretFields are the node record fields holding CHAP secrets
+var chapSecretFields = []string{"node.session.auth.password", "node.session.auth.password_in"}
+
+// NodeSnapshot is a copy of the iSCSI node records which can be saved, e.g. as JSON, and imported back
+type NodeSnapshot struct {
+	Version int         `json:"version"`
+	Created time.Time   `json:"created"`
+	Nodes   []ISCSINode `json:"nodes"`
+}
+
+// SnapshotOptions controls ExportNodes and ImportNodes
+type SnapshotOptions struct {
+	// EncryptionKey is an AES-128, AES-192 or AES-256 key. When set, the CHAP secrets of the exported
+	// records are encrypted with AES-GCM, and the ones of the imported records decrypted.
+	EncryptionKey []byte
+}
+
+func (o SnapshotOptions) aead() (cipher.AEAD, error) {
+	if len(o.EncryptionKey) == 0 {
+		return nil, nil
+	}
+	block, err := aes.NewCipher(o.EncryptionKey)
+	if err != nil {
+		return nil, goiscsierrors.Wrap(goiscsierrors.Validation, err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// newNodeSnapshot copies the node records into a snapshot, encrypting their CHAP secrets if a key is set
+func newNodeSnapshot(nodes []ISCSINode, opts SnapshotOptions) (*NodeSnapshot, error) {
+	aead, err := opts.aead()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &NodeSnapshot{Version: NodeSnapshotVersion, Created: time.Now().UTC(), Nodes: make([]ISCSINode, 0, len(nodes))}
+	for _, n := range nodes {
+		fields := make(map[string]string, len(n.Fields))
+		for k, v := range n.Fields {
+			fields[k] = v
+		}
+		if aead != nil {
+			for _, k := range chapSecretFields {
+				if v := fields[k]; v != "" && v != maskedSecret {
+					if fields[k], err = encryptSecret(aead, v, secretAAD(n, k)); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+		snapshot.Nodes = append(snapshot.Nodes, ISCSINode{Target: n.Target, Portal: n.Portal, Fields: fields})
+	}
+	return snapshot, nil
+}
+
+// importNodeSnapshot creates or updates a node record for each node of the snapshot with createOrUpdate.
+// The secrets are decrypted before any record is changed, so a wrong key does not leave records half imported.
+func importNodeSnapshot(snapshot *NodeSnapshot, opts SnapshotOptions,
+	createOrUpdate func(ISCSITarget, map[string]string) error,
+) (NodeOpResults, error) {
+	if snapshot == nil || snapshot.Version != NodeSnapshotVersion {
+		return NodeOpResults{}, goiscsierrors.New(goiscsierrors.Validation, "error unsupported node snapshot version")
+	}
+	aead, err := opts.aead()
+	if err != nil {
+		return NodeOpResults{}, err
+	}
+	targets := make([]ISCSITarget, 0, len(snapshot.Nodes))
+	settings := make(map[ISCSITarget]map[string]string, len(snapshot.Nodes))
+	for _, n := range snapshot.Nodes {
+		fields := clonableNodeFields(n.Fields)
+		for _, k := range chapSecretFields {
+			v := fields[k]
+			switch {
+			case v == maskedSecret:
+				// the secret was not revealed at export, keep the current one
+				delete(fields, k)
+			case strings.HasPrefix(v, encryptedSecretPrefix):
+				if aead == nil {
+					return NodeOpResults{}, goiscsierrors.New(goiscsierrors.Validation,
+						"error node snapshot has encrypted CHAP secrets but no encryption key is set")
+				}
+				if fields[k], err = decryptSecret(aead, v, secretAAD(n, k)); err != nil {
+					return NodeOpResults{}, err
+				}
+			}
+		}
+		// the records are restored on their iface
+		t := ISCSITarget{Target: n.Target, Portal: n.Portal, Iface: replaceEmpty(n.Fields["iface.iscsi_ifacename"])}
+		targets = append(targets, t)
+		settings[t] = fields
+	}
+	return runNodeOps(targets, func(t ISCSITarget) error {
+		return createOrUpdate(t, settings[t])
+	})
+}
+
+// secretAAD binds an encrypted secret to its record and field, so it can't be moved to another one
+func secretAAD(n ISCSINode, field string) []byte {
+	return []byte(n.Target + "," + n.Portal + "," + field)
+}
+
+func encryptSecret(aead cipher.AEAD, secret string, aad []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", goiscsierrors.Wrap(goiscsierrors.Internal, err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(secret), aad)
+	return encryptedSecretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptSecret(aead cipher.AEAD, value string, aad []byte) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedSecretPrefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", goiscsierrors.New(goiscsierrors.Validation, "error malformed encrypted CHAP secret")
+	}
+	secret, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+	if err != nil {
+		return "", goiscsierrors.Wrap(goiscsierrors.Validation, fmt.Errorf("error decrypting CHAP secret: %w", err))
+	}
+	return string(secret), nil
+}
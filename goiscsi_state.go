@@ -0,0 +1,243 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package goiscsi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// State is a snapshot of the iSCSI sessions, node records and block devices of the system
+type State struct {
+	Captured time.Time
+	Sessions []ISCSISession
+	Nodes    []ISCSINode
+	Devices  []SessionDevice
+}
+
+// SessionDevice is a block device of a LUN attached to an iSCSI session
+type SessionDevice struct {
+	SID    string
+	Target string
+	HCTL   HCTL
+	// Device is the name of the block device, e.g. sdb
+	Device string
+	// Multipath is the name of the dm-multipath device built on top of the block device, e.g. dm-0, if any
+	Multipath string
+}
+
+// SessionChange holds a session present in two states with different attributes
+type SessionChange struct {
+	Before ISCSISession
+	After  ISCSISession
+}
+
+// NodeChange holds a node record present in two states with different fields
+type NodeChange struct {
+	Before ISCSINode
+	After  ISCSINode
+	// Fields are the names of the fields which were added, removed or changed
+	Fields []string
+}
+
+// DeviceChange holds a block device present in two states with a different address or session
+type DeviceChange struct {
+	Before SessionDevice
+	After  SessionDevice
+}
+
+// StateDiff holds the differences between two states
+type StateDiff struct {
+	AddedSessions   []ISCSISession
+	RemovedSessions []ISCSISession
+	ChangedSessions []SessionChange
+	AddedNodes      []ISCSINode
+	RemovedNodes    []ISCSINode
+	ChangedNodes    []NodeChange
+	AddedDevices    []SessionDevice
+	RemovedDevices  []SessionDevice
+	ChangedDevices  []DeviceChange
+}
+
+// CaptureState returns the current sessions and node records of a client, along with the
+// block devices of the sessions when the device tree is available in sysfs
+func CaptureState(iscsi ISCSIinterface) (*State, error) {
+	state := &State{Captured: time.Now()}
+	var err error
+	if state.Sessions, err = iscsi.GetSessions(); err != nil {
+		return nil, err
+	}
+	if state.Nodes, err = iscsi.GetNodes(); err != nil {
+		return nil, err
+	}
+	tree := defaultSysfsTree()
+	if c, ok := iscsi.(interface{ sysfs() sysfsTree }); ok {
+		tree = c.sysfs()
+	}
+	for _, s := range state.Sessions {
+		state.Devices = append(state.Devices, tree.sessionDevices(s)...)
+	}
+	sort.Slice(state.Devices, func(i, j int) bool { return state.Devices[i].Device < state.Devices[j].Device })
+	return state, nil
+}
+
+// DiffStates returns what changed between the states a and b, e.g. captured before and after an operation.
+// Sessions are matched by SID, node records by target and portal and devices by name.
+func DiffStates(a, b *State) StateDiff {
+	if a == nil {
+		a = &State{}
+	}
+	if b == nil {
+		b = &State{}
+	}
+	var diff StateDiff
+
+	before := make(map[string]ISCSISession, len(a.Sessions))
+	for _, s := range a.Sessions {
+		before[sessionKey(s)] = s
+	}
+	for _, s := range b.Sessions {
+		prev, ok := before[sessionKey(s)]
+		delete(before, sessionKey(s))
+		switch {
+		case !ok:
+			diff.AddedSessions = append(diff.AddedSessions, s)
+		case prev != s:
+			diff.ChangedSessions = append(diff.ChangedSessions, SessionChange{Before: prev, After: s})
+		}
+	}
+	for _, s := range a.Sessions {
+		if _, ok := before[sessionKey(s)]; ok {
+			diff.RemovedSessions = append(diff.RemovedSessions, s)
+		}
+	}
+
+	nodesBefore := make(map[string]ISCSINode, len(a.Nodes))
+	for _, n := range a.Nodes {
+		nodesBefore[n.Target+","+n.Portal] = n
+	}
+	for _, n := range b.Nodes {
+		key := n.Target + "," + n.Portal
+		prev, ok := nodesBefore[key]
+		delete(nodesBefore, key)
+		if !ok {
+			diff.AddedNodes = append(diff.AddedNodes, n)
+			continue
+		}
+		if fields := changedFields(prev.Fields, n.Fields); len(fields) > 0 {
+			diff.ChangedNodes = append(diff.ChangedNodes, NodeChange{Before: prev, After: n, Fields: fields})
+		}
+	}
+	for _, n := range a.Nodes {
+		if _, ok := nodesBefore[n.Target+","+n.Portal]; ok {
+			diff.RemovedNodes = append(diff.RemovedNodes, n)
+		}
+	}
+
+	devicesBefore := make(map[string]SessionDevice, len(a.Devices))
+	for _, d := range a.Devices {
+		devicesBefore[d.Device] = d
+	}
+	for _, d := range b.Devices {
+		prev, ok := devicesBefore[d.Device]
+		delete(devicesBefore, d.Device)
+		switch {
+		case !ok:
+			diff.AddedDevices = append(diff.AddedDevices, d)
+		case prev != d:
+			diff.ChangedDevices = append(diff.ChangedDevices, DeviceChange{Before: prev, After: d})
+		}
+	}
+	for _, d := range a.Devices {
+		if _, ok := devicesBefore[d.Device]; ok {
+			diff.RemovedDevices = append(diff.RemovedDevices, d)
+		}
+	}
+	return diff
+}
+
+// Empty reports whether the states had no differences
+func (d StateDiff) Empty() bool {
+	return len(d.AddedSessions)+len(d.RemovedSessions)+len(d.ChangedSessions)+
+		len(d.AddedNodes)+len(d.RemovedNodes)+len(d.ChangedNodes)+
+		len(d.AddedDevices)+len(d.RemovedDevices)+len(d.ChangedDevices) == 0
+}
+
+// String returns a summary of the differences, one per line, suitable for logs
+func (d StateDiff) String() string {
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+	for _, s := range d.AddedSessions {
+		add("+ session %s %s at %s %s", s.SID, s.Target, s.Portal, s.ISCSISessionState)
+	}
+	for _, s := range d.RemovedSessions {
+		add("- session %s %s at %s", s.SID, s.Target, s.Portal)
+	}
+	for _, c := range d.ChangedSessions {
+		add("~ session %s %s at %s %s/%s -> %s/%s", c.After.SID, c.After.Target, c.After.Portal,
+			c.Before.ISCSISessionState, c.Before.ISCSIConnectionState, c.After.ISCSISessionState, c.After.ISCSIConnectionState)
+	}
+	for _, n := range d.AddedNodes {
+		add("+ node %s at %s", n.Target, n.Portal)
+	}
+	for _, n := range d.RemovedNodes {
+		add("- node %s at %s", n.Target, n.Portal)
+	}
+	for _, c := range d.ChangedNodes {
+		add("~ node %s at %s %s", c.After.Target, c.After.Portal, strings.Join(c.Fields, ","))
+	}
+	for _, dev := range d.AddedDevices {
+		add("+ device %s %s session %s", dev.Device, dev.HCTL, dev.SID)
+	}
+	for _, dev := range d.RemovedDevices {
+		add("- device %s %s session %s", dev.Device, dev.HCTL, dev.SID)
+	}
+	for _, c := range d.ChangedDevices {
+		add("~ device %s %s session %s -> %s session %s", c.After.Device, c.Before.HCTL, c.Before.SID, c.After.HCTL, c.After.SID)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sessionKey identifies a session by its SID, or by its target and portal if the SID is unknown
+func sessionKey(s ISCSISession) string {
+	if s.SID != "" {
+		return s.SID
+	}
+	return s.Target + "," + s.Portal
+}
+
+// changedFields returns the sorted names of the fields which differ between a and b
+func changedFields(a, b map[string]string) []string {
+	var fields []string
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			fields = append(fields, k)
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
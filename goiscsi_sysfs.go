@@ -0,0 +1,397 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+// sysfsRoot is the mount point of sysfs
+var sysfsRoot = "/sys"
+
+// devRoot is where the device nodes and their links are found
+var devRoot = "/dev"
+
+// sysfsTree reads the iSCSI and block device attributes from a sysfs tree, and the device links from a /dev tree
+type sysfsTree struct {
+	// root is the mount point of sysfs
+	root string
+	// dev is where the device nodes and their links are found
+	dev string
+}
+
+// defaultSysfsTree returns the trees of the system, at sysfsRoot and devRoot
+func defaultSysfsTree() sysfsTree {
+	return sysfsTree{root: sysfsRoot, dev: devRoot}
+}
+
+// errSysfsUnavailable is returned when the iSCSI transport class is not present in sysfs
+var errSysfsUnavailable = goiscsierrors.New(goiscsierrors.NotFound, "iSCSI sysfs information is not available")
+
+// sysfsConnectionStates maps the kernel connection states to the iscsiadm ones
+var sysfsConnectionStates = map[string]ISCSIConnectionState{
+	"up":     ISCSIConnectionStateLOGGEDIN,
+	"bound":  ISCSIConnectionStateINLOGIN,
+	"down":   ISCSIConnectionStateFREE,
+	"failed": ISCSIConnectionStateFREE,
+}
+
+// sysfsTransports maps the SCSI host driver names to the iSCSI transport names
+var sysfsTransports = map[string]ISCSITransportName{
+	"iscsi_tcp": ISCSITransportNameTCP,
+	"ib_iser":   ISCSITransportNameISER,
+}
+
+// classPath returns the directory of a device class, e.g. iscsi_session
+func (tree sysfsTree) classPath(class string) string {
+	return filepath.Join(tree.root, "class", class)
+}
+
+// readSysfsAttr returns the trimmed content of a sysfs attribute, or "" if it can't be read
+func readSysfsAttr(path ...string) string {
+	data, err := os.ReadFile(filepath.Clean(filepath.Join(path...)))
+	if err != nil {
+		return ""
+	}
+	return replaceEmpty(strings.TrimSpace(string(data)))
+}
+
+// readSessions builds the session info from the key per file attributes in sysfs,
+// which unlike the iscsiadm output do not change format across versions
+func (tree sysfsTree) readSessions() ([]ISCSISession, error) {
+	return tree.readMatchingSessions(SessionFilter{})
+}
+
+// readMatchingSessions reads the sessions matching filter, only reading the other attributes of the sessions
+// whose SID and target name match
+func (tree sysfsTree) readMatchingSessions(filter SessionFilter) ([]ISCSISession, error) {
+	entries, err := os.ReadDir(tree.classPath("iscsi_session"))
+	if err != nil {
+		return nil, errSysfsUnavailable
+	}
+	sessions := []ISCSISession{}
+	for _, e := range entries {
+		sid, ok := strings.CutPrefix(e.Name(), "session")
+		if !ok || (filter.SID != "" && sid != filter.SID) {
+			continue
+		}
+		if filter.Target != "" && readSysfsAttr(tree.classPath("iscsi_session"), e.Name(), "targetname") != filter.Target {
+			continue
+		}
+		if s := tree.readSession(sid); filter.matches(s) {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		a, b := sessions[i].SID, sessions[j].SID
+		return len(a) < len(b) || (len(a) == len(b) && a < b)
+	})
+	return sessions, nil
+}
+
+// sysfsPortal returns the portal of the address and port attributes of a connection, empty if it has no address
+func sysfsPortal(conn, addressAttr, portAttr string) string {
+	address := readSysfsAttr(conn, addressAttr)
+	if address == "" {
+		return ""
+	}
+	return net.JoinHostPort(address, readSysfsAttr(conn, portAttr))
+}
+
+func (tree sysfsTree) readSession(sid string) ISCSISession {
+	dir := filepath.Join(tree.classPath("iscsi_session"), "session"+sid)
+	session := ISCSISession{
+		SID:               sid,
+		Target:            readSysfsAttr(dir, "targetname"),
+		GroupTag:          readSysfsAttr(dir, "tpgt"),
+		IfaceName:         readSysfsAttr(dir, "ifacename"),
+		ISCSISessionState: ISCSISessionState(readSysfsAttr(dir, "state")),
+		Username:          readSysfsAttr(dir, "username"),
+		Password:          readSysfsAttr(dir, "password"),
+		UsernameIn:        readSysfsAttr(dir, "username_in"),
+		PasswordIn:        readSysfsAttr(dir, "password_in"),
+	}
+	// sessions created by the kernel, from the flash of an offload adapter, have no creator process
+	switch readSysfsAttr(dir, "creator") {
+	case "-1":
+		session.SessionSource = ISCSISessionSourceFlash
+	case "":
+	default:
+		session.SessionSource = ISCSISessionSourceSoftware
+	}
+
+	conns, _ := filepath.Glob(filepath.Join(tree.classPath("iscsi_connection"), "connection"+sid+":*"))
+	if len(conns) > 0 {
+		sort.Strings(conns)
+		session.EffectivePortal = sysfsPortal(conns[0], "address", "port")
+		session.OriginalPortal = sysfsPortal(conns[0], "persistent_address", "persistent_port")
+		// offload sessions may have no current portal, only the persistent one
+		session.Portal = session.EffectivePortal
+		if session.Portal == "" {
+			session.Portal = session.OriginalPortal
+		}
+		state := readSysfsAttr(conns[0], "state")
+		if s, ok := sysfsConnectionStates[state]; ok {
+			session.ISCSIConnectionState = s
+		} else {
+			session.ISCSIConnectionState = ISCSIConnectionState(state)
+		}
+	}
+
+	host := tree.sessionHost(dir)
+	if host != "" {
+		hostDir := filepath.Join(tree.classPath("iscsi_host"), host)
+		session.IfaceIPaddress = readSysfsAttr(hostDir, "ipaddress")
+		session.IfaceInitiatorname = readSysfsAttr(hostDir, "initiatorname")
+		session.IfaceNetdev = readSysfsAttr(hostDir, "netdev")
+		driver := readSysfsAttr(tree.classPath("scsi_host"), host, "proc_name")
+		if t, ok := sysfsTransports[driver]; ok {
+			session.IfaceTransport = t
+		} else {
+			session.IfaceTransport = ISCSITransportName(driver)
+		}
+	}
+	if name := readSysfsAttr(dir, "initiatorname"); name != "" {
+		session.IfaceInitiatorname = name
+	}
+	return session
+}
+
+// readSessionAuth fills the CHAP settings of a session from sysfs, leaving them unchanged if not available
+func (tree sysfsTree) readSessionAuth(session *ISCSISession) {
+	if session.SID == "" {
+		return
+	}
+	dir := filepath.Join(tree.classPath("iscsi_session"), "session"+session.SID)
+	if _, err := os.Stat(dir); err != nil {
+		return
+	}
+	session.Username = readSysfsAttr(dir, "username")
+	session.Password = readSysfsAttr(dir, "password")
+	session.UsernameIn = readSysfsAttr(dir, "username_in")
+	session.PasswordIn = readSysfsAttr(dir, "password_in")
+}
+
+// sessionHost returns the name of the SCSI host a session belongs to, from the device path
+// of the session, e.g. /sys/devices/platform/host2/session1/iscsi_session/session1
+func (tree sysfsTree) sessionHost(sessionDir string) string {
+	path, err := filepath.EvalSymlinks(sessionDir)
+	if err != nil {
+		return ""
+	}
+	if root, err := filepath.EvalSymlinks(tree.root); err == nil {
+		path = strings.TrimPrefix(path, root)
+	}
+	for _, p := range strings.Split(path, string(filepath.Separator)) {
+		if n, ok := strings.CutPrefix(p, "host"); ok && n != "" && strings.Trim(n, "0123456789") == "" {
+			return p
+		}
+	}
+	return ""
+}
+
+// readSessionHCTLs returns the SCSI addresses of the devices attached to a session,
+// found as .../hostH/sessionN/targetH:C:T/H:C:T:L in the device tree
+func (tree sysfsTree) readSessionHCTLs(sid string) ([]HCTL, error) {
+	sessionDevDir, err := tree.sessionDeviceDir(sid)
+	if err != nil {
+		return nil, classifyFileError(err)
+	}
+	paths, _ := filepath.Glob(filepath.Join(sessionDevDir, "target*", "*:*:*:*"))
+	var hctls []HCTL
+	for _, p := range paths {
+		h, err := parseHCTL(filepath.Base(p))
+		if err != nil {
+			continue
+		}
+		hctls = append(hctls, h)
+	}
+	return hctls, nil
+}
+
+// sessionDeviceDir returns the device directory of a session, .../hostH/sessionN
+func (tree sysfsTree) sessionDeviceDir(sid string) (string, error) {
+	dir, err := filepath.EvalSymlinks(filepath.Join(tree.classPath("iscsi_session"), "session"+sid))
+	if err != nil {
+		return "", err
+	}
+	// the class entry lives in .../sessionN/iscsi_session/sessionN
+	return filepath.Dir(filepath.Dir(dir)), nil
+}
+
+// findLUNDevice returns the block device path of a LUN attached to a session, e.g. /dev/sdb
+func (tree sysfsTree) findLUNDevice(sid string, lun int) (string, bool) {
+	sessionDevDir, err := tree.sessionDeviceDir(sid)
+	if err != nil {
+		return "", false
+	}
+	paths, _ := filepath.Glob(filepath.Join(sessionDevDir, "target*", fmt.Sprintf("*:*:*:%d", lun), "block", "*"))
+	if len(paths) == 0 {
+		return "", false
+	}
+	sort.Strings(paths)
+	return "/dev/" + filepath.Base(paths[0]), true
+}
+
+func parseHCTL(s string) (HCTL, error) {
+	var h HCTL
+	n, err := fmt.Sscanf(s, "%d:%d:%d:%d", &h.Host, &h.Channel, &h.Target, &h.LUN)
+	if err != nil || n != 4 || h.String() != s {
+		return HCTL{}, fmt.Errorf("invalid HCTL %q", s)
+	}
+	return h, nil
+}
+
+// scanHCTL asks the SCSI host to scan a single channel, target and LUN
+func (tree sysfsTree) scanHCTL(h HCTL) error {
+	path := filepath.Join(tree.classPath("scsi_host"), fmt.Sprintf("host%d", h.Host), "scan")
+	return classifyFileError(os.WriteFile(path, []byte(fmt.Sprintf("%d %d %d", h.Channel, h.Target, h.LUN)), 0o200))
+}
+
+// scanHostLUN asks the SCSI host of a session to scan a LUN on all its channels and targets
+func (tree sysfsTree) scanHostLUN(sid string, lun int) error {
+	host := tree.sessionHost(filepath.Join(tree.classPath("iscsi_session"), "session"+sid))
+	if host == "" {
+		return goiscsierrors.Wrap(goiscsierrors.NotFound, fmt.Errorf("no SCSI host found for session %s", sid))
+	}
+	path := filepath.Join(tree.classPath("scsi_host"), host, "scan")
+	return classifyFileError(os.WriteFile(path, []byte(fmt.Sprintf("- - %d", lun)), 0o200))
+}
+
+// scanSessionHosts asks each SCSI host backing an iSCSI session to scan all its channels, targets and LUNs
+func (tree sysfsTree) scanSessionHosts() error {
+	entries, err := os.ReadDir(tree.classPath("iscsi_session"))
+	if err != nil {
+		return errSysfsUnavailable
+	}
+	scanned := make(map[string]bool)
+	for _, e := range entries {
+		host := tree.sessionHost(filepath.Join(tree.classPath("iscsi_session"), e.Name()))
+		if host == "" || scanned[host] {
+			continue
+		}
+		scanned[host] = true
+		path := filepath.Join(tree.classPath("scsi_host"), host, "scan")
+		if err := classifyFileError(os.WriteFile(path, []byte("- - -"), 0o200)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sessionBlockDevices returns the names of the block devices of the LUNs attached to a session, e.g. sdb
+func (tree sysfsTree) sessionBlockDevices(sid string) []string {
+	sessionDevDir, err := tree.sessionDeviceDir(sid)
+	if err != nil {
+		return nil
+	}
+	paths, _ := filepath.Glob(filepath.Join(sessionDevDir, "target*", "*:*:*:*", "block", "*"))
+	devices := make([]string, 0, len(paths))
+	for _, p := range paths {
+		devices = append(devices, filepath.Base(p))
+	}
+	return devices
+}
+
+// readSessionDevices returns the block device names of the LUNs attached to a session by SCSI address
+func (tree sysfsTree) readSessionDevices(sid string) map[HCTL]string {
+	sessionDevDir, err := tree.sessionDeviceDir(sid)
+	if err != nil {
+		return nil
+	}
+	paths, _ := filepath.Glob(filepath.Join(sessionDevDir, "target*", "*:*:*:*", "block", "*"))
+	devices := make(map[HCTL]string, len(paths))
+	for _, p := range paths {
+		h, err := parseHCTL(filepath.Base(filepath.Dir(filepath.Dir(p))))
+		if err != nil {
+			continue
+		}
+		devices[h] = filepath.Base(p)
+	}
+	return devices
+}
+
+// sysfsSectorSize is the unit of the size attribute of the block devices
+const sysfsSectorSize = 512
+
+// readBlockSize returns the size in bytes of a block device, e.g. sdb
+func (tree sysfsTree) readBlockSize(device string) (int64, error) {
+	sectors, err := strconv.ParseInt(readSysfsAttr(tree.root, "block", device, "size"), 10, 64)
+	if err != nil {
+		return 0, goiscsierrors.Wrap(goiscsierrors.NotFound, fmt.Errorf("no size found for block device %s", device))
+	}
+	return sectors * sysfsSectorSize, nil
+}
+
+// rescanSysfsBlockDevice asks the SCSI device of a block device to update its capacity
+var rescanSysfsBlockDevice = func(tree sysfsTree, device string) error {
+	path := filepath.Join(tree.root, "block", device, "device", "rescan")
+	return classifyFileError(os.WriteFile(path, []byte("1"), 0o200))
+}
+
+// multipathHolders returns the dm-multipath devices built on top of a block device, e.g. dm-3
+func (tree sysfsTree) multipathHolders(device string) []string {
+	holders, _ := os.ReadDir(filepath.Join(tree.root, "block", device, "holders"))
+	var mpaths []string
+	for _, h := range holders {
+		if strings.HasPrefix(readSysfsAttr(tree.root, "block", h.Name(), "dm", "uuid"), "mpath-") {
+			mpaths = append(mpaths, h.Name())
+		}
+	}
+	return mpaths
+}
+
+// multipathActivePaths returns the running path devices of a dm-multipath device
+func (tree sysfsTree) multipathActivePaths(dm string) []string {
+	slaves, _ := os.ReadDir(filepath.Join(tree.root, "block", dm, "slaves"))
+	var paths []string
+	for _, s := range slaves {
+		if readSysfsAttr(tree.root, "block", s.Name(), "device", "state") == "running" {
+			paths = append(paths, s.Name())
+		}
+	}
+	return paths
+}
+
+// devLinks returns the links in a directory of the /dev tree, e.g. disk/by-id, pointing to a device, e.g. sdb
+func (tree sysfsTree) devLinks(dir, device string) []string {
+	entries, _ := os.ReadDir(filepath.Join(tree.dev, dir))
+	var links []string
+	for _, e := range entries {
+		path := filepath.Join(tree.dev, dir, e.Name())
+		if target, err := os.Readlink(path); err == nil && filepath.Base(target) == device {
+			links = append(links, path)
+		}
+	}
+	return links
+}
+
+// hasHolders checks if another device, e.g. a LVM volume, is built on top of a block device
+func (tree sysfsTree) hasHolders(device string) bool {
+	holders, _ := os.ReadDir(filepath.Join(tree.root, "block", device, "holders"))
+	return len(holders) > 0
+}
@@ -0,0 +1,115 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import "fmt"
+
+// TargetSource provides the targets the storage arrays expect the host to be logged in to, e.g. read from
+// their REST API, so AuditTargetSource compares what the arrays say should exist with what the host sees
+type TargetSource interface {
+	// ExpectedTargets returns the expected targets, with their portal and, optionally, their iface
+	ExpectedTargets() ([]ISCSITarget, error)
+}
+
+// TargetSourceFunc is a TargetSource backed by a function
+type TargetSourceFunc func() ([]ISCSITarget, error)
+
+// ExpectedTargets returns the targets of f
+func (f TargetSourceFunc) ExpectedTargets() ([]ISCSITarget, error) {
+	return f()
+}
+
+const (
+	// FindingExpectedTargetWithoutNode is reported for an expected target with neither a node record nor a session
+	FindingExpectedTargetWithoutNode FindingKind = "ExpectedTargetWithoutNode"
+	// FindingExpectedTargetWithoutSession is reported for an expected target with a node record but no session
+	FindingExpectedTargetWithoutSession FindingKind = "ExpectedTargetWithoutSession"
+	// FindingUnexpectedSession is reported for a session to an expected target at a portal or through an iface
+	// which the source does not list, e.g. a path the array no longer exports
+	FindingUnexpectedSession FindingKind = "UnexpectedSession"
+)
+
+// auditTargetSource compares the expected targets with the node records and the sessions. Only the sessions to the
+// IQNs of the expected targets are checked, so the sessions to the targets of other arrays are not reported.
+func auditTargetSource(expected []ISCSITarget, nodes []ISCSINode, sessions []ISCSISession) []ConsistencyFinding {
+	findings := []ConsistencyFinding{}
+	iqns := map[string]bool{}
+	matched := make([]bool, len(sessions))
+	for _, t := range expected {
+		iqns[t.Target] = true
+		found := false
+		for i, s := range sessions {
+			if s.Target == t.Target && s.matchesPortal(t.Portal) && ifaceMatches(s.IfaceName, t.Iface) {
+				found, matched[i] = true, true
+			}
+		}
+		if found {
+			continue
+		}
+		recorded := false
+		for _, n := range nodes {
+			if n.Target == t.Target && portalMatches(n.Portal, t.Portal) && ifaceMatches(nodeIface(n), t.Iface) {
+				recorded = true
+				break
+			}
+		}
+		if recorded {
+			findings = append(findings, ConsistencyFinding{
+				Kind: FindingExpectedTargetWithoutSession, Target: t,
+				Message: fmt.Sprintf("expected target %s at %s has a node record but no session, "+
+					"log in with PerformLogin", t.Target, t.Portal),
+			})
+		} else {
+			findings = append(findings, ConsistencyFinding{
+				Kind: FindingExpectedTargetWithoutNode, Target: t,
+				Message: fmt.Sprintf("expected target %s at %s has neither a node record nor a session, "+
+					"discover it with DiscoverTargets or create it with CreateOrUpdateNode", t.Target, t.Portal),
+			})
+		}
+	}
+	for i, s := range sessions {
+		if matched[i] || !iqns[s.Target] {
+			continue
+		}
+		findings = append(findings, ConsistencyFinding{
+			Kind: FindingUnexpectedSession, Target: ISCSITarget{Target: s.Target, Portal: s.Portal, Iface: s.IfaceName}, SID: s.SID,
+			Message: fmt.Sprintf("session %s to %s at %s is not expected by the target source, "+
+				"log out with LogoutSessionBySID if the array no longer exports the portal", s.SID, s.Target, s.Portal),
+		})
+	}
+	return findings
+}
+
+// auditTargetSourceOf reads the expected targets of source and compares them with the node records and sessions
+// of client
+func auditTargetSourceOf(client ISCSIinterface, source TargetSource) ([]ConsistencyFinding, error) {
+	expected, err := source.ExpectedTargets()
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := client.GetNodes()
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := client.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+	return auditTargetSource(expected, nodes, sessions), nil
+}
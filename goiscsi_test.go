@@ -22,12 +22,26 @@
 package goiscsi
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
 )
 
 var (
@@ -46,6 +60,7 @@ func reset() {
 	GOISCSIMock.InduceDiscoveryError = false
 	GOISCSIMock.InduceInitiatorError = false
 	GOISCSIMock.InduceLoginError = false
+	GOISCSIMock.InduceCHAPRequiredError = false
 	GOISCSIMock.InduceLogoutError = false
 	GOISCSIMock.InduceRescanError = false
 	GOISCSIMock.InduceGetSessionsError = false
@@ -53,6 +68,17 @@ func reset() {
 	GOISCSIMock.InduceCreateOrUpdateNodeError = false
 	GOISCSIMock.InduceSetCHAPError = false
 	GOISCSIMock.InduceDeleteNodeError = false
+	GOISCSIMock.InduceGetHCTLsError = false
+	GOISCSIMock.InduceRescanHCTLError = false
+	GOISCSIMock.InduceRescanAndVerifyLUNError = false
+	GOISCSIMock.InduceLastPathError = false
+	GOISCSIMock.InduceFlashSessionError = false
+	GOISCSIMock.InduceAddPathError = false
+	GOISCSIMock.InduceGetIfaceError = false
+	GOISCSIMock.InduceSetIfaceError = false
+	GOISCSIMock.InduceRescanDeviceError = false
+	GOISCSIMock.InducePingError = false
+	GOISCSIMock.InduceResolveDevicePathsError = false
 }
 
 func TestPolymorphichCapability(t *testing.T) {
@@ -219,6 +245,16 @@ func TestGetInitiators(t *testing.T) {
 	if err.Error() != expectedError.Error() {
 		t.Errorf("Expected error: %v, but got: %v", expectedError, err)
 	}
+
+	// the read errors go to the logger of the client
+	logger := &recordingLogger{}
+	c.SetLogger(logger)
+	if _, err = c.GetInitiators(t.TempDir()); err == nil {
+		t.Error("Expected an error reading a directory")
+	}
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "Error gathering initiator names") {
+		t.Errorf("Expected the error to be logged but got %q", logger.lines)
+	}
 }
 
 func TestPerformRescan(t *testing.T) {
@@ -646,6 +682,9 @@ func TestSessionParserParse(t *testing.T) {
 			compareStr(t, session.Target, "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3")
 			compareStr(t, session.Portal, "192.168.1.1:3260")
 			compareStr(t, session.SID, "12")
+			compareStr(t, session.GroupTag, "1")
+			compareStr(t, session.IfaceName, "default")
+			compareStr(t, session.IfaceNetdev, "")
 			compareStr(t, string(session.IfaceTransport), string(ISCSITransportNameTCP))
 			compareStr(t, session.IfaceInitiatorname, "iqn.1994-05.com.redhat:650e84b584d")
 			compareStr(t, session.IfaceIPaddress, "1.1.1.1")
@@ -680,6 +719,17 @@ func TestSessionParserParse(t *testing.T) {
 	if len(r) != 0 {
 		t.Error("non empty result while parsing invalid data")
 	}
+
+	// localized outputs are not understood, and yield no sessions rather than partial ones
+	for _, name := range []string{"testdata/session_info_de", "testdata/session_info_ja"} {
+		data, err = os.ReadFile(name) // #nosec G304
+		if err != nil {
+			t.Error(fileErrMsg)
+		}
+		if r = sp.Parse(data); len(r) != 0 {
+			t.Errorf("non empty result %v while parsing localized data of %s", r, name)
+		}
+	}
 }
 
 func TestNodeParserParse(t *testing.T) {
@@ -744,3 +794,5170 @@ func TestFieldKeyValue(t *testing.T) {
 		t.Error("invalid value")
 	}
 }
+
+func TestDeleteNodes(t *testing.T) {
+	reset()
+	c := NewLinuxISCSI(map[string]string{})
+	tgts := []ISCSITarget{
+		{Portal: "10.0.0.0", Target: "iqn.1991-05.com.emc:dummyExample"},
+		{Portal: "", Target: "iqn.1991-05.com.emc:dummyExample"},
+	}
+	results, err := c.DeleteNodes(tgts)
+	if err == nil {
+		t.Error("Expected an error")
+	}
+	if len(results) != len(tgts) {
+		t.Fatalf("Expected %d results but got %d", len(tgts), len(results))
+	}
+	expectedError := errors.New("exec: \"iscsiadm\": executable file not found in $PATH")
+	if results[0].Error == nil || results[0].Error.Error() != expectedError.Error() {
+		t.Errorf("Expected error: %v, but got: %v", expectedError, results[0].Error)
+	}
+	expectedError = errors.New("error invalid IP or portal address")
+	if results[1].Error == nil || results[1].Error.Error() != expectedError.Error() {
+		t.Errorf("Expected error: %v, but got: %v", expectedError, results[1].Error)
+	}
+}
+
+func TestMockDeleteNodes(t *testing.T) {
+	reset()
+	c := NewMockISCSI(map[string]string{})
+	tgts := []ISCSITarget{{Target: "a"}, {Target: "b"}}
+	results, err := c.DeleteNodes(tgts)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	for i, r := range results {
+		if r.Error != nil || r.Target != tgts[i] {
+			t.Errorf("unexpected result %v", r)
+		}
+	}
+	GOISCSIMock.InduceDeleteNodeError = true
+	results, err = c.DeleteNodes(tgts)
+	if err == nil || !strings.Contains(err.Error(), "induced") {
+		t.Error("Expected an induced error")
+	}
+	if len(results) != len(tgts) || results[0].Error == nil {
+		t.Errorf("Expected per node errors, got %v", results)
+	}
+}
+
+func TestDetectHostRoot(t *testing.T) {
+	defaultCandidates := hostRootCandidates
+	defer func() { hostRootCandidates = defaultCandidates }()
+	empty := t.TempDir()
+	host := t.TempDir()
+	hostRootCandidates = []string{empty, host}
+
+	c := NewLinuxISCSI(nil)
+	_, err := c.DetectHostRoot()
+	if err != ErrHostRootNotFound {
+		t.Errorf("Expected error: %v, but got: %v", ErrHostRootNotFound, err)
+	}
+
+	for _, f := range []string{"usr/sbin/iscsiadm", "sbin/iscsid"} {
+		path := host + "/" + f
+		if err := os.MkdirAll(path[:strings.LastIndex(path, "/")], 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte{}, 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the root is only accepted with iscsid accepting connections
+	defaultSocket := iscsidSocket
+	defer func() { iscsidSocket = defaultSocket }()
+	iscsidSocket = t.TempDir() + "/iscsid.sock"
+	if _, err = c.DetectHostRoot(); !errors.Is(err, ErrHostRootNotFound) || !errors.Is(err, ErrIscsidUnavailable) {
+		t.Errorf("Expected an unavailable iscsid but got %v", err)
+	}
+	l, err := net.Listen("unix", iscsidSocket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	root, err := c.DetectHostRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != host {
+		t.Errorf("Expected host root %s but got %s", host, root)
+	}
+	if c.getChrootDirectory() != host {
+		t.Errorf("Expected chroot directory %s but got %s", host, c.getChrootDirectory())
+	}
+}
+
+func TestNodeOpResults(t *testing.T) {
+	errFirst := errors.New("first")
+	results := NodeOpResults{
+		{Target: ISCSITarget{Target: "a"}},
+		{Target: ISCSITarget{Target: "b"}, Error: errFirst},
+		{Target: ISCSITarget{Target: "c"}, Error: errors.New("second")},
+	}
+	if results.SucceededCount() != 1 {
+		t.Errorf("Expected 1 succeeded but got %d", results.SucceededCount())
+	}
+	if results.FailedCount() != 2 {
+		t.Errorf("Expected 2 failed but got %d", results.FailedCount())
+	}
+	if results.FirstError() != errFirst {
+		t.Errorf("Expected first error %v but got %v", errFirst, results.FirstError())
+	}
+	err := results.Errors()
+	if !errors.Is(err, errFirst) || !strings.Contains(err.Error(), "second") {
+		t.Errorf("Expected joined errors but got %v", err)
+	}
+	ok := NodeOpResults{{Target: ISCSITarget{Target: "a"}}}
+	if ok.Errors() != nil || ok.FirstError() != nil || ok.FailedCount() != 0 {
+		t.Error("Expected no errors")
+	}
+}
+
+func TestMockDiscoverTargetsFilter(t *testing.T) {
+	reset()
+	testdata := []struct {
+		regex    string
+		prefixes string
+		count    int
+		err      bool
+	}{
+		{"", "", 12, false},
+		{`0000[0-4]$`, "", 5, false},
+		{"", "iqn.1992-04.com.mock:600009700bcbb70e328701740000001", 2, false},
+		{"", "iqn.1992-04.com.other, iqn.1992-04.com.mock", 12, false},
+		{`1$`, "iqn.1992-04.com.mock", 2, false},
+		{"", "iqn.1992-04.com.other", 0, false},
+		{"[", "", 0, true},
+	}
+	for _, tt := range testdata {
+		opts := map[string]string{
+			MockNumberOfTargets:  "12",
+			TargetFilterRegex:    tt.regex,
+			TargetFilterPrefixes: tt.prefixes,
+		}
+		c := NewMockISCSI(opts)
+		targets, err := c.DiscoverTargets("1.1.1.1", false)
+		if (err != nil) != tt.err {
+			t.Errorf("Unexpected error for regex %q prefixes %q: %v", tt.regex, tt.prefixes, err)
+		}
+		if len(targets) != tt.count {
+			t.Errorf("Expected %d targets for regex %q prefixes %q, but got %d", tt.count, tt.regex, tt.prefixes, len(targets))
+		}
+	}
+}
+
+func TestLoadOptionsFromFile(t *testing.T) {
+	opts, err := LoadOptionsFromFile("testdata/options.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts) != 2 {
+		t.Errorf("Expected 2 options but got %v", opts)
+	}
+	compareStr(t, opts[ChrootDirectory], "/host")
+	compareStr(t, opts[TargetFilterPrefixes], "iqn.1992-04.com.emc")
+
+	if _, err = LoadOptionsFromFile("testdata/missing.conf"); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+	if _, err = LoadOptionsFromFile("testdata/initiatorname.iscsi"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err = LoadOptionsFromFile("testdata/session_info_valid"); err == nil {
+		t.Error("Expected an error for an invalid file")
+	}
+}
+
+func TestWatchOptionsFile(t *testing.T) {
+	dir := t.TempDir()
+	host, noderoot := t.TempDir(), t.TempDir()
+	path := dir + "/options.conf"
+	write := func(content string) {
+		// replaced as in a ConfigMap volume
+		if err := os.WriteFile(path+".tmp", []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("chrootDirectory=" + host + "\nlogLevel=error\n")
+	c := NewLinuxISCSI(map[string]string{CommandTimeout: "1m"})
+	c.SetRetryPolicy(RetryPolicy{Attempts: 2, Delay: time.Second})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	// a long interval, the changes are notified
+	go func() { done <- c.WatchOptionsFile(ctx, path, time.Hour) }()
+
+	waitForOption := func(key, expected string) {
+		for i := 0; i < 200 && c.getOptions()[key] != expected; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		compareStr(t, c.getOptions()[key], expected)
+	}
+	waitForOption(ChrootDirectory, host)
+	if c.GetTimeout() != time.Minute {
+		t.Errorf("Expected the timeout of the constructor to be kept but got %s", c.GetTimeout())
+	}
+	if c.logEnabled("info") || !c.logEnabled("error") {
+		t.Error("Expected only the errors to be logged")
+	}
+
+	write("chrootDirectory=" + noderoot + "\nretryAttempts=5\nretryDelay=10ms\n")
+	waitForOption(ChrootDirectory, noderoot)
+	if _, policy := c.commandRunner(); policy.Attempts != 5 || policy.Delay != 10*time.Millisecond {
+		t.Errorf("Expected the retry policy of the file but got %+v", policy)
+	}
+	if !c.logEnabled("debug") {
+		t.Error("Expected everything to be logged without log level")
+	}
+
+	// an invalid file keeps the current options
+	write("chrootDirectory=" + dir + "/missing\n")
+	time.Sleep(100 * time.Millisecond)
+	compareStr(t, c.getOptions()[ChrootDirectory], noderoot)
+	write("sessionCacheTTL=5s\n")
+	waitForOption(SessionCacheTTL, "5s")
+	compareStr(t, c.getOptions()[ChrootDirectory], "")
+	compareStr(t, c.getOptions()[CommandTimeout], "1m")
+	if _, policy := c.commandRunner(); policy.Attempts != 2 {
+		t.Errorf("Expected the retry policy of the client but got %+v", policy)
+	}
+
+	// the options changed at runtime are kept, those the file overrode are restored when it no longer sets them
+	c.SetTimeout(2 * time.Minute)
+	write("sessionCacheTTL=10s\n")
+	waitForOption(SessionCacheTTL, "10s")
+	if c.GetTimeout() != 2*time.Minute {
+		t.Errorf("Expected the timeout set at runtime to be kept but got %s", c.GetTimeout())
+	}
+	write("sessionCacheTTL=10s\ncommandTimeout=30s\n")
+	waitForOption(CommandTimeout, "30s")
+	write("sessionCacheTTL=1s\n")
+	waitForOption(CommandTimeout, "2m0s")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if err := c.WatchOptionsFile(context.Background(), path+".missing", 0); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+	write("logLevel=verbose\n")
+	if err := c.WatchOptionsFile(context.Background(), path, 0); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("Expected an invalid options error but got %v", err)
+	}
+}
+
+func TestNewCommandEnvironment(t *testing.T) {
+	t.Setenv("LD_PRELOAD", "/tmp/preload.so")
+	t.Setenv("LC_MESSAGES", "de_DE.UTF-8")
+	t.Setenv("https_proxy", "http://proxy")
+	t.Setenv("GOISCSI_KEEP", "1")
+
+	hasVar := func(env []string, name string) bool {
+		for _, kv := range env {
+			if strings.HasPrefix(kv, name+"=") {
+				return true
+			}
+		}
+		return false
+	}
+
+	c := NewLinuxISCSI(map[string]string{Locale: "inherit"})
+	cmd := c.newCommand(context.Background(), []string{"iscsiadm", "-m", "session"})
+	if cmd.Env != nil {
+		t.Error("Expected the environment to be inherited")
+	}
+
+	// the C locale is enforced by default
+	c = NewLinuxISCSI(map[string]string{})
+	cmd = c.newCommand(context.Background(), []string{"iscsiadm", "-m", "session"})
+	if hasVar(cmd.Env, "LC_MESSAGES") || !hasVar(cmd.Env, "GOISCSI_KEEP") || !hasVar(cmd.Env, "LD_PRELOAD") {
+		t.Errorf("Expected only the locale variables to be replaced but got %v", cmd.Env)
+	}
+	for _, kv := range []string{"LANG=C", "LC_ALL=C"} {
+		if !slices.Contains(cmd.Env, kv) {
+			t.Errorf("Expected %s in the environment", kv)
+		}
+	}
+
+	c = NewLinuxISCSI(map[string]string{CleanEnvironment: "true", ExcludeEnvironment: "http_proxy, https*"})
+	cmd = c.newCommand(context.Background(), []string{"iscsiadm", "-m", "session"})
+	for _, name := range []string{"LD_PRELOAD", "LC_MESSAGES", "https_proxy"} {
+		if hasVar(cmd.Env, name) {
+			t.Errorf("Expected %s to be removed from the environment", name)
+		}
+	}
+	if !hasVar(cmd.Env, "GOISCSI_KEEP") {
+		t.Error("Expected GOISCSI_KEEP to be kept in the environment")
+	}
+}
+
+// makeSysfsSession creates the sysfs entries of an iSCSI session in the sysfsRoot
+func makeSysfsSession(t *testing.T, host, sid string, attrs map[string]string) {
+	t.Helper()
+	write := func(dir string, files map[string]string) {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			t.Fatal(err)
+		}
+		for name, value := range files {
+			if err := os.WriteFile(dir+"/"+name, []byte(value+"\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	link := func(dir, class, name string) {
+		if err := os.MkdirAll(defaultSysfsTree().classPath(class), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(dir, defaultSysfsTree().classPath(class)+"/"+name); err != nil && !os.IsExist(err) {
+			t.Fatal(err)
+		}
+	}
+	hostDir := sysfsRoot + "/devices/platform/" + host
+	sessionDir := hostDir + "/session" + sid
+	write(sessionDir+"/iscsi_session/session"+sid, attrs)
+	link(sessionDir+"/iscsi_session/session"+sid, "iscsi_session", "session"+sid)
+	connDir := sessionDir + "/connection" + sid + ":0/iscsi_connection/connection" + sid + ":0"
+	write(connDir, map[string]string{"address": "192.168.1." + sid, "port": "3260", "state": "up"})
+	link(connDir, "iscsi_connection", "connection"+sid+":0")
+	write(hostDir+"/iscsi_host/"+host, map[string]string{"ipaddress": "1.1.1.1", "initiatorname": "<empty>"})
+	link(hostDir+"/iscsi_host/"+host, "iscsi_host", host)
+	write(hostDir+"/scsi_host/"+host, map[string]string{"proc_name": "iscsi_tcp"})
+	link(hostDir+"/scsi_host/"+host, "scsi_host", host)
+}
+
+func TestGetSessionsSysfs(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+
+	c := NewLinuxISCSI(map[string]string{SessionSource: "sysfs"})
+	if _, err := c.GetSessions(); err != errSysfsUnavailable {
+		t.Errorf("Expected error: %v, but got: %v", errSysfsUnavailable, err)
+	}
+
+	makeSysfsSession(t, "host3", "12", map[string]string{
+		"targetname":    "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3",
+		"state":         "LOGGED_IN",
+		"username":      "admin",
+		"password":      "foobar",
+		"username_in":   "<empty>",
+		"initiatorname": "iqn.1994-05.com.redhat:650e84b584d",
+	})
+	makeSysfsSession(t, "host4", "9", map[string]string{
+		"targetname": "iqn.2015-10.com.dell:dellemc-foobar-123-b-61ecc53a",
+		"state":      "FAILED",
+	})
+
+	sessions, err := NewLinuxISCSI(map[string]string{}).GetSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions but got %v", sessions)
+	}
+	s := sessions[1]
+	compareStr(t, s.SID, "12")
+	compareStr(t, s.Target, "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3")
+	compareStr(t, s.Portal, "192.168.1.12:3260")
+	compareStr(t, string(s.IfaceTransport), string(ISCSITransportNameTCP))
+	compareStr(t, s.IfaceInitiatorname, "iqn.1994-05.com.redhat:650e84b584d")
+	compareStr(t, s.IfaceIPaddress, "1.1.1.1")
+	compareStr(t, string(s.ISCSISessionState), string(ISCSISessionStateLOGGEDIN))
+	compareStr(t, string(s.ISCSIConnectionState), string(ISCSIConnectionStateLOGGEDIN))
+	compareStr(t, s.Username, "admin")
+	compareStr(t, s.Password, "foobar")
+	compareStr(t, s.UsernameIn, "")
+	compareStr(t, sessions[0].SID, "9")
+	compareStr(t, string(sessions[0].ISCSISessionState), string(ISCSISessionStateFAILED))
+	compareStr(t, sessions[0].IfaceInitiatorname, "")
+
+	// iscsiadm source ignores sysfs
+	_, err = NewLinuxISCSI(map[string]string{SessionSource: "iscsiadm"}).GetSessions()
+	expectedError := errors.New("exec: \"iscsiadm\": executable file not found in $PATH")
+	if err == nil || err.Error() != expectedError.Error() {
+		t.Errorf("Expected error: %v, but got: %v", expectedError, err)
+	}
+}
+
+func TestMockLoginBackoff(t *testing.T) {
+	reset()
+	c := NewMockISCSI(map[string]string{LoginBackoff: "1h"})
+	tgt := ISCSITarget{Portal: testPortal, Target: testTarget}
+	other := ISCSITarget{Portal: testPortal, Target: testTarget + "2"}
+
+	GOISCSIMock.InduceLoginError = true
+	err := c.PerformLogin(tgt)
+	if err == nil || !strings.Contains(err.Error(), "induced") {
+		t.Errorf("Expected an induced error but got %v", err)
+	}
+	err = c.PerformLogin(tgt)
+	if !errors.Is(err, ErrLoginBackoff) {
+		t.Errorf("Expected error: %v, but got: %v", ErrLoginBackoff, err)
+	}
+	err = c.PerformLogin(other)
+	if err == nil || !strings.Contains(err.Error(), "induced") {
+		t.Errorf("Expected an induced error for another target but got %v", err)
+	}
+
+	c.ResetLoginBackoff(tgt)
+	err = c.PerformLogin(tgt)
+	if err == nil || !strings.Contains(err.Error(), "induced") {
+		t.Errorf("Expected an induced error after reset but got %v", err)
+	}
+
+	GOISCSIMock.InduceLoginError = false
+	c.ResetLoginBackoff()
+	if err = c.PerformLogin(other); err != nil {
+		t.Errorf("Unexpected error after reset: %v", err)
+	}
+}
+
+func TestLoginBackoffEscalation(t *testing.T) {
+	c := NewMockISCSI(map[string]string{LoginBackoff: "1s"})
+	clock := NewFakeClock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	c.SetClock(clock)
+	tgt := ISCSITarget{Portal: testPortal, Target: testTarget}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+	for _, e := range expected {
+		c.recordLoginResult(tgt, errors.New("failed"))
+		if remaining := c.loginFailures[loginBackoffKey(tgt)].until.Sub(clock.Now()); remaining != e {
+			t.Errorf("Expected a cool-down of %v but got %v", e, remaining)
+		}
+	}
+	// the cool-down ends with the time of the clock of the client
+	if !errors.Is(c.checkLoginBackoff(tgt), ErrLoginBackoff) {
+		t.Error("Expected the login to be held back")
+	}
+	clock.Sleep(4 * time.Second)
+	if err := c.checkLoginBackoff(tgt); err != nil {
+		t.Errorf("Expected the cool-down to be over but got %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		c.recordLoginResult(tgt, errors.New("failed"))
+	}
+	if remaining := c.loginFailures[loginBackoffKey(tgt)].until.Sub(clock.Now()); remaining != MaxLoginBackoff {
+		t.Errorf("Expected a cool-down of %v but got %v", MaxLoginBackoff, remaining)
+	}
+	c.recordLoginResult(tgt, nil)
+	if c.checkLoginBackoff(tgt) != nil {
+		t.Error("Expected a successful login to clear the cool-down")
+	}
+	// the portals with and without the default port are the same
+	c.recordLoginResult(ISCSITarget{Portal: "192.168.1.12", Target: testTarget}, errors.New("failed"))
+	if !errors.Is(c.checkLoginBackoff(ISCSITarget{Portal: "192.168.1.12:3260", Target: testTarget}), ErrLoginBackoff) {
+		t.Error("Expected the login to the portal with the default port to be held back")
+	}
+
+	// without the option no failures are tracked
+	c = NewMockISCSI(map[string]string{})
+	c.recordLoginResult(tgt, errors.New("failed"))
+	if c.checkLoginBackoff(tgt) != nil {
+		t.Error("Expected no cool-down without the LoginBackoff option")
+	}
+}
+
+func TestGetHCTLsForTarget(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": target, "state": "LOGGED_IN"})
+	makeSysfsSession(t, "host4", "13", map[string]string{"targetname": target, "state": "LOGGED_IN"})
+	for _, dir := range []string{
+		"host3/session12/target3:0:0/3:0:0:0",
+		"host3/session12/target3:0:0/3:0:0:1",
+		"host4/session13/target4:0:0/4:0:0:1",
+	} {
+		if err := os.MkdirAll(sysfsRoot+"/devices/platform/"+dir, 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := NewLinuxISCSI(map[string]string{})
+	hctls, err := c.GetHCTLsForTarget(ISCSITarget{Target: target})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hctls) != 3 {
+		t.Errorf("Expected 3 HCTLs but got %v", hctls)
+	}
+	hctls, err = c.GetHCTLsForTarget(ISCSITarget{Target: target, Portal: "192.168.1.12"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hctls) != 2 || hctls[1].String() != "3:0:0:1" {
+		t.Errorf("Expected 3:0:0:0 and 3:0:0:1 but got %v", hctls)
+	}
+	hctls, err = c.GetHCTLsForTarget(ISCSITarget{Target: target, Portal: "192.168.1.13:3260"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hctls) != 1 || hctls[0] != (HCTL{Host: 4, Channel: 0, Target: 0, LUN: 1}) {
+		t.Errorf("Expected 4:0:0:1 but got %v", hctls)
+	}
+
+	if err = c.RescanHCTL(HCTL{Host: 3, Channel: 0, Target: 0, LUN: 2}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(defaultSysfsTree().classPath("scsi_host") + "/host3/scan")
+	compareStr(t, string(data), "0 0 2")
+	if err = c.RescanHCTL(HCTL{Host: 9}); err == nil {
+		t.Error("Expected an error for an unknown host")
+	}
+}
+
+func TestParseHCTL(t *testing.T) {
+	if _, err := parseHCTL("1:2:3"); err == nil {
+		t.Error("Expected an error for an invalid HCTL")
+	}
+	if _, err := parseHCTL("1:2:3:4x"); err == nil {
+		t.Error("Expected an error for an invalid HCTL")
+	}
+	h, err := parseHCTL("1:2:3:4")
+	if err != nil || h != (HCTL{1, 2, 3, 4}) {
+		t.Errorf("Unexpected result %v, %v", h, err)
+	}
+}
+
+func TestMockHCTL(t *testing.T) {
+	reset()
+	c := NewMockISCSI(map[string]string{})
+	hctls, err := c.GetHCTLsForTarget(ISCSITarget{})
+	if err != nil || len(hctls) == 0 {
+		t.Errorf("Unexpected result %v, %v", hctls, err)
+	}
+	if err = c.RescanHCTL(hctls[0]); err != nil {
+		t.Error(err)
+	}
+	GOISCSIMock.InduceGetHCTLsError = true
+	GOISCSIMock.InduceRescanHCTLError = true
+	if _, err = c.GetHCTLsForTarget(ISCSITarget{}); err == nil || !strings.Contains(err.Error(), "induced") {
+		t.Error("Expected an induced error")
+	}
+	if err = c.RescanHCTL(HCTL{}); err == nil || !strings.Contains(err.Error(), "induced") {
+		t.Error("Expected an induced error")
+	}
+}
+
+func TestNewLinuxISCSIE(t *testing.T) {
+	testdata := []struct {
+		opts map[string]string
+		err  bool
+	}{
+		{nil, false},
+		{map[string]string{ChrootDirectory: "testdata", LoginBackoff: "5s", SessionSource: "sysfs", CleanEnvironment: "true"}, false},
+		{map[string]string{ChrootDirectory: ""}, false},
+		{map[string]string{"chrootDir": "/host"}, true},
+		{map[string]string{"chrootDir": "/host", AllowUnknownOptions: "true"}, false},
+		{map[string]string{ChrootDirectory: "testdata/missing"}, true},
+		{map[string]string{ChrootDirectory: "testdata/valid.iscsi"}, true},
+		{map[string]string{TargetFilterRegex: "["}, true},
+		{map[string]string{LoginBackoff: "5"}, true},
+		{map[string]string{LoginBackoff: "-5s"}, true},
+		{map[string]string{CleanEnvironment: "yes"}, true},
+		{map[string]string{SessionSource: "proc"}, true},
+	}
+	for _, tt := range testdata {
+		c, err := NewLinuxISCSIE(tt.opts)
+		if tt.err {
+			if !errors.Is(err, ErrInvalidOptions) {
+				t.Errorf("Expected error: %v for %v, but got: %v", ErrInvalidOptions, tt.opts, err)
+			}
+			continue
+		}
+		if err != nil || c == nil {
+			t.Errorf("Unexpected error for %v: %v", tt.opts, err)
+		}
+	}
+}
+
+func TestMockWaitForSessionState(t *testing.T) {
+	reset()
+	defaultInterval := sessionStatePollInterval
+	defer func() { sessionStatePollInterval = defaultInterval }()
+	sessionStatePollInterval = 10 * time.Millisecond
+
+	c := NewMockISCSI(map[string]string{MockNumberOfSessions: "2"})
+	if err := c.WaitForSessionState("2", ISCSISessionStateLOGGEDIN, time.Second); err != nil {
+		t.Error(err)
+	}
+	err := c.WaitForSessionState("2", ISCSISessionStateFAILED, 50*time.Millisecond)
+	if !errors.Is(err, ErrSessionStateTimeout) || !strings.Contains(err.Error(), string(ISCSISessionStateLOGGEDIN)) {
+		t.Errorf("Expected error: %v, but got: %v", ErrSessionStateTimeout, err)
+	}
+	err = c.WaitForSessionState("3", ISCSISessionStateLOGGEDIN, 0)
+	if !errors.Is(err, ErrSessionStateTimeout) || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected error: %v, but got: %v", ErrSessionStateTimeout, err)
+	}
+	GOISCSIMock.InduceGetSessionsError = true
+	if err = c.WaitForSessionState("1", ISCSISessionStateLOGGEDIN, time.Second); err == nil || !strings.Contains(err.Error(), "induced") {
+		t.Error("Expected an induced error")
+	}
+}
+
+func TestWaitForSessionStateChange(t *testing.T) {
+	calls := 0
+	getSessions := func() ([]ISCSISession, error) {
+		calls++
+		state := ISCSISessionStateFAILED
+		if calls > 2 {
+			state = ISCSISessionStateLOGGEDIN
+		}
+		return []ISCSISession{{SID: "7", ISCSISessionState: state}}, nil
+	}
+	clock := NewFakeClock(time.Now())
+	start := clock.Now()
+	if err := waitForSessionState(clock, getSessions, "7", ISCSISessionStateLOGGEDIN, 5*time.Second); err != nil {
+		t.Error(err)
+	}
+	if elapsed := clock.Now().Sub(start); elapsed != 2*sessionStatePollInterval {
+		t.Errorf("Expected 2 poll intervals on the clock but got %s", elapsed)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 polls but got %d", calls)
+	}
+}
+
+func TestTopologySegments(t *testing.T) {
+	sessions := []ISCSISession{
+		{Target: "iqn.2015-10.com.dell:array-a", Portal: "192.168.1.1:3260", ISCSISessionState: ISCSISessionStateLOGGEDIN},
+		{Target: "iqn.2015-10.com.dell:array-b", Portal: "192.168.1.2:3260", ISCSISessionState: ISCSISessionStateLOGGEDIN},
+		{Target: "iqn.2015-10.com.dell:array-c", Portal: "192.168.1.3:3260", ISCSISessionState: ISCSISessionStateFAILED},
+		{Target: "iqn.2015-10.com.dell:unknown", Portal: "192.168.1.4:3260", ISCSISessionState: ISCSISessionStateLOGGEDIN},
+	}
+	arrays := map[string]string{
+		"iqn.2015-10.com.dell:array-a": "PS0001",
+		"192.168.1.2":                  "10.0.0.2",
+		"192.168.1.3:3260":             "PS0003",
+	}
+	segments := TopologySegments("csi-powerstore.dellemc.com", sessions, arrays)
+	expected := map[string]string{
+		"csi-powerstore.dellemc.com/PS0001-iscsi":   "true",
+		"csi-powerstore.dellemc.com/10.0.0.2-iscsi": "true",
+	}
+	if len(segments) != len(expected) {
+		t.Errorf("Expected %v but got %v", expected, segments)
+	}
+	for k, v := range expected {
+		compareStr(t, segments[k], v)
+	}
+	compareStr(t, TopologyKey("csi-unity.dellemc.com", "fe80::1"), "csi-unity.dellemc.com/fe80--1-iscsi")
+	long := TopologyKey("d", strings.Repeat("a", 100))
+	if len(long) != len("d/")+maxTopologyNameLength || !strings.HasSuffix(long, TopologyProtocolSuffix) {
+		t.Errorf("Unexpected long key %s", long)
+	}
+}
+
+func TestMockLoginHook(t *testing.T) {
+	reset()
+	c := NewMockISCSI(map[string]string{})
+	var results []error
+	c.AddLoginHook(func(_ ISCSITarget, err error) { results = append(results, err) })
+	_ = c.PerformLogin(ISCSITarget{Portal: testPortal, Target: testTarget})
+	GOISCSIMock.InduceLoginError = true
+	_ = c.PerformLogin(ISCSITarget{Portal: testPortal, Target: testTarget})
+	if len(results) != 2 || results[0] != nil || results[1] == nil {
+		t.Errorf("Expected a successful and a failed login but got %v", results)
+	}
+}
+
+func TestRescanAndVerifyLUN(t *testing.T) {
+	reset()
+	defaultRoot, defaultInterval := sysfsRoot, lunPollInterval
+	defer func() { sysfsRoot, lunPollInterval = defaultRoot, defaultInterval }()
+	sysfsRoot = t.TempDir()
+	lunPollInterval = 10 * time.Millisecond
+
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": target, "state": "LOGGED_IN"})
+	c := NewLinuxISCSI(map[string]string{})
+
+	_, err := c.RescanAndVerifyLUN(ISCSITarget{Target: "iqn.2015-10.com.dell:other"}, 1, 0)
+	if !errors.Is(err, ErrLUNNotVisible) {
+		t.Errorf("Expected error: %v, but got: %v", ErrLUNNotVisible, err)
+	}
+	_, err = c.RescanAndVerifyLUN(ISCSITarget{Target: target}, 1, 30*time.Millisecond)
+	if !errors.Is(err, ErrLUNNotVisible) {
+		t.Errorf("Expected error: %v, but got: %v", ErrLUNNotVisible, err)
+	}
+	data, _ := os.ReadFile(defaultSysfsTree().classPath("scsi_host") + "/host3/scan")
+	compareStr(t, string(data), "- - 1")
+
+	// the goroutine gets the fixture root from the test, and is waited for before the globals are restored
+	root, appeared := sysfsRoot, make(chan struct{})
+	go func() {
+		defer close(appeared)
+		time.Sleep(30 * time.Millisecond)
+		_ = os.MkdirAll(root+"/devices/platform/host3/session12/target3:0:0/3:0:0:1/block/sdc", 0o750)
+	}()
+	device, err := c.RescanAndVerifyLUN(ISCSITarget{Target: target, Portal: "192.168.1.12:3260"}, 1, time.Second)
+	<-appeared
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareStr(t, device, "/dev/sdc")
+}
+
+func TestMockRescanAndVerifyLUN(t *testing.T) {
+	reset()
+	c := NewMockISCSI(map[string]string{})
+	device, err := c.RescanAndVerifyLUN(ISCSITarget{}, 2, time.Second)
+	if err != nil || device == "" {
+		t.Errorf("Unexpected result %s, %v", device, err)
+	}
+	GOISCSIMock.InduceRescanAndVerifyLUNError = true
+	if _, err = c.RescanAndVerifyLUN(ISCSITarget{}, 2, time.Second); err == nil || !strings.Contains(err.Error(), "induced") {
+		t.Error("Expected an induced error")
+	}
+}
+
+func TestPerformLogoutProtectLastPath(t *testing.T) {
+	reset()
+	defaultRoot, defaultBusy := sysfsRoot, deviceBusy
+	defer func() { sysfsRoot, deviceBusy = defaultRoot, defaultBusy }()
+	sysfsRoot = t.TempDir()
+	busy := true
+	deviceBusy = func(_ string) bool { return busy }
+
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": target, "state": "LOGGED_IN"})
+	makeSysfsSession(t, "host4", "13", map[string]string{"targetname": target, "state": "LOGGED_IN"})
+	mkdir := func(dir string) {
+		if err := os.MkdirAll(sysfsRoot+"/"+dir, 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mkdir("devices/platform/host3/session12/target3:0:0/3:0:0:1/block/sdb")
+	mkdir("devices/platform/host4/session13/target4:0:0/4:0:0:1/block/sdc")
+	mkdir("block/sdb/holders/dm-0")
+	mkdir("block/sdc/holders/dm-0")
+	mkdir("block/dm-0/slaves/sdb")
+	mkdir("block/dm-0/slaves/sdc")
+	mkdir("block/dm-0/dm")
+	mkdir("block/sdb/device")
+	mkdir("block/sdc/device")
+	for file, value := range map[string]string{
+		"block/dm-0/dm/uuid":     "mpath-368ccf09800e6a5f1a1b2c3d4e5f60718",
+		"block/sdb/device/state": "running",
+		"block/sdc/device/state": "running",
+	} {
+		if err := os.WriteFile(sysfsRoot+"/"+file, []byte(value+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := NewLinuxISCSI(map[string]string{ProtectLastPath: "true"})
+	notInstalled := "exec: \"iscsiadm\": executable file not found in $PATH"
+	// the path through the other portal remains
+	err := c.PerformLogout(ISCSITarget{Target: target, Portal: "192.168.1.12"})
+	if err == nil || err.Error() != notInstalled {
+		t.Errorf("Expected error: %v, but got: %v", notInstalled, err)
+	}
+	// the path through the other portal is offline
+	var lastPathErr *LastPathError
+	_ = os.WriteFile(sysfsRoot+"/block/sdc/device/state", []byte("offline\n"), 0o600)
+	err = c.PerformLogout(ISCSITarget{Target: target, Portal: "192.168.1.12"})
+	if !errors.As(err, &lastPathErr) || lastPathErr.Device != "dm-0" {
+		t.Errorf("Expected a LastPathError, but got: %v", err)
+	}
+	err = c.PerformLogoutWithOptions(ISCSITarget{Target: target, Portal: "192.168.1.12"}, LogoutOptions{Force: true})
+	if err == nil || err.Error() != notInstalled {
+		t.Errorf("Expected error: %v, but got: %v", notInstalled, err)
+	}
+	// the device is not in use
+	busy = false
+	err = c.PerformLogout(ISCSITarget{Target: target, Portal: "192.168.1.12"})
+	if err == nil || err.Error() != notInstalled {
+		t.Errorf("Expected error: %v, but got: %v", notInstalled, err)
+	}
+	// the protection is disabled by default
+	busy = true
+	err = NewLinuxISCSI(map[string]string{}).PerformLogout(ISCSITarget{Target: target, Portal: "192.168.1.12"})
+	if err == nil || err.Error() != notInstalled {
+		t.Errorf("Expected error: %v, but got: %v", notInstalled, err)
+	}
+}
+
+func TestMockPerformLogoutLastPath(t *testing.T) {
+	reset()
+	c := NewMockISCSI(map[string]string{})
+	GOISCSIMock.InduceLastPathError = true
+	var lastPathErr *LastPathError
+	if err := c.PerformLogout(ISCSITarget{}); !errors.As(err, &lastPathErr) {
+		t.Errorf("Expected a LastPathError, but got: %v", err)
+	}
+	if err := c.PerformLogoutWithOptions(ISCSITarget{}, LogoutOptions{Force: true}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAddPathToTarget(t *testing.T) {
+	reset()
+	c := NewLinuxISCSI(map[string]string{})
+	err := c.AddPathToTarget("iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3", "192.168.1.3", "")
+	expectedError := errors.New("exec: \"iscsiadm\": executable file not found in $PATH")
+	if err == nil || err.Error() != expectedError.Error() {
+		t.Errorf("Expected error: %v, but got: %v", expectedError, err)
+	}
+}
+
+func TestAddPathToTargetCHAPSecrets(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	// the node listing masks the CHAP secrets, -S reveals them
+	log := fakeISCSIAdm(t, `case "$*" in
+*"-o show"*) secret="********"; case "$*" in *-S*) secret=chapsecret;; esac
+echo "# BEGIN RECORD 2.1.8"
+echo "node.name = `+target+`"
+echo "node.conn[0].address = 192.168.1.12"
+echo "node.conn[0].port = 3260"
+echo "node.session.auth.authmethod = CHAP"
+echo "node.session.auth.username = chapuser"
+echo "node.session.auth.password = $secret"
+echo "# END RECORD";;
+esac`)
+	c := NewLinuxISCSI(map[string]string{})
+	_ = c.AddPathToTarget(target, "192.168.1.13", "")
+	args, err := os.ReadFile(log) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(args), "-p 192.168.1.12:3260 -o show -S") {
+		t.Errorf("Expected the source record to be read with its secrets but got %s", args)
+	}
+	if !strings.Contains(string(args), "-n node.session.auth.password -v chapsecret") {
+		t.Errorf("Expected the CHAP secret to be copied but got %s", args)
+	}
+	if strings.Contains(string(args), "-v ********") {
+		t.Errorf("Expected no masked secret to be copied but got %s", args)
+	}
+}
+
+func TestClonableNodeFields(t *testing.T) {
+	data, err := os.ReadFile("testdata/node_info_valid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := (&nodeParser{}).Parse(data)
+	fields := clonableNodeFields(nodes[0].Fields)
+	for _, k := range []string{"node.startup", "node.session.auth.authmethod", "node.session.scan", "node.conn[0].timeo.login_timeout"} {
+		if fields[k] != nodes[0].Fields[k] {
+			t.Errorf("Expected %s to be copied", k)
+		}
+	}
+	for _, k := range []string{"node.name", "node.tpgt", "node.conn[0].address", "node.conn[0].port", "iface.iscsi_ifacename", "node.discovery_address", "node.session.auth.username"} {
+		if _, ok := fields[k]; ok {
+			t.Errorf("Expected %s not to be copied", k)
+		}
+	}
+	if _, ok := clonableNodeFields(map[string]string{"node.session.auth.password": maskedSecret})["node.session.auth.password"]; ok {
+		t.Error("Expected the masked password not to be copied")
+	}
+}
+
+func TestMockAddPathToTarget(t *testing.T) {
+	reset()
+	c := NewMockISCSI(map[string]string{})
+	if err := c.AddPathToTarget(testTarget, testPortal, "default"); err != nil {
+		t.Error(err)
+	}
+	GOISCSIMock.InduceAddPathError = true
+	if err := c.AddPathToTarget(testTarget, testPortal, "default"); err == nil || !strings.Contains(err.Error(), "induced") {
+		t.Error("Expected an induced error")
+	}
+}
+
+func TestErrorCategories(t *testing.T) {
+	reset()
+	c := NewLinuxISCSI(map[string]string{})
+	ctx := context.Background()
+
+	_, err := c.DiscoverTargets("", false)
+	if !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+	err = c.PerformLogin(ISCSITarget{Portal: testPortal, Target: "bad"})
+	if !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+	_, err = c.GetNodes()
+	if !errors.Is(err, goiscsierrors.NotFound) {
+		t.Errorf("Expected a not found error but got %v", err)
+	}
+	_, err = c.GetInitiators("testdata/missing.iscsi")
+	if !errors.Is(err, goiscsierrors.NotFound) {
+		t.Errorf("Expected a not found error but got %v", err)
+	}
+	_, err = NewMockISCSI(map[string]string{TargetFilterRegex: "["}).DiscoverTargets("1.1.1.1", false)
+	if !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+	_, err = NewLinuxISCSIE(map[string]string{"unknown": "x"})
+	if !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+	if goiscsierrors.CategoryOf(&LastPathError{}) != goiscsierrors.Conflict {
+		t.Error("Expected LastPathError to be a conflict")
+	}
+
+	testdata := []struct {
+		code     int
+		category goiscsierrors.Category
+	}{
+		{24, goiscsierrors.Auth},
+		{21, goiscsierrors.NotFound},
+		{15, goiscsierrors.Conflict},
+		{8, goiscsierrors.Timeout},
+		{4, goiscsierrors.Transport},
+		{1, goiscsierrors.Internal},
+	}
+	for _, tt := range testdata {
+		_, err = c.runCommand(ctx, []string{"sh", "-c", fmt.Sprintf("exit %d", tt.code)})
+		if goiscsierrors.CategoryOf(err) != tt.category {
+			t.Errorf("Expected category %s for exit code %d but got %v", tt.category, tt.code, goiscsierrors.CategoryOf(err))
+		}
+		if tt.code == 21 && !isNoObjsExitCode(err) {
+			t.Error("Expected the exit code to be kept")
+		}
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = c.runCommand(timeoutCtx, []string{"sleep", "5"})
+	if !errors.Is(err, goiscsierrors.Timeout) {
+		t.Errorf("Expected a timeout error but got %v", err)
+	}
+}
+
+func TestDiscoveryPortal(t *testing.T) {
+	testdata := []struct {
+		address  string
+		opts     DiscoveryOptions
+		expected string
+		err      bool
+	}{
+		{"1.1.1.1", DiscoveryOptions{}, "1.1.1.1:3260", false},
+		{"1.1.1.1:860", DiscoveryOptions{}, "1.1.1.1:860", false},
+		{"1.1.1.1:860", DiscoveryOptions{Port: 3261}, "1.1.1.1:3261", false},
+		{"isns.example.com", DiscoveryOptions{Type: DiscoveryISNS}, "isns.example.com:3205", false},
+		{"array.example.com:3260", DiscoveryOptions{Type: DiscoverySendTargets}, "array.example.com:3260", false},
+		{"fe80::1", DiscoveryOptions{}, "[fe80::1]:3260", false},
+		{"[fe80::1]:3205", DiscoveryOptions{Type: DiscoveryISNS}, "[fe80::1]:3205", false},
+		{"", DiscoveryOptions{}, "", true},
+		{"bad_host!", DiscoveryOptions{}, "", true},
+		{"1.1.1.1:port", DiscoveryOptions{}, "", true},
+		{"1.1.1.1:70000", DiscoveryOptions{}, "", true},
+		{"1.1.1.1", DiscoveryOptions{Port: -1}, "", true},
+		{"1.1.1.1", DiscoveryOptions{Type: "slp"}, "", true},
+	}
+	for _, tt := range testdata {
+		portal, err := discoveryPortal(tt.address, tt.opts)
+		if tt.err {
+			if !errors.Is(err, goiscsierrors.Validation) {
+				t.Errorf("Expected a validation error for %q %v but got %v", tt.address, tt.opts, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %q %v: %v", tt.address, tt.opts, err)
+		}
+		compareStr(t, portal, tt.expected)
+	}
+}
+
+func TestDiscoverTargetsWithOptions(t *testing.T) {
+	reset()
+	c := NewLinuxISCSI(map[string]string{})
+	_, err := c.DiscoverTargetsWithOptions("isns.example.com", DiscoveryOptions{Type: DiscoveryISNS})
+	expectedError := errors.New("exec: \"iscsiadm\": executable file not found in $PATH")
+	if err == nil || err.Error() != expectedError.Error() {
+		t.Errorf("Expected error: %v, but got: %v", expectedError, err)
+	}
+	_, err = c.DiscoverTargetsWithOptions("", DiscoveryOptions{})
+	if !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+
+	m := NewMockISCSI(map[string]string{MockNumberOfTargets: "2"})
+	targets, err := m.DiscoverTargetsWithOptions("1.1.1.1:3205", DiscoveryOptions{Type: DiscoveryISNS})
+	if err != nil || len(targets) != 2 {
+		t.Errorf("Unexpected result %v, %v", targets, err)
+	}
+}
+
+func TestIfaceParameters(t *testing.T) {
+	reset()
+	c := NewLinuxISCSI(map[string]string{})
+	expectedError := errors.New("exec: \"iscsiadm\": executable file not found in $PATH")
+	_, err := c.GetIfaceParameters("iface0")
+	if err == nil || err.Error() != expectedError.Error() {
+		t.Errorf("Expected error: %v, but got: %v", expectedError, err)
+	}
+	err = c.SetIfaceParameters("iface0", map[string]string{"iface.vlan_id": "100"})
+	if err == nil || err.Error() != expectedError.Error() {
+		t.Errorf("Expected error: %v, but got: %v", expectedError, err)
+	}
+	if _, err = c.GetIfaceParameters("iface 0"); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+
+	testdata := []struct {
+		params map[string]string
+		valid  bool
+	}{
+		{map[string]string{"iface.vlan_id": "100", "iface.vlan_priority": "3", "iface.mtu": "9000"}, true},
+		{map[string]string{"iface.ipaddress": "10.0.0.1", "iface.hwaddress": "00:11:22:33:44:55"}, true},
+		{map[string]string{"iface.initiatorname": "iqn.1994-05.com.redhat:650e84b584d"}, true},
+		{map[string]string{"iface.net_ifacename": "eth1.100"}, true},
+		{map[string]string{"iface.vlan_id": "4096"}, false},
+		{map[string]string{"iface.vlan_priority": "8"}, false},
+		{map[string]string{"iface.mtu": "big"}, false},
+		{map[string]string{"iface.ipaddress": "10.0.0"}, false},
+		{map[string]string{"iface.hwaddress": "00:11"}, false},
+		{map[string]string{"iface.initiatorname": "bad"}, false},
+		{map[string]string{"iface.iscsi_ifacename": "other"}, false},
+		{map[string]string{"node.startup": "manual"}, false},
+	}
+	m := NewMockISCSI(map[string]string{})
+	for _, tt := range testdata {
+		err = m.SetIfaceParameters("iface0", tt.params)
+		if (err == nil) != tt.valid {
+			t.Errorf("Unexpected result for %v: %v", tt.params, err)
+		}
+	}
+	params, err := m.GetIfaceParameters("iface0")
+	if err != nil || params["iface.iscsi_ifacename"] != "iface0" {
+		t.Errorf("Unexpected result %v, %v", params, err)
+	}
+	GOISCSIMock.InduceGetIfaceError = true
+	GOISCSIMock.InduceSetIfaceError = true
+	if _, err = m.GetIfaceParameters("iface0"); err == nil || !strings.Contains(err.Error(), "induced") {
+		t.Error("Expected an induced error")
+	}
+	if err = m.SetIfaceParameters("iface0", nil); err == nil || !strings.Contains(err.Error(), "induced") {
+		t.Error("Expected an induced error")
+	}
+}
+
+func TestMockOverrides(t *testing.T) {
+	reset()
+	c := NewMockISCSI(map[string]string{})
+	GOISCSIMock.InduceLoginError = true
+	var logins []string
+	c.PerformLoginFn = func(target ISCSITarget) error {
+		logins = append(logins, target.Portal)
+		if target.Portal == "10.0.0.2" {
+			return errors.New("portal unreachable")
+		}
+		return nil
+	}
+	if err := c.PerformLogin(ISCSITarget{Portal: "10.0.0.1"}); err != nil {
+		t.Errorf("Expected the override to ignore the induced error but got %v", err)
+	}
+	if err := c.PerformLogin(ISCSITarget{Portal: "10.0.0.2"}); err == nil || err.Error() != "portal unreachable" {
+		t.Errorf("Expected the error of the override but got %v", err)
+	}
+	if len(logins) != 2 {
+		t.Errorf("Expected 2 calls of the override but got %d", len(logins))
+	}
+
+	c.GetSessionsFn = func() ([]ISCSISession, error) {
+		return []ISCSISession{{SID: "7", ISCSISessionState: ISCSISessionStateFAILED}}, nil
+	}
+	sessions, err := c.GetSessions()
+	if err != nil || len(sessions) != 1 || sessions[0].SID != "7" {
+		t.Errorf("Unexpected sessions %v, %v", sessions, err)
+	}
+
+	// methods without an override keep the default behavior
+	GOISCSIMock.InduceDiscoveryError = true
+	if _, err = c.DiscoverTargets("1.1.1.1", false); err == nil || !strings.Contains(err.Error(), "induced") {
+		t.Errorf("Expected an induced error but got %v", err)
+	}
+	c.PerformLoginFn = nil
+	if err = c.PerformLogin(ISCSITarget{Portal: "10.0.0.1"}); err == nil || !strings.Contains(err.Error(), "induced") {
+		t.Errorf("Expected an induced error but got %v", err)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	reset()
+	defaultRoot, defaultInterval := sysfsRoot, lunPollInterval
+	defer func() { sysfsRoot, lunPollInterval = defaultRoot, defaultInterval }()
+	sysfsRoot = t.TempDir()
+	lunPollInterval = 10 * time.Millisecond
+
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": target, "state": "LOGGED_IN"})
+	makeSysfsSession(t, "host4", "13", map[string]string{"targetname": target, "state": "FAILED"})
+	if err := os.Remove(defaultSysfsTree().classPath("scsi_host") + "/host4"); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.MkdirAll(sysfsRoot+"/devices/platform/host3/session12/target3:0:0/3:0:0:1/block/sdc", 0o750)
+
+	c := NewLinuxISCSI(map[string]string{})
+	var warnings []Warning
+	c.AddWarningHandler(func(w Warning) { warnings = append(warnings, w) })
+
+	device, err := c.RescanAndVerifyLUN(ISCSITarget{Target: target}, 1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareStr(t, device, "/dev/sdc")
+	if len(warnings) != 1 || warnings[0].Code != WarningHostSkipped || !strings.Contains(warnings[0].Message, "session 13") {
+		t.Errorf("Expected a %s warning for session 13 but got %v", WarningHostSkipped, warnings)
+	}
+
+	warnings = nil
+	c.checkLoginSession(ISCSITarget{Target: target, Portal: "192.168.1.13"})
+	if len(warnings) != 1 || warnings[0].Code != WarningSessionDegraded {
+		t.Errorf("Expected a %s warning but got %v", WarningSessionDegraded, warnings)
+	}
+	warnings = nil
+	c.checkLoginSession(ISCSITarget{Target: target, Portal: "192.168.1.12"})
+	if len(warnings) != 0 {
+		t.Errorf("Expected no warning but got %v", warnings)
+	}
+
+	m := NewMockISCSI(map[string]string{MockNumberOfTargets: "3", TargetFilterRegex: "1$"})
+	m.AddWarningHandler(func(w Warning) { warnings = append(warnings, w) })
+	targets, err := m.DiscoverTargets("1.1.1.1", false)
+	if err != nil || len(targets) != 1 {
+		t.Fatalf("Unexpected targets %v, %v", targets, err)
+	}
+	if len(warnings) != 1 || warnings[0].String() != "TargetsFiltered: 2 of 3 discovered targets dropped by the target filter" {
+		t.Errorf("Expected a %s warning but got %v", WarningTargetsFiltered, warnings)
+	}
+}
+
+func TestNodeSnapshot(t *testing.T) {
+	reset()
+	key := []byte("0123456789abcdef0123456789abcdef")
+	nodes := []ISCSINode{
+		{
+			Target: "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a0",
+			Portal: "192.168.1.10:3260",
+			Fields: map[string]string{
+				"node.name":                           "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a0",
+				"node.conn[0].address":                "192.168.1.10",
+				"node.session.auth.authmethod":        "CHAP",
+				"node.session.auth.username":          "user",
+				"node.session.auth.password":          "secret",
+				"node.session.auth.password_in":       maskedSecret,
+				"node.conn[0].timeo.noop_out_timeout": "5",
+			},
+		},
+	}
+	snapshot, err := newNodeSnapshot(nodes, SnapshotOptions{EncryptionKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	password := snapshot.Nodes[0].Fields["node.session.auth.password"]
+	if !strings.HasPrefix(password, encryptedSecretPrefix) || strings.Contains(password, "secret") {
+		t.Errorf("Expected an encrypted password but got %s", password)
+	}
+	if nodes[0].Fields["node.session.auth.password"] != "secret" {
+		t.Error("Expected the exported records to be left unchanged")
+	}
+
+	imported := make(map[string]string)
+	record := func(_ ISCSITarget, fields map[string]string) error {
+		imported = fields
+		return nil
+	}
+	results, err := importNodeSnapshot(snapshot, SnapshotOptions{EncryptionKey: key}, record)
+	if err != nil || results.SucceededCount() != 1 {
+		t.Fatalf("Unexpected results %v, %v", results, err)
+	}
+	compareStr(t, imported["node.session.auth.password"], "secret")
+	compareStr(t, imported["node.session.auth.username"], "user")
+	if _, ok := imported["node.session.auth.password_in"]; ok {
+		t.Error("Expected the masked secret not to be imported")
+	}
+	if _, ok := imported["node.conn[0].address"]; ok {
+		t.Error("Expected the address not to be imported")
+	}
+
+	_, err = importNodeSnapshot(snapshot, SnapshotOptions{}, record)
+	if !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error without key but got %v", err)
+	}
+	_, err = importNodeSnapshot(snapshot, SnapshotOptions{EncryptionKey: []byte("fedcba9876543210fedcba9876543210")}, record)
+	if !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error with a wrong key but got %v", err)
+	}
+	// an encrypted secret can't be moved to another record
+	snapshot.Nodes[0].Portal = "192.168.1.11:3260"
+	_, err = importNodeSnapshot(snapshot, SnapshotOptions{EncryptionKey: key}, record)
+	if !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error for a moved secret but got %v", err)
+	}
+	if _, err = newNodeSnapshot(nodes, SnapshotOptions{EncryptionKey: []byte("short")}); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error for an invalid key but got %v", err)
+	}
+	if _, err = importNodeSnapshot(&NodeSnapshot{Version: 2}, SnapshotOptions{}, record); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error for an unknown version but got %v", err)
+	}
+
+	plain, err := newNodeSnapshot(nodes, SnapshotOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareStr(t, plain.Nodes[0].Fields["node.session.auth.password"], "secret")
+
+	c := NewLinuxISCSI(map[string]string{})
+	expectedError := errors.New("exec: \"iscsiadm\": executable file not found in $PATH")
+	if _, err = c.ExportNodes(SnapshotOptions{}); err == nil || err.Error() != expectedError.Error() {
+		t.Errorf("Expected error: %v, but got: %v", expectedError, err)
+	}
+
+	m := NewMockISCSI(map[string]string{MockNumberOfNodes: "2"})
+	snapshot, err = m.ExportNodes(SnapshotOptions{EncryptionKey: key})
+	if err != nil || len(snapshot.Nodes) != 2 {
+		t.Fatalf("Unexpected snapshot %v, %v", snapshot, err)
+	}
+	results, err = m.ImportNodes(snapshot, SnapshotOptions{EncryptionKey: key})
+	if err != nil || results.SucceededCount() != 2 {
+		t.Errorf("Unexpected results %v, %v", results, err)
+	}
+	GOISCSIMock.InduceCreateOrUpdateNodeError = true
+	results, err = m.ImportNodes(snapshot, SnapshotOptions{EncryptionKey: key})
+	if err == nil || results.FailedCount() != 2 {
+		t.Errorf("Expected the import to fail but got %v, %v", results, err)
+	}
+}
+
+func TestCaptureAndDiffStates(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": target, "state": "LOGGED_IN"})
+	_ = os.MkdirAll(sysfsRoot+"/devices/platform/host3/session12/target3:0:0/3:0:0:1/block/sdc", 0o750)
+
+	c := NewMockISCSI(map[string]string{MockNumberOfNodes: "2"})
+	session := ISCSISession{SID: "12", Target: target, Portal: "192.168.1.12:3260", ISCSISessionState: ISCSISessionStateLOGGEDIN}
+	c.GetSessionsFn = func() ([]ISCSISession, error) { return []ISCSISession{session}, nil }
+
+	a, err := CaptureState(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Sessions) != 1 || len(a.Nodes) != 2 || len(a.Devices) != 1 {
+		t.Fatalf("Unexpected state %+v", a)
+	}
+	expectedDevice := SessionDevice{SID: "12", Target: target, HCTL: HCTL{3, 0, 0, 1}, Device: "sdc"}
+	if a.Devices[0] != expectedDevice {
+		t.Errorf("Expected device %v but got %v", expectedDevice, a.Devices[0])
+	}
+	if diff := DiffStates(a, a); !diff.Empty() {
+		t.Errorf("Expected no difference but got %s", diff)
+	}
+
+	b := &State{
+		Sessions: []ISCSISession{
+			{SID: "12", Target: target, Portal: "192.168.1.12:3260", ISCSISessionState: ISCSISessionStateFAILED},
+			{SID: "13", Target: target, Portal: "192.168.1.13:3260", ISCSISessionState: ISCSISessionStateLOGGEDIN},
+		},
+		Nodes: []ISCSINode{
+			{Target: a.Nodes[0].Target, Portal: a.Nodes[0].Portal, Fields: map[string]string{"node.session.scan": "manual"}},
+			{Target: target, Portal: "192.168.1.13:3260"},
+		},
+		Devices: []SessionDevice{
+			{SID: "12", Target: target, HCTL: HCTL{3, 0, 0, 2}, Device: "sdc"},
+			{SID: "13", Target: target, HCTL: HCTL{4, 0, 0, 1}, Device: "sdd"},
+		},
+	}
+	diff := DiffStates(a, b)
+	if len(diff.AddedSessions) != 1 || diff.AddedSessions[0].SID != "13" ||
+		len(diff.ChangedSessions) != 1 || len(diff.RemovedSessions) != 0 {
+		t.Errorf("Unexpected session differences %+v", diff)
+	}
+	if len(diff.AddedNodes) != 1 || len(diff.RemovedNodes) != 1 || len(diff.ChangedNodes) != 1 ||
+		strings.Join(diff.ChangedNodes[0].Fields, ",") != "node.session.scan" {
+		t.Errorf("Unexpected node differences %+v", diff)
+	}
+	if len(diff.AddedDevices) != 1 || len(diff.ChangedDevices) != 1 || len(diff.RemovedDevices) != 0 {
+		t.Errorf("Unexpected device differences %+v", diff)
+	}
+	if !strings.Contains(diff.String(), "~ session 12 "+target+" at 192.168.1.12:3260 LOGGED_IN/ -> FAILED/") {
+		t.Errorf("Unexpected summary %s", diff)
+	}
+
+	diff = DiffStates(b, nil)
+	if len(diff.RemovedSessions) != 2 || len(diff.RemovedNodes) != 2 || len(diff.RemovedDevices) != 2 {
+		t.Errorf("Expected everything removed but got %+v", diff)
+	}
+
+	GOISCSIMock.InduceGetNodesError = true
+	if _, err = CaptureState(c); err == nil {
+		t.Error("Expected an error capturing the state")
+	}
+}
+
+func TestCompareDiagnostics(t *testing.T) {
+	reset()
+	c := NewMockISCSI(map[string]string{MockNumberOfNodes: "2"})
+	c.GetSessionsFn = func() ([]ISCSISession, error) {
+		return []ISCSISession{{SID: "1", IfaceName: "iface-eth1"}}, nil
+	}
+	current, err := CaptureDiagnostics(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff, err := CompareDiagnostics(current, current); err != nil || !diff.Empty() {
+		t.Errorf("Expected no difference but got %s, %v", diff, err)
+	}
+
+	var bundle DiagnosticBundle
+	if err = json.Unmarshal(current, &bundle); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bundle.Ifaces["iface-eth1"]; !ok {
+		t.Errorf("Expected the iface of the session in the bundle but got %v", bundle.Ifaces)
+	}
+	bundle.IscsidConf = map[string]string{"node.session.timeo.replacement_timeout": "120", "node.startup": "manual"}
+	bundle.Nodes[0].Fields = map[string]string{"node.session.scan": "manual"}
+	bundle.Nodes = bundle.Nodes[:1]
+	bundle.Ifaces["iface-eth1"]["iface.mtu"] = "9000"
+	bundle.Ifaces["iface-eth2"] = map[string]string{}
+	baseline, err := json.Marshal(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := CompareDiagnostics(current, baseline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.IscsidConf) != 2 || len(diff.AddedNodes) != 1 || len(diff.RemovedNodes) != 0 ||
+		len(diff.ChangedNodes) != 1 || len(diff.RemovedIfaces) != 1 || len(diff.ChangedIfaces) != 1 {
+		t.Errorf("Unexpected differences %+v", diff)
+	}
+	for _, line := range []string{
+		"~ iscsid.conf node.startup manual -> <unset>",
+		"~ iface iface-eth1 iface.mtu 9000 -> 0",
+		"- iface iface-eth2",
+	} {
+		if !strings.Contains(diff.String(), line) {
+			t.Errorf("Expected %q in the summary %s", line, diff)
+		}
+	}
+
+	if _, err = CompareDiagnostics([]byte("{"), baseline); err == nil {
+		t.Error("Expected an error parsing the current bundle")
+	}
+	if _, err = CompareDiagnostics(current, []byte("[]")); err == nil {
+		t.Error("Expected an error parsing the baseline bundle")
+	}
+
+	root := t.TempDir()
+	_ = os.MkdirAll(root+"/etc/iscsi", 0o750)
+	_ = os.WriteFile(root+"/etc/iscsi/iscsid.conf",
+		[]byte("# node.startup = automatic\nnode.startup = manual\n\nnode.session.cmds_max = 128\n"), 0o600)
+	settings, err := NewLinuxISCSI(map[string]string{ChrootDirectory: root}).readIscsidConf()
+	expected := map[string]string{"node.startup": "manual", "node.session.cmds_max": "128"}
+	if err != nil || !reflect.DeepEqual(settings, expected) {
+		t.Errorf("Expected iscsid.conf settings %v but got %v, %v", expected, settings, err)
+	}
+}
+
+func TestIfaceSessionCounts(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": "iqn.2015-10.com.dell:a", "ifacename": "iface-eth1"})
+	if err := os.WriteFile(defaultSysfsTree().classPath("iscsi_host")+"/host3/netdev", []byte("eth1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	session := defaultSysfsTree().readSession("12")
+	compareStr(t, session.IfaceName, "iface-eth1")
+	compareStr(t, session.IfaceNetdev, "eth1")
+
+	sessions := []ISCSISession{
+		{IfaceName: "iface-eth1", IfaceNetdev: "eth1"},
+		{IfaceName: "iface-eth1", IfaceNetdev: "eth1"},
+		{IfaceName: "iface-eth1", IfaceNetdev: "eth1"},
+		{IfaceName: "iface-eth1", IfaceNetdev: "eth1"},
+		{IfaceName: "iface-eth1", IfaceNetdev: "eth1"},
+		{IfaceName: "iface-eth2", IfaceNetdev: "eth2"},
+		{},
+	}
+	counts := countIfaceSessions(sessions)
+	expected := []IfaceSessionCount{
+		{Iface: "default", Sessions: 1},
+		{Iface: "iface-eth1", Netdev: "eth1", Sessions: 5},
+		{Iface: "iface-eth2", Netdev: "eth2", Sessions: 1},
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("Expected %v but got %v", expected, counts)
+	}
+
+	moves := RecommendIfaceRebalance(counts, 1.5)
+	expectedMoves := []IfaceRebalanceMove{
+		{From: "iface-eth1", To: "default", Sessions: 1},
+		{From: "iface-eth1", To: "iface-eth2", Sessions: 1},
+	}
+	if !reflect.DeepEqual(moves, expectedMoves) {
+		t.Errorf("Expected %v but got %v", expectedMoves, moves)
+	}
+	if moves = RecommendIfaceRebalance(counts, 5); moves != nil {
+		t.Errorf("Expected no move but got %v", moves)
+	}
+	if moves = RecommendIfaceRebalance(counts[:1], 1); moves != nil {
+		t.Errorf("Expected no move but got %v", moves)
+	}
+	moves = RecommendIfaceRebalance([]IfaceSessionCount{{Iface: "a", Sessions: 4}, {Iface: "b"}}, 0)
+	if len(moves) != 1 || moves[0].Sessions != 2 {
+		t.Errorf("Expected 2 sessions moved but got %v", moves)
+	}
+
+	c := NewMockISCSI(map[string]string{MockNumberOfSessions: "3"})
+	counts, err := c.GetIfaceSessionCounts()
+	if err != nil || len(counts) != 1 || counts[0].Sessions != 3 {
+		t.Errorf("Unexpected counts %v, %v", counts, err)
+	}
+	GOISCSIMock.InduceGetSessionsError = true
+	if _, err = c.GetIfaceSessionCounts(); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func TestGetSessionsByIface(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": "iqn.2015-10.com.dell:a", "ifacename": "iface-eth1"})
+	makeSysfsSession(t, "host4", "13", map[string]string{"targetname": "iqn.2015-10.com.dell:a", "ifacename": "iface-eth2"})
+	makeSysfsSession(t, "host5", "14", map[string]string{"targetname": "iqn.2015-10.com.dell:b", "ifacename": "iface-eth1"})
+
+	c := NewLinuxISCSI(map[string]string{SessionSource: "sysfs"})
+	sessions, err := c.GetSessionsByIface("iface-eth1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[0].SID != "12" || sessions[1].SID != "14" {
+		t.Errorf("Expected sessions 12 and 14 but got %v", sessions)
+	}
+	if sessions, err = c.GetSessionsByIface("iface-eth3"); err != nil || len(sessions) != 0 {
+		t.Errorf("Expected no session but got %v, %v", sessions, err)
+	}
+	if _, err = c.GetSessionsByIface("iface eth1"); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+
+	mock := NewMockISCSI(map[string]string{MockNumberOfSessions: "3"})
+	if sessions, err = mock.GetSessionsByIface("default"); err != nil || len(sessions) != 3 {
+		t.Errorf("Expected 3 sessions through the default iface but got %v, %v", sessions, err)
+	}
+	if sessions, err = mock.GetSessionsByIface("iface-eth1"); err != nil || len(sessions) != 0 {
+		t.Errorf("Expected no session but got %v, %v", sessions, err)
+	}
+	GOISCSIMock.InduceGetSessionsError = true
+	if _, err = mock.GetSessionsByIface("default"); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func TestCheckIscsid(t *testing.T) {
+	reset()
+	defaultSocket := iscsidSocket
+	defer func() { iscsidSocket = defaultSocket }()
+	iscsidSocket = t.TempDir() + "/iscsid.sock"
+
+	target := ISCSITarget{Portal: "1.1.1.1", Target: "iqn.1992-04.com.emc:600009700bcbb70e3287017400000000"}
+	c := NewLinuxISCSI(map[string]string{CheckIscsid: "true"})
+	if err := c.PerformLogin(target); !errors.Is(err, ErrIscsidUnavailable) || !errors.Is(err, goiscsierrors.Conflict) {
+		t.Errorf("Expected error: %v, but got: %v", ErrIscsidUnavailable, err)
+	}
+	if err := c.DeleteNode(target); !errors.Is(err, ErrIscsidUnavailable) {
+		t.Errorf("Expected error: %v, but got: %v", ErrIscsidUnavailable, err)
+	}
+	if _, err := c.DiscoverTargets("1.1.1.1", false); !errors.Is(err, ErrIscsidUnavailable) {
+		t.Errorf("Expected error: %v, but got: %v", ErrIscsidUnavailable, err)
+	}
+
+	l, err := net.Listen("unix", iscsidSocket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	expectedError := errors.New("exec: \"iscsiadm\": executable file not found in $PATH")
+	if err = c.PerformLogin(target); err == nil || err.Error() != expectedError.Error() {
+		t.Errorf("Expected error: %v, but got: %v", expectedError, err)
+	}
+
+	// without the option, iscsiadm is run without checking iscsid
+	c = NewLinuxISCSI(map[string]string{})
+	l.Close()
+	if err = c.PerformRescan(); err == nil || err.Error() != expectedError.Error() {
+		t.Errorf("Expected error: %v, but got: %v", expectedError, err)
+	}
+}
+
+func TestLoginExistingSession(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": target, "state": "LOGGED_IN", "tpgt": "2"})
+	tgt := ISCSITarget{Portal: "192.168.1.12:3260", GroupTag: "1", Target: target}
+
+	c := NewLinuxISCSI(map[string]string{})
+	var warnings []Warning
+	c.AddWarningHandler(func(w Warning) { warnings = append(warnings, w) })
+	if err := c.PerformLogin(tgt); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].Code != WarningSessionExists || !strings.Contains(warnings[0].Message, "session 12") {
+		t.Errorf("Expected a %s warning but got %v", WarningSessionExists, warnings)
+	}
+
+	c = NewLinuxISCSI(map[string]string{ErrorOnExistingSession: "true"})
+	err := c.PerformLogin(tgt)
+	var existing *AlreadyLoggedInError
+	if !errors.As(err, &existing) || existing.SID != "12" || existing.GroupTag != "2" {
+		t.Errorf("Expected an AlreadyLoggedInError for session 12 but got %v", err)
+	}
+	if !errors.Is(err, ErrAlreadyLoggedIn) || !errors.Is(err, goiscsierrors.Conflict) {
+		t.Errorf("Expected error: %v, but got: %v", ErrAlreadyLoggedIn, err)
+	}
+
+	// no session to this portal
+	expectedError := errors.New("exec: \"iscsiadm\": executable file not found in $PATH")
+	tgt.Portal = "192.168.1.13:3260"
+	if err = c.PerformLogin(tgt); err == nil || err.Error() != expectedError.Error() {
+		t.Errorf("Expected error: %v, but got: %v", expectedError, err)
+	}
+}
+
+func TestGetNodesFromDB(t *testing.T) {
+	reset()
+	root := t.TempDir()
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	writeRecord := func(path, content string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := NewLinuxISCSI(map[string]string{ChrootDirectory: root, NodeSource: "db"})
+	if _, err := c.GetNodes(); !errors.Is(err, goiscsierrors.NotFound) {
+		t.Errorf("Expected a not found error but got %v", err)
+	}
+
+	// legacy layout, with the record stored in place of the portal directory
+	writeRecord(root+"/var/lib/iscsi/nodes/"+target+"/192.168.1.2,3260,1",
+		"node.startup = manual\nnode.session.auth.password = secret\n")
+	nodes, err := c.GetNodes()
+	if err != nil || len(nodes) != 1 {
+		t.Fatalf("Unexpected nodes %v, %v", nodes, err)
+	}
+	compareStr(t, nodes[0].Target, target)
+	compareStr(t, nodes[0].Portal, "192.168.1.2:3260")
+	compareStr(t, nodes[0].Fields["node.startup"], "manual")
+	compareStr(t, nodes[0].Fields["node.session.auth.password"], maskedSecret)
+
+	// the current location is preferred
+	writeRecord(root+"/etc/iscsi/nodes/"+target+"/192.168.1.1,3260,1/default", "# BEGIN RECORD 2.1.8\n"+
+		"node.name = "+target+"\nnode.tpgt = 1\nnode.startup = automatic\n"+
+		"iface.iscsi_ifacename = default\nnode.conn[0].address = 192.168.1.1\nnode.conn[0].port = 3260\n# END RECORD\n")
+	writeRecord(root+"/etc/iscsi/nodes/"+target+"/fe80::1,3260,1/iface1", "node.startup = manual\n")
+	nodes, err = c.GetNodes()
+	if err != nil || len(nodes) != 2 {
+		t.Fatalf("Unexpected nodes %v, %v", nodes, err)
+	}
+	compareStr(t, nodes[0].Portal, "192.168.1.1:3260")
+	compareStr(t, nodes[0].Fields["node.startup"], "automatic")
+	compareStr(t, nodes[0].Fields["iface.iscsi_ifacename"], "default")
+	compareStr(t, nodes[1].Portal, "[fe80::1]:3260")
+
+	// auto falls back to iscsiadm when there is no node database
+	c = NewLinuxISCSI(map[string]string{ChrootDirectory: t.TempDir(), NodeSource: "auto"})
+	if _, err = c.GetNodes(); err == nil || errors.Is(err, goiscsierrors.NotFound) && strings.Contains(err.Error(), "database") {
+		t.Errorf("Expected an error running iscsiadm but got %v", err)
+	}
+}
+
+// fakeISCSIAdm puts an iscsiadm shell script running body first in PATH, and returns the
+// file where the script records its arguments
+func fakeISCSIAdm(t *testing.T, body string) string {
+	t.Helper()
+	dir := t.TempDir()
+	log := filepath.Join(dir, "args.log")
+	script := "#!/bin/sh\necho \"$@\" >> " + log + "\n" + body + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "iscsiadm"), []byte(script), 0o700); err != nil { // #nosec G306
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return log
+}
+
+func TestGetSessionsSlowPath(t *testing.T) {
+	reset()
+	defaultRoot, defaultRecheck := sysfsRoot, slowPathRecheckInterval
+	defer func() { sysfsRoot, slowPathRecheckInterval = defaultRoot, defaultRecheck }()
+	sysfsRoot = t.TempDir()
+	makeSysfsSession(t, "host3", "12", map[string]string{"username": "chapuser"})
+
+	data, err := filepath.Abs("testdata/session_info_valid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := fakeISCSIAdm(t, "/bin/sleep 0.05\n/bin/cat "+data)
+
+	c := NewLinuxISCSI(map[string]string{SessionSource: "iscsiadm", SlowSessionThreshold: "10ms"})
+	var warnings []Warning
+	c.AddWarningHandler(func(w Warning) { warnings = append(warnings, w) })
+
+	sessions, err := c.GetSessions()
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("Unexpected sessions %v, %v", sessions, err)
+	}
+	compareStr(t, sessions[0].Username, "admin")
+	if len(warnings) != 1 || warnings[0].Code != WarningSlowPath {
+		t.Errorf("Expected a %s warning but got %v", WarningSlowPath, warnings)
+	}
+
+	// the next query uses level 1, with the CHAP settings read from sysfs
+	sessions, err = c.GetSessions()
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("Unexpected sessions %v, %v", sessions, err)
+	}
+	compareStr(t, sessions[0].Username, "chapuser")
+	compareStr(t, sessions[1].Username, "")
+	if len(warnings) != 1 {
+		t.Errorf("Expected no new warning but got %v", warnings)
+	}
+
+	// back to level 2 once the recheck interval is over
+	c.slowPathMu.Lock()
+	c.slowPathUntil = time.Time{}
+	c.slowPathMu.Unlock()
+	c.SetOptions(map[string]string{SessionSource: "iscsiadm"})
+	if _, err = c.GetSessions(); err != nil {
+		t.Fatal(err)
+	}
+	args, _ := os.ReadFile(log)
+	compareStr(t, string(args), "-m session -P 2 -S\n-m session -P 1 -S\n-m session -P 2 -S\n")
+}
+
+func TestDetectResizedDevices(t *testing.T) {
+	reset()
+	defaultRoot, defaultRescan := sysfsRoot, rescanSysfsBlockDevice
+	defer func() { sysfsRoot, rescanSysfsBlockDevice = defaultRoot, defaultRescan }()
+	sysfsRoot = t.TempDir()
+
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": target, "state": "LOGGED_IN"})
+	for lun, dev := range []string{"sdc", "sdd"} {
+		_ = os.MkdirAll(fmt.Sprintf("%s/devices/platform/host3/session12/target3:0:0/3:0:0:%d/block/%s", sysfsRoot, lun, dev), 0o750)
+		_ = os.MkdirAll(sysfsRoot+"/block/"+dev+"/device", 0o750)
+		if err := os.WriteFile(sysfsRoot+"/block/"+dev+"/size", []byte("2048\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := NewLinuxISCSI(map[string]string{})
+	if err := c.RescanDevice("/dev/sdc"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(sysfsRoot + "/block/sdc/device/rescan")
+	compareStr(t, string(data), "1")
+	if err := c.RescanDevice("../sdc"); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+
+	// the rescan of sdd finds it grown
+	rescanSysfsBlockDevice = func(_ sysfsTree, device string) error {
+		if device == "sdd" {
+			return os.WriteFile(sysfsRoot+"/block/sdd/size", []byte("4096\n"), 0o600)
+		}
+		return nil
+	}
+	resized, err := c.DetectResizedDevices(ISCSITarget{Target: target})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ResizedDevice{{Device: "sdd", OldSize: 2048 * 512, NewSize: 4096 * 512}}
+	if !reflect.DeepEqual(resized, expected) {
+		t.Errorf("Expected %v but got %v", expected, resized)
+	}
+	resized, err = c.DetectResizedDevices(ISCSITarget{Target: "iqn.2015-10.com.dell:other"})
+	if err != nil || len(resized) != 0 {
+		t.Errorf("Expected no device but got %v, %v", resized, err)
+	}
+
+	m := NewMockISCSI(map[string]string{})
+	if resized, err = m.DetectResizedDevices(ISCSITarget{Target: target}); err != nil || len(resized) != 0 {
+		t.Errorf("Unexpected result %v, %v", resized, err)
+	}
+	GOISCSIMock.InduceRescanDeviceError = true
+	if err = m.RescanDevice("sdc"); err == nil || !strings.Contains(err.Error(), "induced") {
+		t.Errorf("Expected an induced error but got %v", err)
+	}
+	if _, err = m.DetectResizedDevices(ISCSITarget{Target: target}); err == nil || !strings.Contains(err.Error(), "induced") {
+		t.Errorf("Expected an induced error but got %v", err)
+	}
+}
+
+func TestNodeMetadata(t *testing.T) {
+	reset()
+	defaultDir := nodeMetadataDir
+	nodeMetadataDir = t.TempDir()
+	defer func() { nodeMetadataDir = defaultDir }()
+	target := ISCSITarget{Portal: "192.168.1.1", Target: "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"}
+	data := filepath.Join(t.TempDir(), "nodes")
+	record := "# BEGIN RECORD 2.1.8\nnode.name = " + target.Target + "\nnode.tpgt = 1\n" +
+		"node.conn[0].address = 192.168.1.1\nnode.conn[0].port = 3260\n# END RECORD\n"
+	if err := os.WriteFile(data, []byte(record), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	log := fakeISCSIAdm(t, "/bin/cat "+data)
+
+	c := NewLinuxISCSI(map[string]string{})
+	options := NodeMetadataOptions(map[string]string{"volume-id": "vol-1", "owner": "csi"})
+	options["node.startup"] = "manual"
+	if err := c.CreateOrUpdateNode(target, options); err != nil {
+		t.Fatal(err)
+	}
+	args, err := os.ReadFile(log) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(args), NodeMetadataPrefix) {
+		t.Errorf("Expected no metadata in the iscsiadm arguments but got %s", args)
+	}
+	if err = c.CreateOrUpdateNode(target, NodeMetadataOptions(map[string]string{"owner": ""})); err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := c.GetNodes()
+	if err != nil || len(nodes) != 1 {
+		t.Fatalf("Unexpected nodes %v, %v", nodes, err)
+	}
+	if metadata := NodeMetadata(nodes[0]); !reflect.DeepEqual(metadata, map[string]string{"volume-id": "vol-1"}) {
+		t.Errorf("Unexpected metadata %v", metadata)
+	}
+
+	invalid := NodeMetadataOptions(map[string]string{"volume id": "vol-1"})
+	if err = c.CreateOrUpdateNode(target, invalid); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+	large := NodeMetadataOptions(map[string]string{"data": strings.Repeat("x", maxNodeMetadataSize)})
+	if err = c.CreateOrUpdateNode(target, large); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+
+	if err = c.DeleteNode(target); err != nil {
+		t.Fatal(err)
+	}
+	nodes, err = c.GetNodes()
+	if err != nil || len(NodeMetadata(nodes[0])) != 0 {
+		t.Errorf("Expected the metadata to be removed but got %v, %v", nodes, err)
+	}
+
+	mock := NewMockISCSI(map[string]string{})
+	mockTarget := ISCSITarget{Portal: "192.168.1.0", Target: "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a0"}
+	if err = mock.CreateOrUpdateNode(mockTarget, NodeMetadataOptions(map[string]string{"volume-id": "vol-2"})); err != nil {
+		t.Fatal(err)
+	}
+	nodes, err = mock.GetNodes()
+	if err != nil || len(nodes) == 0 {
+		t.Fatalf("Unexpected nodes %v, %v", nodes, err)
+	}
+	compareStr(t, NodeMetadata(nodes[0])["volume-id"], "vol-2")
+}
+
+func TestLogoutSessionBySID(t *testing.T) {
+	reset()
+	log := fakeISCSIAdm(t, "exit 0")
+	c := NewLinuxISCSI(map[string]string{})
+	if err := c.LogoutSessionBySID("12"); err != nil {
+		t.Fatal(err)
+	}
+	args, err := os.ReadFile(log) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareStr(t, strings.TrimSpace(string(args)), "-m session -r 12 -u")
+	if err = c.LogoutSessionBySID("12; reboot"); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+
+	fakeISCSIAdm(t, "exit 21")
+	if err = c.LogoutSessionBySID("13"); !errors.Is(err, goiscsierrors.NotFound) {
+		t.Errorf("Expected a not found error but got %v", err)
+	}
+
+	mock := NewMockISCSI(map[string]string{})
+	if err = mock.LogoutSessionBySID("1"); err != nil {
+		t.Error(err)
+	}
+	GOISCSIMock.InduceLogoutError = true
+	if err = mock.LogoutSessionBySID("1"); err == nil {
+		t.Error("Expected an induced error")
+	}
+}
+
+func TestGetAllInitiators(t *testing.T) {
+	reset()
+	root := t.TempDir()
+	writeFile := func(name, content string) {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var warnings []Warning
+	c := NewLinuxISCSI(map[string]string{ChrootDirectory: root})
+	c.AddWarningHandler(func(w Warning) { warnings = append(warnings, w) })
+
+	if _, err := c.GetAllInitiators(); !errors.Is(err, goiscsierrors.NotFound) {
+		t.Errorf("Expected a not found error but got %v", err)
+	}
+
+	writeFile(DefaultInitiatorNameFile, "InitiatorName=iqn.1993-08.org.debian:01:aaaa\n")
+	writeFile("/etc/open-iscsi/initiatorname.iscsi", "InitiatorName = iqn.1993-08.org.debian:01:aaaa\n")
+	report, err := c.GetAllInitiators()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Files) != 2 || report.Conflict || len(warnings) != 0 {
+		t.Errorf("Unexpected report %+v, warnings %v", report, warnings)
+	}
+
+	writeFile("/etc/initiatorname.iscsi", "InitiatorName=iqn.1996-04.de.suse:01:bbbb\n")
+	report, err = c.GetAllInitiators()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Conflict || !reflect.DeepEqual(report.IQNs,
+		[]string{"iqn.1993-08.org.debian:01:aaaa", "iqn.1996-04.de.suse:01:bbbb"}) {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	compareStr(t, report.Files[0].Path, filepath.Join(root, DefaultInitiatorNameFile))
+	if len(warnings) != 1 || warnings[0].Code != WarningInitiatorConflict {
+		t.Errorf("Expected an initiator conflict warning but got %v", warnings)
+	}
+
+	mock := NewMockISCSI(map[string]string{MockNumberOfInitiators: "2"})
+	if report, err = mock.GetAllInitiators(); err != nil || !report.Conflict {
+		t.Errorf("Unexpected mock report %+v, %v", report, err)
+	}
+	GOISCSIMock.InduceInitiatorError = true
+	if _, err = mock.GetAllInitiators(); err == nil {
+		t.Error("Expected an induced error")
+	}
+}
+
+func TestInitiatorOverride(t *testing.T) {
+	reset()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "initiatorname.iscsi")
+	content := "\ufeff## generated\r\nInitiatorName = \"iqn.1993-08.org.debian:01:aaaa\"\r\n#InitiatorName=iqn.1993-08.org.debian:01:bbbb\r\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := NewLinuxISCSI(map[string]string{ChrootDirectory: dir})
+	iqns, err := c.GetInitiators(path)
+	if err != nil || !reflect.DeepEqual(iqns, []string{"iqn.1993-08.org.debian:01:aaaa"}) {
+		t.Errorf("Expected the quoted initiator name of the CRLF file but got %v, %v", iqns, err)
+	}
+
+	t.Setenv(InitiatorNameEnv, " 'iqn.1993-08.org.debian:01:env' ")
+	iqns, err = c.GetInitiators(path)
+	if err != nil || !reflect.DeepEqual(iqns, []string{"iqn.1993-08.org.debian:01:env"}) {
+		t.Errorf("Expected the initiator name of the environment but got %v, %v", iqns, err)
+	}
+	c.SetInitiatorOverride("iqn.1993-08.org.debian:01:override")
+	report, err := c.GetAllInitiators()
+	if err != nil || report.Override != "iqn.1993-08.org.debian:01:override" ||
+		!reflect.DeepEqual(report.IQNs, []string{"iqn.1993-08.org.debian:01:override"}) {
+		t.Errorf("Expected the initiator override to take precedence but got %+v, %v", report, err)
+	}
+	c.SetInitiatorOverride("")
+	if iqns, _ = c.GetInitiators(path); !reflect.DeepEqual(iqns, []string{"iqn.1993-08.org.debian:01:env"}) {
+		t.Errorf("Expected the initiator name of the environment after clearing the override but got %v", iqns)
+	}
+
+	mock := NewMockISCSI(map[string]string{})
+	GOISCSIMock.InduceInitiatorError = true
+	if iqns, err = mock.GetInitiators(""); err != nil || iqns[0] != "iqn.1993-08.org.debian:01:env" {
+		t.Errorf("Expected the mock to use the initiator name of the environment but got %v, %v", iqns, err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	reset()
+	defaultInterval := pingInterval
+	pingInterval = time.Millisecond
+	defer func() { pingInterval = defaultInterval }()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	portal := listener.Addr().String()
+	target := ISCSITarget{Portal: portal, Target: "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"}
+
+	// the NOP counters increase between the two statistics queries
+	dir := t.TempDir()
+	session := "Target: " + target.Target + " (non-flash)\n\tCurrent Portal: " + portal + ",1\n" +
+		"\t\tSID: 7\n\t\tiSCSI Connection State: LOGGED IN\n\t\tiSCSI Session State: LOGGED_IN\n"
+	if err = os.WriteFile(filepath.Join(dir, "session"), []byte(session), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fakeISCSIAdm(t, `case "$*" in
+*-s) n=$(cat `+dir+`/count 2>/dev/null || echo 0); echo $((n+2)) > `+dir+`/count
+	printf 'Stats for session [sid: 7]\niSCSI SNMP:\n\tnoptx_pdus: %d\n\tnoprx_pdus: %d\n' $n $n ;;
+*) cat `+dir+`/session ;;
+esac`)
+
+	c := NewLinuxISCSI(map[string]string{SessionSource: "iscsiadm"})
+	result, err := c.Ping(target, 3, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.RTTs) != 3 || result.Lost != 0 {
+		t.Errorf("Expected 3 answered probes but got %+v", result)
+	}
+	compareStr(t, result.SID, "7")
+	compareStr(t, string(result.SessionState), string(ISCSISessionStateLOGGEDIN))
+	if result.NopOuts != 2 || result.NopIns != 2 {
+		t.Errorf("Expected 2 NOP-Outs and NOP-Ins but got %+v", result)
+	}
+
+	if _, err = c.Ping(target, 0, time.Second); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+	listener.Close()
+	result, err = c.Ping(target, 2, 100*time.Millisecond)
+	if !errors.Is(err, goiscsierrors.Transport) || result.Lost != 2 {
+		t.Errorf("Expected a transport error but got %+v, %v", result, err)
+	}
+
+	mock := NewMockISCSI(map[string]string{})
+	if result, err = mock.Ping(target, 2, time.Second); err != nil || len(result.RTTs) != 2 {
+		t.Errorf("Unexpected mock result %+v, %v", result, err)
+	}
+	GOISCSIMock.InducePingError = true
+	if _, err = mock.Ping(target, 2, time.Second); err == nil {
+		t.Error("Expected an induced error")
+	}
+}
+
+func TestDiscoveryIface(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	// a session to the target through the default iface does not prevent the login through iface0
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": target, "state": "LOGGED_IN", "ifacename": "default"})
+	log := fakeISCSIAdm(t, `if [ "$2" = discovery ]; then echo "192.168.1.12:3260,1 `+target+`"; fi`)
+
+	c := NewLinuxISCSI(map[string]string{})
+	targets, err := c.DiscoverTargetsWithOptions("192.168.1.12", DiscoveryOptions{Login: true, Iface: "iface0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 || targets[0].Iface != "iface0" {
+		t.Errorf("Expected a target bound to iface0 but got %v", targets)
+	}
+	if err = c.AddPathToTarget(target, "192.168.1.13", "iface1"); err == nil {
+		t.Error("Expected an error as there is no node record to copy")
+	}
+	if err = c.CreateOrUpdateNode(ISCSITarget{Portal: "192.168.1.13", Target: target, Iface: "iface1"},
+		map[string]string{"node.startup": "manual"}); err != nil {
+		t.Fatal(err)
+	}
+	args, err := os.ReadFile(log) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"-m discovery -t st --portal 192.168.1.12:3260 -I iface0",
+		"-m node -T " + target + " --portal 192.168.1.12:3260,1 -l -I iface0",
+		"-m node -p 192.168.1.13 -T " + target + " -I iface1 -o update -n node.startup -v manual",
+	} {
+		if !strings.Contains(string(args), expected+"\n") {
+			t.Errorf("Expected iscsiadm to run with %q but got:\n%s", expected, args)
+		}
+	}
+
+	if _, err = c.DiscoverTargetsWithOptions("192.168.1.12", DiscoveryOptions{Iface: "iface 0"}); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+
+	mock := NewMockISCSI(map[string]string{})
+	if targets, err = mock.DiscoverTargetsWithOptions("1.1.1.1", DiscoveryOptions{Iface: "iface0"}); err != nil || targets[0].Iface != "iface0" {
+		t.Errorf("Unexpected mock targets %v, %v", targets, err)
+	}
+}
+
+func TestFlashSessions(t *testing.T) {
+	reset()
+	data, err := os.ReadFile("testdata/session_info_flash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := (&sessionParser{}).Parse(data)
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions but got %v", sessions)
+	}
+	compareStr(t, string(sessions[0].SessionSource), string(ISCSISessionSourceFlash))
+	compareStr(t, sessions[0].Portal, "192.168.1.1:3260")
+	compareStr(t, sessions[0].GroupTag, "1")
+	compareStr(t, string(sessions[0].IfaceTransport), "qla4xxx")
+	compareStr(t, string(sessions[1].SessionSource), string(ISCSISessionSourceSoftware))
+
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	makeSysfsSession(t, "host3", "1", map[string]string{"targetname": target, "state": "LOGGED_IN", "creator": "-1"})
+	makeSysfsSession(t, "host4", "2", map[string]string{"targetname": target, "state": "LOGGED_IN", "creator": "1234"})
+	sessions, err = defaultSysfsTree().readSessions()
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("Unexpected sessions %v, %v", sessions, err)
+	}
+	compareStr(t, string(sessions[0].SessionSource), string(ISCSISessionSourceFlash))
+	compareStr(t, string(sessions[1].SessionSource), string(ISCSISessionSourceSoftware))
+
+	c := NewLinuxISCSI(map[string]string{})
+	err = c.PerformLogout(ISCSITarget{Portal: "192.168.1.1:3260", Target: target})
+	if !errors.Is(err, ErrFlashSession) || !errors.Is(err, goiscsierrors.Conflict) {
+		t.Errorf("Expected error: %v, but got: %v", ErrFlashSession, err)
+	}
+	// the software session and a forced logout go to iscsiadm
+	expectedError := errors.New("exec: \"iscsiadm\": executable file not found in $PATH")
+	for _, logout := range []func() error{
+		func() error { return c.PerformLogout(ISCSITarget{Portal: "192.168.1.2:3260", Target: target}) },
+		func() error {
+			return c.PerformLogoutWithOptions(ISCSITarget{Portal: "192.168.1.1:3260", Target: target}, LogoutOptions{Force: true})
+		},
+	} {
+		if err = logout(); err == nil || err.Error() != expectedError.Error() {
+			t.Errorf("Expected error: %v, but got: %v", expectedError, err)
+		}
+	}
+
+	mock := NewMockISCSI(map[string]string{})
+	GOISCSIMock.InduceFlashSessionError = true
+	if err = mock.PerformLogout(ISCSITarget{Portal: "192.168.1.1", Target: target}); !errors.Is(err, ErrFlashSession) {
+		t.Errorf("Expected error: %v, but got: %v", ErrFlashSession, err)
+	}
+	if err = mock.PerformLogoutWithOptions(ISCSITarget{Portal: "192.168.1.1", Target: target}, LogoutOptions{Force: true}); err != nil {
+		t.Error(err)
+	}
+}
+
+type recordedSpan struct {
+	operation  string
+	attributes map[string]string
+	err        error
+}
+
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+func (r *recordingTracer) Start(_ context.Context, operation string, attributes map[string]string) Span {
+	s := &recordedSpan{operation: operation, attributes: attributes}
+	r.spans = append(r.spans, s)
+	return s
+}
+
+func (s *recordedSpan) SetAttribute(key, value string) { s.attributes[key] = value }
+
+func (s *recordedSpan) End(err error) { s.err = err }
+
+func TestTracer(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	fakeISCSIAdm(t, `case "$*" in
+*discovery*) echo "192.168.1.12:3260,1 `+target+`" ;;
+*-l*) exit 24 ;;
+esac`)
+
+	tracer := &recordingTracer{}
+	c := NewLinuxISCSI(map[string]string{SessionSource: "sysfs"})
+	c.SetTracer(tracer)
+	if _, err := c.DiscoverTargetsWithOptions("192.168.1.12", DiscoveryOptions{Login: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PerformRescan(); err != nil {
+		t.Fatal(err)
+	}
+	if len(tracer.spans) != 3 {
+		t.Fatalf("Expected 3 spans but got %d", len(tracer.spans))
+	}
+	discovery, login, rescan := tracer.spans[0], tracer.spans[1], tracer.spans[2]
+	compareStr(t, discovery.operation, SpanDiscovery)
+	compareStr(t, discovery.attributes[AttributePortal], "192.168.1.12:3260")
+	compareStr(t, discovery.attributes[AttributeDiscoveryType], "st")
+	compareStr(t, login.operation, SpanLogin)
+	compareStr(t, login.attributes[AttributeTarget], target)
+	compareStr(t, login.attributes[AttributeExitCode], "24")
+	if login.err == nil || discovery.err != nil {
+		t.Errorf("Expected only the login span to fail but got %v, %v", login.err, discovery.err)
+	}
+	compareStr(t, rescan.operation, SpanRescan)
+
+	c.SetTracer(nil)
+	_ = c.PerformRescan()
+	if len(tracer.spans) != 3 {
+		t.Errorf("Expected no span once the tracer is removed but got %d", len(tracer.spans))
+	}
+}
+
+func TestResolveDevicePaths(t *testing.T) {
+	reset()
+	defaultSysfs, defaultDev := sysfsRoot, devRoot
+	defer func() { sysfsRoot, devRoot = defaultSysfs, defaultDev }()
+	sysfsRoot, devRoot = t.TempDir(), t.TempDir()
+
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	wwid := "3600601604ae04200e6d3fa5b3aa1e111"
+	link := func(dir, name, device string) {
+		if err := os.MkdirAll(filepath.Join(devRoot, dir), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink("../../"+device, filepath.Join(devRoot, dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, dev := range []string{"sdc", "sdd"} {
+		sid := fmt.Sprint(12 + i)
+		host := fmt.Sprintf("host%d", 3+i)
+		makeSysfsSession(t, host, sid, map[string]string{"targetname": target, "state": "LOGGED_IN"})
+		_ = os.MkdirAll(fmt.Sprintf("%s/devices/platform/%s/session%s/target%d:0:0/%d:0:0:1/block/%s",
+			sysfsRoot, host, sid, 3+i, 3+i, dev), 0o750)
+		_ = os.MkdirAll(sysfsRoot+"/block/"+dev+"/holders/dm-0", 0o750)
+		link("disk/by-path", fmt.Sprintf("ip-192.168.1.%s:3260-iscsi-%s-lun-1", sid, target), dev)
+		link("disk/by-id", "scsi-"+wwid+"-"+dev, dev)
+	}
+	_ = os.MkdirAll(sysfsRoot+"/block/dm-0/dm", 0o750)
+	if err := os.WriteFile(sysfsRoot+"/block/dm-0/dm/uuid", []byte("mpath-"+wwid+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	link("disk/by-id", "dm-uuid-mpath-"+wwid, "dm-0")
+	link("disk/by-id", "dm-name-mpatha", "dm-0")
+	link("mapper", "mpatha", "dm-0")
+
+	c := NewLinuxISCSI(map[string]string{SessionSource: "sysfs"})
+	paths, err := c.ResolveDevicePaths(ISCSITarget{Target: target}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(paths.Devices, []string{"sdc", "sdd"}) || len(paths.ByPath) != 2 || len(paths.ByID) != 2 {
+		t.Errorf("Unexpected device paths %+v", paths)
+	}
+	compareStr(t, paths.ByPath[0], devRoot+"/disk/by-path/ip-192.168.1.12:3260-iscsi-"+target+"-lun-1")
+	compareStr(t, paths.Multipath, "dm-0")
+	compareStr(t, paths.DMUUID, devRoot+"/disk/by-id/dm-uuid-mpath-"+wwid)
+	if len(paths.MultipathLinks) != 3 || paths.MultipathLinks[2] != devRoot+"/mapper/mpatha" {
+		t.Errorf("Unexpected multipath links %v", paths.MultipathLinks)
+	}
+
+	// a single session
+	paths, err = c.ResolveDevicePaths(ISCSITarget{Target: target, Portal: "192.168.1.13"}, 1)
+	if err != nil || !reflect.DeepEqual(paths.Devices, []string{"sdd"}) {
+		t.Errorf("Unexpected device paths %+v, %v", paths, err)
+	}
+	if _, err = c.ResolveDevicePaths(ISCSITarget{Target: target}, 2); !errors.Is(err, goiscsierrors.NotFound) {
+		t.Errorf("Expected a not found error but got %v", err)
+	}
+
+	mock := NewMockISCSI(map[string]string{})
+	if paths, err = mock.ResolveDevicePaths(ISCSITarget{Target: target, Portal: "1.1.1.1:3260"}, 1); err != nil || paths.DMUUID == "" {
+		t.Errorf("Unexpected mock device paths %+v, %v", paths, err)
+	}
+	GOISCSIMock.InduceResolveDevicePathsError = true
+	if _, err = mock.ResolveDevicePaths(ISCSITarget{Target: target}, 1); err == nil {
+		t.Error("Expected an induced error")
+	}
+}
+
+func TestGetSessionDevices(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	for i, dev := range []string{"sdc", "sdd"} {
+		sid := fmt.Sprint(12 + i)
+		host := fmt.Sprintf("host%d", 3+i)
+		makeSysfsSession(t, host, sid, map[string]string{"targetname": target, "state": "LOGGED_IN"})
+		_ = os.MkdirAll(fmt.Sprintf("%s/devices/platform/%s/session%s/target%d:0:0/%d:0:0:1/block/%s",
+			sysfsRoot, host, sid, 3+i, 3+i, dev), 0o750)
+		_ = os.MkdirAll(sysfsRoot+"/block/"+dev+"/holders/dm-0", 0o750)
+	}
+	_ = os.MkdirAll(sysfsRoot+"/devices/platform/host3/session12/target3:0:0/3:0:0:2/block/sde", 0o750)
+	_ = os.MkdirAll(sysfsRoot+"/block/dm-0/dm", 0o750)
+	if err := os.WriteFile(sysfsRoot+"/block/dm-0/dm/uuid", []byte("mpath-a\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewLinuxISCSI(map[string]string{SessionSource: "sysfs"})
+	devices, err := c.GetSessionDevices("12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SessionDevice{
+		{SID: "12", Target: target, HCTL: HCTL{3, 0, 0, 1}, Device: "sdc", Multipath: "dm-0"},
+		{SID: "12", Target: target, HCTL: HCTL{3, 0, 0, 2}, Device: "sde"},
+	}
+	if !reflect.DeepEqual(devices, expected) {
+		t.Errorf("Expected devices %+v but got %+v", expected, devices)
+	}
+	if _, err = c.GetSessionDevices("99"); !errors.Is(err, goiscsierrors.NotFound) {
+		t.Errorf("Expected a not found error but got %v", err)
+	}
+	if _, err = c.GetSessionDevices(""); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+
+	if devices, err = c.GetTargetDevices(ISCSITarget{Target: target}); err != nil || len(devices) != 3 ||
+		devices[2].Device != "sdd" || devices[2].Multipath != "dm-0" {
+		t.Errorf("Unexpected target devices %+v, %v", devices, err)
+	}
+	if devices, err = c.GetTargetDevices(ISCSITarget{Target: target, Portal: "192.168.1.13"}); err != nil ||
+		len(devices) != 1 || devices[0].SID != "13" {
+		t.Errorf("Unexpected portal devices %+v, %v", devices, err)
+	}
+	if devices, err = c.GetTargetDevices(ISCSITarget{Target: "iqn.1992-04.com.emc:other"}); err != nil || len(devices) != 0 {
+		t.Errorf("Expected no devices but got %+v, %v", devices, err)
+	}
+
+	mock := NewMockISCSI(map[string]string{MockNumberOfSessions: "2"})
+	sessions, _ := mock.GetSessions()
+	if devices, err = mock.GetSessionDevices(sessions[0].SID); err != nil || len(devices) != 1 || devices[0].Multipath != "dm-0" {
+		t.Errorf("Unexpected mock devices %+v, %v", devices, err)
+	}
+	if devices, err = mock.GetTargetDevices(ISCSITarget{Target: sessions[1].Target}); err != nil || len(devices) != 1 {
+		t.Errorf("Unexpected mock target devices %+v, %v", devices, err)
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+
+	// the fake keeps the session and the node record as directories, whose creation and removal are atomic,
+	// and fails with exit code 99 if two commands overlap
+	state := t.TempDir()
+	fakeISCSIAdm(t, `state=`+state+`
+mkdir $state/running 2>/dev/null || exit 99
+trap 'rmdir $state/running' EXIT
+/bin/sleep 0.01
+case "$*" in
+	"-m session"*) exit 21 ;;
+	*" -l"*) mkdir $state/session 2>/dev/null || exit 15 ;;
+	*--logout*) rmdir $state/session 2>/dev/null || exit 21 ;;
+	*"-o new"*) mkdir $state/record 2>/dev/null || exit 15 ;;
+	*"-o update"*) [ -d $state/record ] || exit 21 ;;
+	*"-o delete"*) rmdir $state/record 2>/dev/null || exit 21 ;;
+	*) [ -d $state/record ] || exit 21 ;;
+esac`)
+
+	c := NewLinuxISCSI(map[string]string{SessionSource: "iscsiadm"})
+	target := ISCSITarget{Portal: "192.168.1.12", Target: "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"}
+	options := map[string]string{"node.startup": "manual"}
+	for i := 0; i < 2; i++ {
+		if err := c.CreateOrUpdateNode(target, options); err != nil {
+			t.Errorf("CreateOrUpdateNode %d failed: %v", i, err)
+		}
+		if err := c.PerformLogin(target); err != nil {
+			t.Errorf("PerformLogin %d failed: %v", i, err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.PerformLogout(target); err != nil {
+			t.Errorf("PerformLogout %d failed: %v", i, err)
+		}
+		if err := c.DeleteNode(target); err != nil {
+			t.Errorf("DeleteNode %d failed: %v", i, err)
+		}
+	}
+
+	// concurrent calls on the same target, through portals spelled differently, are serialized
+	portals := []string{"192.168.1.12", "192.168.1.12:3260"}
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 10; i++ {
+		target := ISCSITarget{Portal: portals[i%2], Target: target.Target}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- c.CreateOrUpdateNode(target, options)
+			errs <- c.PerformLogin(target)
+			errs <- c.PerformLogout(target)
+			errs <- c.DeleteNode(target)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Unexpected error of a concurrent call: %v", err)
+		}
+	}
+	if entries, _ := os.ReadDir(state); len(entries) != 0 {
+		t.Errorf("Unexpected state left by the calls: %v", entries)
+	}
+}
+
+func TestNonDefaultPorts(t *testing.T) {
+	reset()
+	for _, portal := range []string{"10.0.0.1", "10.0.0.1:3263", "fd00::1", "[fd00::1]:3264"} {
+		if err := validateIPAddress(portal); err != nil {
+			t.Errorf("Expected %s to be valid but got %v", portal, err)
+		}
+	}
+	for _, portal := range []string{"10.0.0.1:0", "10.0.0.1:70000", "10.0.0.1:", "array:3263", "fd00::1:3263:x"} {
+		if err := validateIPAddress(portal); err == nil {
+			t.Errorf("Expected %s to be invalid", portal)
+		}
+	}
+	for _, tc := range []struct {
+		session, portal string
+		matches         bool
+	}{
+		{"10.0.0.1:3263", "10.0.0.1:3263", true},
+		{"10.0.0.1:3263", "10.0.0.1", true},
+		{"10.0.0.1:3263", "10.0.0.1:3260", false},
+		{"10.0.0.1:3260", "10.0.0.1:3264", false},
+		{"[fd00::1]:3264", "[fd00:0::1]:3264", true},
+		{"[fd00::1]:3264", "[fd00::1]:3263", false},
+	} {
+		if portalMatches(tc.session, tc.portal) != tc.matches {
+			t.Errorf("Expected portalMatches(%s, %s) to be %v", tc.session, tc.portal, tc.matches)
+		}
+	}
+
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": target, "state": "LOGGED_IN"})
+	port := sysfsRoot + "/devices/platform/host3/session12/connection12:0/iscsi_connection/connection12:0/port"
+	if err := os.WriteFile(port, []byte("3263\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	log := fakeISCSIAdm(t, `if [ "$2" = discovery ]; then echo "192.168.1.12:3263,1 `+target+`"; echo "192.168.1.12:3264,2 `+target+`"; fi`)
+
+	c := NewLinuxISCSI(map[string]string{})
+	targets, err := c.DiscoverTargetsWithOptions("192.168.1.12", DiscoveryOptions{Port: 3263, Login: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 || targets[0].Portal != "192.168.1.12:3263" || targets[1].Portal != "192.168.1.12:3264" {
+		t.Errorf("Expected the targets to keep their ports but got %v", targets)
+	}
+	if err = c.CreateOrUpdateNode(ISCSITarget{Portal: "192.168.1.12:3264", Target: target},
+		map[string]string{"node.startup": "manual"}); err != nil {
+		t.Fatal(err)
+	}
+	args, err := os.ReadFile(log) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"-m discovery -t st --portal 192.168.1.12:3263",
+		// the login uses the node record of the discovered group tag
+		"-m node -T " + target + " --portal 192.168.1.12:3264,2 -l",
+		"-m node -p 192.168.1.12:3264 -T " + target + " -o update -n node.startup -v manual",
+	} {
+		if !strings.Contains(string(args), expected+"\n") {
+			t.Errorf("Expected iscsiadm to run with %q but got:\n%s", expected, args)
+		}
+	}
+	// the session on port 3263 is found, so no login is attempted to that portal
+	if strings.Contains(string(args), "--portal 192.168.1.12:3263,1 -l") {
+		t.Errorf("Expected no login to the portal of the existing session but got:\n%s", args)
+	}
+
+	mock := NewMockISCSI(map[string]string{})
+	if targets, err = mock.DiscoverTargetsWithOptions("1.1.1.1", DiscoveryOptions{Port: 3264}); err != nil || targets[0].Portal != "1.1.1.1:3264" {
+		t.Errorf("Unexpected mock targets %v, %v", targets, err)
+	}
+}
+
+func TestSysfsRootOption(t *testing.T) {
+	reset()
+	defaultSysfs, defaultDev := sysfsRoot, devRoot
+	defer func() { sysfsRoot, devRoot = defaultSysfs, defaultDev }()
+
+	fixture, chroot := t.TempDir(), t.TempDir()
+	sysfsRoot = fixture
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": "iqn.2015-10.com.dell:a"})
+	sysfsRoot = filepath.Join(chroot, "sys")
+	makeSysfsSession(t, "host4", "13", map[string]string{"targetname": "iqn.2015-10.com.dell:b"})
+	makeSysfsSession(t, "host5", "14", map[string]string{"targetname": "iqn.2015-10.com.dell:b"})
+	if err := os.MkdirAll(filepath.Join(chroot, "dev", "disk"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	sysfsRoot, devRoot = t.TempDir(), t.TempDir()
+
+	c := NewLinuxISCSI(map[string]string{SessionSource: "sysfs", SysfsRoot: fixture})
+	sessions, err := c.GetSessions()
+	if err != nil || len(sessions) != 1 || sessions[0].SID != "12" {
+		t.Errorf("Expected the session of the fixture but got %v, %v", sessions, err)
+	}
+	c = NewLinuxISCSI(map[string]string{SessionSource: "sysfs", ChrootDirectory: chroot})
+	if sessions, err = c.GetSessions(); err != nil || len(sessions) != 2 {
+		t.Errorf("Expected the sessions of the chroot but got %v, %v", sessions, err)
+	}
+	if tree := c.sysfs(); tree.dev != filepath.Join(chroot, "dev") {
+		t.Errorf("Expected the /dev tree of the chroot but got %s", tree.dev)
+	}
+	c = NewLinuxISCSI(map[string]string{ChrootDirectory: chroot, SysfsRoot: fixture, DevRoot: fixture})
+	if tree := c.sysfs(); tree.root != fixture || tree.dev != fixture {
+		t.Errorf("Expected the options to override the chroot but got %+v", tree)
+	}
+	// a chroot without a mounted sysfs falls back to the one of the system
+	c = NewLinuxISCSI(map[string]string{ChrootDirectory: t.TempDir()})
+	if tree := c.sysfs(); tree != defaultSysfsTree() {
+		t.Errorf("Expected the trees of the system but got %+v", tree)
+	}
+
+	if _, err = NewLinuxISCSIE(map[string]string{SysfsRoot: filepath.Join(fixture, "missing")}); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("Expected an invalid options error but got %v", err)
+	}
+}
+
+func TestBatchNodeUpdates(t *testing.T) {
+	reset()
+	target := ISCSITarget{Portal: "192.168.1.12", Target: "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"}
+	options := map[string]string{"node.startup": "manual", "node.session.timeo.replacement_timeout": "15", "node.conn[0].timeo.noop_out_interval": "5"}
+	base := "-m node -p 192.168.1.12 -T " + target.Target + " -o update"
+
+	log := fakeISCSIAdm(t, "")
+	c := NewLinuxISCSI(map[string]string{BatchNodeUpdates: "true"})
+	if err := c.CreateOrUpdateNode(target, options); err != nil {
+		t.Fatal(err)
+	}
+	args, err := os.ReadFile(log) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := base + " -n node.conn[0].timeo.noop_out_interval -v 5 -n node.session.timeo.replacement_timeout -v 15 -n node.startup -v manual\n"
+	if strings.Count(string(args), "-o update") != 1 || !strings.Contains(string(args), expected) {
+		t.Errorf("Expected a single update %q but got:\n%s", expected, args)
+	}
+
+	// an iscsiadm rejecting several parameters gets one update per parameter
+	log = fakeISCSIAdm(t, `case "$*" in *"-v"*"-v"*) exit 7 ;; esac`)
+	if err = c.CreateOrUpdateNode(target, options); err != nil {
+		t.Fatal(err)
+	}
+	if args, err = os.ReadFile(log); err != nil { // #nosec G304
+		t.Fatal(err)
+	}
+	for k, v := range options {
+		if !strings.Contains(string(args), base+" -n "+k+" -v "+v+"\n") {
+			t.Errorf("Expected an update of %s but got:\n%s", k, args)
+		}
+	}
+
+	log = fakeISCSIAdm(t, "")
+	if err = NewLinuxISCSI(map[string]string{}).CreateOrUpdateNode(target, options); err != nil {
+		t.Fatal(err)
+	}
+	if args, err = os.ReadFile(log); err != nil { // #nosec G304
+		t.Fatal(err)
+	}
+	if strings.Count(string(args), "-o update") != len(options) {
+		t.Errorf("Expected one update per parameter without the option but got:\n%s", args)
+	}
+}
+
+func TestMockTimeline(t *testing.T) {
+	reset()
+	mock := NewMockISCSI(map[string]string{})
+	start := time.Now()
+	if err := mock.WaitForSessionState("1", ISCSISessionStateFAILED, 10*time.Minute); !errors.Is(err, ErrSessionStateTimeout) {
+		t.Errorf("Expected error: %v, but got: %v", ErrSessionStateTimeout, err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Expected the wait to resolve on the fake clock but it took %s", time.Since(start))
+	}
+
+	clock := NewFakeClock(time.Now())
+	mock.SetClock(clock)
+	mock.SetTimeline(MockTimeline{
+		SessionStates: []MockSessionStateChange{
+			{After: 90 * time.Second, SID: "1", State: ISCSISessionStateLOGGEDIN},
+			{After: 30 * time.Second, SID: "1", State: ISCSISessionStateFAILED},
+		},
+		LUNDelays: map[int]time.Duration{2: 10 * time.Second},
+	})
+	begin := clock.Now()
+	if err := mock.WaitForSessionState("1", ISCSISessionStateFAILED, time.Minute); err != nil {
+		t.Error(err)
+	}
+	if elapsed := clock.Now().Sub(begin); elapsed != 30*time.Second {
+		t.Errorf("Expected the session to fail after 30s but got %s", elapsed)
+	}
+	if err := mock.WaitForSessionState("1", ISCSISessionStateLOGGEDIN, 2*time.Minute); err != nil {
+		t.Error(err)
+	}
+	if elapsed := clock.Now().Sub(begin); elapsed != 90*time.Second {
+		t.Errorf("Expected the session to recover after 90s but got %s", elapsed)
+	}
+
+	target := ISCSITarget{Portal: "1.1.1.1", Target: "iqn.1992-04.com.mock:600009700bcbb70e3287017400000000"}
+	if device, err := mock.RescanAndVerifyLUN(target, 1, time.Second); err != nil || device != "/dev/sdmock1" {
+		t.Errorf("Unexpected device %s, %v", device, err)
+	}
+	if _, err := mock.RescanAndVerifyLUN(target, 2, 5*time.Second); !errors.Is(err, ErrLUNNotVisible) {
+		t.Errorf("Expected error: %v, but got: %v", ErrLUNNotVisible, err)
+	}
+	if device, err := mock.RescanAndVerifyLUN(target, 2, 20*time.Second); err != nil || device != "/dev/sdmock2" {
+		t.Errorf("Unexpected device %s, %v", device, err)
+	}
+}
+
+func TestMaxSessions(t *testing.T) {
+	reset()
+	defaultDir, defaultRoot := nodeMetadataDir, sysfsRoot
+	defer func() { nodeMetadataDir, sysfsRoot = defaultDir, defaultRoot }()
+	nodeMetadataDir, sysfsRoot = t.TempDir(), t.TempDir()
+
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": target, "state": "LOGGED_IN"})
+	makeSysfsSession(t, "host4", "13", map[string]string{"targetname": target, "state": "LOGGED_IN"})
+	log := fakeISCSIAdm(t, `if [ "$2" = discovery ]; then echo "192.168.1.14:3260,1 `+target+`"; fi`)
+
+	c := NewLinuxISCSI(map[string]string{EnforceMaxSessions: "true"})
+	var warnings []Warning
+	c.AddWarningHandler(func(w Warning) { warnings = append(warnings, w) })
+	// the array hints are stored with the node records, the smallest one applies
+	for portal, limit := range map[string]string{"192.168.1.12": "4", "192.168.1.13": "2"} {
+		if err := c.CreateOrUpdateNode(ISCSITarget{Portal: portal, Target: target},
+			NodeMetadataOptions(map[string]string{MaxSessionsMetadataKey: limit})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	targets, err := c.DiscoverTargets("192.168.1.14", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 || targets[0].MaxSessions != 2 {
+		t.Errorf("Expected a target hinting 2 sessions but got %v", targets)
+	}
+	if len(warnings) != 1 || warnings[0].Code != WarningMaxSessions {
+		t.Errorf("Expected a MaxSessions warning but got %v", warnings)
+	}
+	args, err := os.ReadFile(log) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(args), " -l") {
+		t.Errorf("Expected no login beyond the session limit but got:\n%s", args)
+	}
+
+	target14 := ISCSITarget{Portal: "192.168.1.14", Target: target}
+	if err = c.PerformLogin(target14); !errors.Is(err, ErrMaxSessions) || !errors.Is(err, goiscsierrors.Conflict) {
+		t.Errorf("Expected error: %v, but got: %v", ErrMaxSessions, err)
+	}
+	target14.MaxSessions = 3
+	if err = c.PerformLogin(target14); err != nil {
+		t.Errorf("Expected the limit of the target to override the hint but got %v", err)
+	}
+	if err = NewLinuxISCSI(map[string]string{}).PerformLogin(ISCSITarget{Portal: "192.168.1.14", Target: target}); err != nil {
+		t.Errorf("Expected no enforcement without the option but got %v", err)
+	}
+
+	mock := NewMockISCSI(map[string]string{EnforceMaxSessions: "true"})
+	mockTarget := ISCSITarget{Portal: "192.168.1.0", Target: "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a0"}
+	if err = mock.CreateOrUpdateNode(mockTarget, NodeMetadataOptions(map[string]string{MaxSessionsMetadataKey: "1"})); err != nil {
+		t.Fatal(err)
+	}
+	if err = mock.PerformLogin(mockTarget); !errors.Is(err, ErrMaxSessions) {
+		t.Errorf("Expected error: %v, but got: %v", ErrMaxSessions, err)
+	}
+}
+
+func TestCHAPRequired(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+
+	target := ISCSITarget{Portal: "192.168.1.14", Target: "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"}
+	fakeLogin := func(authmethod, username string) {
+		fakeISCSIAdm(t, `case "$*" in
+*" -l"*) echo "iscsiadm: Could not login to [iface: default, target: `+target.Target+`, portal: 192.168.1.14,3260]." >&2
+  echo "iscsiadm: initiator reported error (24 - iSCSI login failed due to authorization failure)" >&2
+  exit 24;;
+*"-o show"*) printf "# BEGIN RECORD 2.1.4\nnode.name = `+target.Target+`\nnode.session.auth.authmethod = `+authmethod+
+			`\nnode.session.auth.username = `+username+`\n# END RECORD\n";;
+esac`)
+	}
+	c := NewLinuxISCSI(map[string]string{})
+
+	fakeLogin("None", "<empty>")
+	err := c.PerformLogin(target)
+	if !errors.Is(err, ErrCHAPRequired) || !errors.Is(err, goiscsierrors.Auth) {
+		t.Errorf("Expected error: %v, but got: %v", ErrCHAPRequired, err)
+	}
+
+	fakeLogin("CHAP", "chapuser")
+	err = c.PerformLogin(target)
+	if err == nil || errors.Is(err, ErrCHAPRequired) || !errors.Is(err, goiscsierrors.Auth) {
+		t.Errorf("Expected an authentication error with CHAP configured but got: %v", err)
+	}
+
+	GOISCSIMock.InduceCHAPRequiredError = true
+	if err = NewMockISCSI(map[string]string{}).PerformLogin(target); !errors.Is(err, ErrCHAPRequired) {
+		t.Errorf("Expected error: %v, but got: %v", ErrCHAPRequired, err)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	reset()
+	defaultDir, defaultRoot := nodeMetadataDir, sysfsRoot
+	defer func() { nodeMetadataDir, sysfsRoot = defaultDir, defaultRoot }()
+	nodeMetadataDir, sysfsRoot = t.TempDir(), t.TempDir()
+	fakeISCSIAdm(t, "")
+
+	journal := filepath.Join(t.TempDir(), "journal.jsonl")
+	c := NewLinuxISCSI(map[string]string{JournalFile: journal, JournalMaxSize: "0"})
+	now := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	c.SetClock(NewFakeClock(now))
+	target := ISCSITarget{Portal: "192.168.1.14", Target: "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"}
+
+	if err := c.SetCHAPCredentials(target, "chapuser", "chapsecret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LogoutSessionBySID("12"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteNode(ISCSITarget{Portal: "not-an-ip", Target: target.Target}); err == nil {
+		t.Fatal("Expected an invalid portal error")
+	}
+	data, err := os.ReadFile(journal) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "chapsecret") {
+		t.Errorf("Expected no CHAP secret in the journal but got:\n%s", data)
+	}
+	var entries []JournalEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var e JournalEntry
+		if err = json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("Expected a JSON line but got %q: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+	expected := []JournalEntry{
+		{Timestamp: now, Op: JournalOpSetCHAP, Target: target.Target, Portal: target.Portal, Result: JournalResultSuccess},
+		{Timestamp: now, Op: JournalOpLogout, SID: "12", Result: JournalResultSuccess},
+		{Timestamp: now, Op: JournalOpDeleteNode, Target: target.Target, Portal: "not-an-ip", Result: JournalResultFailure},
+	}
+	if len(entries) == len(expected) {
+		expected[2].Error = entries[2].Error
+	}
+	if !reflect.DeepEqual(entries, expected) || entries[2].Error == "" {
+		t.Errorf("Expected journal entries %v but got %v", expected, entries)
+	}
+
+	// each line takes the journal beyond the limit, so each one rotates it, keeping a single backup
+	c.SetOptions(map[string]string{JournalFile: journal, JournalMaxSize: "10", JournalMaxBackups: "1"})
+	for _, sid := range []string{"13", "14"} {
+		if err = c.LogoutSessionBySID(sid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for path, sid := range map[string]string{journal: "14", journal + ".1": "13"} {
+		data, err = os.ReadFile(path) // #nosec G304
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 1 || !strings.Contains(lines[0], `"sid":"`+sid+`"`) {
+			t.Errorf("Expected the logout of session %s in %s but got:\n%s", sid, path, data)
+		}
+	}
+	if _, err = os.Stat(journal + ".2"); !os.IsNotExist(err) {
+		t.Errorf("Expected a single backup of the journal but got %v", err)
+	}
+
+	if _, err = NewLinuxISCSIE(map[string]string{JournalMaxSize: "-1"}); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("Expected error: %v, but got: %v", ErrInvalidOptions, err)
+	}
+}
+
+type recordingLogger struct{ lines []string }
+
+func (l *recordingLogger) Printf(format string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+// scriptedExecutor records the commands it is given and fails the first ones with the exit codes of failures
+type scriptedExecutor struct {
+	commands [][]string
+	failures []int
+}
+
+func (e *scriptedExecutor) Output(cmd *exec.Cmd) ([]byte, error) {
+	e.commands = append(e.commands, cmd.Args)
+	if len(e.failures) > 0 {
+		code := e.failures[0]
+		e.failures = e.failures[1:]
+		return exec.Command("/bin/sh", "-c", "exit "+strconv.Itoa(code)).Output() // #nosec G204
+	}
+	return nil, nil
+}
+
+func TestNewLinuxISCSIFromConfig(t *testing.T) {
+	reset()
+	defaultDir := nodeMetadataDir
+	defer func() { nodeMetadataDir = defaultDir }()
+	nodeMetadataDir = t.TempDir()
+
+	logger := &recordingLogger{}
+	executor := &scriptedExecutor{failures: []int{4, 4}}
+	c, err := NewLinuxISCSIFromConfig(Config{
+		Timeout:     2 * time.Minute,
+		RetryPolicy: RetryPolicy{Attempts: 3, Delay: time.Second, MaxDelay: 1500 * time.Millisecond},
+		Logger:      logger,
+		Executor:    executor,
+		Options:     map[string]string{Locale: "inherit"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	c.SetClock(clock)
+	if c.GetTimeout() != 2*time.Minute {
+		t.Errorf("Expected a timeout of 2m but got %s", c.GetTimeout())
+	}
+
+	// the transport failures are retried after 1s, then 1.5s
+	target := ISCSITarget{Portal: "192.168.1.14", Target: "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"}
+	if err = c.LogoutSessionBySID("12"); err != nil {
+		t.Fatal(err)
+	}
+	if len(executor.commands) != 3 || clock.Now().Sub(start) != 2500*time.Millisecond {
+		t.Errorf("Expected 3 runs over 2.5s but got %d over %s", len(executor.commands), clock.Now().Sub(start))
+	}
+	executor.failures = []int{24}
+	if err = c.LogoutSessionBySID("12"); !errors.Is(err, goiscsierrors.Auth) || len(executor.commands) != 4 {
+		t.Errorf("Expected an authentication failure run once but got %v after %d runs", err, len(executor.commands))
+	}
+
+	if err = c.SetCHAPCredentials(target, "chapuser", "chapsecret"); err != nil {
+		t.Fatal(err)
+	}
+	logged := strings.Join(logger.lines, "\n")
+	if strings.Contains(logged, "chapsecret") || !strings.Contains(logged, "node.session.auth.password -v "+redactedSecret) {
+		t.Errorf("Expected the CHAP secret to be masked but got:\n%s", logged)
+	}
+
+	c.SetTimeout(time.Minute)
+	if c.GetTimeout() != time.Minute || NewLinuxISCSI(map[string]string{}).GetTimeout() != DefaultCommandTimeout {
+		t.Errorf("Expected timeouts of 1m and the default but got %s", c.GetTimeout())
+	}
+	for _, cfg := range []Config{
+		{Chroot: "/does/not/exist"},
+		{RetryPolicy: RetryPolicy{Attempts: -1}},
+		{SecretRedaction: "partial"},
+	} {
+		if _, err = NewLinuxISCSIFromConfig(cfg); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("Expected error: %v for %+v, but got: %v", ErrInvalidOptions, cfg, err)
+		}
+	}
+}
+
+func TestAuditConsistency(t *testing.T) {
+	reset()
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	node := func(portal, startup, user string) ISCSINode {
+		return ISCSINode{Target: target, Portal: portal, Fields: map[string]string{
+			"iface.iscsi_ifacename": "default", "node.startup": startup, "node.session.auth.username": user,
+		}}
+	}
+	nodes := []ISCSINode{
+		node("192.168.1.12:3260", "automatic", "chapuser"),
+		node("192.168.1.13:3260", "automatic", "<empty>"),
+		node("192.168.1.14:3260", "manual", "<empty>"),
+		node("192.168.1.15:3260", "automatic", "<empty>"),
+		node("192.168.1.18:3260", "manual", "chapuser"),
+		node("192.168.1.19:3260", "manual", "chapuser"),
+	}
+	// the secrets of 192.168.1.18 were rotated, those of 192.168.1.19 are masked
+	nodes[4].Fields["node.session.auth.password"] = "newsecret"
+	nodes[5].Fields["node.session.auth.password"] = maskedSecret
+	sessions := []ISCSISession{
+		{Target: target, Portal: "192.168.1.12:3260", SID: "1", IfaceName: "default", Username: "chapuser"},
+		{Target: target, Portal: "192.168.1.13:3260", SID: "2", IfaceName: "default", Username: "olduser"},
+		{Target: target, Portal: "192.168.1.16:3260", SID: "3", IfaceName: "default"},
+		{Target: target, Portal: "192.168.1.17:3260", SID: "4", SessionSource: ISCSISessionSourceFlash},
+		{Target: target, Portal: "192.168.1.18:3260", SID: "5", IfaceName: "default", Username: "chapuser", Password: "oldsecret"},
+		{Target: target, Portal: "192.168.1.19:3260", SID: "6", IfaceName: "default", Username: "chapuser", Password: "oldsecret"},
+	}
+	findings := auditConsistency(nodes, sessions)
+	var got []string
+	for _, f := range findings {
+		got = append(got, string(f.Kind)+" "+f.Target.Portal+" "+f.SID)
+		if f.Message == "" {
+			t.Errorf("Expected a message for %v", f)
+		}
+	}
+	expected := []string{
+		"CHAPUserMismatch 192.168.1.13:3260 2",
+		"NodeWithoutSession 192.168.1.15:3260 ",
+		"CHAPSecretMismatch 192.168.1.18:3260 5",
+		"SessionWithoutNode 192.168.1.16:3260 3",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected findings %v but got %v", expected, got)
+	}
+	for _, f := range findings {
+		if strings.Contains(f.Message, "secret") && strings.Contains(f.Message, "oldsecret") {
+			t.Errorf("Expected the message not to reveal the secrets but got %q", f.Message)
+		}
+	}
+
+	// the secrets masked in the listed records are read revealed for the sessions with the CHAP user of the record
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": target, "state": "LOGGED_IN", "ifacename": "default",
+		"username": "chapuser", "password": "oldsecret"})
+	record := "# BEGIN RECORD 2.1.8\nnode.name = " + target + "\nnode.tpgt = 1\nnode.conn[0].address = 192.168.1.12\n" +
+		"node.conn[0].port = 3260\niface.iscsi_ifacename = default\nnode.session.auth.username = chapuser\n" +
+		"node.session.auth.password = %s\n# END RECORD"
+	log := fakeISCSIAdm(t, `case "$*" in
+*"-o show -S"*) printf '`+record+`' newsecret;;
+*"-o show"*) printf '`+record+`' '`+maskedSecret+`';;
+esac`)
+	c := NewLinuxISCSI(map[string]string{SessionSource: "sysfs"})
+	findings, err := c.AuditConsistency()
+	if err != nil || len(findings) != 1 || findings[0].Kind != FindingCHAPSecretMismatch || findings[0].SID != "12" {
+		t.Errorf("Expected a CHAP secret mismatch for the session 12 but got %v, %v", findings, err)
+	}
+	if args, _ := os.ReadFile(log); !strings.Contains(string(args), "-o show -S") {
+		t.Errorf("Expected the secrets of the record to be read revealed but got:\n%s", args)
+	}
+
+	findings, err = NewMockISCSI(map[string]string{}).AuditConsistency()
+	if err != nil || len(findings) != 0 {
+		t.Errorf("Expected the mocked node records to match the mocked sessions but got %v, %v", findings, err)
+	}
+	GOISCSIMock.InduceGetNodesError = true
+	if _, err = NewMockISCSI(map[string]string{}).AuditConsistency(); err == nil {
+		t.Error("Expected an error listing the node records")
+	}
+}
+
+func TestReconcileCHAPSessions(t *testing.T) {
+	reset()
+	defaultRoot, defaultBusy := sysfsRoot, deviceBusy
+	defer func() { sysfsRoot, deviceBusy = defaultRoot, defaultBusy }()
+	sysfsRoot = t.TempDir()
+	deviceBusy = func(_ string) bool { return true }
+
+	// the sessions 12 and 13 are the paths of dm-0, the session 14 the only path of dm-1
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	var records strings.Builder
+	for _, sid := range []string{"12", "13", "14"} {
+		makeSysfsSession(t, "host"+sid, sid, map[string]string{"targetname": target, "state": "LOGGED_IN", "username": "olduser"})
+		fmt.Fprintf(&records, "# BEGIN RECORD 2.1.8\nnode.name = %s\nnode.tpgt = 1\nnode.conn[0].address = 192.168.1.%s\n"+
+			"node.conn[0].port = 3260\niface.iscsi_ifacename = default\nnode.session.auth.username = newuser\n# END RECORD\n",
+			target, sid)
+	}
+	files := map[string]string{"block/dm-0/dm/uuid": "mpath-a", "block/dm-1/dm/uuid": "mpath-b"}
+	for sid, path := range map[string][2]string{"12": {"sdb", "dm-0"}, "13": {"sdc", "dm-0"}, "14": {"sdd", "dm-1"}} {
+		for _, dir := range []string{
+			"devices/platform/host" + sid + "/session" + sid + "/target" + sid + ":0:0/" + sid + ":0:0:1/block/" + path[0],
+			"block/" + path[0] + "/holders/" + path[1], "block/" + path[1] + "/slaves/" + path[0], "block/" + path[0] + "/device",
+			"block/" + path[1] + "/dm",
+		} {
+			if err := os.MkdirAll(sysfsRoot+"/"+dir, 0o750); err != nil {
+				t.Fatal(err)
+			}
+		}
+		files["block/"+path[0]+"/device/state"] = "running"
+	}
+	for file, value := range files {
+		if err := os.WriteFile(sysfsRoot+"/"+file, []byte(value+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nodes := filepath.Join(t.TempDir(), "nodes")
+	if err := os.WriteFile(nodes, []byte(records.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// a logged out session leaves sysfs
+	log := fakeISCSIAdm(t, `case "$*" in
+*"-o show"*) /bin/cat `+nodes+`;;
+*" -u") /bin/rm `+sysfsRoot+`/class/iscsi_session/session$4;;
+esac`)
+
+	c := NewLinuxISCSI(map[string]string{})
+	clock := NewFakeClock(time.Now())
+	c.SetClock(clock)
+	if _, err := c.ReconcileCHAPSessions(0); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+	start := clock.Now()
+	results, err := c.ReconcileCHAPSessions(2)
+	if len(results) != 3 {
+		t.Fatalf("Expected the results of the 3 sessions but got %v, %v", results, err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 node operations failed") {
+		t.Errorf("Expected an error for the session kept for its last path but got %v", err)
+	}
+	var lastPathErr *LastPathError
+	if results.Errors() == nil || results.FailedCount() != 1 || !errors.As(results[2].Error, &lastPathErr) ||
+		lastPathErr.Device != "dm-1" {
+		t.Errorf("Expected the only path of dm-1 to be kept but got %v", results.Errors())
+	}
+	args, err := os.ReadFile(log) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	var relogins []string
+	for _, line := range strings.Split(string(args), "\n") {
+		if strings.HasSuffix(line, " -u") || strings.Contains(line, " -l ") {
+			relogins = append(relogins, line)
+		}
+	}
+	expected := []string{
+		"-m session -r 12 -u", "-m node -T " + target + " --portal 192.168.1.12:3260 -l -I default",
+		"-m session -r 13 -u", "-m node -T " + target + " --portal 192.168.1.13:3260 -l -I default",
+	}
+	if !reflect.DeepEqual(relogins, expected) {
+		t.Errorf("Expected the paths of dm-0 to be logged in again one after the other but got:\n%s", args)
+	}
+	if elapsed := clock.Now().Sub(start); elapsed != chapReconcileStagger {
+		t.Errorf("Expected the 2 waves to be staggered but they took %s", elapsed)
+	}
+
+	mock := NewMockISCSI(map[string]string{})
+	mock.AuditConsistencyFn = func() ([]ConsistencyFinding, error) {
+		return []ConsistencyFinding{
+			{Kind: FindingCHAPUserMismatch, SID: "1"}, {Kind: FindingNodeWithoutSession}, {Kind: FindingCHAPSecretMismatch, SID: "2"},
+		}, nil
+	}
+	if results, err := mock.ReconcileCHAPSessions(1); err != nil || len(results) != 2 || results.Errors() != nil {
+		t.Errorf("Expected the mocked sessions logged in again but got %v, %v", results, err)
+	}
+	GOISCSIMock.InduceLoginError = true
+	if results, err := mock.ReconcileCHAPSessions(1); err == nil || results.FailedCount() != 2 {
+		t.Errorf("Expected an error for the failed login but got %v, %v", results, err)
+	}
+}
+
+func TestPortalRedirection(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+
+	// the login to 192.168.1.12 was redirected by the target to 192.168.1.20
+	target := ISCSITarget{Portal: "192.168.1.12", Target: "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"}
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": target.Target, "state": "LOGGED_IN"})
+	connDir := sysfsRoot + "/devices/platform/host3/session12/connection12:0/iscsi_connection/connection12:0"
+	for name, value := range map[string]string{"address": "192.168.1.20", "persistent_address": "192.168.1.12", "persistent_port": "3260"} {
+		if err := os.WriteFile(filepath.Join(connDir, name), []byte(value+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log := fakeISCSIAdm(t, "")
+
+	c := NewLinuxISCSI(map[string]string{SessionSource: "sysfs"})
+	sessions, err := c.GetSessions()
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("Expected a session but got %v, %v", sessions, err)
+	}
+	s := sessions[0]
+	if !s.Redirected() || s.OriginalPortal != "192.168.1.12:3260" || s.EffectivePortal != "192.168.1.20:3260" || s.Portal != s.EffectivePortal {
+		t.Errorf("Expected a session redirected from 192.168.1.12 to 192.168.1.20 but got %+v", s)
+	}
+	// the redirected session is found by the portal of its node record
+	var warnings []Warning
+	c.AddWarningHandler(func(w Warning) { warnings = append(warnings, w) })
+	if err = c.PerformLogin(target); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(log); !os.IsNotExist(err) {
+		t.Errorf("Expected no login to the redirected target but got %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].Code != WarningSessionExists {
+		t.Errorf("Expected a SessionExists warning but got %v", warnings)
+	}
+	c.checkLoginSession(target)
+	if len(warnings) != 2 || warnings[1].Code != WarningPortalRedirected {
+		t.Errorf("Expected a PortalRedirected warning after the login but got %v", warnings)
+	}
+
+	parsed := (&sessionParser{}).Parse([]byte("Target: " + target.Target + " (non-flash)\n" +
+		"\tCurrent Portal: 192.168.1.20:3260,1\n\tPersistent Portal: 192.168.1.12:3260,1\n\t\tSID: 12\n"))
+	if len(parsed) != 1 || !parsed[0].Redirected() || parsed[0].Portal != "192.168.1.20:3260" {
+		t.Errorf("Expected a redirected session but got %+v", parsed)
+	}
+	if (ISCSISession{OriginalPortal: "192.168.1.12:3260", EffectivePortal: "192.168.1.12:3260"}).Redirected() {
+		t.Error("Expected a session at its persistent portal not to be redirected")
+	}
+}
+
+func TestRawOutput(t *testing.T) {
+	reset()
+	defaultDir, defaultRoot := nodeMetadataDir, sysfsRoot
+	defer func() { nodeMetadataDir, sysfsRoot = defaultDir, defaultRoot }()
+	nodeMetadataDir, sysfsRoot = t.TempDir(), t.TempDir()
+
+	data, err := filepath.Abs("testdata/session_info_valid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	discovery := "192.168.1.14:3260,1 iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3\n"
+	fakeISCSIAdm(t, `case "$2" in
+discovery) printf "`+strings.TrimSpace(discovery)+`\n";;
+session) /bin/cat `+data+`;;
+node) echo "iscsiadm: No records found" >&2; exit 21;;
+esac`)
+	c := NewLinuxISCSI(map[string]string{SessionSource: "sysfs"})
+
+	targets, raw, err := c.DiscoverTargetsRaw("192.168.1.14", DiscoveryOptions{})
+	if err != nil || len(targets) != 1 || raw.Stdout != discovery || raw.ExitCode != 0 ||
+		!slices.Equal(raw.Command, []string{"iscsiadm", "-m", "discovery", "-t", "st", "--portal", "192.168.1.14:3260"}) {
+		t.Errorf("Expected the discovery output but got %v, %+v, %v", targets, raw, err)
+	}
+	expected, err := os.ReadFile(data) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the raw variant queries iscsiadm even with the sysfs session source
+	sessions, raw, err := c.GetSessionsRaw()
+	if err != nil || len(sessions) != 2 || raw.Stdout != string(expected) {
+		t.Errorf("Expected the sessions parsed from the iscsiadm output but got %v, %+v, %v", sessions, raw, err)
+	}
+	nodes, raw, err := c.GetNodesRaw()
+	if err != nil || len(nodes) != 0 || raw.ExitCode != 21 || !strings.Contains(raw.Stderr, "No records found") {
+		t.Errorf("Expected no node record with the error of iscsiadm but got %v, %+v, %v", nodes, raw, err)
+	}
+}
+
+// blockingExecutor counts the mutating commands running at once and holds them until release is closed
+type blockingExecutor struct {
+	mu        sync.Mutex
+	active    int
+	maxActive int
+	started   chan struct{}
+	release   chan struct{}
+}
+
+func (e *blockingExecutor) Output(cmd *exec.Cmd) ([]byte, error) {
+	if !isMutatingCommand(cmd.Args) {
+		return nil, nil
+	}
+	e.mu.Lock()
+	e.active++
+	e.maxActive = max(e.maxActive, e.active)
+	e.mu.Unlock()
+	e.started <- struct{}{}
+	<-e.release
+	e.mu.Lock()
+	e.active--
+	e.mu.Unlock()
+	return nil, nil
+}
+
+func TestSerializeMutations(t *testing.T) {
+	reset()
+	executor := &blockingExecutor{started: make(chan struct{}, 8), release: make(chan struct{})}
+	c := NewLinuxISCSI(map[string]string{SerializeMutations: "true", Locale: "inherit"})
+	c.SetExecutor(executor)
+	other := NewLinuxISCSI(map[string]string{SerializeMutations: "true", Locale: "inherit"})
+	other.SetExecutor(executor)
+
+	var wg sync.WaitGroup
+	for sid := 1; sid <= 4; sid++ {
+		wg.Add(1)
+		go func(client *LinuxISCSI) {
+			defer wg.Done()
+			if err := client.LogoutSessionBySID(strconv.Itoa(sid)); err != nil {
+				t.Error(err)
+			}
+		}([]*LinuxISCSI{c, other}[sid%2])
+	}
+	<-executor.started
+	// the listings run while a mutation holds the lock
+	if _, err := c.GetNodes(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := len(executor.started); n != 0 {
+		t.Errorf("Expected the other logouts to wait but %d started", n)
+	}
+	close(executor.release)
+	wg.Wait()
+	if executor.maxActive != 1 {
+		t.Errorf("Expected the logouts to run one at a time but got %d at once", executor.maxActive)
+	}
+
+	for cmd, expected := range map[string]bool{
+		"iscsiadm -m node -T t -p p -l":          true,
+		"iscsiadm -m session -r 3 -u":            true,
+		"iscsiadm -m discovery -t st --portal p": true,
+		"iscsiadm -m node -o update -n k -v v":   true,
+		"iscsiadm -m node -o show":               false,
+		"iscsiadm -m session -P 2 -S":            false,
+	} {
+		if isMutatingCommand(strings.Fields(cmd)) != expected {
+			t.Errorf("Expected %q to be mutating: %v", cmd, expected)
+		}
+	}
+}
+
+func TestPerformLoginWithOptions(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+	target := ISCSITarget{Portal: "192.168.1.14", Target: "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"}
+
+	// a slow target exceeds the timeout of the client but not that of the call
+	fakeISCSIAdm(t, `case "$*" in *" -l"*) /bin/sleep 0.3;; esac`)
+	c := NewLinuxISCSI(map[string]string{CommandTimeout: "50ms"})
+	if err := c.PerformLogin(target); !errors.Is(err, goiscsierrors.Timeout) {
+		t.Errorf("Expected a timeout with the timeout of the client but got %v", err)
+	}
+	if err := c.PerformLoginWithOptions(target, LoginOptions{Timeout: 5 * time.Second}); err != nil {
+		t.Errorf("Expected the login to succeed with the timeout of the call but got %v", err)
+	}
+
+	// the retry policy of the call applies to its commands only
+	log := fakeISCSIAdm(t, `case "$*" in *" -l"*) exit 4;; esac`)
+	if err := c.PerformLoginWithOptions(target, LoginOptions{RetryPolicy: &RetryPolicy{Attempts: 3}}); !errors.Is(err, goiscsierrors.Transport) {
+		t.Errorf("Expected a transport error but got %v", err)
+	}
+	if err := c.PerformLogin(target); !errors.Is(err, goiscsierrors.Transport) {
+		t.Errorf("Expected a transport error but got %v", err)
+	}
+	args, err := os.ReadFile(log) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(args), " -l"); n != 4 {
+		t.Errorf("Expected 3 login attempts with the retry policy of the call and 1 without but got %d:\n%s", n, args)
+	}
+
+	var got LoginOptions
+	mock := NewMockISCSI(map[string]string{})
+	mock.PerformLoginWithOptionsFn = func(_ ISCSITarget, opts LoginOptions) error {
+		got = opts
+		return nil
+	}
+	if err = mock.PerformLogin(target); err != nil || got != (LoginOptions{}) {
+		t.Errorf("Expected PerformLogin to log in with the default options but got %v, %v", got, err)
+	}
+}
+
+func TestNodePresets(t *testing.T) {
+	reset()
+	expected := []NodePreset{PresetPowerMaxDefault, PresetPowerStoreDefault, PresetUnityDefault}
+	if got := NodePresets(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected presets %v but got %v", expected, got)
+	}
+	params, err := PresetParameters(PresetPowerStoreDefault)
+	if err != nil || params["node.session.timeo.replacement_timeout"] != "15" {
+		t.Errorf("Unexpected PowerStore settings %v, %v", params, err)
+	}
+	params["node.session.timeo.replacement_timeout"] = "0"
+	if params, _ = PresetParameters(PresetPowerStoreDefault); params["node.session.timeo.replacement_timeout"] != "15" {
+		t.Error("Expected a copy of the preset settings")
+	}
+	if _, err = PresetParameters("missing"); !errors.Is(err, ErrUnknownPreset) {
+		t.Errorf("Expected %v but got %v", ErrUnknownPreset, err)
+	}
+
+	c := NewMockISCSI(map[string]string{})
+	var applied map[string]string
+	c.CreateOrUpdateNodeFn = func(_ ISCSITarget, options map[string]string) error {
+		applied = options
+		return nil
+	}
+	target := ISCSITarget{Target: "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3", Portal: "192.168.1.12:3260"}
+	err = ApplyNodePreset(c, target, PresetUnityDefault, map[string]string{"node.session.queue_depth": "64"})
+	if err != nil || applied["node.session.timeo.replacement_timeout"] != "120" || applied["node.session.queue_depth"] != "64" {
+		t.Errorf("Unexpected settings applied %v, %v", applied, err)
+	}
+	if err = ApplyNodePreset(c, target, "missing", nil); !errors.Is(err, ErrUnknownPreset) {
+		t.Errorf("Expected %v but got %v", ErrUnknownPreset, err)
+	}
+}
+
+func TestScanSCSIHosts(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": "iqn.2015-10.com.dell:a"})
+	makeSysfsSession(t, "host3", "13", map[string]string{"targetname": "iqn.2015-10.com.dell:b"})
+	// a SCSI host without iSCSI session, e.g. of a local HBA
+	other := defaultSysfsTree().classPath("scsi_host") + "/host0"
+	_ = os.MkdirAll(other, 0o750)
+	fakeISCSIAdm(t, "exit 0")
+
+	scan := defaultSysfsTree().classPath("scsi_host") + "/host3/scan"
+	if err := NewLinuxISCSI(map[string]string{}).PerformRescan(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(scan); !os.IsNotExist(err) {
+		t.Error("Expected no SCSI host scan without the option")
+	}
+
+	if err := NewLinuxISCSI(map[string]string{ScanSCSIHosts: "true"}).PerformRescan(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(scan)
+	compareStr(t, string(data), "- - -")
+	if _, err := os.Stat(other + "/scan"); !os.IsNotExist(err) {
+		t.Error("Expected the SCSI host without iSCSI session not to be scanned")
+	}
+}
+
+func TestOutputLimits(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+	for _, sid := range []string{"12", "13", "14"} {
+		makeSysfsSession(t, "host3", sid, map[string]string{"targetname": "iqn.2015-10.com.dell:a"})
+	}
+	c := NewLinuxISCSI(map[string]string{MaxRecords: "2"})
+	sessions, err := c.GetSessions()
+	if !errors.Is(err, ErrOutputTruncated) || len(sessions) != 2 {
+		t.Errorf("Expected 2 sessions and %v but got %d sessions, %v", ErrOutputTruncated, len(sessions), err)
+	}
+
+	// a firmware repeating the same record endlessly
+	fakeISCSIAdm(t, "i=0; while [ $i -lt 1000 ]; do echo '192.168.1.12:3260,1 iqn.2015-10.com.dell:a'; i=$((i+1)); done")
+	c = NewLinuxISCSI(map[string]string{MaxOutputBytes: "100"})
+	out, err := c.runCommand(context.Background(), []string{"iscsiadm", "-m", "discovery"})
+	if !errors.Is(err, ErrOutputTruncated) || len(out) != 100 {
+		t.Errorf("Expected 100 bytes and %v but got %d bytes, %v", ErrOutputTruncated, len(out), err)
+	}
+	targets, err := c.DiscoverTargets("192.168.1.12", false)
+	if !errors.Is(err, ErrOutputTruncated) || len(targets) != 0 {
+		t.Errorf("Expected %v but got %v, %v", ErrOutputTruncated, targets, err)
+	}
+
+	c = NewLinuxISCSI(map[string]string{MaxRecords: "10"})
+	targets, err = c.DiscoverTargetsWithOptions("192.168.1.12", DiscoveryOptions{})
+	if !errors.Is(err, ErrOutputTruncated) || len(targets) != 10 {
+		t.Errorf("Expected 10 targets and %v but got %d targets, %v", ErrOutputTruncated, len(targets), err)
+	}
+	if targets, err = NewLinuxISCSI(map[string]string{}).DiscoverTargetsWithOptions("192.168.1.12", DiscoveryOptions{}); err != nil || len(targets) != 1000 {
+		t.Errorf("Expected 1000 targets without limit but got %d, %v", len(targets), err)
+	}
+}
+
+func TestRetryHooks(t *testing.T) {
+	reset()
+	executor := &scriptedExecutor{failures: []int{4, 8}}
+	c, err := NewLinuxISCSIFromConfig(Config{
+		RetryPolicy: RetryPolicy{Attempts: 3, Delay: time.Second, MaxDelay: 1500 * time.Millisecond},
+		Executor:    executor,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetClock(NewFakeClock(time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)))
+	var retries []string
+	c.AddRetryHook(func(op string, attempt int, err error, nextDelay time.Duration) {
+		retries = append(retries, fmt.Sprintf("%s %d %s %v", op, attempt, nextDelay, errors.Is(err, goiscsierrors.Transport)))
+	})
+	if err = c.LogoutSessionBySID("12"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"session logout 1 1s true", "session logout 2 1.5s false"}
+	if !reflect.DeepEqual(retries, expected) {
+		t.Errorf("Expected retries %v but got %v", expected, retries)
+	}
+
+	// the final failure is not a retry
+	retries = nil
+	executor.failures = []int{4, 4, 4}
+	if err = c.LogoutSessionBySID("12"); err == nil || len(retries) != 2 {
+		t.Errorf("Expected 2 retries before the failure but got %v, %v", retries, err)
+	}
+
+	compareStr(t, commandOperation([]string{"chroot", "/host", "iscsiadm", "-m", "node", "-T", "iqn", "-o", "update"}), "node update")
+	compareStr(t, commandOperation([]string{"iscsiadm", "-m", "discovery", "-t", "st", "--portal", "1.1.1.1"}), "discovery")
+}
+
+func TestUnsafeSkipValidation(t *testing.T) {
+	reset()
+	defaultDir := nodeMetadataDir
+	defer func() { nodeMetadataDir = defaultDir }()
+	nodeMetadataDir = t.TempDir()
+	log := fakeISCSIAdm(t, "exit 0")
+
+	// a lab array with a target name which is not an IQN, reached by its hostname
+	target := ISCSITarget{Portal: "labarray:3260", Target: "test_array.target-1"}
+	if err := NewLinuxISCSI(map[string]string{}).DeleteNode(target); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+	c := NewLinuxISCSI(map[string]string{UnsafeSkipValidation: "true"})
+	if err := c.DeleteNode(target); err != nil {
+		t.Fatal(err)
+	}
+	args, _ := os.ReadFile(log)
+	if !strings.Contains(string(args), "-p labarray:3260 -T test_array.target-1 -o delete") {
+		t.Errorf("Expected the node record of the target to be deleted but got:\n%s", args)
+	}
+	for _, invalid := range []ISCSITarget{{Portal: "labarray", Target: "-o"}, {Portal: "", Target: "test_array.target-1"}} {
+		if err := c.DeleteNode(invalid); !errors.Is(err, goiscsierrors.Validation) {
+			t.Errorf("Expected a validation error for %+v but got %v", invalid, err)
+		}
+	}
+}
+
+func TestMutationPreflight(t *testing.T) {
+	reset()
+	defaultDir := nodeMetadataDir
+	defer func() { nodeMetadataDir = defaultDir }()
+	nodeMetadataDir = t.TempDir()
+	log := fakeISCSIAdm(t, "exit 0")
+	c := NewLinuxISCSI(map[string]string{})
+
+	const iqn = "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	missing := filepath.Join(t.TempDir(), "missing")
+	entryPoints := map[string]func(ISCSITarget) error{
+		"PerformLogin": c.PerformLogin,
+		"PerformLoginWithOptions": func(target ISCSITarget) error {
+			return c.PerformLoginWithOptions(target, LoginOptions{Chroot: missing})
+		},
+		"PerformLogout": c.PerformLogout,
+		"PerformLogoutWithOptions": func(target ISCSITarget) error {
+			return c.PerformLogoutWithOptions(target, LogoutOptions{Chroot: missing})
+		},
+		"CreateOrUpdateNode": func(target ISCSITarget) error {
+			return c.CreateOrUpdateNode(target, map[string]string{"node.startup": "manual"})
+		},
+		"SetCHAPCredentials": func(target ISCSITarget) error {
+			return c.SetCHAPCredentials(target, "user", "password")
+		},
+		// with invalid credentials, checked after the target
+		"SetCHAPCredentialsBidirectional": func(target ISCSITarget) error {
+			return c.SetCHAPCredentialsBidirectional(target, CHAPCredentials{Username: "user"})
+		},
+		"DeleteNode": c.DeleteNode,
+		"AddPathToTarget": func(target ISCSITarget) error {
+			return c.AddPathToTarget(target.Target, target.Portal, target.Iface)
+		},
+		"DeleteNodes": func(target ISCSITarget) error {
+			_, err := c.DeleteNodes([]ISCSITarget{target})
+			return err
+		},
+		"ImportNodes": func(target ISCSITarget) error {
+			snapshot := &NodeSnapshot{Version: NodeSnapshotVersion, Nodes: []ISCSINode{{
+				Target: target.Target, Portal: target.Portal,
+				Fields: map[string]string{"iface.iscsi_ifacename": target.Iface, "node.startup": "manual"},
+			}}}
+			_, err := c.ImportNodes(snapshot, SnapshotOptions{})
+			return err
+		},
+	}
+	tests := []struct {
+		name   string
+		target ISCSITarget
+		want   string
+	}{
+		{"portal before IQN", ISCSITarget{Portal: "bad", Target: "bad", Iface: "bad iface"}, "invalid IP or portal address"},
+		{"IQN before iface", ISCSITarget{Portal: "1.1.1.1", Target: "bad", Iface: "bad iface"}, "invalid IQN"},
+		{"iface", ISCSITarget{Portal: "1.1.1.1", Target: iqn, Iface: "bad iface"}, "invalid iface name"},
+	}
+	for name, fn := range entryPoints {
+		for _, tt := range tests {
+			err := fn(tt.target)
+			if !errors.Is(err, goiscsierrors.Validation) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("%s, %s: expected a validation error %q but got %v", name, tt.name, tt.want, err)
+			}
+		}
+	}
+	// the options of the call are checked after the target
+	for _, name := range []string{"PerformLoginWithOptions", "PerformLogoutWithOptions"} {
+		if err := entryPoints[name](ISCSITarget{Portal: "1.1.1.1", Target: iqn}); !errors.Is(err, goiscsierrors.Validation) ||
+			!strings.Contains(err.Error(), "chroot") {
+			t.Errorf("%s: expected a validation error of the chroot but got %v", name, err)
+		}
+	}
+	// the sessions are logged out of by SID
+	for _, sid := range []string{"", "bad", "-u"} {
+		if err := c.LogoutSessionBySID(sid); !errors.Is(err, goiscsierrors.Validation) || !strings.Contains(err.Error(), "invalid session SID") {
+			t.Errorf("LogoutSessionBySID: expected a validation error for %q but got %v", sid, err)
+		}
+	}
+	if args, _ := os.ReadFile(log); len(args) != 0 {
+		t.Errorf("Expected no iscsiadm command before the validation but got:\n%s", args)
+	}
+}
+
+func TestGetSIDToHostMap(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": "iqn.2015-10.com.dell:a"})
+	makeSysfsSession(t, "host4", "13", map[string]string{"targetname": "iqn.2015-10.com.dell:b"})
+	fakeISCSIAdm(t, "exit 0")
+
+	c := NewLinuxISCSI(map[string]string{})
+	hosts, err := c.GetSIDToHostMap()
+	if err != nil || !reflect.DeepEqual(hosts, map[string]int{"12": 3, "13": 4}) {
+		t.Errorf("Unexpected SID to host map %v, %v", hosts, err)
+	}
+	// without cache, the sessions of other clients are seen at once
+	makeSysfsSession(t, "host5", "14", map[string]string{"targetname": "iqn.2015-10.com.dell:c"})
+	if hosts, _ = c.GetSIDToHostMap(); hosts["14"] != 5 {
+		t.Errorf("Expected the new session in the map but got %v", hosts)
+	}
+
+	// the map is cached with the sessions until the TTL, a logout or Invalidate
+	c.SetOptions(map[string]string{SessionCacheTTL: "1m"})
+	c.SetClock(NewFakeClock(time.Now()))
+	_, _ = c.GetSIDToHostMap()
+	makeSysfsSession(t, "host6", "15", map[string]string{"targetname": "iqn.2015-10.com.dell:d"})
+	if hosts, _ = c.GetSIDToHostMap(); len(hosts) != 3 {
+		t.Errorf("Expected the cached map but got %v", hosts)
+	}
+	c.Invalidate()
+	if hosts, _ = c.GetSIDToHostMap(); hosts["15"] != 6 {
+		t.Errorf("Expected the map to be read again after Invalidate but got %v", hosts)
+	}
+	makeSysfsSession(t, "host7", "16", map[string]string{"targetname": "iqn.2015-10.com.dell:e"})
+	if err = c.LogoutSessionBySID("13"); err != nil {
+		t.Fatal(err)
+	}
+	if hosts, _ = c.GetSIDToHostMap(); hosts["16"] != 7 {
+		t.Errorf("Expected the map to be read again after the logout but got %v", hosts)
+	}
+
+	data, err := os.ReadFile("testdata/session_info_p3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hosts = parseSessionHosts(data); !reflect.DeepEqual(hosts, map[string]int{"12": 3, "13": 4}) {
+		t.Errorf("Unexpected SID to host map parsed from iscsiadm %v", hosts)
+	}
+
+	if hosts, err = NewMockISCSI(map[string]string{MockNumberOfSessions: "2"}).GetSIDToHostMap(); err != nil ||
+		!reflect.DeepEqual(hosts, map[string]int{"1": 3, "2": 4}) {
+		t.Errorf("Unexpected mocked SID to host map %v, %v", hosts, err)
+	}
+}
+
+func TestIBFT(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": target})
+	makeSysfsSession(t, "host4", "13", map[string]string{"targetname": target})
+	log := fakeISCSIAdm(t, "exit 0")
+
+	c := NewLinuxISCSI(map[string]string{})
+	if config, err := c.DetectIBFTConfiguration(); err != nil || config.Present() {
+		t.Errorf("Expected no iBFT but got %+v, %v", config, err)
+	}
+
+	write := func(dir string, attrs map[string]string) {
+		_ = os.MkdirAll(sysfsRoot+"/firmware/ibft/"+dir, 0o750)
+		for name, value := range attrs {
+			_ = os.WriteFile(sysfsRoot+"/firmware/ibft/"+dir+"/"+name, []byte(value+"\n"), 0o600)
+		}
+	}
+	write("initiator", map[string]string{"initiator-name": "iqn.1993-08.org.debian:01:boot"})
+	write("target0", map[string]string{"target-name": target, "ip-addr": "192.168.1.12", "port": "3260", "lun": "0"})
+	write("ethernet0", map[string]string{"ip-addr": "192.168.1.10"})
+	config, err := c.DetectIBFTConfiguration()
+	expected := IBFTConfiguration{
+		InitiatorName: "iqn.1993-08.org.debian:01:boot",
+		Targets:       []IBFTTarget{{Index: 0, Target: target, Portal: "192.168.1.12:3260", LUN: "0"}},
+	}
+	if err != nil || !reflect.DeepEqual(config, expected) {
+		t.Errorf("Expected %+v but got %+v, %v", expected, config, err)
+	}
+
+	sessions, err := c.GetSessions()
+	if err != nil || len(sessions) != 2 || !sessions[0].BootCritical || sessions[1].BootCritical {
+		t.Errorf("Expected the session 12 only to be boot critical but got %+v, %v", sessions, err)
+	}
+	if err = c.PerformLogout(ISCSITarget{Target: target, Portal: "192.168.1.12:3260"}); !errors.Is(err, ErrBootSession) {
+		t.Errorf("Expected %v but got %v", ErrBootSession, err)
+	}
+	if err = c.LogoutSessionBySID("12"); !errors.Is(err, ErrBootSession) {
+		t.Errorf("Expected %v but got %v", ErrBootSession, err)
+	}
+	if args, _ := os.ReadFile(log); len(args) != 0 {
+		t.Errorf("Expected no iscsiadm command but got:\n%s", args)
+	}
+	if err = c.LogoutSessionBySID("13"); err != nil {
+		t.Errorf("Expected the logout of the session 13 to succeed but got %v", err)
+	}
+	err = c.PerformLogoutWithOptions(ISCSITarget{Target: target, Portal: "192.168.1.12:3260"}, LogoutOptions{Force: true})
+	if err != nil {
+		t.Errorf("Expected the forced logout to succeed but got %v", err)
+	}
+}
+
+func TestGroupTag(t *testing.T) {
+	reset()
+	tag, err := ParseGroupTag("1")
+	if v, ok := tag.Value(); err != nil || !ok || v != 1 || tag != NewGroupTag(1) {
+		t.Errorf("Expected the group tag 1 but got %v, %v", tag, err)
+	}
+	if tag, err = ParseGroupTag(""); err != nil || tag.IsSet() || tag.String() != "" {
+		t.Errorf("Expected an unset group tag but got %v, %v", tag, err)
+	}
+	for _, invalid := range []string{"-1", "65536", "1a", " 1"} {
+		if _, err = ParseGroupTag(invalid); !errors.Is(err, goiscsierrors.Validation) {
+			t.Errorf("Expected a validation error for %q but got %v", invalid, err)
+		}
+	}
+
+	data, _ := json.Marshal(NewGroupTag(0))
+	if string(data) != `"0"` {
+		t.Errorf("Expected the group tag to be encoded as a string but got %s", data)
+	}
+	if err = json.Unmarshal([]byte(`"garbage"`), &tag); err == nil {
+		t.Error("Expected an error decoding an invalid group tag")
+	}
+	if tag, err = (ISCSITarget{GroupTag: "2"}).ParsedGroupTag(); err != nil || tag != NewGroupTag(2) {
+		t.Errorf("Expected the parsed group tag 2 but got %v, %v", tag, err)
+	}
+	if _, err = (ISCSISession{GroupTag: "x"}).ParsedGroupTag(); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error for the group tag of the session but got %v", err)
+	}
+
+	// a discovered portal with an invalid group tag is skipped
+	fakeISCSIAdm(t, `echo "192.168.1.12:3260,1 iqn.2015-10.com.dell:a"; echo "192.168.1.13:3260,x iqn.2015-10.com.dell:b"`)
+	targets, err := NewLinuxISCSI(map[string]string{}).DiscoverTargets("192.168.1.12", false)
+	if err != nil || len(targets) != 1 || targets[0].GroupTag != "1" {
+		t.Errorf("Expected the target with a valid group tag only but got %v, %v", targets, err)
+	}
+	compareStr(t, portalArgument(ISCSITarget{Portal: "192.168.1.12:3260"}), "192.168.1.12:3260")
+	compareStr(t, portalArgument(targets[0]), "192.168.1.12:3260,1")
+}
+
+func TestErrorContext(t *testing.T) {
+	reset()
+	fakeISCSIAdm(t, `if [ "$1" = "--version" ]; then echo "iscsiadm version 2.1.8"; exit 0; fi
+for i in $(seq 1 25); do echo "iscsiadm: line $i" >&2; done
+exit 2`)
+	target := ISCSITarget{Portal: "192.168.1.12:3260", Target: "iqn.2015-10.com.dell:a", Iface: "iface0"}
+
+	var contextErr *ContextError
+	if err := NewLinuxISCSI(map[string]string{}).DeleteNode(target); err == nil || errors.As(err, &contextErr) {
+		t.Errorf("Expected an error without context but got %v", err)
+	}
+	err := NewLinuxISCSI(map[string]string{AttachErrorContext: "true"}).DeleteNode(target)
+	if !errors.As(err, &contextErr) {
+		t.Fatalf("Expected a ContextError but got %v", err)
+	}
+	c := contextErr.Context
+	if c.Op != JournalOpDeleteNode || c.Target != target.Target || c.Portal != target.Portal || c.Iface != "iface0" ||
+		c.ExitCode != 2 || c.Version != "2.1.8" {
+		t.Errorf("Unexpected error context %+v", c)
+	}
+	if len(c.Stderr) != errorContextStderrLines || c.Stderr[0] != "iscsiadm: line 6" || c.Stderr[19] != "iscsiadm: line 25" {
+		t.Errorf("Expected the last lines of the standard error but got %q", c.Stderr)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || err.Error() != contextErr.Err.Error() {
+		t.Errorf("Expected the ContextError to wrap the command error but got %v", err)
+	}
+	if !strings.Contains(c.String(), "exit=2") {
+		t.Errorf("Unexpected error context summary %s", c.String())
+	}
+}
+
+func TestProcessLifetime(t *testing.T) {
+	reset()
+	defaultInterval := reaperInterval
+	defer func() { reaperInterval = defaultInterval }()
+	reaperInterval = 10 * time.Millisecond
+	fakeISCSIAdm(t, "exec /bin/sleep 10")
+
+	logger := &recordingLogger{}
+	c, err := NewLinuxISCSIFromConfig(Config{Logger: logger, Options: map[string]string{ProcessLifetime: "100ms"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err = c.DeleteNode(ISCSITarget{Portal: "192.168.1.12:3260", Target: "iqn.2015-10.com.dell:a"})
+	if !errors.Is(err, ErrProcessKilled) || !errors.Is(err, goiscsierrors.Timeout) {
+		t.Errorf("Expected ErrProcessKilled but got %v", err)
+	}
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || !timeoutErr.Killed || timeoutErr.Budget != 100*time.Millisecond {
+		t.Errorf("Expected a killed process with a budget of 100ms but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the stuck process to be killed but it ran %s", elapsed)
+	}
+	if !slices.ContainsFunc(logger.lines, func(l string) bool { return strings.Contains(l, "Killed iscsiadm node delete") }) {
+		t.Errorf("Expected the killed process to be logged but got %q", logger.lines)
+	}
+	c.reaper.mu.Lock()
+	defer c.reaper.mu.Unlock()
+	if len(c.reaper.processes) != 0 {
+		t.Errorf("Expected no process left tracked but got %v", c.reaper.processes)
+	}
+}
+
+func TestTimeoutError(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+	target := ISCSITarget{Portal: "192.168.1.14", Target: "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"}
+
+	// a hung iscsiadm is killed at the end of the budget of the call
+	fakeISCSIAdm(t, `case "$*" in *" -l"*) exec /bin/sleep 10;; esac`)
+	c := NewLinuxISCSI(map[string]string{})
+	err := c.PerformLoginWithOptions(target, LoginOptions{Timeout: 50 * time.Millisecond})
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || !errors.Is(err, goiscsierrors.Timeout) {
+		t.Fatalf("Expected a TimeoutError but got %v", err)
+	}
+	if timeoutErr.Op != "node login" || timeoutErr.Budget != 50*time.Millisecond || !timeoutErr.Killed ||
+		timeoutErr.Elapsed < 50*time.Millisecond || timeoutErr.Elapsed > 5*time.Second {
+		t.Errorf("Expected a killed node login with a budget of 50ms but got %+v", timeoutErr)
+	}
+
+	// a timeout reported by iscsiadm
+	fakeISCSIAdm(t, `case "$*" in *" -l"*) exit 8;; esac`)
+	err = c.PerformLoginWithOptions(target, LoginOptions{Timeout: time.Minute})
+	if !errors.As(err, &timeoutErr) || timeoutErr.Killed || timeoutErr.Budget != time.Minute {
+		t.Errorf("Expected a timeout reported by iscsiadm but got %v", err)
+	}
+	if !strings.Contains(err.Error(), "reported by iscsiadm") {
+		t.Errorf("Expected the error to tell the timeout was reported by iscsiadm but got %v", err)
+	}
+
+	// other errors are not timeouts
+	fakeISCSIAdm(t, `case "$*" in *" -l"*) exit 4;; esac`)
+	if err := c.PerformLogin(target); errors.As(err, &timeoutErr) {
+		t.Errorf("Expected a transport error but got %v", err)
+	}
+}
+
+func TestDiscoverTargetsFromAddresses(t *testing.T) {
+	reset()
+	fakeISCSIAdm(t, `case "$*" in
+*192.168.1.13*) echo "iscsiadm: cannot make connection to 192.168.1.13" >&2; exit 4;;
+*) echo "192.168.1.12:3260,1 iqn.2015-10.com.dell:a"; echo "192.168.1.13:3260,2 iqn.2015-10.com.dell:a";;
+esac`)
+	c := NewLinuxISCSI(map[string]string{})
+
+	results, err := c.DiscoverTargetsFromAddresses([]string{"192.168.1.12, 192.168.1.13", "192.168.1.14"}, DiscoveryOptions{})
+	if err != nil || len(results) != 3 {
+		t.Fatalf("Expected the results of 3 addresses but got %v, %v", results, err)
+	}
+	if results[1].Address != "192.168.1.13" || results[1].Error == nil || results.FailedCount() != 1 {
+		t.Errorf("Expected the discovery through 192.168.1.13 to fail but got %+v", results[1])
+	}
+	if len(results[0].Targets) != 2 || len(results.Targets()) != 2 {
+		t.Errorf("Expected 2 distinct targets but got %v", results.Targets())
+	}
+	if !strings.Contains(results.Errors().Error(), "discovery through 192.168.1.13") {
+		t.Errorf("Unexpected errors %v", results.Errors())
+	}
+
+	if _, err = c.DiscoverTargetsFromAddresses([]string{"192.168.1.13"}, DiscoveryOptions{}); err == nil {
+		t.Error("Expected an error when the discovery failed through every address")
+	}
+	if _, err = c.DiscoverTargetsFromAddresses([]string{" , "}, DiscoveryOptions{}); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error without address but got %v", err)
+	}
+	mock := NewMockISCSI(map[string]string{})
+	if results, err = mock.DiscoverTargetsFromAddresses([]string{"1.1.1.1,1.1.1.2"}, DiscoveryOptions{}); err != nil || len(results) != 2 {
+		t.Errorf("Unexpected mock results %v, %v", results, err)
+	}
+}
+
+func TestDiscoverEndpointTargets(t *testing.T) {
+	reset()
+	log := fakeISCSIAdm(t, `case "$*" in
+*192.168.1.13*) echo "iscsiadm: cannot make connection to 192.168.1.13" >&2; exit 4;;
+*) echo "192.168.1.12:3260,1 iqn.2015-10.com.dell:a";;
+esac`)
+	c := NewLinuxISCSI(map[string]string{})
+	var warnings []Warning
+	c.AddWarningHandler(func(w Warning) { warnings = append(warnings, w) })
+
+	endpoint := DiscoveryEndpoint{Name: "array1", Addresses: []string{"192.168.1.13, 192.168.1.12", "192.168.1.14"}}
+	targets, err := c.DiscoverEndpointTargets(endpoint, DiscoveryOptions{})
+	if err != nil || len(targets) != 1 || targets[0].Target != "iqn.2015-10.com.dell:a" {
+		t.Fatalf("Unexpected targets %v, %v", targets, err)
+	}
+	if args, _ := os.ReadFile(log); strings.Contains(string(args), "192.168.1.14") {
+		t.Errorf("Expected no discovery after the first success but got %s", args)
+	}
+	if len(warnings) != 1 || warnings[0].Code != WarningDiscoveryFailover ||
+		!strings.Contains(warnings[0].Message, "array1 failed over to 192.168.1.12") {
+		t.Errorf("Expected a DiscoveryFailover warning but got %v", warnings)
+	}
+
+	// no warning without failover
+	warnings = nil
+	if _, err = c.DiscoverEndpointTargets(DiscoveryEndpoint{Addresses: []string{"192.168.1.12"}}, DiscoveryOptions{}); err != nil || len(warnings) != 0 {
+		t.Errorf("Unexpected discovery %v, warnings %v", err, warnings)
+	}
+	_, err = c.DiscoverEndpointTargets(DiscoveryEndpoint{Addresses: []string{"192.168.1.13"}}, DiscoveryOptions{})
+	if err == nil || !strings.Contains(err.Error(), "discovery of 192.168.1.13 failed through all 1 addresses") {
+		t.Errorf("Expected an error when the discovery failed through every address but got %v", err)
+	}
+	for _, e := range []DiscoveryEndpoint{{}, {Addresses: []string{" , "}}, {Addresses: []string{"192.168.1.12", "bad address"}}} {
+		if _, err = c.DiscoverEndpointTargets(e, DiscoveryOptions{}); !errors.Is(err, goiscsierrors.Validation) {
+			t.Errorf("Expected a validation error for %v but got %v", e.Addresses, err)
+		}
+	}
+
+	mock := NewMockISCSI(map[string]string{})
+	mock.DiscoverTargetsWithOptionsFn = func(address string, _ DiscoveryOptions) ([]ISCSITarget, error) {
+		switch address {
+		case "1.1.1.1":
+			return nil, goiscsierrors.New(goiscsierrors.Transport, "unreachable")
+		case "1.1.1.3":
+			return nil, goiscsierrors.New(goiscsierrors.Auth, "authentication failure")
+		}
+		return []ISCSITarget{{Portal: address + ":3260", Target: "iqn.2015-10.com.dell:a"}}, nil
+	}
+	if targets, err = mock.DiscoverEndpointTargets(DiscoveryEndpoint{Addresses: []string{"1.1.1.1,1.1.1.2"}}, DiscoveryOptions{}); err != nil ||
+		len(targets) != 1 || targets[0].Portal != "1.1.1.2:3260" {
+		t.Errorf("Unexpected mock targets %v, %v", targets, err)
+	}
+	// an authentication failure fails alike through every address
+	if _, err = mock.DiscoverEndpointTargets(DiscoveryEndpoint{Addresses: []string{"1.1.1.3,1.1.1.2"}}, DiscoveryOptions{}); !errors.Is(err, goiscsierrors.Auth) {
+		t.Errorf("Expected the authentication error without failover but got %v", err)
+	}
+}
+
+func TestDiscoverEndpointTargetsLoginFailure(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+
+	// the discovery through 192.168.1.12 succeeds but the login to its target is unreachable
+	log := fakeISCSIAdm(t, `case "$*" in
+*" -l"*) exit 4;;
+*"-m discovery"*) echo "192.168.1.12:3260,1 iqn.2015-10.com.dell:a";;
+esac`)
+	c := NewLinuxISCSI(map[string]string{RollbackDiscovery: "true"})
+	endpoint := DiscoveryEndpoint{Addresses: []string{"192.168.1.12", "192.168.1.13"}}
+	_, err := c.DiscoverEndpointTargets(endpoint, DiscoveryOptions{Login: true})
+	if !errors.Is(err, goiscsierrors.Transport) || !strings.Contains(err.Error(), "login to iqn.2015-10.com.dell:a") {
+		t.Errorf("Expected the failed login but got %v", err)
+	}
+	args, _ := os.ReadFile(log) // #nosec G304
+	if strings.Contains(string(args), "192.168.1.13") {
+		t.Errorf("Expected no discovery through the next address after the failed login but got %s", args)
+	}
+}
+
+func TestGetCHAPConfig(t *testing.T) {
+	reset()
+	log := fakeISCSIAdm(t, `case "$*" in
+*iqn.2015-10.com.dell:missing*) exit 21;;
+*) echo "# BEGIN RECORD 2.1.8"
+echo "node.name = iqn.2015-10.com.dell:a"
+echo "node.session.auth.authmethod = CHAP"
+echo "node.session.auth.username = chapuser"
+echo "node.session.auth.password = ********"
+echo "node.session.auth.username_in = <empty>"
+echo "node.session.auth.password_in = <empty>"
+echo "# END RECORD";;
+esac`)
+	c := NewLinuxISCSI(map[string]string{})
+	target := ISCSITarget{Portal: "192.168.1.12:3260", Target: "iqn.2015-10.com.dell:a", Iface: "iface0"}
+
+	config, err := c.GetCHAPConfig(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := CHAPConfig{Target: target, AuthMethod: "CHAP", Username: "chapuser", PasswordSet: true}
+	if config != expected || !config.Enabled() || config.Mutual() {
+		t.Errorf("Expected %+v but got %+v", expected, config)
+	}
+	args, _ := os.ReadFile(log)
+	if !strings.Contains(string(args), "-p 192.168.1.12:3260 -o show -I iface0") {
+		t.Errorf("Expected the node record of the iface to be shown but got:\n%s", args)
+	}
+	_, err = c.GetCHAPConfig(ISCSITarget{Portal: "192.168.1.12:3260", Target: "iqn.2015-10.com.dell:missing"})
+	if !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("Expected ErrNodeNotFound but got %v", err)
+	}
+	if _, err = c.GetCHAPConfig(ISCSITarget{Portal: "192.168.1.12:3260", Target: "not an iqn"}); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+
+	mock := NewMockISCSI(map[string]string{})
+	config, err = mock.GetCHAPConfig(ISCSITarget{Portal: "192.168.1.0", Target: "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a0"})
+	if err != nil || config.Enabled() {
+		t.Errorf("Expected a mock node record without CHAP but got %+v, %v", config, err)
+	}
+}
+
+func TestSetCHAPCredentialsBidirectional(t *testing.T) {
+	reset()
+	defaultDir := nodeMetadataDir
+	defer func() { nodeMetadataDir = defaultDir }()
+	nodeMetadataDir = t.TempDir()
+	target := "iqn.2015-10.com.dell:a"
+	log := fakeISCSIAdm(t, `case "$*" in
+*"-o new"*) exit 15;;
+*--discover*) echo "192.168.1.12:3260,1 `+target+`";;
+esac`)
+	c := NewLinuxISCSI(map[string]string{})
+	creds := CHAPCredentials{Username: "chapuser", Password: "chapsecret", UsernameIn: "targetuser", PasswordIn: "targetsecret"}
+
+	if err := c.SetCHAPCredentialsBidirectional(ISCSITarget{Portal: "192.168.1.12:3260", Target: target}, creds); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetCHAPCredentialsBidirectional(ISCSITarget{Portal: "192.168.1.12:3260", Target: target},
+		CHAPCredentials{Username: "chapuser", Password: "chapsecret"}); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error without the credentials of the target but got %v", err)
+	}
+	targets, err := c.DiscoverTargetsWithOptions("192.168.1.12", DiscoveryOptions{CHAP: &creds})
+	if err != nil || len(targets) != 1 || targets[0].Target != target {
+		t.Fatalf("Unexpected discovery %v, %v", targets, err)
+	}
+	args, _ := os.ReadFile(log)
+	for _, expected := range []string{
+		"-n node.session.auth.username_in -v targetuser",
+		"-n node.session.auth.password_in -v targetsecret",
+		"-m discoverydb -t st -p 192.168.1.12:3260 -o new",
+		"-m discoverydb -t st -p 192.168.1.12:3260 -o update -n discovery.sendtargets.auth.authmethod -v CHAP",
+		"-n discovery.sendtargets.auth.username_in -v targetuser",
+		"-m discoverydb -t st --portal 192.168.1.12:3260 --discover",
+	} {
+		if !strings.Contains(string(args), expected) {
+			t.Errorf("Expected %q but got:\n%s", expected, args)
+		}
+	}
+	if strings.Contains(string(args), "-m discovery ") {
+		t.Errorf("Expected the discovery to read the discovery record but got:\n%s", args)
+	}
+	_, err = c.DiscoverTargetsWithOptions("192.168.1.12", DiscoveryOptions{Type: DiscoveryISNS, CHAP: &creds})
+	if !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error for iSNS discovery with CHAP but got %v", err)
+	}
+
+	mock := NewMockISCSI(map[string]string{})
+	mockTarget := ISCSITarget{Portal: "192.168.1.12:3260", Target: target}
+	if err = mock.SetCHAPCredentialsBidirectional(mockTarget, creds); err != nil {
+		t.Fatal(err)
+	}
+	if err = mock.SetCHAPCredentialsBidirectional(mockTarget, CHAPCredentials{Username: "chapuser", UsernameIn: "targetuser"}); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a mock validation error but got %v", err)
+	}
+}
+
+func TestAnalyzeHostTuning(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+
+	// sdb of session 12 has a low queue depth and no multipath device, sdc of session 13 is a path of dm-0
+	target := "iqn.2015-10.com.dell:a"
+	for sid, device := range map[string]string{"12": "sdb", "13": "sdc"} {
+		makeSysfsSession(t, "host"+sid, sid, map[string]string{"targetname": target, "state": "LOGGED_IN"})
+		dir := sysfsRoot + "/devices/platform/host" + sid + "/session" + sid + "/target" + sid + ":0:0/" + sid + ":0:0:1/block/" + device
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"block/sdb/device/queue_depth": "16", "block/sdc/device/queue_depth": "64", "block/dm-0/dm/uuid": "mpath-a",
+	}
+	if err := os.MkdirAll(sysfsRoot+"/block/sdc/holders/dm-0", 0o750); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	files[dir+"/iscsid.conf"] = "node.session.timeo.replacement_timeout = 5\n# node.conn[0].timeo.noop_out_interval = 30"
+	files[dir+"/multipath.conf"] = "defaults {\n  polling_interval 10\n  checker_timeout 15 # seconds\n}\n" +
+		"devices {\n  device {\n    checker_timeout 60\n  }\n}"
+	for file, value := range files {
+		if !filepath.IsAbs(file) {
+			file = sysfsRoot + "/" + file
+		}
+		if err := os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(value+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fakeISCSIAdm(t, `echo "# BEGIN RECORD 2.1.8"
+echo "node.name = `+target+`"
+echo "node.conn[0].address = 192.168.1.12"
+echo "node.conn[0].port = 3260"
+echo "node.session.timeo.replacement_timeout = 120"
+echo "node.conn[0].timeo.noop_out_interval = 10"
+echo "node.session.queue_depth = <empty>"
+echo "# END RECORD"`)
+
+	c := NewLinuxISCSI(map[string]string{SessionSource: "sysfs"})
+	c.SetPaths(Paths{IscsidConf: dir + "/iscsid.conf", MultipathConf: dir + "/multipath.conf"})
+	recs, err := c.AnalyzeHostTuning()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(recs))
+	for _, r := range recs {
+		got = append(got, fmt.Sprintf("%s %s %s %s=%s", r.Severity, r.Area, r.Subject, r.Parameter, r.Current))
+	}
+	expected := []string{
+		"critical iscsid.conf iscsid.conf node.session.timeo.replacement_timeout=5",
+		"warning node " + target + " at 192.168.1.12:3260 node.conn[0].timeo.noop_out_interval=10",
+		"info device sdb queue_depth=16",
+		"warning multipath sdb =",
+		"warning multipath " + dir + "/multipath.conf polling_interval=10",
+	}
+	if !slices.Equal(got, expected) {
+		t.Errorf("Expected recommendations\n%s\nbut got\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	c.SetPaths(Paths{IscsidConf: dir + "/missing.conf", MultipathConf: dir + "/missing.conf"})
+	if recs, err = c.AnalyzeHostTuning(); err != nil || len(recs) != 4 || recs[3].Subject != dir+"/missing.conf" {
+		t.Errorf("Expected a missing multipath.conf to be reported but got %+v, %v", recs, err)
+	}
+
+	mock := NewMockISCSI(map[string]string{})
+	if recs, err = mock.AnalyzeHostTuning(); err != nil || len(recs) != 0 {
+		t.Errorf("Expected no recommendation for the mock node records but got %+v, %v", recs, err)
+	}
+}
+
+func TestIfaceManagement(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": "iqn.2015-10.com.dell:a", "ifacename": "iface0"})
+	log := fakeISCSIAdm(t, `case "$*" in
+"-m iface") echo "default tcp,<empty>,<empty>,<empty>,<empty>"
+  echo "iface0 tcp,00:50:56:a1:b2:c3,10.0.0.5,eth1,iqn.1994-05.com.redhat:a";;
+"-m iface -I iface0 -o new") exit 15;;
+"-m iface -I missing -o show") exit 21;;
+"-m iface -I iface1 -o update -n iface.transport_name -v iser") exit 7;;
+esac`)
+	c := NewLinuxISCSI(map[string]string{SessionSource: "sysfs"})
+
+	ifaces, err := c.ListIfaces()
+	expected := []ISCSIIface{
+		{Name: "default", Transport: ISCSITransportNameTCP},
+		{
+			Name: "iface0", Transport: ISCSITransportNameTCP, HWAddress: "00:50:56:a1:b2:c3", IPAddress: "10.0.0.5",
+			Netdev: "eth1", InitiatorName: "iqn.1994-05.com.redhat:a",
+		},
+	}
+	if err != nil || !slices.Equal(ifaces, expected) {
+		t.Errorf("Expected ifaces %+v but got %+v, %v", expected, ifaces, err)
+	}
+	if err = c.CreateIface(ISCSIIface{Name: "iface2", Netdev: "eth2", IPAddress: "10.0.0.6"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.CreateIface(ISCSIIface{Name: "iface0"}); !errors.Is(err, ErrIfaceExists) {
+		t.Errorf("Expected ErrIfaceExists but got %v", err)
+	}
+	if err = c.CreateIface(ISCSIIface{Name: "iface1", Transport: ISCSITransportNameISER}); err == nil {
+		t.Error("Expected the failed update of the transport to fail the creation")
+	}
+	if err = c.UpdateIface(ISCSIIface{Name: "iface0", InitiatorName: "iqn.1994-05.com.redhat:b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.UpdateIface(ISCSIIface{Name: "missing", Netdev: "eth3"}); !errors.Is(err, ErrIfaceNotFound) {
+		t.Errorf("Expected ErrIfaceNotFound but got %v", err)
+	}
+	if err = c.DeleteIface("iface0"); !errors.Is(err, ErrIfaceInUse) {
+		t.Errorf("Expected ErrIfaceInUse but got %v", err)
+	}
+	if err = c.DeleteIface("iface2"); err != nil {
+		t.Fatal(err)
+	}
+	for _, invalid := range []error{
+		c.DeleteIface("default"),
+		c.CreateIface(ISCSIIface{Name: "iface3", Transport: "fc"}),
+		c.CreateIface(ISCSIIface{Name: "iface3", IPAddress: "not-an-ip"}),
+		c.UpdateIface(ISCSIIface{Name: "iser", Netdev: "eth3"}),
+	} {
+		if !errors.Is(invalid, goiscsierrors.Validation) {
+			t.Errorf("Expected a validation error but got %v", invalid)
+		}
+	}
+	args, _ := os.ReadFile(log)
+	for _, expected := range []string{
+		"-m iface -I iface2 -o new\n-m iface -I iface2 -o update -n iface.ipaddress -v 10.0.0.6\n" +
+			"-m iface -I iface2 -o update -n iface.net_ifacename -v eth2\n",
+		"-m iface -I iface1 -o delete",
+		"-m iface -I iface0 -o show\n-m iface -I iface0 -o update -n iface.initiatorname -v iqn.1994-05.com.redhat:b\n",
+		"-m iface -I iface2 -o delete",
+	} {
+		if !strings.Contains(string(args), expected) {
+			t.Errorf("Expected %q but got:\n%s", expected, args)
+		}
+	}
+	if strings.Contains(string(args), "-I iface0 -o delete") {
+		t.Errorf("Expected the iface in use to be kept but got:\n%s", args)
+	}
+
+	mock := NewMockISCSI(map[string]string{})
+	if ifaces, err = mock.ListIfaces(); err != nil || len(ifaces) != 2 {
+		t.Errorf("Unexpected mock ifaces %+v, %v", ifaces, err)
+	}
+	if err = mock.CreateIface(ISCSIIface{Name: "iface0", Netdev: "eth1"}); err != nil {
+		t.Error(err)
+	}
+	if err = mock.DeleteIface("default"); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a mock validation error but got %v", err)
+	}
+}
+
+func TestDiscoveryCache(t *testing.T) {
+	reset()
+	log := fakeISCSIAdm(t, `/bin/sleep 0.2; echo "192.168.1.12:3260,1 iqn.2015-10.com.dell:a"`)
+	cache := NewDiscoveryCache(time.Minute)
+	clock := NewFakeClock(time.Now())
+	clients := []*LinuxISCSI{NewLinuxISCSI(map[string]string{}), NewLinuxISCSI(map[string]string{})}
+	for _, c := range clients {
+		c.SetClock(clock)
+		c.SetDiscoveryCache(cache)
+	}
+	discoveries := func() int {
+		data, _ := os.ReadFile(log)
+		return strings.Count(string(data), "-m discovery")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 6)
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(c *LinuxISCSI) {
+			defer wg.Done()
+			targets, err := c.DiscoverTargets("192.168.1.12", false)
+			if err == nil && (len(targets) != 1 || targets[0].Target != "iqn.2015-10.com.dell:a") {
+				err = fmt.Errorf("unexpected targets %v", targets)
+			}
+			errs <- err
+		}(clients[i%2])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if n := discoveries(); n != 1 {
+		t.Errorf("Expected the concurrent discoveries to run iscsiadm once but got %d", n)
+	}
+	if _, err := clients[0].DiscoverTargetsWithOptions("192.168.1.12:3260", DiscoveryOptions{}); err != nil || discoveries() != 1 {
+		t.Errorf("Expected the discovery of the same portal to be cached but got %d discoveries, %v", discoveries(), err)
+	}
+	if _, err := clients[0].DiscoverTargetsWithOptions("192.168.1.12", DiscoveryOptions{Iface: "iface0"}); err != nil || discoveries() != 2 {
+		t.Errorf("Expected the discovery through another iface to run but got %d discoveries, %v", discoveries(), err)
+	}
+
+	cache.Invalidate("192.168.1.12")
+	if _, err := clients[1].DiscoverTargets("192.168.1.12", false); err != nil || discoveries() != 3 {
+		t.Errorf("Expected the invalidated discovery to run but got %d discoveries, %v", discoveries(), err)
+	}
+	clock.Sleep(2 * time.Minute)
+	if _, err := clients[1].DiscoverTargets("192.168.1.12", false); err != nil || discoveries() != 4 {
+		t.Errorf("Expected the expired discovery to run but got %d discoveries, %v", discoveries(), err)
+	}
+
+	// the discoveries with CHAP run through discoverydb, and are shared with the clients having the same credentials only
+	chapDiscoveries := func() int {
+		data, _ := os.ReadFile(log)
+		return strings.Count(string(data), "--discover\n")
+	}
+	chap := &CHAPCredentials{Username: "user", Password: "secret1234567"}
+	if _, err := clients[0].DiscoverTargetsWithOptions("192.168.1.12", DiscoveryOptions{CHAP: chap}); err != nil || chapDiscoveries() != 1 {
+		t.Errorf("Expected the discovery with CHAP to run but got %d discoveries, %v", chapDiscoveries(), err)
+	}
+	if _, err := clients[1].DiscoverTargetsWithOptions("192.168.1.12", DiscoveryOptions{CHAP: chap}); err != nil || chapDiscoveries() != 1 {
+		t.Errorf("Expected the discovery with the same CHAP to be cached but got %d discoveries, %v", chapDiscoveries(), err)
+	}
+	other := &CHAPCredentials{Username: "user", Password: "wrong1234567"}
+	if _, err := clients[1].DiscoverTargetsWithOptions("192.168.1.12", DiscoveryOptions{CHAP: other}); err != nil || chapDiscoveries() != 2 {
+		t.Errorf("Expected the discovery with other CHAP to run but got %d discoveries, %v", chapDiscoveries(), err)
+	}
+	cache.Invalidate("")
+	if _, err := clients[0].DiscoverTargetsWithOptions("192.168.1.12", DiscoveryOptions{CHAP: chap}); err != nil || chapDiscoveries() != 3 {
+		t.Fatalf("Expected the invalidated discovery with CHAP to run but got %d discoveries, %v", chapDiscoveries(), err)
+	}
+	plainDiscoveries := func() int {
+		data, _ := os.ReadFile(log)
+		return strings.Count(string(data), "-m discovery -t")
+	}
+	if _, err := clients[1].DiscoverTargets("192.168.1.12", false); err != nil || plainDiscoveries() != 5 {
+		t.Errorf("Expected the discovery without CHAP to run but got %d discoveries, %v", plainDiscoveries(), err)
+	}
+}
+
+func TestDiscoveryCacheInvalidation(t *testing.T) {
+	reset()
+	target := ISCSITarget{Portal: "192.168.1.13:3260", GroupTag: "1", Target: "iqn.2015-10.com.dell:a"}
+	// the logins fail as if the node records were gone
+	log := fakeISCSIAdm(t, `case "$*" in *" -l") exit 21;; esac
+echo "192.168.1.13:3260,1 iqn.2015-10.com.dell:a"`)
+	cache := NewDiscoveryCache(time.Minute)
+	c := NewLinuxISCSI(map[string]string{})
+	c.SetClock(NewFakeClock(time.Now()))
+	c.SetDiscoveryCache(cache)
+	discoveries := func() int {
+		data, _ := os.ReadFile(log)
+		return strings.Count(string(data), "-m discovery")
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.DiscoverTargets("192.168.1.12", false); err != nil || discoveries() != 1 {
+			t.Fatalf("Expected the discovery to run once but got %d discoveries, %v", discoveries(), err)
+		}
+	}
+	if err := c.DeleteNode(target); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.DiscoverTargets("192.168.1.12", false); err != nil || discoveries() != 2 {
+		t.Errorf("Expected the discovery listing the deleted target to run but got %d discoveries, %v", discoveries(), err)
+	}
+	if err := c.PerformLogin(target); err == nil {
+		t.Fatal("Expected the login to fail")
+	}
+	if _, err := c.DiscoverTargets("192.168.1.12", false); err != nil || discoveries() != 3 {
+		t.Errorf("Expected the discovery listing the target failing to log in to run but got %d discoveries, %v", discoveries(), err)
+	}
+
+	// the TTL starts once the discovery is done, so a discovery slower than the TTL is still shared
+	clock := NewFakeClock(time.Now())
+	slow := NewDiscoveryCache(time.Second)
+	runs := 0
+	for i := 0; i < 2; i++ {
+		_, _ = slow.do(context.Background(), discoveryCacheKey{portal: "192.168.1.12:3260"}, clock.Now, func() ([]byte, error) {
+			runs++
+			clock.Sleep(2 * time.Second)
+			return nil, nil
+		})
+	}
+	if runs != 1 {
+		t.Errorf("Expected the slow discovery to be cached but it ran %d times", runs)
+	}
+}
+
+func TestDiscoverySessions(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+	// session 12 is to a target at 192.168.1.12, 13 and 14 are discovery sessions to 192.168.1.13 and 192.168.1.14
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": "iqn.2015-10.com.dell:a", "state": "LOGGED_IN"})
+	makeSysfsSession(t, "host4", "13", map[string]string{"targetname": "<empty>", "state": "LOGGED_IN"})
+	makeSysfsSession(t, "host5", "14", map[string]string{"state": "LOGGED_IN"})
+	log := fakeISCSIAdm(t, "")
+	c := NewLinuxISCSI(map[string]string{SessionSource: "sysfs"})
+
+	sessions, err := c.ListDiscoverySessions()
+	if err != nil || len(sessions) != 2 || sessions[0].SID != "13" || sessions[1].SID != "14" {
+		t.Fatalf("Expected the discovery sessions 13 and 14 but got %+v, %v", sessions, err)
+	}
+	if err = c.LogoutDiscoverySession("192.168.1.13:3260"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.LogoutDiscoverySession("192.168.1.12"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.LogoutDiscoverySession("not-an-ip"); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+	args, _ := os.ReadFile(log)
+	if string(args) != "-m session -r 13 -u\n" {
+		t.Errorf("Expected to log out of the discovery session 13 only but got:\n%s", args)
+	}
+	if findings := auditConsistency(nil, sessions); len(findings) != 0 {
+		t.Errorf("Expected no finding for the discovery sessions but got %+v", findings)
+	}
+
+	mock := NewMockISCSI(map[string]string{})
+	if sessions, err = mock.ListDiscoverySessions(); err != nil || len(sessions) != 0 {
+		t.Errorf("Expected no mock discovery session but got %+v, %v", sessions, err)
+	}
+	if err = mock.LogoutDiscoverySession("192.168.1.13"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetSessionsFiltered(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+	targetA, targetB := "iqn.2015-10.com.dell:a", "iqn.2015-10.com.dell:b"
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": targetA, "state": "LOGGED_IN"})
+	makeSysfsSession(t, "host4", "13", map[string]string{"targetname": targetA, "state": "FAILED", "ifacename": "iface0"})
+	makeSysfsSession(t, "host5", "14", map[string]string{"targetname": targetB, "state": "LOGGED_IN"})
+	c := NewLinuxISCSI(map[string]string{SessionSource: "sysfs"})
+
+	sids := func(sessions []ISCSISession) string {
+		var ids []string
+		for _, s := range sessions {
+			ids = append(ids, s.SID)
+		}
+		return strings.Join(ids, ",")
+	}
+	for _, tc := range []struct {
+		filter   SessionFilter
+		expected string
+	}{
+		{SessionFilter{}, "12,13,14"},
+		{SessionFilter{Target: targetA}, "12,13"},
+		{SessionFilter{Target: targetA, State: ISCSISessionStateLOGGEDIN}, "12"},
+		{SessionFilter{Portal: "192.168.1.14"}, "14"},
+		{SessionFilter{Iface: "default"}, "12,14"},
+		{SessionFilter{Iface: "iface0"}, "13"},
+		{SessionFilter{SID: "13"}, "13"},
+		{SessionFilter{SID: "13", Target: targetB}, ""},
+	} {
+		sessions, err := c.GetSessionsFiltered(tc.filter)
+		if err != nil || sids(sessions) != tc.expected {
+			t.Errorf("Expected the sessions %q for %+v but got %q, %v", tc.expected, tc.filter, sids(sessions), err)
+		}
+	}
+	if sessions, err := c.GetSessionsByTarget(targetB); err != nil || sids(sessions) != "14" {
+		t.Errorf("Expected the session 14 to %s but got %q, %v", targetB, sids(sessions), err)
+	}
+	if sessions, err := c.GetSessionsByPortal("192.168.1.12:3260"); err != nil || sids(sessions) != "12" {
+		t.Errorf("Expected the session 12 to 192.168.1.12:3260 but got %q, %v", sids(sessions), err)
+	}
+	for _, err := range []error{
+		func() error { _, err := c.GetSessionsFiltered(SessionFilter{SID: "x"}); return err }(),
+		func() error { _, err := c.GetSessionsByTarget("not an iqn"); return err }(),
+		func() error { _, err := c.GetSessionsByPortal(""); return err }(),
+	} {
+		if !errors.Is(err, goiscsierrors.Validation) {
+			t.Errorf("Expected a validation error but got %v", err)
+		}
+	}
+
+	data, err := filepath.Abs("testdata/session_info_valid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := fakeISCSIAdm(t, `case "$*" in
+*"-r 14"*) exit 2;;
+*) /bin/cat `+data+`;;
+esac`)
+	c = NewLinuxISCSI(map[string]string{SessionSource: "iscsiadm"})
+	sessions, err := c.GetSessionsFiltered(SessionFilter{SID: "13"})
+	if err != nil || sids(sessions) != "13" {
+		t.Errorf("Expected the session 13 but got %q, %v", sids(sessions), err)
+	}
+	if sessions, err = c.GetSessionsFiltered(SessionFilter{SID: "14"}); err != nil || len(sessions) != 0 {
+		t.Errorf("Expected no session 14 but got %q, %v", sids(sessions), err)
+	}
+	args, _ := os.ReadFile(log)
+	if !strings.Contains(string(args), "-m session -r 13 -P 2 -S") {
+		t.Errorf("Expected iscsiadm to query the session 13 only but got:\n%s", args)
+	}
+
+	mock := NewMockISCSI(map[string]string{MockNumberOfSessions: "2"})
+	if sessions, err = mock.GetSessionsByPortal("192.168.1.1"); err != nil || len(sessions) != 1 {
+		t.Errorf("Expected a mock session to 192.168.1.1 but got %+v, %v", sessions, err)
+	}
+}
+
+func TestCommandMiddlewares(t *testing.T) {
+	reset()
+	defaultDir := nodeMetadataDir
+	defer func() { nodeMetadataDir = defaultDir }()
+	nodeMetadataDir = t.TempDir()
+
+	var calls []string
+	record := func(name string) CommandMiddleware {
+		return func(next CommandFunc) CommandFunc {
+			return func(ctx context.Context, exe []string) ([]byte, error) {
+				calls = append(calls, name+" "+commandOperation(exe))
+				out, err := next(ctx, exe)
+				if err != nil {
+					calls = append(calls, name+" "+string(goiscsierrors.CategoryOf(err)))
+				}
+				return out, err
+			}
+		}
+	}
+	c, err := NewLinuxISCSIFromConfig(Config{
+		RetryPolicy: RetryPolicy{Attempts: 2},
+		Executor:    &scriptedExecutor{failures: []int{4}},
+		Middlewares: []CommandMiddleware{record("first")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetClock(NewFakeClock(time.Now()))
+	c.Use(record("second"))
+	if err = c.DeleteNode(ISCSITarget{Portal: "192.168.1.12:3260", Target: "iqn.2015-10.com.dell:a"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"first node delete", "second node delete", "second transport", "first transport",
+		"first node delete", "second node delete",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected the middlewares to wrap each attempt as %q but got %q", expected, calls)
+	}
+
+	// a middleware can fail the commands without running them
+	c.Use(func(CommandFunc) CommandFunc {
+		return func(context.Context, []string) ([]byte, error) { return nil, errors.New("rate limited") }
+	})
+	if err = c.DeleteNode(ISCSITarget{Portal: "192.168.1.12:3260", Target: "iqn.2015-10.com.dell:a"}); err == nil ||
+		err.Error() != "rate limited" {
+		t.Errorf("Expected the error of the middleware but got %v", err)
+	}
+}
+
+func TestRollbackDiscovery(t *testing.T) {
+	reset()
+	defaultRoot, defaultDir := sysfsRoot, nodeMetadataDir
+	defer func() { sysfsRoot, nodeMetadataDir = defaultRoot, defaultDir }()
+	sysfsRoot, nodeMetadataDir = t.TempDir(), t.TempDir()
+	state := t.TempDir()
+	record := func(target, portal string) string {
+		return `echo "# BEGIN RECORD 2.1.8"; echo "node.name = ` + target + `"; echo "iface.iscsi_ifacename = default"
+echo "node.conn[0].address = ` + portal + `"; echo "node.conn[0].port = 3260"; echo "# END RECORD"`
+	}
+	log := fakeISCSIAdm(t, `case "$*" in
+"-m discoverydb -t st -p 192.168.1.12:3260 -o show") exit 21;;
+"-m discovery -t st --portal 192.168.1.12:3260") touch `+state+`/discovered
+  echo "192.168.1.12:3260,1 iqn.2015-10.com.dell:a"; echo "192.168.1.13:3260,1 iqn.2015-10.com.dell:b";;
+"-m node -o show") `+record("iqn.2015-10.com.dell:old", "192.168.1.11")+`
+  if [ -f `+state+`/discovered ]; then `+record("iqn.2015-10.com.dell:a", "192.168.1.12")+"\n"+record("iqn.2015-10.com.dell:b", "192.168.1.13")+`; fi;;
+*iqn.2015-10.com.dell:b*" -l"*) exit 24;;
+esac`)
+	c := NewLinuxISCSI(map[string]string{RollbackDiscovery: "true"})
+	c.AddLoginHook(func(target ISCSITarget, err error) {
+		if err == nil && target.Target == "iqn.2015-10.com.dell:a" {
+			makeSysfsSession(t, "host3", "12", map[string]string{"targetname": target.Target})
+		}
+	})
+
+	targets, err := c.DiscoverTargets("192.168.1.12:3260", true)
+	if err == nil || !strings.Contains(err.Error(), "login to iqn.2015-10.com.dell:b") || len(targets) != 0 {
+		t.Fatalf("Expected the discovery to fail on the login to the second target but got %v, %v", targets, err)
+	}
+	data, _ := os.ReadFile(log)
+	args := string(data)
+	for _, expected := range []string{
+		"-m session -r 12 -u",
+		"-m node -p 192.168.1.12:3260 -T iqn.2015-10.com.dell:a -o delete -I default",
+		"-m node -p 192.168.1.13:3260 -T iqn.2015-10.com.dell:b -o delete -I default",
+		"-m discoverydb -t st -p 192.168.1.12:3260 -o delete",
+	} {
+		if !strings.Contains(args, expected) {
+			t.Errorf("Expected the rollback to run %q but got:\n%s", expected, args)
+		}
+	}
+	if strings.Contains(args, "iqn.2015-10.com.dell:old -o delete") {
+		t.Errorf("Expected the node record existing before the discovery to be kept but got:\n%s", args)
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	defaultVersion, defaultCommit := version, commit
+	defer func() { version, commit = defaultVersion, defaultCommit }()
+
+	info := BuildInfo{}
+	fillBuildInfo(&info, &debug.BuildInfo{
+		Main:     debug.Module{Path: "github.com/dell/csi-powerstore", Version: "v2.10.0"},
+		Deps:     []*debug.Module{{Path: modulePath, Version: "v1.12.0"}},
+		Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "0123abc"}},
+	})
+	if info.Version != "v1.12.0" || info.Commit != "" {
+		t.Errorf("Expected the version of the dependency without the commit of the driver but got %+v", info)
+	}
+	info = BuildInfo{}
+	fillBuildInfo(&info, &debug.BuildInfo{
+		Main:     debug.Module{Path: modulePath, Version: "(devel)"},
+		Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "0123abc"}},
+	})
+	if info.Version != "(devel)" || info.Commit != "0123abc" {
+		t.Errorf("Expected the version and commit of the main module but got %+v", info)
+	}
+
+	version, commit = "v1.13.0", "4567def"
+	info = GetBuildInfo()
+	if info.Version != "v1.13.0" || Version() != "v1.13.0" || info.Commit != "4567def" {
+		t.Errorf("Expected the version and commit set at build time but got %+v", info)
+	}
+	if !slices.IsSorted(info.Capabilities) || !slices.Contains(Capabilities(), "ibft") {
+		t.Errorf("Unexpected capabilities %v", info.Capabilities)
+	}
+}
+
+func TestInitiatorFingerprint(t *testing.T) {
+	reset()
+	defaultNetdevs, defaultHostname := hostNetdevs, hostname
+	defer func() { hostNetdevs, hostname = defaultNetdevs, defaultHostname }()
+	hostNetdevs = func() (map[string]hostNetdev, error) {
+		return map[string]hostNetdev{"ens1f0": {hwAddress: "00:50:56:A1:B2:C3"}, "ens1f1": {hwAddress: "00:50:56:a1:b2:c4"}}, nil
+	}
+	hostname = func() (string, error) { return "node1", nil }
+	log := fakeISCSIAdm(t, `echo "default tcp,<empty>,<empty>,<empty>,<empty>"
+echo "iface1 tcp,<empty>,10.0.0.5,ens1f0,<empty>"
+echo "iface2 tcp,00:50:56:a1:b2:c4,10.0.1.5,ens1f1,<empty>"`)
+	journal := filepath.Join(t.TempDir(), "journal.log")
+	c := NewLinuxISCSI(map[string]string{JournalFile: journal})
+	c.SetInitiatorOverride("iqn.1993-08.org.debian:01:node1")
+
+	f, err := c.GetInitiatorFingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.IQN != "iqn.1993-08.org.debian:01:node1" || f.Hostname != "node1" ||
+		!slices.Equal(f.MACs, []string{"00:50:56:a1:b2:c3", "00:50:56:a1:b2:c4"}) || len(f.ID) != 16 {
+		t.Errorf("Unexpected fingerprint %+v", f)
+	}
+	if again, _ := c.GetInitiatorFingerprint(); again.ID != f.ID {
+		t.Errorf("Expected a stable fingerprint but got %s and %s", f, again)
+	}
+	hostname = func() (string, error) { return "node2", nil }
+	if other, _ := c.GetInitiatorFingerprint(); other.ID == f.ID {
+		t.Errorf("Expected another fingerprint on another host but got %s", other)
+	}
+	hostname = func() (string, error) { return "node1", nil }
+
+	// the journal entries carry the ID, the ifaces being listed once
+	_ = c.DeleteNode(ISCSITarget{Portal: "1.1.1.1", Target: "iqn.2015-10.com.dell:a"})
+	_ = c.DeleteNode(ISCSITarget{Portal: "1.1.1.1", Target: "iqn.2015-10.com.dell:b"})
+	lines, err := os.ReadFile(journal) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(lines), `"initiator":"`+f.ID+`"`); n != 2 {
+		t.Errorf("Expected the fingerprint in the 2 journal entries but got:\n%s", lines)
+	}
+	args, _ := os.ReadFile(log) // #nosec G304
+	if n := strings.Count(string(args), "-m iface\n"); n != 4 {
+		t.Errorf("Expected the ifaces listed for the 3 fingerprints and once for the 2 journal entries but got:\n%s", args)
+	}
+
+	// the diagnostic bundle carries the fingerprint
+	mock := NewMockISCSI(map[string]string{})
+	bundle, err := CaptureDiagnostics(mock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed DiagnosticBundle
+	if err := json.Unmarshal(bundle, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Initiator == nil || parsed.Initiator.Hostname != mockHostname || parsed.Initiator.IQN == "" {
+		t.Errorf("Expected the fingerprint of the mock in the bundle but got %+v", parsed.Initiator)
+	}
+}
+
+func TestValidateIfaces(t *testing.T) {
+	reset()
+	defaultNetdevs := hostNetdevs
+	defer func() { hostNetdevs = defaultNetdevs }()
+	hostNetdevs = func() (map[string]hostNetdev, error) {
+		return map[string]hostNetdev{
+			"lo":     {ips: []string{"127.0.0.1"}},
+			"ens1f0": {hwAddress: "00:50:56:a1:b2:c3", ips: []string{"10.0.0.5"}},
+			"ens1f1": {hwAddress: "00:50:56:a1:b2:c4", ips: []string{"10.0.1.5"}},
+		}, nil
+	}
+	fakeISCSIAdm(t, `echo "default tcp,<empty>,<empty>,<empty>,<empty>"
+echo "iser iser,<empty>,<empty>,<empty>,<empty>"
+echo "renamed tcp,00:50:56:A1:B2:C3,10.0.0.5,eth1,<empty>"
+echo "gone tcp,<empty>,<empty>,eth9,<empty>"
+echo "moved tcp,<empty>,10.0.0.9,ens1f1,<empty>"
+echo "swapped tcp,<empty>,10.0.0.5,ens1f1,<empty>"
+echo "ok tcp,00:50:56:a1:b2:c4,10.0.1.5,ens1f1,<empty>"`)
+
+	findings, err := NewLinuxISCSI(map[string]string{}).ValidateIfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []IfaceFinding{
+		{Iface: "renamed", Netdev: "eth1", HWAddress: "00:50:56:a1:b2:c3", IPAddress: "10.0.0.5", Problem: IfaceNetdevMissing,
+			Suggestion: "iscsiadm -m iface -I renamed -o update -n iface.net_ifacename -v ens1f0"},
+		{Iface: "gone", Netdev: "eth9", Problem: IfaceNetdevMissing,
+			Suggestion: "bind the iface to an existing interface or delete it: iscsiadm -m iface -I gone -o delete"},
+		{Iface: "moved", Netdev: "ens1f1", IPAddress: "10.0.0.9", Problem: IfaceIPMissing,
+			Suggestion: "iscsiadm -m iface -I moved -o update -n iface.ipaddress -v 10.0.1.5"},
+		{Iface: "swapped", Netdev: "ens1f1", IPAddress: "10.0.0.5", Problem: IfaceIPMismatch,
+			Suggestion: "iscsiadm -m iface -I swapped -o update -n iface.net_ifacename -v ens1f0"},
+	}
+	if !reflect.DeepEqual(findings, expected) {
+		t.Errorf("Expected findings\n%+v\nbut got\n%+v", expected, findings)
+	}
+	if findings, err = NewMockISCSI(map[string]string{}).ValidateIfaces(); err != nil || len(findings) != 0 {
+		t.Errorf("Expected no mock finding but got %v, %v", findings, err)
+	}
+}
+
+func TestRepairIfaceBindings(t *testing.T) {
+	reset()
+	defaultNetdevs := hostNetdevs
+	defer func() { hostNetdevs = defaultNetdevs }()
+	hostNetdevs = func() (map[string]hostNetdev, error) {
+		return map[string]hostNetdev{
+			"ens1f0": {hwAddress: "00:50:56:a1:b2:c3", ips: []string{"10.0.0.5"}},
+			"ens1f1": {hwAddress: "00:50:56:a1:b2:c4", ips: []string{"10.0.1.5"}},
+		}, nil
+	}
+	log := fakeISCSIAdm(t, `case "$*" in
+"-m iface") echo "default tcp,<empty>,<empty>,<empty>,<empty>"
+  echo "replaced tcp,00:50:56:aa:aa:aa,10.0.0.5,eth1,<empty>"
+  echo "swapped tcp,<empty>,10.0.0.5,ens1f1,<empty>"
+  echo "newmac tcp,00:50:56:aa:aa:ab,10.0.1.5,<empty>,<empty>"
+  echo "moved tcp,<empty>,10.0.0.9,ens1f1,<empty>"
+  echo "ok tcp,00:50:56:A1:B2:C4,10.0.1.5,ens1f1,<empty>";;
+*"-I swapped -o update"*) exit 7;;
+esac`)
+	c := NewLinuxISCSI(map[string]string{})
+
+	expected := []IfaceRepair{
+		{Iface: "replaced", Problem: IfaceNetdevMissing,
+			Params: map[string]string{"iface.net_ifacename": "ens1f0", "iface.hwaddress": "00:50:56:a1:b2:c3"}},
+		{Iface: "swapped", Problem: IfaceIPMismatch, Params: map[string]string{"iface.net_ifacename": "ens1f0"}},
+		{Iface: "newmac", Problem: IfaceHWAddressMissing, Params: map[string]string{"iface.hwaddress": "00:50:56:a1:b2:c4"}},
+	}
+	repairs, err := c.RepairIfaceBindings(true)
+	if err != nil || !reflect.DeepEqual(repairs, expected) {
+		t.Fatalf("Expected the repairs\n%+v\nbut got\n%+v, %v", expected, repairs, err)
+	}
+	if args, _ := os.ReadFile(log); strings.Contains(string(args), "-o update") {
+		t.Errorf("Expected no update in dry run mode but got:\n%s", args)
+	}
+
+	if repairs, err = c.RepairIfaceBindings(false); err != nil || len(repairs) != 3 {
+		t.Fatalf("Unexpected repairs %+v, %v", repairs, err)
+	}
+	if !repairs[0].Applied || repairs[0].Error != nil || repairs[1].Applied || repairs[1].Error == nil || !repairs[2].Applied {
+		t.Errorf("Expected the update of swapped only to fail but got %+v", repairs)
+	}
+	args, _ := os.ReadFile(log)
+	for _, expected := range []string{
+		"-m iface -I replaced -o update -n iface.hwaddress -v 00:50:56:a1:b2:c3\n" +
+			"-m iface -I replaced -o update -n iface.net_ifacename -v ens1f0\n",
+		"-m iface -I newmac -o update -n iface.hwaddress -v 00:50:56:a1:b2:c4\n",
+	} {
+		if !strings.Contains(string(args), expected) {
+			t.Errorf("Expected %q but got:\n%s", expected, args)
+		}
+	}
+
+	if repairs, err = NewMockISCSI(map[string]string{}).RepairIfaceBindings(false); err != nil || len(repairs) != 0 {
+		t.Errorf("Expected no mock repair but got %+v, %v", repairs, err)
+	}
+}
+
+func TestReadCache(t *testing.T) {
+	reset()
+	defaultDir := nodeMetadataDir
+	defer func() { nodeMetadataDir = defaultDir }()
+	nodeMetadataDir = t.TempDir()
+	log := fakeISCSIAdm(t, `case "$*" in
+"-m node -o show") echo "# BEGIN RECORD 2.1.8"; echo "node.name = iqn.2015-10.com.dell:a"; echo "# END RECORD";;
+esac`)
+	runs := func(command string) int {
+		data, _ := os.ReadFile(log)
+		return strings.Count(string(data), command+"\n")
+	}
+	c := NewLinuxISCSI(map[string]string{SessionSource: "iscsiadm", SessionCacheTTL: "5s", NodeCacheTTL: "1m"})
+	clock := NewFakeClock(time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC))
+	c.SetClock(clock)
+
+	nodes, err := c.GetNodes()
+	if err != nil || len(nodes) != 1 {
+		t.Fatalf("Unexpected nodes %v, %v", nodes, err)
+	}
+	nodes[0].Fields["node.name"] = "changed"
+	if nodes, _ = c.GetNodes(); nodes[0].Fields["node.name"] != "iqn.2015-10.com.dell:a" || runs("-m node -o show") != 1 {
+		t.Errorf("Expected an unchanged copy of the cached nodes but got %v after %d runs", nodes, runs("-m node -o show"))
+	}
+	clock.Sleep(time.Minute)
+	_, _ = c.GetNodes()
+	if runs("-m node -o show") != 2 {
+		t.Errorf("Expected the nodes to be read again after the TTL but got %d runs", runs("-m node -o show"))
+	}
+	target := ISCSITarget{Portal: "192.168.1.12:3260", Target: "iqn.2015-10.com.dell:a"}
+	if err = c.CreateOrUpdateNode(target, map[string]string{"node.session.scan": "manual"}); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = c.GetNodes()
+	if runs("-m node -o show") != 3 {
+		t.Errorf("Expected the node update to invalidate the cache but got %d runs", runs("-m node -o show"))
+	}
+
+	for range 3 {
+		if _, err = c.GetSessions(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if runs("-m session -P 2 -S") != 1 {
+		t.Errorf("Expected the sessions to be read once but got %d runs", runs("-m session -P 2 -S"))
+	}
+	c.Invalidate()
+	_, _ = c.GetSessions()
+	if runs("-m session -P 2 -S") != 2 {
+		t.Errorf("Expected Invalidate to drop the cached sessions but got %d runs", runs("-m session -P 2 -S"))
+	}
+	_ = c.PerformLogout(target)
+	before := runs("-m session -P 2 -S")
+	_, _ = c.GetSessions()
+	if runs("-m session -P 2 -S") != before+1 {
+		t.Errorf("Expected the logout to invalidate the cached sessions")
+	}
+	// the operations deciding on the sessions read them past the cache
+	before = runs("-m session -P 2 -S")
+	_ = c.WaitForSessionState("12", ISCSISessionStateLOGGEDIN, 0)
+	_, _ = c.GetHCTLsForTarget(target)
+	_, _ = c.ResolveDevicePaths(target, 0)
+	_, _ = c.DetectResizedDevices(target)
+	if runs("-m session -P 2 -S") != before+4 {
+		t.Errorf("Expected the sessions to be read past the cache but got %d runs", runs("-m session -P 2 -S")-before)
+	}
+}
+
+func TestPaths(t *testing.T) {
+	reset()
+	root := t.TempDir()
+	write := func(path, content string) {
+		if err := os.MkdirAll(filepath.Dir(root+path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(root+path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("/opt/iscsi/initiatorname.iscsi", "InitiatorName=iqn.1993-08.org.debian:01:custom\n")
+	write("/opt/iscsi/iscsid.conf", "node.startup = manual\n")
+	write("/opt/iscsi/db/iqn.2015-10.com.dell:a/192.168.1.2,3260,1/default", "node.startup = manual\n")
+
+	c, err := NewLinuxISCSIFromConfig(Config{
+		Chroot:  root,
+		Options: map[string]string{NodeSource: "db"},
+		Paths: Paths{
+			InitiatorNameFile:           "/opt/iscsi/initiatorname.iscsi",
+			AlternateInitiatorNameFiles: []string{},
+			IscsidConf:                  "/opt/iscsi/iscsid.conf",
+			NodeDBDirs:                  []string{"/opt/iscsi/db"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	iqns, err := c.GetInitiators("")
+	if err != nil || !reflect.DeepEqual(iqns, []string{"iqn.1993-08.org.debian:01:custom"}) {
+		t.Errorf("Expected the initiator of the relocated file but got %v, %v", iqns, err)
+	}
+	report, err := c.GetAllInitiators()
+	if err != nil || len(report.Files) != 1 || report.Files[0].Path != root+"/opt/iscsi/initiatorname.iscsi" {
+		t.Errorf("Expected the relocated initiator name file only but got %+v, %v", report, err)
+	}
+	conf, err := c.readIscsidConf()
+	if err != nil || conf["node.startup"] != "manual" {
+		t.Errorf("Expected the relocated iscsid.conf but got %v, %v", conf, err)
+	}
+	nodes, err := c.GetNodes()
+	if err != nil || len(nodes) != 1 || nodes[0].Target != "iqn.2015-10.com.dell:a" {
+		t.Errorf("Expected the record of the relocated node database but got %v, %v", nodes, err)
+	}
+	if paths := c.getPaths(); paths.MetadataDir != nodeMetadataDir {
+		t.Errorf("Expected the unset metadata directory to keep its default but got %s", paths.MetadataDir)
+	}
+
+	c.SetPaths(Paths{})
+	if !reflect.DeepEqual(c.getPaths(), DefaultPaths()) || DefaultPaths().InitiatorNameFile != DefaultInitiatorNameFile {
+		t.Errorf("Expected the default paths but got %+v", c.getPaths())
+	}
+}
+
+func TestMockInducedErrors(t *testing.T) {
+	target := ISCSITarget{Portal: "192.168.1.1", Target: "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a0"}
+	for _, induce := range []bool{true, false} {
+		t.Run(fmt.Sprintf("induced=%t", induce), func(t *testing.T) {
+			t.Parallel()
+			c := NewMockISCSI(map[string]string{})
+			c.Induced = MockInducedErrors{InduceLoginError: induce, InduceGetSessionsError: induce}
+			for range 50 {
+				if err := c.PerformLogin(target); (err != nil) != induce {
+					t.Errorf("Expected a login error %t but got %v", induce, err)
+				}
+				if _, err := c.GetSessions(); (err != nil) != induce {
+					t.Errorf("Expected a sessions error %t but got %v", induce, err)
+				}
+			}
+		})
+	}
+}
+
+func TestHostLock(t *testing.T) {
+	reset()
+	root := t.TempDir()
+	record := root + "/etc/iscsi/nodes/iqn.2015-10.com.dell:a/192.168.1.2,3260,1/default"
+	if err := os.MkdirAll(filepath.Dir(record), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(record, []byte("node.startup = manual\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewLinuxISCSIFromConfig(Config{
+		Chroot:  root,
+		Options: map[string]string{NodeSource: "db", HostLock: "true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetClock(NewFakeClock(time.Now()))
+	writeFile := root + "/run/lock/iscsi/lock.write"
+	err = c.WithHostLock(context.Background(), func() error {
+		if _, err := os.Stat(writeFile); err != nil {
+			t.Errorf("Expected the lock to be held while running the function but got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(writeFile); !os.IsNotExist(err) {
+		t.Errorf("Expected the lock to be released but got %v", err)
+	}
+	if nodes, err := c.GetNodes(); err != nil || len(nodes) != 1 {
+		t.Errorf("Expected the node database to be read holding the lock but got %v, %v", nodes, err)
+	}
+
+	// another tool holding the lock
+	if err = os.Link(root+"/run/lock/iscsi/lock", writeFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.GetNodes(); !errors.Is(err, ErrHostLockTimeout) {
+		t.Errorf("Expected the read to time out waiting for the lock but got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = c.WithHostLock(ctx, func() error { return nil })
+	if goiscsierrors.CategoryOf(err) != goiscsierrors.Timeout {
+		t.Errorf("Expected a timeout once the context is done but got %v", err)
+	}
+}
+
+func TestAuditTargetSource(t *testing.T) {
+	reset()
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	expected := []ISCSITarget{
+		{Target: target, Portal: "192.168.1.12:3260"},
+		{Target: target, Portal: "192.168.1.13"},
+		{Target: target, Portal: "192.168.1.14:3260", Iface: "iface1"},
+	}
+	nodes := []ISCSINode{
+		{Target: target, Portal: "192.168.1.12:3260", Fields: map[string]string{"iface.iscsi_ifacename": "default"}},
+		{Target: target, Portal: "192.168.1.13:3260", Fields: map[string]string{"iface.iscsi_ifacename": "default"}},
+	}
+	sessions := []ISCSISession{
+		{Target: target, Portal: "192.168.1.12:3260", SID: "1", IfaceName: "default"},
+		{Target: target, Portal: "192.168.1.15:3260", SID: "2", IfaceName: "default"},
+		{Target: "iqn.2015-10.com.other:b", Portal: "192.168.2.12:3260", SID: "3", IfaceName: "default"},
+	}
+	mock := NewMockISCSI(map[string]string{})
+	mock.GetNodesFn = func() ([]ISCSINode, error) { return nodes, nil }
+	mock.GetSessionsFn = func() ([]ISCSISession, error) { return sessions, nil }
+	findings, err := mock.AuditTargetSource(TargetSourceFunc(func() ([]ISCSITarget, error) { return expected, nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range findings {
+		got = append(got, string(f.Kind)+" "+f.Target.Portal+" "+f.SID)
+		if f.Message == "" {
+			t.Errorf("Expected a message for %v", f)
+		}
+	}
+	want := []string{
+		"ExpectedTargetWithoutSession 192.168.1.13 ",
+		"ExpectedTargetWithoutNode 192.168.1.14:3260 ",
+		"UnexpectedSession 192.168.1.15:3260 2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected findings %v but got %v", want, got)
+	}
+
+	_, err = mock.AuditTargetSource(TargetSourceFunc(func() ([]ISCSITarget, error) { return nil, errors.New("array unreachable") }))
+	if err == nil || err.Error() != "array unreachable" {
+		t.Errorf("Expected the error of the target source but got %v", err)
+	}
+}
+
+func TestExitCodeFromError(t *testing.T) {
+	reset()
+	fakeISCSIAdm(t, "exit 28")
+	c := NewLinuxISCSI(map[string]string{})
+	err := c.DeleteNode(ISCSITarget{Portal: "1.1.1.1", Target: "iqn.2015-10.com.dell:a"})
+	if code, ok := ExitCodeFromError(err); !ok || code != ExitBusy {
+		t.Errorf("Expected ExitBusy but got %v, %v from %v", code, ok, err)
+	}
+	fakeISCSIAdm(t, "exit 24")
+	err = c.DeleteNode(ISCSITarget{Portal: "1.1.1.1", Target: "iqn.2015-10.com.dell:a"})
+	if code, ok := ExitCodeFromError(err); !ok || code != ExitAuthFailure || code.String() != "login authentication failure" {
+		t.Errorf("Expected ExitAuthFailure but got %v, %v from %v", code, ok, err)
+	}
+	if _, ok := ExitCodeFromError(c.DeleteNode(ISCSITarget{Portal: "bad"})); ok {
+		t.Error("Expected no exit code for a validation error")
+	}
+	if ExitSessionExists != 15 || ExitCode(99).String() != "exit code 99" {
+		t.Errorf("Unexpected exit code %d, %s", ExitSessionExists, ExitCode(99))
+	}
+}
+
+func TestAuthFailuresNotRetried(t *testing.T) {
+	reset()
+	defaultDir := nodeMetadataDir
+	defer func() { nodeMetadataDir = defaultDir }()
+	nodeMetadataDir = t.TempDir()
+
+	target := ISCSITarget{Portal: "192.168.1.12:3260", Target: "iqn.2015-10.com.dell:a"}
+	for _, tc := range []struct {
+		retryAuth bool
+		commands  int
+	}{{false, 1}, {true, 3}} {
+		executor := &scriptedExecutor{failures: []int{24, 24, 24}}
+		c, err := NewLinuxISCSIFromConfig(Config{
+			RetryPolicy: RetryPolicy{Attempts: 3, Delay: time.Second, RetryAuthFailures: tc.retryAuth},
+			Executor:    executor,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetClock(NewFakeClock(time.Now()))
+		if err = c.DeleteNode(target); !errors.Is(err, goiscsierrors.Auth) {
+			t.Errorf("Expected an auth error but got %v", err)
+		}
+		if len(executor.commands) != tc.commands {
+			t.Errorf("Expected %d runs with RetryAuthFailures %t but got %d", tc.commands, tc.retryAuth, len(executor.commands))
+		}
+	}
+
+	// older iscsiadm versions report the rejected logins with a generic exit code
+	_, err := exec.Command("/bin/sh", "-c",
+		"echo 'iscsiadm: initiator reported error (24 - iSCSI login failed due to authorization failure)' >&2; exit 19").Output()
+	err = classifyCommandError(context.Background(), err)
+	if !errors.Is(err, goiscsierrors.Auth) || IsRetryableError(err) {
+		t.Errorf("Expected a non-retryable auth error but got %v", err)
+	}
+	if !IsRetryableError(goiscsierrors.New(goiscsierrors.Transport, "connection refused")) {
+		t.Error("Expected the transport errors to be retryable")
+	}
+}
+
+func TestUpdateLiveSessionParam(t *testing.T) {
+	reset()
+	defaultRoot := sysfsRoot
+	defer func() { sysfsRoot = defaultRoot }()
+	sysfsRoot = t.TempDir()
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": "iqn.2015-10.com.dell:a", "recovery_tmo": "120"})
+	for _, dir := range []string{"devices/platform/host3/session12/target3:0:0/3:0:0:1/block/sdb", "block/sdb/device"} {
+		if err := os.MkdirAll(sysfsRoot+"/"+dir, 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := NewLinuxISCSI(map[string]string{})
+	if err := c.UpdateLiveSessionParam("12", "node.session.timeo.replacement_timeout", "15"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(sysfsRoot + "/class/iscsi_session/session12/recovery_tmo"); string(data) != "15" {
+		t.Errorf("Expected the recovery timeout of the session to be 15 but got %q", data)
+	}
+	if err := c.UpdateLiveSessionParam("12", "node.session.queue_depth", "64"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(sysfsRoot + "/block/sdb/device/queue_depth"); string(data) != "64" {
+		t.Errorf("Expected the queue depth of the LUN to be 64 but got %q", data)
+	}
+
+	for _, tc := range []struct {
+		sid, param, value string
+		category          goiscsierrors.Category
+	}{
+		{"12", "node.startup", "manual", goiscsierrors.Validation},
+		{"12", "node.session.queue_depth", "-1", goiscsierrors.Validation},
+		{"x", "node.session.queue_depth", "64", goiscsierrors.Validation},
+		{"13", "node.session.queue_depth", "64", goiscsierrors.NotFound},
+	} {
+		if err := c.UpdateLiveSessionParam(tc.sid, tc.param, tc.value); goiscsierrors.CategoryOf(err) != tc.category {
+			t.Errorf("Expected a %s error updating %s of session %s to %s but got %v", tc.category, tc.param, tc.sid, tc.value, err)
+		}
+	}
+
+	mock := NewMockISCSI(map[string]string{})
+	if err := mock.UpdateLiveSessionParam("1", "node.session.timeo.replacement_timeout", "15"); err != nil {
+		t.Errorf("Expected the mocked session to be updated but got %v", err)
+	}
+	if err := mock.UpdateLiveSessionParam("2", "node.session.timeo.replacement_timeout", "15"); !errors.Is(err, goiscsierrors.NotFound) {
+		t.Errorf("Expected an unknown mocked session to be reported but got %v", err)
+	}
+	mock.Induced.InduceUpdateSessionParamError = true
+	if err := mock.UpdateLiveSessionParam("1", "node.session.timeo.replacement_timeout", "15"); err == nil {
+		t.Error("Expected an induced error")
+	}
+}
+
+func TestOpenISCSIJSON(t *testing.T) {
+	reset()
+	state := &State{
+		Sessions: []ISCSISession{{
+			SID: "3", Target: "iqn.2015-10.com.dell:a", Portal: "192.168.1.12:3260", GroupTag: "1",
+			EffectivePortal: "192.168.1.13:3261", ISCSISessionState: ISCSISessionStateLOGGEDIN,
+			IfaceName: "default", IfaceTransport: ISCSITransportNameTCP, Username: "user", Password: "secret",
+		}},
+		Nodes: []ISCSINode{{Target: "iqn.2015-10.com.dell:a", Portal: "192.168.1.12", Fields: map[string]string{
+			"node.startup": "manual", "node.session.auth.password": "secret", NodeMetadataPrefix + "volume": "vol1",
+		}}},
+	}
+	var buf bytes.Buffer
+	if err := state.WriteOpenISCSIJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Sessions []map[string]interface{} `json:"sessions"`
+		Nodes    []map[string]string      `json:"nodes"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil || len(out.Sessions) != 1 || len(out.Nodes) != 1 {
+		t.Fatalf("Unexpected open-iscsi JSON %s, %v", buf.String(), err)
+	}
+	session := out.Sessions[0]
+	for key, value := range map[string]interface{}{
+		"sid": 3.0, "target_name": "iqn.2015-10.com.dell:a", "address": "192.168.1.13", "port": 3261.0,
+		"persistent_address": "192.168.1.12", "persistent_port": 3260.0, "tpgt": 1.0, "password": "********",
+	} {
+		if session[key] != value {
+			t.Errorf("Expected session %s to be %v but got %v", key, value, session[key])
+		}
+	}
+	if iface, _ := session["iface"].(map[string]interface{}); iface["transport_name"] != "tcp" {
+		t.Errorf("Expected the iface of the session but got %v", session["iface"])
+	}
+	expected := map[string]string{
+		"node.name": "iqn.2015-10.com.dell:a", "node.conn[0].address": "192.168.1.12", "node.conn[0].port": "3260",
+		"node.startup": "manual", "node.session.auth.password": "********",
+	}
+	if !reflect.DeepEqual(out.Nodes[0], expected) {
+		t.Errorf("Expected node %v but got %v", expected, out.Nodes[0])
+	}
+}
+
+func TestLogoutFlush(t *testing.T) {
+	reset()
+	defaultRoot, defaultDev, defaultFlush := sysfsRoot, devRoot, flushBlockDevice
+	defer func() { sysfsRoot, devRoot, flushBlockDevice = defaultRoot, defaultDev, defaultFlush }()
+	sysfsRoot, devRoot = t.TempDir(), "/dev"
+	target := "iqn.2015-10.com.dell:dellemc-foobar-123-a-7ceb34a3"
+	makeSysfsSession(t, "host3", "12", map[string]string{"targetname": target, "state": "LOGGED_IN"})
+	for _, dir := range []string{
+		"devices/platform/host3/session12/target3:0:0/3:0:0:1/block/sdb",
+		"block/sdb/holders/dm-0",
+		"block/dm-0/dm",
+	} {
+		if err := os.MkdirAll(sysfsRoot+"/"+dir, 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(sysfsRoot+"/block/dm-0/dm/uuid", []byte("mpath-368ccf098\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var flushed []string
+	flushBlockDevice = func(path string) error {
+		flushed = append(flushed, path)
+		return nil
+	}
+	c := NewLinuxISCSI(map[string]string{})
+	notInstalled := "exec: \"iscsiadm\": executable file not found in $PATH"
+	err := c.PerformLogoutWithOptions(ISCSITarget{Target: target, Portal: "192.168.1.12"}, LogoutOptions{Flush: true})
+	if err == nil || err.Error() != notInstalled {
+		t.Errorf("Expected the logout to run after the flush but got %v", err)
+	}
+	if expected := []string{"/dev/dm-0", "/dev/sdb"}; !reflect.DeepEqual(flushed, expected) {
+		t.Errorf("Expected the multipath device then its path to be flushed, %v, but got %v", expected, flushed)
+	}
+
+	// a failed or stuck flush skips the logout
+	flushBlockDevice = func(string) error { return syscall.EIO }
+	err = c.PerformLogoutWithOptions(ISCSITarget{Target: target, Portal: "192.168.1.12"}, LogoutOptions{Flush: true})
+	if !errors.Is(err, syscall.EIO) {
+		t.Errorf("Expected the flush error but got %v", err)
+	}
+	release, released := make(chan struct{}), make(chan struct{})
+	flushBlockDevice = func(string) error {
+		<-release
+		defer close(released)
+		// the device fails the flush, which ends it
+		return syscall.EIO
+	}
+	err = c.PerformLogoutWithOptions(ISCSITarget{Target: target, Portal: "192.168.1.12"},
+		LogoutOptions{Flush: true, FlushTimeout: 10 * time.Millisecond})
+	if !errors.Is(err, ErrFlushTimeout) {
+		t.Errorf("Expected the flush to time out but got %v", err)
+	}
+	// the stuck flush ends before the globals are restored
+	close(release)
+	<-released
+}
+
+func TestCallChroot(t *testing.T) {
+	reset()
+	defaultDir := nodeMetadataDir
+	defer func() { nodeMetadataDir = defaultDir }()
+	nodeMetadataDir = t.TempDir()
+
+	host, containerA, containerB := t.TempDir(), t.TempDir(), t.TempDir()
+	executor := &scriptedExecutor{}
+	c, err := NewLinuxISCSIFromConfig(Config{Chroot: host, Executor: executor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := ISCSITarget{Portal: "192.168.1.12:3260", Target: "iqn.2015-10.com.dell:a"}
+	chrootOf := func(op string) []string {
+		var chroots []string
+		for _, args := range executor.commands {
+			if slices.Contains(args, op) {
+				chroots = append(chroots, commandChroot(args))
+			}
+		}
+		executor.commands = nil
+		return chroots
+	}
+	if err = c.PerformLoginWithOptions(target, LoginOptions{Chroot: containerA}); err != nil {
+		t.Fatal(err)
+	}
+	if got := chrootOf("-l"); !reflect.DeepEqual(got, []string{containerA}) {
+		t.Errorf("Expected the login to run in the chroot of the call but got %v", got)
+	}
+	if err = c.PerformLogin(target); err != nil {
+		t.Fatal(err)
+	}
+	if got := chrootOf("-l"); !reflect.DeepEqual(got, []string{host}) {
+		t.Errorf("Expected the next login to run in the chroot of the client but got %v", got)
+	}
+	if err = c.PerformLogoutWithOptions(target, LogoutOptions{Chroot: "/"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := chrootOf("--logout"); !reflect.DeepEqual(got, []string{"/"}) {
+		t.Errorf("Expected the logout to run without chroot but got %v", got)
+	}
+	if _, err = c.DiscoverTargetsWithOptions("192.168.1.12", DiscoveryOptions{Chroot: containerB}); err != nil {
+		t.Fatal(err)
+	}
+	if got := chrootOf("discovery"); !reflect.DeepEqual(got, []string{containerB}) {
+		t.Errorf("Expected the discovery to run in the chroot of the call but got %v", got)
+	}
+	for _, dir := range []string{"containers/a", containerA + "/missing"} {
+		err = c.PerformLoginWithOptions(target, LoginOptions{Chroot: dir})
+		if !errors.Is(err, goiscsierrors.Validation) || len(executor.commands) != 0 {
+			t.Errorf("Expected the chroot %s to be rejected before running iscsiadm but got %v, %v", dir, err, executor.commands)
+		}
+	}
+}
+
+func TestDiscoverTargetsDeletesFilteredNodes(t *testing.T) {
+	reset()
+	// the foreign target b had a node record before the discovery, the foreign target c did not
+	nodes := filepath.Join(t.TempDir(), "nodes")
+	record := "# BEGIN RECORD 2.1.8\nnode.name = iqn.1992-04.com.other:b\nnode.tpgt = 1\nnode.conn[0].address = 192.168.1.12\n" +
+		"node.conn[0].port = 3260\niface.iscsi_ifacename = default\n# END RECORD\n"
+	if err := os.WriteFile(nodes, []byte(record), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	log := fakeISCSIAdm(t, `case "$*" in
+*"-o show"*) /bin/cat `+nodes+`;;
+*"-m discovery"*) echo "192.168.1.12:3260,1 iqn.2015-10.com.dell:a"; echo "192.168.1.12:3260,1 iqn.1992-04.com.other:b"
+echo "192.168.1.12:3260,1 iqn.1992-04.com.other:c";;
+esac`)
+
+	c := NewLinuxISCSI(map[string]string{TargetFilterPrefixes: "iqn.2015-10.com.dell"})
+	targets, err := c.DiscoverTargets("192.168.1.12", false)
+	if err != nil || len(targets) != 1 || targets[0].Target != "iqn.2015-10.com.dell:a" {
+		t.Fatalf("Expected the dell target only but got %v, %v", targets, err)
+	}
+	args, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deletes []string
+	for _, line := range strings.Split(string(args), "\n") {
+		if strings.HasSuffix(line, "-o delete") {
+			deletes = append(deletes, line)
+		}
+	}
+	if len(deletes) != 1 || !strings.Contains(deletes[0], "-T iqn.1992-04.com.other:c -p 192.168.1.12:3260 -I default") {
+		t.Errorf("Expected the node record of the target c only to be deleted but got %q", deletes)
+	}
+
+	// without a filter the node records are neither listed nor deleted
+	if err = os.Truncate(log, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewLinuxISCSI(map[string]string{}).DiscoverTargets("192.168.1.12", false); err != nil {
+		t.Fatal(err)
+	}
+	if args, err = os.ReadFile(log); err != nil || strings.Contains(string(args), "-o show") || strings.Contains(string(args), "-o delete") {
+		t.Errorf("Expected no node record access without a filter but got %q, %v", args, err)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+// TimeoutError is returned when an iscsiadm command timed out. Killed tells a hung iscsiadm, killed by the client
+// at the end of its budget, from a slow array, whose timeout iscsiadm reported itself.
+// It matches goiscsierrors.Timeout, and ErrProcessKilled if the ProcessLifetime option killed the process.
+type TimeoutError struct {
+	// Op is the iscsiadm operation, e.g. node login
+	Op string
+	// Budget is the time the command was given by the timeout of the operation or the ProcessLifetime option,
+	// 0 if unbounded
+	Budget time.Duration
+	// Elapsed is how long the command ran
+	Elapsed time.Duration
+	// Killed is true if the client killed the iscsiadm process, false if iscsiadm exited with a timeout
+	Killed bool
+	Err    error
+}
+
+func (e *TimeoutError) Error() string {
+	cause := "reported by iscsiadm"
+	if e.Killed {
+		cause = "iscsiadm killed"
+	}
+	budget := "unbounded"
+	if e.Budget > 0 {
+		budget = "budget " + e.Budget.String()
+	}
+	return fmt.Sprintf("%s timed out after %s (%s, %s): %v", e.Op, e.Elapsed.Round(time.Millisecond), budget, cause, e.Err)
+}
+
+// Unwrap returns the error of the command
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// timeoutError returns err, the classified error of the command exe run with ctx for elapsed, as a TimeoutError if
+// the command timed out
+func (iscsi *LinuxISCSI) timeoutError(ctx context.Context, exe []string, elapsed time.Duration, err error) error {
+	if !errors.Is(err, goiscsierrors.Timeout) {
+		return err
+	}
+	e := &TimeoutError{Op: commandOperation(exe), Elapsed: elapsed, Err: err}
+	if _, ok := ctx.Deadline(); ok {
+		e.Budget = iscsi.callTimeout(ctx)
+	}
+	switch {
+	case errors.Is(err, ErrProcessKilled):
+		e.Killed = true
+		e.Budget, _ = time.ParseDuration(iscsi.getOptions()[ProcessLifetime])
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		// the process, if it started, was killed by its context
+		var exitErr *exec.ExitError
+		e.Killed = errors.As(err, &exitErr)
+	}
+	return e
+}
@@ -0,0 +1,81 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"net"
+	"strings"
+)
+
+const (
+	// TopologyProtocolSuffix is appended to the array ID in the topology key, as in "<driver>/<array>-iscsi"
+	TopologyProtocolSuffix = "-iscsi"
+	// TopologyValue is the value of the topology segment of a reachable array
+	TopologyValue = "true"
+	// maxTopologyNameLength is the maximum length of the name part of a label key
+	maxTopologyNameLength = 63
+)
+
+// TopologySegments returns the CSI topology segments for the arrays reachable over iSCSI,
+// in the "<driverName>/<arrayID>-iscsi": "true" form used by the Dell CSI drivers.
+// arrays maps a target IQN or portal address (with or without port) to the ID of its array;
+// an array is reachable when at least one of its sessions is logged in.
+func TopologySegments(driverName string, sessions []ISCSISession, arrays map[string]string) map[string]string {
+	segments := make(map[string]string)
+	for _, s := range sessions {
+		if s.ISCSISessionState != ISCSISessionStateLOGGEDIN {
+			continue
+		}
+		arrayID := sessionArrayID(s, arrays)
+		if arrayID == "" {
+			continue
+		}
+		segments[TopologyKey(driverName, arrayID)] = TopologyValue
+	}
+	return segments
+}
+
+// TopologyKey returns the topology key of an array for a driver, replacing the characters
+// not allowed in a label name with '-'
+func TopologyKey(driverName, arrayID string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '-'
+	}, arrayID+TopologyProtocolSuffix)
+	if len(name) > maxTopologyNameLength {
+		name = name[len(name)-maxTopologyNameLength:]
+	}
+	return driverName + "/" + strings.Trim(name, "-_.")
+}
+
+func sessionArrayID(s ISCSISession, arrays map[string]string) string {
+	if id, ok := arrays[s.Target]; ok {
+		return id
+	}
+	if id, ok := arrays[s.Portal]; ok {
+		return id
+	}
+	if host, _, err := net.SplitHostPort(s.Portal); err == nil {
+		return arrays[host]
+	}
+	return ""
+}
@@ -0,0 +1,90 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strconv"
+)
+
+// Operations traced by a Tracer
+const (
+	SpanDiscovery = "goiscsi.discovery"
+	SpanLogin     = "goiscsi.login"
+	SpanRescan    = "goiscsi.rescan"
+	SpanWaitLUN   = "goiscsi.wait_lun"
+)
+
+// Attributes of the traced operations
+const (
+	AttributeTarget        = "iscsi.target"
+	AttributePortal        = "iscsi.portal"
+	AttributeIface         = "iscsi.iface"
+	AttributeDiscoveryType = "iscsi.discovery_type"
+	AttributeLUN           = "iscsi.lun"
+	AttributeExitCode      = "iscsiadm.exit_code"
+)
+
+// Tracer starts a span for each traced operation of a client. It is an interface so that the tracing
+// backend stays optional; the github.com/dell/goiscsi/tracing package implements it with OpenTelemetry.
+type Tracer interface {
+	// Start starts the span of an operation, as a child of the span of ctx if any
+	Start(ctx context.Context, operation string, attributes map[string]string) Span
+}
+
+// Span is the span of a traced operation
+type Span interface {
+	// SetAttribute adds an attribute to the span
+	SetAttribute(key, value string)
+	// End ends the span, recording err if the operation failed
+	End(err error)
+}
+
+// SetTracer sets the tracer of the operations of the client, nil to disable tracing
+func (i *ISCSIType) SetTracer(tracer Tracer) {
+	i.hooksMu.Lock()
+	defer i.hooksMu.Unlock()
+	i.tracer = tracer
+}
+
+// targetSpanAttributes returns the span attributes describing a target
+func targetSpanAttributes(target ISCSITarget) map[string]string {
+	return map[string]string{AttributeTarget: target.Target, AttributePortal: target.Portal, AttributeIface: target.Iface}
+}
+
+// startSpan starts the span of an operation and returns the function ending it,
+// which records the iscsiadm exit code of a failure
+func (i *ISCSIType) startSpan(operation string, attributes map[string]string) func(err error) {
+	i.hooksMu.RLock()
+	tracer := i.tracer
+	i.hooksMu.RUnlock()
+	if tracer == nil {
+		return func(error) {}
+	}
+	span := tracer.Start(context.Background(), operation, attributes)
+	return func(err error) {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			span.SetAttribute(AttributeExitCode, strconv.Itoa(exitErr.ExitCode()))
+		}
+		span.End(err)
+	}
+}
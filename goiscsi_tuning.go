@@ -0,0 +1,311 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// multipathConfFile is the configuration file of dm-multipath
+const multipathConfFile = "/etc/multipath.conf"
+
+// TuningSeverity tells how much a TuningRecommendation matters to the availability of the storage
+type TuningSeverity string
+
+const (
+	// TuningInfo is reported for a setting which is not optimal but does not put the I/O at risk
+	TuningInfo TuningSeverity = "info"
+	// TuningWarning is reported for a setting which slows down or prevents the failover of the paths
+	TuningWarning TuningSeverity = "warning"
+	// TuningCritical is reported for a setting likely to fail the I/O on a short network outage
+	TuningCritical TuningSeverity = "critical"
+)
+
+// TuningArea tells what a TuningRecommendation applies to
+type TuningArea string
+
+const (
+	// TuningAreaIscsidConf is the iscsid.conf file, whose settings the new node records take
+	TuningAreaIscsidConf TuningArea = "iscsid.conf"
+	// TuningAreaNode is the node record of a target
+	TuningAreaNode TuningArea = "node"
+	// TuningAreaDevice is the SCSI device of a LUN
+	TuningAreaDevice TuningArea = "device"
+	// TuningAreaMultipath is the dm-multipath configuration
+	TuningAreaMultipath TuningArea = "multipath"
+)
+
+// TuningRecommendation is a setting of the host which differs from the Dell best practices, found by
+// AnalyzeHostTuning
+type TuningRecommendation struct {
+	Severity TuningSeverity
+	Area     TuningArea
+	// Subject is the file, node record ("target at portal") or block device the setting belongs to
+	Subject string
+	// Parameter is the name of the setting, e.g. node.session.timeo.replacement_timeout; empty if the
+	// recommendation is about the subject as a whole
+	Parameter string
+	// Current is the value of the setting, its default if unset
+	Current string
+	// Recommended is the value of the Dell best practices
+	Recommended string
+	// Message describes the risk and how to apply the recommendation
+	Message string
+}
+
+// tuningRule checks a parameter against the Dell best practices. Its value must be within [min, max];
+// max 0 is no upper bound.
+type tuningRule struct {
+	param    string
+	min, max int
+	// def is the value of an unset parameter, the built-in default of open-iscsi or dm-multipath
+	def string
+	// below and above are the severities of a value lower than min and higher than max
+	below, above TuningSeverity
+	// risk describes the effect of a value out of the bounds
+	risk string
+}
+
+// nodeTuningRules are the node parameters checked in iscsid.conf and in the node records, from the host
+// connectivity guides of PowerStore, PowerMax and Unity, whose presets use the values within the bounds
+var nodeTuningRules = []tuningRule{
+	{
+		param: "node.session.timeo.replacement_timeout", min: 15, max: 120, def: "120", below: TuningCritical, above: TuningWarning,
+		risk: "the I/O fails on a short outage if too low, and the failover to another path waits too long if too high",
+	},
+	{
+		param: "node.conn[0].timeo.noop_out_interval", min: 5, max: 5, def: "5", below: TuningInfo, above: TuningWarning,
+		risk: "a dead connection goes unnoticed for longer if too high",
+	},
+	{
+		param: "node.conn[0].timeo.noop_out_timeout", min: 5, max: 5, def: "5", below: TuningInfo, above: TuningWarning,
+		risk: "a dead connection goes unnoticed for longer if too high",
+	},
+	{
+		param: "node.session.cmds_max", min: 128, def: "128", below: TuningInfo,
+		risk: "the throughput of the session is limited if too low",
+	},
+	{
+		param: "node.session.queue_depth", min: 32, def: "32", below: TuningInfo,
+		risk: "the throughput of the LUNs is limited if too low",
+	},
+}
+
+// deviceQueueDepthRule checks the queue depth of the SCSI devices of the sessions
+var deviceQueueDepthRule = tuningRule{
+	param: "queue_depth", min: 32, below: TuningInfo,
+	risk: "the throughput of the LUN is limited, set node.session.queue_depth and update the live sessions with UpdateLiveSessionParam",
+}
+
+// multipathTuningRules are the parameters checked in the defaults section of multipath.conf
+var multipathTuningRules = []tuningRule{
+	{
+		param: "polling_interval", min: 1, max: 5, def: "5", below: TuningInfo, above: TuningWarning,
+		risk: "a failed path is detected later if too high",
+	},
+	{
+		param: "checker_timeout", min: 1, max: 15, def: "30", below: TuningInfo, above: TuningWarning,
+		risk: "a hung path checker delays the failover if too high",
+	},
+}
+
+// recommended returns the values the rule accepts, as written in a recommendation
+func (r tuningRule) recommended() string {
+	switch {
+	case r.max == 0:
+		return fmt.Sprintf(">= %d", r.min)
+	case r.min == r.max:
+		return strconv.Itoa(r.min)
+	}
+	return fmt.Sprintf("%d-%d", r.min, r.max)
+}
+
+// check returns the recommendation for the value of the parameter of the rule, if out of its bounds. An unset value
+// is checked as the default of the rule, or not at all without default. An invalid value is reported as a warning.
+func (r tuningRule) check(area TuningArea, subject, value string) (TuningRecommendation, bool) {
+	if value == "" {
+		if value = r.def; value == "" {
+			return TuningRecommendation{}, false
+		}
+	}
+	rec := TuningRecommendation{Area: area, Subject: subject, Parameter: r.param, Current: value, Recommended: r.recommended()}
+	v, err := strconv.Atoi(value)
+	switch {
+	case err != nil:
+		rec.Severity = TuningWarning
+		rec.Message = fmt.Sprintf("%s of %s is %q, not a number: set it to %s", r.param, subject, value, rec.Recommended)
+	case v < r.min:
+		rec.Severity = r.below
+		rec.Message = fmt.Sprintf("%s of %s is %d, %s is recommended: %s", r.param, subject, v, rec.Recommended, r.risk)
+	case r.max != 0 && v > r.max:
+		rec.Severity = r.above
+		rec.Message = fmt.Sprintf("%s of %s is %d, %s is recommended: %s", r.param, subject, v, rec.Recommended, r.risk)
+	default:
+		return TuningRecommendation{}, false
+	}
+	return rec, true
+}
+
+// checkTuningRules returns the recommendations of the rules for the settings of a subject
+func checkTuningRules(rules []tuningRule, area TuningArea, subject string, settings map[string]string) []TuningRecommendation {
+	var recs []TuningRecommendation
+	for _, r := range rules {
+		if rec, ok := r.check(area, subject, replaceEmpty(settings[r.param])); ok {
+			recs = append(recs, rec)
+		}
+	}
+	return recs
+}
+
+// analyzeNodeTuning checks the node parameters of iscsid.conf, if read, and of the node records
+func analyzeNodeTuning(iscsidConf map[string]string, nodes []ISCSINode) []TuningRecommendation {
+	recs := []TuningRecommendation{}
+	if iscsidConf != nil {
+		recs = append(recs, checkTuningRules(nodeTuningRules, TuningAreaIscsidConf, "iscsid.conf", iscsidConf)...)
+	}
+	for _, n := range nodes {
+		subject := fmt.Sprintf("%s at %s", n.Target, n.Portal)
+		recs = append(recs, checkTuningRules(nodeTuningRules, TuningAreaNode, subject, n.Fields)...)
+	}
+	return recs
+}
+
+// analyzeDeviceTuning checks the queue depth of the block devices of the sessions and whether they are paths of a
+// dm-multipath device
+func (tree sysfsTree) analyzeDeviceTuning(sessions []ISCSISession) []TuningRecommendation {
+	var recs []TuningRecommendation
+	for _, s := range sessions {
+		devices := tree.sessionBlockDevices(s.SID)
+		slices.Sort(devices)
+		for _, device := range devices {
+			if rec, ok := deviceQueueDepthRule.check(TuningAreaDevice, device,
+				readSysfsAttr(tree.root, "block", device, "device", "queue_depth")); ok {
+				recs = append(recs, rec)
+			}
+			if len(tree.multipathHolders(device)) == 0 {
+				recs = append(recs, TuningRecommendation{
+					Severity: TuningWarning, Area: TuningAreaMultipath, Subject: device,
+					Message: fmt.Sprintf("block device %s of session %s to %s is not a path of a dm-multipath device, "+
+						"its I/O fails with the session instead of moving to another path", device, s.SID, s.Target),
+				})
+			}
+		}
+	}
+	return recs
+}
+
+// analyzeMultipathConf checks the defaults section of the multipath.conf file at path, or reports it missing.
+// The recommendations name the file as subject.
+func analyzeMultipathConf(path, subject string) ([]TuningRecommendation, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return []TuningRecommendation{{
+			Severity: TuningWarning, Area: TuningAreaMultipath, Subject: subject,
+			Message: "multipath.conf is missing, dm-multipath does not combine the paths of the LUNs without it",
+		}}, nil
+	}
+	if err != nil {
+		return nil, classifyFileError(err)
+	}
+	defer f.Close()
+	defaults, err := parseMultipathDefaults(f)
+	if err != nil {
+		return nil, err
+	}
+	return checkTuningRules(multipathTuningRules, TuningAreaMultipath, subject, defaults), nil
+}
+
+// parseMultipathDefaults returns the "key value" settings of the defaults section of a multipath.conf file
+func parseMultipathDefaults(r io.Reader) (map[string]string, error) {
+	settings := make(map[string]string)
+	depth, inDefaults := 0, false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexAny(line, "#!"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case strings.HasSuffix(line, "{"):
+			if depth == 0 && fields[0] == "defaults" {
+				inDefaults = true
+			}
+			depth++
+		case line == "}":
+			if depth--; depth == 0 {
+				inDefaults = false
+			}
+		case inDefaults && depth == 1 && len(fields) >= 2:
+			settings[fields[0]] = strings.Trim(strings.Join(fields[1:], " "), `"`)
+		}
+	}
+	return settings, scanner.Err()
+}
+
+// AnalyzeHostTuning compares the settings of the host with the Dell best practices and returns a recommendation for
+// each setting out of them: the node parameters of iscsid.conf and of the node records, the queue depth of the block
+// devices of the sessions, whether they are paths of dm-multipath devices, and the defaults of multipath.conf
+func (iscsi *LinuxISCSI) AnalyzeHostTuning() ([]TuningRecommendation, error) {
+	iscsidConf, err := iscsi.readIscsidConf()
+	if err != nil {
+		return nil, classifyFileError(err)
+	}
+	if iscsidConf == nil {
+		iscsi.logf("\niscsid.conf not found, only the node records are checked")
+	}
+	nodes, err := iscsi.GetNodes()
+	if err != nil {
+		return nil, err
+	}
+	recs := analyzeNodeTuning(iscsidConf, nodes)
+	sessions, err := iscsi.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+	recs = append(recs, iscsi.sysfs().analyzeDeviceTuning(sessions)...)
+	paths := iscsi.getPaths()
+	multipath, err := analyzeMultipathConf(iscsi.hostPath(context.Background(), paths.MultipathConf), paths.MultipathConf)
+	if err != nil {
+		return nil, err
+	}
+	return append(recs, multipath...), nil
+}
+
+// AnalyzeHostTuning compares the parameters of the mocked node records with the Dell best practices
+func (iscsi *MockISCSI) AnalyzeHostTuning() ([]TuningRecommendation, error) {
+	if iscsi.AnalyzeHostTuningFn != nil {
+		return iscsi.AnalyzeHostTuningFn()
+	}
+	nodes, err := iscsi.GetNodes()
+	if err != nil {
+		return nil, err
+	}
+	return analyzeNodeTuning(nil, nodes), nil
+}
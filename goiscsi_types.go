@@ -18,11 +18,126 @@
 
 package goiscsi
 
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
 // ISCSITarget defines an iSCSI target
 type ISCSITarget struct {
-	Portal   string
+	Portal string
+	// GroupTag is the target portal group tag of the portal, in decimal. When set, the logins and logouts
+	// use the node record of the portal with this tag only.
 	GroupTag string
 	Target   string
+	// Iface is the iSCSI iface the target is reached through. If empty, a login or logout
+	// applies to the node records of every iface.
+	Iface string
+	// MaxSessions is the most sessions to the target the array accepts from the initiator, as hinted
+	// by the array; 0 if unknown. Discovered targets carry the hint stored with their node records.
+	MaxSessions int
+}
+
+// GroupTag is the target portal group tag (TPGT) of a portal, a number from 0 to 65535.
+// The zero value is an unset tag.
+type GroupTag struct {
+	tag uint16
+	set bool
+}
+
+// NewGroupTag returns the group tag tag
+func NewGroupTag(tag uint16) GroupTag {
+	return GroupTag{tag: tag, set: true}
+}
+
+// ParseGroupTag parses a group tag in decimal, an empty string being an unset tag
+func ParseGroupTag(s string) (GroupTag, error) {
+	if s == "" {
+		return GroupTag{}, nil
+	}
+	tag, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return GroupTag{}, goiscsierrors.New(goiscsierrors.Validation, fmt.Sprintf("error invalid group tag %q", s))
+	}
+	return NewGroupTag(uint16(tag)), nil
+}
+
+// Value returns the group tag and whether it is set
+func (g GroupTag) Value() (uint16, bool) {
+	return g.tag, g.set
+}
+
+// IsSet reports whether the group tag is set
+func (g GroupTag) IsSet() bool {
+	return g.set
+}
+
+// String returns the group tag in decimal, or an empty string if it is unset, as the former string group tags
+func (g GroupTag) String() string {
+	if !g.set {
+		return ""
+	}
+	return strconv.Itoa(int(g.tag))
+}
+
+// MarshalText encodes the group tag as String does, e.g. as a JSON string
+func (g GroupTag) MarshalText() ([]byte, error) {
+	return []byte(g.String()), nil
+}
+
+// UnmarshalText decodes a group tag as ParseGroupTag does, rejecting invalid tags
+func (g *GroupTag) UnmarshalText(text []byte) error {
+	tag, err := ParseGroupTag(string(text))
+	if err != nil {
+		return err
+	}
+	*g = tag
+	return nil
+}
+
+// ParsedGroupTag returns the group tag of the target parsed by ParseGroupTag
+func (t ISCSITarget) ParsedGroupTag() (GroupTag, error) {
+	return ParseGroupTag(t.GroupTag)
+}
+
+// DiscoveryType holds the iSCSI discovery method
+type DiscoveryType string
+
+// iSCSI discovery methods and their default ports
+const (
+	DiscoverySendTargets DiscoveryType = "sendtargets"
+	DiscoveryISNS        DiscoveryType = "isns"
+
+	// DefaultPort is the default port of iSCSI portals and SendTargets discovery
+	DefaultPort = 3260
+	// DefaultISNSPort is the default port of iSNS servers
+	DefaultISNSPort = 3205
+)
+
+// DiscoveryOptions controls DiscoverTargetsWithOptions
+type DiscoveryOptions struct {
+	// Type is the discovery method, DiscoverySendTargets if empty
+	Type DiscoveryType
+	// Port overrides the port of the discovery address. If neither is set, the default port of Type is used.
+	Port int
+	// Login logs into the discovered targets
+	Login bool
+	// Iface binds the discovery, the node records it creates and the logins to an iSCSI iface.
+	// The discovered targets are returned with this iface.
+	Iface string
+	// Timeout bounds the iscsiadm discovery and logins, overriding the timeout of the client if set
+	Timeout time.Duration
+	// RetryPolicy overrides the retry policy of the client for the iscsiadm commands of the discovery and logins, if set
+	RetryPolicy *RetryPolicy
+	// Chroot overrides the chroot directory of the client for the discovery and logins, if set
+	Chroot string
+	// CHAP sets the credentials of a SendTargets discovery in its discovery record, if set
+	CHAP *CHAPCredentials
 }
 
 // ISCSISessionState holds iscsi session state
@@ -34,6 +149,9 @@ type ISCSIConnectionState string
 // ISCSITransportName holds iscsi transport name
 type ISCSITransportName string
 
+// ISCSISessionSource tells who manages an iscsi session
+type ISCSISessionSource string
+
 // ISCSI session and connection states
 const (
 	ISCSISessionStateLOGGEDIN ISCSISessionState = "LOGGED_IN"
@@ -50,22 +168,77 @@ const (
 
 	ISCSITransportNameTCP  ISCSITransportName = "tcp"
 	ISCSITransportNameISER ISCSITransportName = "iser"
+
+	// ISCSISessionSourceSoftware sessions are created by iscsid from the node records
+	ISCSISessionSourceSoftware ISCSISessionSource = "software"
+	// ISCSISessionSourceFlash sessions are created by an offload adapter, e.g. qla4xxx, from its flash
+	ISCSISessionSourceFlash ISCSISessionSource = "flash"
 )
 
 // ISCSISession defines an iSCSI session info
 type ISCSISession struct {
 	Target               string
 	Portal               string
+	GroupTag             string
 	SID                  string
+	IfaceName            string
 	IfaceTransport       ISCSITransportName
 	IfaceInitiatorname   string
 	IfaceIPaddress       string
+	IfaceNetdev          string
 	ISCSISessionState    ISCSISessionState
 	ISCSIConnectionState ISCSIConnectionState
 	Username             string
 	Password             string
 	UsernameIn           string
 	PasswordIn           string
+	// SessionSource tells if the session is managed by iscsid or by the flash of an offload adapter;
+	// empty if unknown
+	SessionSource ISCSISessionSource
+	// OriginalPortal is the portal of the node record the session logged in at, the persistent portal of iscsiadm;
+	// empty if unknown
+	OriginalPortal string
+	// EffectivePortal is the portal the connection of the session is established to, the current portal of iscsiadm,
+	// which differs from OriginalPortal when the target redirected the login; empty if unknown
+	EffectivePortal string
+	// BootCritical is true for a session to a boot target of the iBFT, which likely backs the root file system
+	BootCritical bool
+}
+
+// ParsedGroupTag returns the group tag of the session parsed by ParseGroupTag
+func (s ISCSISession) ParsedGroupTag() (GroupTag, error) {
+	return ParseGroupTag(s.GroupTag)
+}
+
+// Redirected reports whether the target redirected the login of the session to another portal
+func (s ISCSISession) Redirected() bool {
+	return s.OriginalPortal != "" && s.EffectivePortal != "" && !portalMatches(s.EffectivePortal, s.OriginalPortal)
+}
+
+// matchesPortal reports whether the session is to portal, at the portal it logged in at or at the one it was
+// redirected to, so that a redirected session is still found by the portal of its node record
+func (s ISCSISession) matchesPortal(portal string) bool {
+	return portalMatches(s.Portal, portal) || (s.OriginalPortal != "" && portalMatches(s.OriginalPortal, portal))
+}
+
+// IsDiscovery tells whether the session is a SendTargets discovery session, which has no target name
+func (s ISCSISession) IsDiscovery() bool {
+	return s.Target == ""
+}
+
+// IfaceSessionCount holds the number of sessions using an iSCSI iface
+type IfaceSessionCount struct {
+	Iface     string
+	Netdev    string
+	IPaddress string
+	Sessions  int
+}
+
+// IfaceRebalanceMove recommends moving sessions from an iSCSI iface to another
+type IfaceRebalanceMove struct {
+	From     string
+	To       string
+	Sessions int
 }
 
 // ISCSINode defines an iSCSI node info
@@ -75,6 +248,161 @@ type ISCSINode struct {
 	Fields map[string]string
 }
 
+// HCTL defines the SCSI address of a device as Host:Channel:Target:LUN
+type HCTL struct {
+	Host    int
+	Channel int
+	Target  int
+	LUN     int
+}
+
+// String returns the address in the H:C:T:L format
+func (h HCTL) String() string {
+	return fmt.Sprintf("%d:%d:%d:%d", h.Host, h.Channel, h.Target, h.LUN)
+}
+
+// ResizedDevice holds a block device whose capacity changed, with its sizes in bytes
+type ResizedDevice struct {
+	Device  string
+	OldSize int64
+	NewSize int64
+}
+
+// RawOutput holds the output of the iscsiadm command run by an operation, as reported by the host
+type RawOutput struct {
+	// Command is the command run, with its arguments
+	Command []string
+	// Stdout is the standard output of the command
+	Stdout string
+	// Stderr is the standard error of the command, only captured when it failed
+	Stderr string
+	// ExitCode is the exit code of the command, -1 if it did not run
+	ExitCode int
+}
+
+// DevicePaths holds the block devices of a LUN and their stable paths
+type DevicePaths struct {
+	// Devices lists the SCSI block devices of the LUN, one per session, e.g. sdb
+	Devices []string
+	// ByPath lists the /dev/disk/by-path links of the devices
+	ByPath []string
+	// ByID lists the /dev/disk/by-id links of the devices, e.g. wwn-0x...
+	ByID []string
+	// Multipath is the dm-multipath device built on the devices, e.g. dm-0; empty if none
+	Multipath string
+	// MultipathLinks lists the /dev/disk/by-id and /dev/mapper links of the multipath device
+	MultipathLinks []string
+	// DMUUID is the /dev/disk/by-id/dm-uuid-mpath- link of the multipath device
+	DMUUID string
+}
+
+// PingResult holds the result of the probes of a target by Ping
+type PingResult struct {
+	Target ISCSITarget
+	// RTTs holds the round trip time of each probe answered
+	RTTs []time.Duration
+	// Lost is the number of probes not answered within the timeout
+	Lost int
+	// SID and SessionState describe the session to the target, if any
+	SID          string
+	SessionState ISCSISessionState
+	// NopOuts and NopIns are the NOP-Out PDUs sent and the NOP-In PDUs received over the session
+	// while probing, as counted by the kernel; zero when there is no session or no statistics
+	NopOuts uint64
+	NopIns  uint64
+}
+
+// NodeOpResult holds the result of an operation on a single iSCSI node
+type NodeOpResult struct {
+	Target ISCSITarget
+	Error  error
+}
+
+// NodeOpResults holds the results of a bulk operation on iSCSI nodes
+type NodeOpResults []NodeOpResult
+
+// SucceededCount returns the number of operations which succeeded
+func (r NodeOpResults) SucceededCount() int {
+	return len(r) - r.FailedCount()
+}
+
+// FailedCount returns the number of operations which failed
+func (r NodeOpResults) FailedCount() int {
+	count := 0
+	for _, res := range r {
+		if res.Error != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// Errors returns the errors of all failed operations joined together, or nil if none failed
+func (r NodeOpResults) Errors() error {
+	var errs []error
+	for _, res := range r {
+		if res.Error != nil {
+			errs = append(errs, fmt.Errorf("%s at %s: %w", res.Target.Target, res.Target.Portal, res.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FirstError returns the error of the first failed operation, or nil if none failed
+func (r NodeOpResults) FirstError() error {
+	for _, res := range r {
+		if res.Error != nil {
+			return res.Error
+		}
+	}
+	return nil
+}
+
+// DiscoveryResult holds the result of a discovery through a single address
+type DiscoveryResult struct {
+	Address string
+	Targets []ISCSITarget
+	Error   error
+}
+
+// DiscoveryResults holds the results of a discovery through several addresses
+type DiscoveryResults []DiscoveryResult
+
+// Targets returns the targets discovered through any address, without duplicates
+func (r DiscoveryResults) Targets() []ISCSITarget {
+	var targets []ISCSITarget
+	for _, res := range r {
+		for _, t := range res.Targets {
+			if !slices.Contains(targets, t) {
+				targets = append(targets, t)
+			}
+		}
+	}
+	return targets
+}
+
+// FailedCount returns the number of addresses the discovery failed through
+func (r DiscoveryResults) FailedCount() int {
+	count := 0
+	for _, res := range r {
+		if res.Error != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// Errors returns the errors of the failed discoveries joined together, or nil if none failed
+func (r DiscoveryResults) Errors() error {
+	var errs []error
+	for _, res := range r {
+		if res.Error != nil {
+			errs = append(errs, fmt.Errorf("discovery through %s: %w", res.Address, res.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 type iSCSISessionParser interface {
 	Parse([]byte) []ISCSISession
 }
@@ -19,7 +19,7 @@
 package goiscsi
 
 import (
-	"fmt"
+	"net"
 	"strings"
 )
 
@@ -35,15 +35,44 @@ func (sp *sessionParser) Parse(data []byte) []ISCSISession {
 		line = strings.TrimSpace(line)
 		switch {
 		case strings.HasPrefix(line, "Target:"):
-			session := ISCSISession{}
-			session.Target = strings.Fields(line)[1]
 			if curSession != nil {
-				result = append(result, *curSession)
+				result = appendParsedSession(result, *curSession)
+			}
+			curSession = nil
+			if fields := strings.Fields(line); len(fields) > 1 {
+				curSession = &ISCSISession{Target: replaceEmpty(fields[1])}
+				// the target name is followed by (flash) or (non-flash)
+				if len(fields) > 2 {
+					switch fields[2] {
+					case "(flash)":
+						curSession.SessionSource = ISCSISessionSourceFlash
+					case "(non-flash)":
+						curSession.SessionSource = ISCSISessionSourceSoftware
+					}
+				}
 			}
-			curSession = &session
 		case curSession == nil:
 		case strings.HasPrefix(line, "Current Portal:"):
-			curSession.Portal = strings.Split(sessionFieldValue(line), ",")[0]
+			portal := strings.Split(sessionFieldValue(line), ",")
+			curSession.Portal = portal[0]
+			curSession.EffectivePortal = portal[0]
+			if len(portal) > 1 {
+				curSession.GroupTag = portal[1]
+			}
+		case strings.HasPrefix(line, "Persistent Portal:"):
+			// offload sessions may have no current portal, only the persistent one
+			portal := strings.Split(sessionFieldValue(line), ",")
+			curSession.OriginalPortal = portal[0]
+			if curSession.Portal == "" {
+				curSession.Portal = portal[0]
+			}
+			if curSession.GroupTag == "" && len(portal) > 1 {
+				curSession.GroupTag = portal[1]
+			}
+		case strings.HasPrefix(line, "Iface Name:"):
+			curSession.IfaceName = sessionFieldValue(line)
+		case strings.HasPrefix(line, "Iface Netdev:"):
+			curSession.IfaceNetdev = sessionFieldValue(line)
 		case strings.HasPrefix(line, "Iface Transport:"):
 			curSession.IfaceTransport = ISCSITransportName(sessionFieldValue(line))
 		case strings.HasPrefix(line, "Iface Initiatorname:"):
@@ -67,11 +96,20 @@ func (sp *sessionParser) Parse(data []byte) []ISCSISession {
 		}
 	}
 	if curSession != nil {
-		result = append(result, *curSession)
+		result = appendParsedSession(result, *curSession)
 	}
 	return result
 }
 
+// appendParsedSession appends a parsed session to sessions, unless its SID is missing: iscsiadm always
+// prints it, so a session without one comes from an output the parser does not understand, e.g. localized
+func appendParsedSession(sessions []ISCSISession, session ISCSISession) []ISCSISession {
+	if session.SID == "" {
+		return sessions
+	}
+	return append(sessions, session)
+}
+
 func sessionFieldValue(s string) string {
 	_, value := fieldKeyValue(s, ":")
 	return value
@@ -93,6 +131,14 @@ func fieldKeyValue(s string, sep string) (string, string) {
 	return key, value
 }
 
+// unquote removes the double or single quotes around s, if any
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
 func replaceEmpty(s string) string {
 	if s == "<empty>" {
 		return ""
@@ -132,7 +178,7 @@ func (np *nodeParser) Parse(data []byte) []ISCSINode {
 		case strings.HasPrefix(line, "node.conn[0].port ="):
 			key, value := nodeFieldKeyValue(line)
 			if curNode.Portal != "" {
-				curNode.Portal = fmt.Sprintf("%s:%s", curNode.Portal, value)
+				curNode.Portal = net.JoinHostPort(curNode.Portal, value)
 			}
 			curNode.Fields[key] = value
 		default:
@@ -0,0 +1,111 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package goiscsi
+
+import (
+	"runtime/debug"
+	"slices"
+)
+
+// modulePath is the path of the goiscsi module in the build information of a binary
+const modulePath = "github.com/dell/goiscsi"
+
+// version and commit may be set when building a binary, e.g. with
+// -ldflags "-X github.com/dell/goiscsi.version=v1.12.0 -X github.com/dell/goiscsi.commit=0123abc",
+// and take precedence over the build information of the binary.
+var (
+	version string
+	commit  string
+)
+
+// capabilities lists the optional subsystems of the library, reported by Capabilities
+var capabilities = []string{
+	"chap-config",
+	"command-middleware",
+	"diagnostics",
+	"discovery-rollback",
+	"error-context",
+	"ibft",
+	"node-db",
+	"node-presets",
+	"node-snapshots",
+	"operation-journal",
+	"process-reaper",
+	"retry-policy",
+	"sysfs-sessions",
+	"tracing",
+}
+
+// BuildInfo describes the goiscsi library built into a binary, to be logged at startup
+type BuildInfo struct {
+	// Version is the module version of the library, e.g. v1.12.0, or "(devel)" if unknown
+	Version string `json:"version"`
+	// Commit is the commit the library was built from, empty if unknown
+	Commit string `json:"commit,omitempty"`
+	// Capabilities lists the optional subsystems of the library, sorted
+	Capabilities []string `json:"capabilities"`
+}
+
+// Version returns the module version of the library, e.g. v1.12.0, or "(devel)" if unknown
+func Version() string {
+	return GetBuildInfo().Version
+}
+
+// Capabilities returns the optional subsystems of the library, sorted, e.g. "ibft" or "node-db"
+func Capabilities() []string {
+	return slices.Clone(capabilities)
+}
+
+// GetBuildInfo returns the version, commit and capabilities of the library built into the running binary
+func GetBuildInfo() BuildInfo {
+	info := BuildInfo{Version: version, Commit: commit, Capabilities: Capabilities()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		fillBuildInfo(&info, bi)
+	}
+	if info.Version == "" {
+		info.Version = "(devel)"
+	}
+	return info
+}
+
+// fillBuildInfo completes info with the module version of the library in bi, and with the commit of the binary
+// if the library is its main module
+func fillBuildInfo(info *BuildInfo, bi *debug.BuildInfo) {
+	isMain := bi.Main.Path == modulePath
+	if info.Version == "" {
+		if isMain {
+			info.Version = bi.Main.Version
+		}
+		for _, dep := range bi.Deps {
+			if dep.Path == modulePath {
+				info.Version = dep.Version
+				if dep.Replace != nil && dep.Replace.Version != "" {
+					info.Version = dep.Replace.Version
+				}
+			}
+		}
+	}
+	if info.Commit == "" && isMain {
+		for _, s := range bi.Settings {
+			if s.Key == "vcs.revision" {
+				info.Commit = s.Value
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package tracing implements the goiscsi.Tracer interface with OpenTelemetry, so the operations of a
+// goiscsi client show up in the traces of the caller.
+//
+//	iscsi := goiscsi.NewLinuxISCSI(map[string]string{})
+//	iscsi.SetTracer(tracing.New(otel.Tracer("goiscsi")))
+package tracing
+
+import (
+	"context"
+
+	"github.com/dell/goiscsi"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer creates the spans of the operations of a goiscsi client with an OpenTelemetry tracer
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New returns a goiscsi.Tracer creating spans with tracer
+func New(tracer trace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+// Start starts the span of an operation, as a child of the span of ctx if any
+func (t *Tracer) Start(ctx context.Context, operation string, attributes map[string]string) goiscsi.Span {
+	attrs := make([]attribute.KeyValue, 0, len(attributes))
+	for k, v := range attributes {
+		if v != "" {
+			attrs = append(attrs, attribute.String(k, v))
+		}
+	}
+	_, s := t.tracer.Start(ctx, operation, trace.WithAttributes(attrs...))
+	return &span{span: s}
+}
+
+type span struct {
+	span trace.Span
+}
+
+func (s *span) SetAttribute(key, value string) {
+	s.span.SetAttributes(attribute.String(key, value))
+}
+
+func (s *span) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
@@ -0,0 +1,68 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dell/goiscsi"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	var tracer goiscsi.Tracer = New(provider.Tracer("goiscsi"))
+
+	ctx, parent := provider.Tracer("driver").Start(context.Background(), "NodeStage")
+	span := tracer.Start(ctx, goiscsi.SpanLogin, map[string]string{
+		goiscsi.AttributeTarget: "iqn.2015-10.com.dell:target", goiscsi.AttributeIface: "",
+	})
+	span.SetAttribute(goiscsi.AttributeExitCode, "24")
+	span.End(errors.New("login failed"))
+	tracer.Start(ctx, goiscsi.SpanRescan, nil).End(nil)
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans but got %d", len(spans))
+	}
+	login := spans[0]
+	if login.Name() != goiscsi.SpanLogin || login.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("Expected a %s span child of NodeStage but got %s", goiscsi.SpanLogin, login.Name())
+	}
+	expected := []attribute.KeyValue{
+		attribute.String(goiscsi.AttributeTarget, "iqn.2015-10.com.dell:target"),
+		attribute.String(goiscsi.AttributeExitCode, "24"),
+	}
+	if attrs := login.Attributes(); len(attrs) != len(expected) || attrs[0] != expected[0] || attrs[1] != expected[1] {
+		t.Errorf("Expected attributes %v but got %v", expected, attrs)
+	}
+	if login.Status().Code != codes.Error || login.Status().Description != "login failed" {
+		t.Errorf("Expected an error status but got %v", login.Status())
+	}
+	if spans[1].Status().Code == codes.Error {
+		t.Errorf("Expected no error status but got %v", spans[1].Status())
+	}
+}
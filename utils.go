@@ -19,29 +19,22 @@
 package goiscsi
 
 import (
-	"errors"
+	"fmt"
 	"net"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
 )
 
+// validateIPAddress checks that ip is an IP address, or a portal made of an IP address and a port
+// of 1 to 65535, e.g. 10.0.0.1, 10.0.0.1:3263 or [fd00::1]:3263
 func validateIPAddress(ip string) error {
-	isValidIP := true
-	isValidPortal := true
-
-	// validtes only IP
-	if net.ParseIP(ip) == nil {
-		isValidIP = false
-	}
-
-	// Regex to validate IPV4 with port - for portal validation Ex: 10.0.0.0:1111
-	const exp = `^(([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])\.){3}([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5]):[0-9]+$`
-	r := regexp.MustCompile(exp)
-	if !r.MatchString(ip) {
-		isValidPortal = false
-	}
-	// Either valid IP/portal address should be given
-	if !isValidIP && !isValidPortal {
-		return errors.New("error invalid IP or portal address")
+	host, _, err := SplitPortal(ip)
+	if err != nil || net.ParseIP(strings.Trim(host, "[]")) == nil {
+		return goiscsierrors.New(goiscsierrors.Validation, "error invalid IP or portal address")
 	}
 	return nil
 }
@@ -50,7 +43,191 @@ func validateIQN(iqn string) error {
 	const exp = `iqn\.\d{4}-\d{2}\.([[:alnum:]-.]+)(:[^,;*&$|\s]+)$`
 	r := regexp.MustCompile(exp)
 	if !r.MatchString(iqn) {
-		return errors.New("error invalid IQN")
+		return goiscsierrors.New(goiscsierrors.Validation, "error invalid IQN")
+	}
+	return nil
+}
+
+// validateArgument checks that a value passed to iscsiadm is not empty and can not be taken for an option
+func validateArgument(v string) error {
+	if v == "" || strings.HasPrefix(v, "-") {
+		return goiscsierrors.New(goiscsierrors.Validation, fmt.Sprintf("error invalid argument %q", v))
+	}
+	return nil
+}
+
+// portalArgument returns the portal of a target as passed to iscsiadm, followed by its group tag if set,
+// e.g. 1.1.1.1:3260,1, so that the command applies to the node record of the portal with this tag only
+func portalArgument(target ISCSITarget) string {
+	if target.GroupTag == "" {
+		return target.Portal
+	}
+	return target.Portal + "," + target.GroupTag
+}
+
+// SplitPortal splits a portal of the form host, host:port, IPv6 or [IPv6]:port into its host and port.
+// The port is 0 if the portal does not have one.
+func SplitPortal(portal string) (string, int, error) {
+	if ip := net.ParseIP(strings.Trim(portal, "[]")); ip != nil {
+		return ip.String(), 0, nil
+	}
+	if !strings.Contains(portal, ":") {
+		return portal, 0, nil
+	}
+	host, p, err := net.SplitHostPort(portal)
+	if err != nil {
+		return "", 0, goiscsierrors.Wrap(goiscsierrors.Validation, err)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, goiscsierrors.Wrap(goiscsierrors.Validation, fmt.Errorf("invalid port in portal %s", portal))
+	}
+	return host, port, nil
+}
+
+// JoinPortal returns the portal of a host and port, bracketing IPv6 addresses
+func JoinPortal(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// portalWithPort returns portal with an explicit port, DefaultPort if it has none
+func portalWithPort(portal string) string {
+	host, port, err := SplitPortal(portal)
+	if err != nil {
+		return portal
+	}
+	if port == 0 {
+		port = DefaultPort
+	}
+	return JoinPortal(host, port)
+}
+
+// validateHostname checks that a host is an IP address or a DNS name
+func validateHostname(host string) error {
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	const exp = `^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.?$`
+	if len(host) > 253 || !regexp.MustCompile(exp).MatchString(host) {
+		return goiscsierrors.New(goiscsierrors.Validation, "error invalid host name")
+	}
+	return nil
+}
+
+// discoveryPortal returns the portal to discover targets from, with an explicit port
+func discoveryPortal(address string, opts DiscoveryOptions) (string, error) {
+	host, port, err := SplitPortal(address)
+	if err != nil {
+		return "", err
+	}
+	if err = validateHostname(host); err != nil {
+		return "", err
+	}
+	if opts.Port != 0 {
+		port = opts.Port
+	}
+	if port == 0 {
+		port = DefaultPort
+		if opts.Type == DiscoveryISNS {
+			port = DefaultISNSPort
+		}
+	}
+	if port < 1 || port > 65535 {
+		return "", goiscsierrors.New(goiscsierrors.Validation, fmt.Sprintf("invalid port %d", port))
+	}
+	switch opts.Type {
+	case "", DiscoverySendTargets, DiscoveryISNS:
+	default:
+		return "", goiscsierrors.New(goiscsierrors.Validation, fmt.Sprintf("invalid discovery type %s", opts.Type))
+	}
+	return JoinPortal(host, port), nil
+}
+
+// blockDeviceName returns the kernel name of a block device given as sdb or /dev/sdb
+func blockDeviceName(device string) (string, error) {
+	name := strings.TrimPrefix(device, "/dev/")
+	if name == "" || strings.ContainsAny(name, "/.") {
+		return "", goiscsierrors.New(goiscsierrors.Validation, "error invalid block device name")
+	}
+	return name, nil
+}
+
+// pingAddress checks the arguments of Ping and returns the address to probe
+func pingAddress(target ISCSITarget, count int, timeout time.Duration) (string, error) {
+	if count < 1 {
+		return "", goiscsierrors.New(goiscsierrors.Validation, "error ping count must be at least 1")
+	}
+	if timeout <= 0 {
+		return "", goiscsierrors.New(goiscsierrors.Validation, "error ping timeout must be positive")
+	}
+	host, port, err := SplitPortal(target.Portal)
+	if err != nil {
+		return "", err
+	}
+	if host == "" {
+		return "", goiscsierrors.New(goiscsierrors.Validation, "error missing portal")
+	}
+	if port == 0 {
+		port = DefaultPort
+	}
+	return JoinPortal(host, port), nil
+}
+
+// validateSID checks the SID of an iSCSI session
+func validateSID(sid string) error {
+	if _, err := strconv.ParseUint(sid, 10, 32); err != nil {
+		return goiscsierrors.New(goiscsierrors.Validation, "error invalid session SID")
+	}
+	return nil
+}
+
+// validateIfaceName checks the name of an iSCSI iface
+func validateIfaceName(iface string) error {
+	const exp = `^[a-zA-Z0-9_.:-]+$`
+	if !regexp.MustCompile(exp).MatchString(iface) {
+		return goiscsierrors.New(goiscsierrors.Validation, "error invalid iface name")
+	}
+	return nil
+}
+
+// validateOptionalIface checks the name of an iSCSI iface, if any
+func validateOptionalIface(iface string) error {
+	if iface == "" {
+		return nil
+	}
+	return validateIfaceName(iface)
+}
+
+// validateIfaceParameters checks the names and values of iface parameters
+func validateIfaceParameters(params map[string]string) error {
+	intRange := func(v string, min, max int) bool {
+		n, err := strconv.Atoi(v)
+		return err == nil && n >= min && n <= max
+	}
+	for k, v := range params {
+		valid := true
+		switch k {
+		case "iface.mtu":
+			valid = intRange(v, 0, 65535)
+		case "iface.vlan_id":
+			valid = intRange(v, 0, 4095)
+		case "iface.vlan_priority":
+			valid = intRange(v, 0, 7)
+		case "iface.ipaddress", "iface.gateway", "iface.subnet_mask":
+			valid = v == "" || net.ParseIP(v) != nil
+		case "iface.hwaddress":
+			_, err := net.ParseMAC(v)
+			valid = v == "" || err == nil
+		case "iface.initiatorname":
+			valid = v == "" || validateIQN(v) == nil
+		case "iface.iscsi_ifacename":
+			return goiscsierrors.New(goiscsierrors.Validation, "error iface.iscsi_ifacename can not be changed")
+		default:
+			valid = strings.HasPrefix(k, "iface.")
+		}
+		if !valid {
+			return goiscsierrors.New(goiscsierrors.Validation, fmt.Sprintf("error invalid iface parameter %s=%s", k, v))
+		}
 	}
 	return nil
 }
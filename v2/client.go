@@ -0,0 +1,249 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package goiscsi
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/dell/goiscsi"
+)
+
+// sessionStatePollInterval is how often the session state is checked while waiting for a state change
+var sessionStatePollInterval = time.Second
+
+// client implements Client on top of a v1 client
+type client struct {
+	iscsi v1.ISCSIinterface
+}
+
+// NewLinuxClient returns a Client running the Linux iSCSI utilities
+func NewLinuxClient(opts Options) (Client, error) {
+	iscsi, err := v1.NewLinuxISCSIE(opts.v1Options())
+	if err != nil {
+		return nil, newOpError("NewLinuxClient", nil, err)
+	}
+	return &client{iscsi: iscsi}, nil
+}
+
+// NewMockClient returns a mock Client failing with the errors induced by opts, or through the
+// deprecated v1 GOISCSIMock variable
+func NewMockClient(opts MockOptions) Client {
+	mock := v1.NewMockISCSI(opts.v1Options())
+	mock.Induced = opts.Induced
+	return &client{iscsi: mock}
+}
+
+func (o Options) v1Options() map[string]string {
+	opts := make(map[string]string)
+	set := func(key, value string) {
+		if value != "" {
+			opts[key] = value
+		}
+	}
+	set(v1.ChrootDirectory, o.ChrootDirectory)
+	set(v1.TargetFilterRegex, o.TargetFilterRegex)
+	set(v1.TargetFilterPrefixes, strings.Join(o.TargetFilterPrefixes, ","))
+	if o.LoginBackoff > 0 {
+		set(v1.LoginBackoff, o.LoginBackoff.String())
+	}
+	if o.CleanEnvironment {
+		set(v1.CleanEnvironment, "true")
+	}
+	set(v1.ExcludeEnvironment, strings.Join(o.ExcludeEnvironment, ","))
+	set(v1.SessionSource, o.SessionSource)
+	if o.ProtectLastPath {
+		set(v1.ProtectLastPath, "true")
+	}
+	return opts
+}
+
+func (o MockOptions) v1Options() map[string]string {
+	opts := make(map[string]string)
+	for key, value := range map[string]int{
+		v1.MockNumberOfInitiators: o.Initiators,
+		v1.MockNumberOfTargets:    o.Targets,
+		v1.MockNumberOfSessions:   o.Sessions,
+		v1.MockNumberOfNodes:      o.Nodes,
+	} {
+		if value > 0 {
+			opts[key] = strconv.Itoa(value)
+		}
+	}
+	return opts
+}
+
+func (t Target) v1Target() v1.ISCSITarget {
+	return v1.ISCSITarget{Portal: t.Portal.String(), Target: string(t.Name), GroupTag: t.GroupTag.String(), Iface: t.Iface, MaxSessions: t.MaxSessions}
+}
+
+// v1Credentials returns the v1 credentials of c, nil if c is nil
+func (c *CHAPCredentials) v1Credentials() *v1.CHAPCredentials {
+	if c == nil {
+		return nil
+	}
+	return &v1.CHAPCredentials{Username: c.Username, Password: c.Password, UsernameIn: c.UsernameIn, PasswordIn: c.PasswordIn}
+}
+
+func fromV1Target(t v1.ISCSITarget) Target {
+	portal, err := ParsePortal(t.Portal)
+	if err != nil {
+		portal = Portal{Host: t.Portal}
+	}
+	// the discovered targets have a valid group tag, others are left unset
+	tag, _ := t.ParsedGroupTag()
+	return Target{Portal: portal, Name: TargetName(t.Target), GroupTag: tag, Iface: t.Iface, MaxSessions: t.MaxSessions}
+}
+
+// call runs a v1 operation, returning early with the error of ctx if it is done first.
+// The v1 operations bound their iscsiadm commands with their own timeouts, so an operation
+// abandoned this way still ends in the background.
+func call[T any](ctx context.Context, op string, target *Target, f func() (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, newOpError(op, target, err)
+	}
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := f()
+		done <- result{value, err}
+	}()
+	select {
+	case <-ctx.Done():
+		return zero, newOpError(op, target, ctx.Err())
+	case r := <-done:
+		if r.err != nil {
+			return zero, newOpError(op, target, r.err)
+		}
+		return r.value, nil
+	}
+}
+
+// deadlineTimeout returns the time left before the deadline of ctx, so that the iscsiadm commands of an
+// operation end with it rather than run on in the background; zero without deadline
+func deadlineTimeout(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+	return 0
+}
+
+func callErr(ctx context.Context, op string, target *Target, f func() error) error {
+	_, err := call(ctx, op, target, func() (struct{}, error) {
+		return struct{}{}, f()
+	})
+	return err
+}
+
+func (c *client) DiscoverTargets(ctx context.Context, portal Portal, opts DiscoveryOptions) ([]Target, error) {
+	targets, err := call(ctx, "DiscoverTargets", nil, func() ([]v1.ISCSITarget, error) {
+		return c.iscsi.DiscoverTargetsWithOptions(portal.Host, v1.DiscoveryOptions{
+			Type: opts.Type, Port: portal.Port, Login: opts.Login, Iface: opts.Iface, Timeout: deadlineTimeout(ctx),
+			CHAP: opts.CHAP.v1Credentials(),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Target, 0, len(targets))
+	for _, t := range targets {
+		result = append(result, fromV1Target(t))
+	}
+	return result, nil
+}
+
+func (c *client) GetInitiators(ctx context.Context, filename string) ([]string, error) {
+	return call(ctx, "GetInitiators", nil, func() ([]string, error) {
+		return c.iscsi.GetInitiators(filename)
+	})
+}
+
+func (c *client) Login(ctx context.Context, target Target) error {
+	return callErr(ctx, "Login", &target, func() error {
+		return c.iscsi.PerformLoginWithOptions(target.v1Target(), v1.LoginOptions{Timeout: deadlineTimeout(ctx)})
+	})
+}
+
+func (c *client) Logout(ctx context.Context, target Target, opts LogoutOptions) error {
+	return callErr(ctx, "Logout", &target, func() error {
+		return c.iscsi.PerformLogoutWithOptions(target.v1Target(), v1.LogoutOptions{
+			Force: opts.Force, Flush: opts.Flush, FlushTimeout: deadlineTimeout(ctx),
+		})
+	})
+}
+
+func (c *client) Rescan(ctx context.Context) error {
+	return callErr(ctx, "Rescan", nil, c.iscsi.PerformRescan)
+}
+
+func (c *client) GetSessions(ctx context.Context) ([]Session, error) {
+	return call(ctx, "GetSessions", nil, c.iscsi.GetSessions)
+}
+
+func (c *client) GetNodes(ctx context.Context) ([]Node, error) {
+	return call(ctx, "GetNodes", nil, c.iscsi.GetNodes)
+}
+
+func (c *client) CreateOrUpdateNode(ctx context.Context, target Target, settings map[string]string) error {
+	return callErr(ctx, "CreateOrUpdateNode", &target, func() error {
+		return c.iscsi.CreateOrUpdateNode(target.v1Target(), settings)
+	})
+}
+
+func (c *client) DeleteNode(ctx context.Context, target Target) error {
+	return callErr(ctx, "DeleteNode", &target, func() error {
+		return c.iscsi.DeleteNode(target.v1Target())
+	})
+}
+
+func (c *client) SetCHAPCredentials(ctx context.Context, target Target, creds CHAPCredentials) error {
+	return callErr(ctx, "SetCHAPCredentials", &target, func() error {
+		if creds.UsernameIn != "" || creds.PasswordIn != "" {
+			return c.iscsi.SetCHAPCredentialsBidirectional(target.v1Target(), *creds.v1Credentials())
+		}
+		return c.iscsi.SetCHAPCredentials(target.v1Target(), creds.Username, creds.Password)
+	})
+}
+
+// WaitForSessionState polls the sessions until the session reaches the desired state or ctx is done
+func (c *client) WaitForSessionState(ctx context.Context, sid string, desired SessionState) error {
+	ticker := time.NewTicker(sessionStatePollInterval)
+	defer ticker.Stop()
+	for {
+		sessions, err := c.GetSessions(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range sessions {
+			if s.SID == sid && s.ISCSISessionState == desired {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return newOpError("WaitForSessionState", nil, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,64 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package goiscsi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+// OpError is the error returned by the operations of a Client. Its category can be
+// tested with errors.Is(err, goiscsierrors.NotFound) or goiscsierrors.CategoryOf(err).
+type OpError struct {
+	// Op is the name of the failed operation, e.g. "Login"
+	Op string
+	// Target is the target of the operation, if any
+	Target *Target
+	// Category is the category of the failure, empty if unknown
+	Category goiscsierrors.Category
+	// Err is the underlying error
+	Err error
+}
+
+func newOpError(op string, target *Target, err error) *OpError {
+	category := goiscsierrors.CategoryOf(err)
+	if errors.Is(err, context.DeadlineExceeded) {
+		category = goiscsierrors.Timeout
+	}
+	return &OpError{Op: op, Target: target, Category: category, Err: err}
+}
+
+func (e *OpError) Error() string {
+	if e.Target != nil {
+		return fmt.Sprintf("%s %s at %s: %v", e.Op, e.Target.Name, e.Target.Portal, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error belongs to a category
+func (e *OpError) Is(target error) bool {
+	return e.Category != "" && target == e.Category
+}
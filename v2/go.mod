@@ -0,0 +1,10 @@
+module github.com/dell/goiscsi/v2
+
+go 1.23.0
+
+require github.com/dell/goiscsi v1.13.1-0.20261016153924-caa0776179f6
+
+require (
+	github.com/fsnotify/fsnotify v1.9.0 // indirect
+	golang.org/x/sys v0.35.0 // indirect
+)
@@ -0,0 +1,164 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+// Package goiscsi is the second version of the goiscsi API. Every method takes a context,
+// targets are described with the Portal and TargetName types instead of strings, the
+// optional behaviors are set with option structs instead of string maps, and the errors
+// are returned as *OpError carrying the category of the failure.
+//
+// The v1 package github.com/dell/goiscsi is frozen for its existing consumers; this
+// package is built on top of it, so both share the same implementation.
+package goiscsi
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/dell/goiscsi"
+)
+
+// Client is the interface that provides the iSCSI client functionality
+type Client interface {
+	// DiscoverTargets runs an iSCSI discovery on a portal and returns the targets found
+	DiscoverTargets(ctx context.Context, portal Portal, opts DiscoveryOptions) ([]Target, error)
+
+	// GetInitiators returns the initiator names read from filename, or from the default file if empty
+	GetInitiators(ctx context.Context, filename string) ([]string, error)
+
+	// Login logs into an iSCSI target
+	Login(ctx context.Context, target Target) error
+
+	// Logout logs out of an iSCSI target
+	Logout(ctx context.Context, target Target, opts LogoutOptions) error
+
+	// Rescan rescans the targets known to the current sessions
+	Rescan(ctx context.Context) error
+
+	// GetSessions returns the iSCSI sessions
+	GetSessions(ctx context.Context) ([]Session, error)
+
+	// GetNodes returns the iSCSI node records
+	GetNodes(ctx context.Context) ([]Node, error)
+
+	// CreateOrUpdateNode creates or updates the node record of a target with the given settings
+	CreateOrUpdateNode(ctx context.Context, target Target, settings map[string]string) error
+
+	// DeleteNode deletes the node record of a target
+	DeleteNode(ctx context.Context, target Target) error
+
+	// SetCHAPCredentials sets the CHAP credentials in the node record of a target
+	SetCHAPCredentials(ctx context.Context, target Target, creds CHAPCredentials) error
+
+	// WaitForSessionState waits until the session with the given SID reaches the desired state
+	WaitForSessionState(ctx context.Context, sid string, desired SessionState) error
+}
+
+// Session holds the information of an iSCSI session
+type Session = v1.ISCSISession
+
+// Node holds the information of an iSCSI node record
+type Node = v1.ISCSINode
+
+// SessionState holds the state of an iSCSI session
+type SessionState = v1.ISCSISessionState
+
+// DiscoveryType holds the iSCSI discovery method
+type DiscoveryType = v1.DiscoveryType
+
+// GroupTag is the target portal group tag of a portal, unset if zero
+type GroupTag = v1.GroupTag
+
+// iSCSI discovery methods and session states
+const (
+	DiscoverySendTargets = v1.DiscoverySendTargets
+	DiscoveryISNS        = v1.DiscoveryISNS
+
+	SessionStateLoggedIn = v1.ISCSISessionStateLOGGEDIN
+	SessionStateFailed   = v1.ISCSISessionStateFAILED
+	SessionStateFree     = v1.ISCSISessionStateFREE
+)
+
+// Target defines an iSCSI target reachable at a portal
+type Target struct {
+	Portal   Portal
+	Name     TargetName
+	GroupTag GroupTag
+	// Iface is the iSCSI iface the target is reached through, every iface if empty
+	Iface string
+	// MaxSessions is the most sessions to the target the array accepts from the initiator; 0 if unknown
+	MaxSessions int
+}
+
+// CHAPCredentials holds the CHAP user name and secret of a target
+type CHAPCredentials struct {
+	Username string
+	Password string
+	// UsernameIn and PasswordIn authenticate the target to the initiator, for mutual CHAP
+	UsernameIn string
+	PasswordIn string
+}
+
+// Options controls the behavior of a Linux client
+type Options struct {
+	// ChrootDirectory runs the iscsiadm commands within a chrooted path, helpful for containerized services
+	ChrootDirectory string
+	// TargetFilterRegex restricts discovered targets to those whose IQN matches this regular expression
+	TargetFilterRegex string
+	// TargetFilterPrefixes restricts discovered targets to those whose IQN starts with one of these prefixes
+	TargetFilterPrefixes []string
+	// LoginBackoff enables a cool-down after failed logins to a target, starting at this duration
+	LoginBackoff time.Duration
+	// CleanEnvironment removes the dynamic linker and locale variables from the environment of iscsiadm
+	CleanEnvironment bool
+	// ExcludeEnvironment lists additional environment variables to remove from the environment of iscsiadm
+	ExcludeEnvironment []string
+	// SessionSource selects where session info is read from: "sysfs", "iscsiadm" or "auto" if empty
+	SessionSource string
+	// ProtectLastPath makes Logout fail instead of removing the last active path of a multipath device in use
+	ProtectLastPath bool
+}
+
+// MockOptions controls the data returned by a mock client
+type MockOptions struct {
+	Initiators int
+	Targets    int
+	Sessions   int
+	Nodes      int
+	// Induced selects the operations of the client which fail with an induced error
+	Induced v1.MockInducedErrors
+}
+
+// DiscoveryOptions controls DiscoverTargets
+type DiscoveryOptions struct {
+	// Type is the discovery method, DiscoverySendTargets if empty
+	Type DiscoveryType
+	// Login logs into the discovered targets
+	Login bool
+	// Iface binds the discovery and the logins to an iSCSI iface
+	Iface string
+	// CHAP authenticates a SendTargets discovery, if set
+	CHAP *CHAPCredentials
+}
+
+// LogoutOptions controls Logout
+type LogoutOptions struct {
+	// Force logs out even if it removes the last active path of a multipath device in use
+	Force bool
+	// Flush writes the cached data of the block devices of the target and flushes their buffer cache before the
+	// logout, bounded by the deadline of the context
+	Flush bool
+}
@@ -0,0 +1,167 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package goiscsi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	v1 "github.com/dell/goiscsi"
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+func TestParsePortal(t *testing.T) {
+	testdata := []struct {
+		in     string
+		portal Portal
+		str    string
+	}{
+		{"10.0.0.1", Portal{Host: "10.0.0.1"}, "10.0.0.1"},
+		{"10.0.0.1:3261", Portal{Host: "10.0.0.1", Port: 3261}, "10.0.0.1:3261"},
+		{"[fe80::1]:3260", Portal{Host: "fe80::1", Port: 3260}, "[fe80::1]:3260"},
+		{"array.example.com", Portal{Host: "array.example.com"}, "array.example.com"},
+	}
+	for _, tt := range testdata {
+		p, err := ParsePortal(tt.in)
+		if err != nil || p != tt.portal || p.String() != tt.str {
+			t.Errorf("ParsePortal(%s) = %v, %v", tt.in, p, err)
+		}
+	}
+	for _, in := range []string{"", "10.0.0.1:port", "10.0.0.1:70000"} {
+		if _, err := ParsePortal(in); !errors.Is(err, goiscsierrors.Validation) {
+			t.Errorf("Expected a validation error for %q but got %v", in, err)
+		}
+	}
+}
+
+func TestTargetNameValidate(t *testing.T) {
+	if err := TargetName("iqn.1992-04.com.emc:600009700bcbb70e3287017400000000").Validate(); err != nil {
+		t.Error(err)
+	}
+	if err := TargetName("foo").Validate(); !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	opts := Options{
+		TargetFilterPrefixes: []string{"iqn.1992-04.com.emc", "iqn.2015-10.com.dell"},
+		LoginBackoff:         5 * time.Second,
+		ProtectLastPath:      true,
+	}.v1Options()
+	expected := map[string]string{
+		v1.TargetFilterPrefixes: "iqn.1992-04.com.emc,iqn.2015-10.com.dell",
+		v1.LoginBackoff:         "5s",
+		v1.ProtectLastPath:      "true",
+	}
+	if len(opts) != len(expected) {
+		t.Errorf("Expected %v but got %v", expected, opts)
+	}
+	for k, v := range expected {
+		if opts[k] != v {
+			t.Errorf("Expected %s=%s but got %s", k, v, opts[k])
+		}
+	}
+
+	_, err := NewLinuxClient(Options{SessionSource: "proc"})
+	if !errors.Is(err, goiscsierrors.Validation) {
+		t.Errorf("Expected a validation error but got %v", err)
+	}
+}
+
+func TestMockClient(t *testing.T) {
+	ctx := context.Background()
+	c := NewMockClient(MockOptions{Targets: 2, Sessions: 2})
+
+	targets, err := c.DiscoverTargets(ctx, Portal{Host: "1.1.1.1"}, DiscoveryOptions{})
+	if err != nil || len(targets) != 2 {
+		t.Fatalf("Unexpected targets %v, %v", targets, err)
+	}
+	if targets[0].Portal.Host != "1.1.1.1" || targets[0].Name.Validate() != nil {
+		t.Errorf("Unexpected target %v", targets[0])
+	}
+	if err = c.Login(ctx, targets[0]); err != nil {
+		t.Error(err)
+	}
+	sessions, err := c.GetSessions(ctx)
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("Unexpected sessions %v, %v", sessions, err)
+	}
+	if err = c.WaitForSessionState(ctx, sessions[0].SID, SessionStateLoggedIn); err != nil {
+		t.Error(err)
+	}
+	if err = c.SetCHAPCredentials(ctx, targets[0], CHAPCredentials{Username: "user", Password: "secret"}); err != nil {
+		t.Error(err)
+	}
+	if err = c.Logout(ctx, targets[0], LogoutOptions{}); err != nil {
+		t.Error(err)
+	}
+
+	v1.GOISCSIMock.InduceLoginError = true
+	defer func() { v1.GOISCSIMock.InduceLoginError = false }()
+	err = c.Login(ctx, targets[1])
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.Op != "Login" || opErr.Target.Name != targets[1].Name {
+		t.Errorf("Expected an OpError for Login but got %v", err)
+	}
+	v1.GOISCSIMock.InduceLoginError = false
+
+	failing := NewMockClient(MockOptions{Targets: 2, Induced: v1.MockInducedErrors{InduceLoginError: true}})
+	if err = failing.Login(ctx, targets[1]); !errors.As(err, &opErr) {
+		t.Errorf("Expected the error induced in the client but got %v", err)
+	}
+	if err = c.Login(ctx, targets[1]); err != nil {
+		t.Errorf("Expected the error induced in another client not to apply but got %v", err)
+	}
+}
+
+func TestContext(t *testing.T) {
+	c := NewMockClient(MockOptions{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.GetSessions(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected %v but got %v", context.Canceled, err)
+	}
+
+	defaultInterval := sessionStatePollInterval
+	defer func() { sessionStatePollInterval = defaultInterval }()
+	sessionStatePollInterval = 10 * time.Millisecond
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := c.WaitForSessionState(ctx, "42", SessionStateLoggedIn)
+	if !errors.Is(err, goiscsierrors.Timeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a timeout error but got %v", err)
+	}
+
+	// the deadline of ctx bounds the iscsiadm login
+	var timeout time.Duration
+	c.(*client).iscsi.(*v1.MockISCSI).PerformLoginWithOptionsFn = func(_ v1.ISCSITarget, opts v1.LoginOptions) error {
+		timeout = opts.Timeout
+		return nil
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err = c.Login(ctx, Target{Portal: Portal{Host: "1.1.1.1"}, Name: "iqn.2015-10.com.dell:target"}); err != nil {
+		t.Fatal(err)
+	}
+	if timeout <= 0 || timeout > time.Minute {
+		t.Errorf("Expected a login timeout within the deadline of ctx but got %s", timeout)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package goiscsi
+
+import (
+	"fmt"
+	"regexp"
+
+	v1 "github.com/dell/goiscsi"
+	goiscsierrors "github.com/dell/goiscsi/errors"
+)
+
+// DefaultPort is the default port of iSCSI portals
+const DefaultPort = v1.DefaultPort
+
+// Portal is the network address of an iSCSI portal or discovery server
+type Portal struct {
+	// Host is an IP address or a host name
+	Host string
+	// Port is the TCP port, the default port of the protocol if 0
+	Port int
+}
+
+// ParsePortal parses a portal of the form host, host:port, IPv6 or [IPv6]:port
+func ParsePortal(s string) (Portal, error) {
+	host, port, err := v1.SplitPortal(s)
+	if err != nil {
+		return Portal{}, err
+	}
+	if host == "" {
+		return Portal{}, goiscsierrors.New(goiscsierrors.Validation, "error empty portal address")
+	}
+	return Portal{Host: host, Port: port}, nil
+}
+
+// String returns the portal in the host:port form, or the host alone if the port is not set
+func (p Portal) String() string {
+	if p.Port == 0 {
+		return p.Host
+	}
+	return v1.JoinPortal(p.Host, p.Port)
+}
+
+// iqnRegexp matches the iSCSI qualified names
+var iqnRegexp = regexp.MustCompile(`^iqn\.\d{4}-\d{2}\.([[:alnum:]-.]+)(:[^,;*&$|\s]+)$`)
+
+// TargetName is the iSCSI qualified name of a target, e.g. iqn.1992-04.com.emc:600009700bcbb70e3287017400000000
+type TargetName string
+
+// Validate checks that the name is a valid IQN
+func (n TargetName) Validate() error {
+	if !iqnRegexp.MatchString(string(n)) {
+		return goiscsierrors.New(goiscsierrors.Validation, fmt.Sprintf("error invalid IQN %q", string(n)))
+	}
+	return nil
+}